@@ -17,9 +17,23 @@ type Config struct {
 	InstanceId string                `json:"instance_id" mapstructure:"instance_id"`
 	Host       string                `json:"host" mapstructure:"host"`
 	Port       string                `json:"port" mapstructure:"port"`
+	Timezone   string                `json:"timezone" mapstructure:"timezone"`
 	Redis      RedisConf             `json:"redis" mapstructure:"redis"`
 	DB         DBConf                `json:"db" mapstructure:"db"`
 	Accounting AccountingServiceConf `json:"accounting" mapstructure:"accounting"`
+	Payment    PaymentConf           `json:"payment" mapstructure:"payment"`
+	Reconcile  ReconcileConf         `json:"reconcile" mapstructure:"reconcile"`
+	Holds      HoldsConf             `json:"holds" mapstructure:"holds"`
+	Waitlist   WaitlistConf          `json:"waitlist" mapstructure:"waitlist"`
+	Auctions   AuctionsConf          `json:"auctions" mapstructure:"auctions"`
+	Templates  TemplatesConf         `json:"templates" mapstructure:"templates"`
+	Calendar   CalendarConf          `json:"calendar" mapstructure:"calendar"`
+	Events     EventsConf            `json:"events" mapstructure:"events"`
+	Tenancy    TenancyConf           `json:"tenancy" mapstructure:"tenancy"`
+	Creatives  CreativesConf         `json:"creatives" mapstructure:"creatives"`
+	Serve      ServeConf             `json:"serve" mapstructure:"serve"`
+	Tracking   TrackingConf          `json:"tracking" mapstructure:"tracking"`
+	Slots      SlotsConf             `json:"slots" mapstructure:"slots"`
 	AcLogger   AsyncommLoggerCnf     `json:"asyncomm_logger" mapstructure:"asyncomm_logger"`
 	Logger     struct {
 		Level          string `json:"level" mapstructure:"level"`
@@ -51,13 +65,97 @@ type DBConf struct {
 	Name     string `json:"name" mapstructure:"name"`
 	Username string `json:"username" mapstructure:"username"`
 	Password string `json:"password" mapstructure:"password"`
+	Tenancy  string `json:"tenancy" mapstructure:"tenancy"`
 }
 
 type AccountingServiceConf struct {
-	Scheme          string `json:"scheme" mapstructure:"scheme"`
-	Host            string `json:"host" mapstructure:"host"`
-	Port            string `json:"port" mapstructure:"port"`
-	HealthCheckPath string `json:"health_check_path" mapstructure:"health_check_path"`
+	Scheme                  string        `json:"scheme" mapstructure:"scheme"`
+	Host                    string        `json:"host" mapstructure:"host"`
+	Port                    string        `json:"port" mapstructure:"port"`
+	HealthCheckPath         string        `json:"health_check_path" mapstructure:"health_check_path"`
+	HealthCheckInterval     time.Duration `json:"health_check_interval" mapstructure:"health_check_interval"`
+	Timeout                 time.Duration `json:"timeout" mapstructure:"timeout"`
+	MaxRetries              int           `json:"max_retries" mapstructure:"max_retries"`
+	MinRetryBackoff         time.Duration `json:"min_retry_backoff" mapstructure:"min_retry_backoff"`
+	MaxRetryBackoff         time.Duration `json:"max_retry_backoff" mapstructure:"max_retry_backoff"`
+	BreakerFailureThreshold int           `json:"breaker_failure_threshold" mapstructure:"breaker_failure_threshold"`
+	BreakerResetTimeout     time.Duration `json:"breaker_reset_timeout" mapstructure:"breaker_reset_timeout"`
+	SigningSecret           string        `json:"signing_secret" mapstructure:"signing_secret"`
+	TLSCertPath             string        `json:"tls_cert_path" mapstructure:"tls_cert_path"`
+	TLSKeyPath              string        `json:"tls_key_path" mapstructure:"tls_key_path"`
+	TLSCAPath               string        `json:"tls_ca_path" mapstructure:"tls_ca_path"`
+}
+
+type PaymentConf struct {
+	DefaultProvider string `json:"default_provider" mapstructure:"default_provider"`
+}
+
+type ReconcileConf struct {
+	Enabled      bool          `json:"enabled" mapstructure:"enabled"`
+	Interval     time.Duration `json:"interval" mapstructure:"interval"`
+	LookbackDays int           `json:"lookback_days" mapstructure:"lookback_days"`
+	AutoRepair   bool          `json:"auto_repair" mapstructure:"auto_repair"`
+}
+
+type HoldsConf struct {
+	TTL            time.Duration `json:"ttl" mapstructure:"ttl"`
+	ExpiryInterval time.Duration `json:"expiry_interval" mapstructure:"expiry_interval"`
+}
+
+type WaitlistConf struct {
+	OfferTTL time.Duration `json:"offer_ttl" mapstructure:"offer_ttl"`
+	Interval time.Duration `json:"interval" mapstructure:"interval"`
+}
+
+type AuctionsConf struct {
+	Pricing       string        `json:"pricing" mapstructure:"pricing"`
+	CloseInterval time.Duration `json:"close_interval" mapstructure:"close_interval"`
+}
+
+type TemplatesConf struct {
+	DaysAhead int           `json:"days_ahead" mapstructure:"days_ahead"`
+	Interval  time.Duration `json:"interval" mapstructure:"interval"`
+}
+
+type CalendarConf struct {
+	Operators []string `json:"operators" mapstructure:"operators"`
+}
+
+type EventsConf struct {
+	WebhookURL string        `json:"webhook_url" mapstructure:"webhook_url"`
+	Timeout    time.Duration `json:"timeout" mapstructure:"timeout"`
+}
+
+type TenancyConf struct {
+	AuthSecret string   `json:"auth_secret" mapstructure:"auth_secret"`
+	Tenants    []string `json:"tenants" mapstructure:"tenants"`
+}
+
+type CreativesConf struct {
+	Store   string `json:"store" mapstructure:"store"`
+	Dir     string `json:"dir" mapstructure:"dir"`
+	MaxSize int64  `json:"max_size" mapstructure:"max_size"`
+	// ReviewCutoff is how long before their start booked slots need an approved creative
+	ReviewCutoff    time.Duration `json:"review_cutoff" mapstructure:"review_cutoff"`
+	HouseAdFallback bool          `json:"house_ad_fallback" mapstructure:"house_ad_fallback"`
+}
+
+type ServeConf struct {
+	CacheTTL time.Duration `json:"cache_ttl" mapstructure:"cache_ttl"`
+}
+
+type TrackingConf struct {
+	// Secret signs the tracking urls, tenancy.auth_secret when it's empty
+	Secret        string        `json:"secret" mapstructure:"secret"`
+	FlushInterval time.Duration `json:"flush_interval" mapstructure:"flush_interval"`
+	// URLTTL is how long the served tracking urls are counted
+	URLTTL time.Duration `json:"url_ttl" mapstructure:"url_ttl"`
+}
+
+type SlotsConf struct {
+	// Retention is how long deleted slots are kept before they are purged
+	Retention     time.Duration `json:"retention" mapstructure:"retention"`
+	PurgeInterval time.Duration `json:"purge_interval" mapstructure:"purge_interval"`
 }
 
 type AsyncommLoggerCnf struct {
@@ -95,10 +193,42 @@ func InitializeConfig() *Config {
 	// Set undefined variables
 	viper.SetDefault("host", "localhost")
 	viper.SetDefault("port", "10001")
+	viper.SetDefault("timezone", "UTC")
+	viper.SetDefault("db.tenancy", "column")
 	viper.SetDefault("redis.host", "localhost")
 	viper.SetDefault("redis.port", "6379")
 	viper.SetDefault("accounting.host", "http://localhost")
 	viper.SetDefault("accounting.port", "10002")
+	viper.SetDefault("accounting.health_check_interval", "30s")
+	viper.SetDefault("accounting.timeout", "30s")
+	viper.SetDefault("accounting.max_retries", 3)
+	viper.SetDefault("accounting.min_retry_backoff", "200ms")
+	viper.SetDefault("accounting.max_retry_backoff", "5s")
+	viper.SetDefault("accounting.breaker_failure_threshold", 5)
+	viper.SetDefault("accounting.breaker_reset_timeout", "30s")
+	viper.SetDefault("payment.default_provider", "accounting")
+	viper.SetDefault("reconcile.interval", "24h")
+	viper.SetDefault("reconcile.lookback_days", 7)
+	viper.SetDefault("holds.ttl", "15m")
+	viper.SetDefault("holds.expiry_interval", "1m")
+	viper.SetDefault("waitlist.offer_ttl", "30m")
+	viper.SetDefault("waitlist.interval", "1m")
+	viper.SetDefault("auctions.pricing", "second")
+	viper.SetDefault("auctions.close_interval", "1m")
+	viper.SetDefault("templates.days_ahead", 30)
+	viper.SetDefault("templates.interval", "1h")
+	viper.SetDefault("events.timeout", "10s")
+	viper.SetDefault("creatives.store", "local")
+	viper.SetDefault("creatives.dir", "./creatives")
+	viper.SetDefault("creatives.max_size", 5242880)
+	viper.SetDefault("creatives.review_cutoff", "24h")
+	viper.SetDefault("creatives.house_ad_fallback", false)
+	viper.SetDefault("serve.cache_ttl", "1m")
+	viper.SetDefault("tracking.secret", "")
+	viper.SetDefault("tracking.flush_interval", "10s")
+	viper.SetDefault("tracking.url_ttl", "1h")
+	viper.SetDefault("slots.retention", "720h")
+	viper.SetDefault("slots.purge_interval", "1h")
 	viper.SetDefault("redis.username", "")
 	viper.SetDefault("redis.password", "")
 	viper.SetDefault("logger.level", "info")
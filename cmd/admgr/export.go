@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/core"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// runExport implements `admgr export`, it writes the slots of a tenant with
+// the transactions of their bookings in the date range
+func runExport(args []string, storages map[string]*mysql.Storage) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	from := flags.String("from", models.DateToString(models.Today().AddDate(0, 0, -30)), "start date of the slots to export")
+	to := flags.String("to", models.DateToString(models.Today()), "end date of the slots to export")
+	status := flags.String("status", "", "comma separated statuses of the slots to export, all when empty")
+	placement := flags.String("placement", "", "placement of the slots to export, all when empty")
+	format := flags.String("format", models.ExportFormatCSV, "output format, csv, ndjson or parquet")
+	output := flags.String("output", "", "file to write the export to, defaults to stdout")
+	tenant := flags.String("tenant", models.DefaultTenant, "tenant whose slots are exported")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	storage, ok := storages[*tenant]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown --tenant %q\n", *tenant)
+		return 2
+	}
+	opts, err := core.ExportOptions(map[string]string{"start_date": *from, "end_date": *to, "status": *status, "placement": *placement})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid options: %s\n", err)
+		return 2
+	}
+	if *format != models.ExportFormatCSV && *format != models.ExportFormatNDJSON && *format != models.ExportFormatParquet {
+		fmt.Fprintf(os.Stderr, "invalid --format %q, must be csv, ndjson or parquet\n", *format)
+		return 2
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		fd, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create %s: %s\n", *output, err)
+			return 1
+		}
+		defer fd.Close()
+		w = fd
+	}
+	rows, err := core.NewExporter(core.NewRepository(storage), logger).Export(w, *format, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export failed: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "exported %d slots\n", rows)
+	return 0
+}
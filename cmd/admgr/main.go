@@ -1,22 +1,36 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
 	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
+	// the zone database is embedded for images without one
+	_ "time/tzdata"
 
+	"github.com/kiran-anand14/admgr/internal/pkg/blob"
 	"github.com/kiran-anand14/admgr/internal/pkg/core"
+	"github.com/kiran-anand14/admgr/internal/pkg/events"
 	"github.com/kiran-anand14/admgr/internal/pkg/http/rest"
 	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/payment"
 	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
 )
 
 var cnf *Config
 
+// shutdownTimeout bounds how long the requests in flight are waited for on shutdown
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 
 	cnf = InitializeConfig()
@@ -34,13 +48,21 @@ func main() {
 			panic(fmt.Errorf("failed to load logfile : %s", err.Error()))
 		}
 	}
-	fmt.Println("Output log filepath: ", absPath)
+	fmt.Fprintln(os.Stderr, "Output log filepath: ", absPath)
 	fd, err := os.OpenFile(absPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
 		panic(fmt.Sprintf("failed to create log file %s", err.Error()))
 	}
 	defer fd.Close()
+	// commands other than the server print their output on stdout, so they only log to the file
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
 	writer := io.MultiWriter(os.Stdout, fd)
+	if command != "" {
+		writer = fd
+	}
 	InitializeLogger(cnf, writer)
 
 	logger.Infof("Initializing admgr Instance: %s", cnf.InstanceId)
@@ -49,8 +71,21 @@ func main() {
 
 	addr := fmt.Sprintf("%s:%s", cnf.Host, cnf.Port)
 
-	var service core.Service
-	var accountService accounting.AccountingService
+	location, err := time.LoadLocation(cnf.Timezone)
+	if err != nil {
+		logger.Errorf("Invalid timezone '%s': %s", cnf.Timezone, err)
+		return
+	}
+	models.SetLocation(location)
+
+	if cnf.DB.Tenancy != models.TenancyColumn && cnf.DB.Tenancy != models.TenancySchema {
+		logger.Errorf("Invalid db.tenancy '%s', must be %s or %s", cnf.DB.Tenancy, models.TenancyColumn, models.TenancySchema)
+		return
+	}
+	tenants := cnf.Tenancy.Tenants
+	if len(tenants) == 0 {
+		tenants = []string{models.DefaultTenant}
+	}
 
 	dbConf := models.DBConf(cnf.DB)
 	s, err := mysql.NewStorage(logger, writer, cnf.Logger.Level, &dbConf)
@@ -59,10 +94,166 @@ func main() {
 		return
 	}
 	acntServiceConf := models.AccountingServiceConf(cnf.Accounting)
-	accountService = accounting.NewAccountingService(logger, acntServiceConf, cnf.InstanceId)
-	service = core.NewService(s, accountService, logger)
+	accountService, err := accounting.NewAccountingService(logger, acntServiceConf, cnf.InstanceId)
+	if err != nil {
+		logger.Errorf("%s", err.Error())
+		return
+	}
+
+	storages := make(map[string]*mysql.Storage, len(tenants))
+	registries := make(map[string]*payment.Registry, len(tenants))
+	reconcilers := make(map[string]*core.Reconciler, len(tenants))
+	for _, tenant := range tenants {
+		ts, err := s.ForTenant(tenant)
+		if err != nil {
+			logger.Errorf("Failed to initialize tenant %s: %s", tenant, err)
+			return
+		}
+		registry := payment.NewRegistry(logger, ts, cnf.Payment.DefaultProvider)
+		registry.Register(payment.ProviderAccounting, accountService.ForTenant(tenant))
+		registry.Register(payment.ProviderWallet, payment.NewWalletProvider(ts))
+		registry.Register(payment.ProviderInvoice, payment.NewInvoiceProvider(ts))
+		if !registry.Has(cnf.Payment.DefaultProvider) {
+			logger.Errorf("Invalid payment.default_provider '%s', must be one of %v", cnf.Payment.DefaultProvider, registry.Names())
+			return
+		}
+		storages[tenant] = ts
+		registries[tenant] = registry
+		reconcilers[tenant] = core.NewReconciler(core.NewRepository(ts), registry, logger)
+	}
+
+	switch command {
+	case "":
+	case "reconcile":
+		os.Exit(runReconcile(os.Args[2:], reconcilers))
+	case "export":
+		os.Exit(runExport(os.Args[2:], storages))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, available commands: reconcile, export\n", command)
+		os.Exit(2)
+	}
+
+	if cnf.Auctions.Pricing != models.AuctionPricingFirst && cnf.Auctions.Pricing != models.AuctionPricingSecond {
+		logger.Errorf("Invalid auctions.pricing '%s', must be %s or %s", cnf.Auctions.Pricing, models.AuctionPricingFirst, models.AuctionPricingSecond)
+		return
+	}
+	publisher := events.NewLogPublisher(logger)
+	if cnf.Events.WebhookURL != "" {
+		publisher = events.NewWebhookPublisher(logger, cnf.Events.WebhookURL, cnf.Events.Timeout)
+	}
+	if cnf.Creatives.Store != "local" {
+		logger.Errorf("Invalid creatives.store '%s', must be local", cnf.Creatives.Store)
+		return
+	}
+	blobs, err := blob.NewFileStore(cnf.Creatives.Dir)
+	if err != nil {
+		logger.Errorf("Failed to open creatives.dir '%s': %s", cnf.Creatives.Dir, err)
+		return
+	}
+	trackingSecret := cnf.Tracking.Secret
+	if trackingSecret == "" {
+		trackingSecret = cnf.Tenancy.AuthSecret
+	}
+	if trackingSecret == "" {
+		logger.Warnf("Neither tracking.secret nor tenancy.auth_secret is set, the tracking urls can be forged")
+	}
+	services := make(map[string]core.Service, len(tenants))
+	for _, tenant := range tenants {
+		services[tenant] = core.NewService(core.NewRepository(storages[tenant]), registries[tenant], core.Config{
+			HoldTTL:              cnf.Holds.TTL,
+			WaitlistOfferTTL:     cnf.Waitlist.OfferTTL,
+			AuctionPricing:       cnf.Auctions.Pricing,
+			TemplateDaysAhead:    cnf.Templates.DaysAhead,
+			Events:               publisher,
+			Operators:            cnf.Calendar.Operators,
+			Tenant:               tenant,
+			Blobs:                blobs,
+			CreativeMaxSize:      cnf.Creatives.MaxSize,
+			CreativeReviewCutoff: cnf.Creatives.ReviewCutoff,
+			HouseAdFallback:      cnf.Creatives.HouseAdFallback,
+			ServeCacheTTL:        cnf.Serve.CacheTTL,
+			TrackingSecret:       trackingSecret,
+			TrackingURLTTL:       cnf.Tracking.URLTTL,
+			SlotRetention:        cnf.Slots.Retention,
+		}, logger)
+	}
+	core.Schedule(logger, "HoldExpiry", cnf.Holds.ExpiryInterval, forEachTenant(services, func(s core.Service) error {
+		_, err := s.ExpireHolds()
+		return err
+	}))
+	core.Schedule(logger, "Waitlist", cnf.Waitlist.Interval, forEachTenant(services, func(s core.Service) error {
+		_, err := s.ProcessWaitlist()
+		return err
+	}))
+	core.Schedule(logger, "AuctionClose", cnf.Auctions.CloseInterval, forEachTenant(services, func(s core.Service) error {
+		_, err := s.CloseAuctions()
+		return err
+	}))
+	core.Schedule(logger, "SlotGeneration", cnf.Templates.Interval, forEachTenant(services, func(s core.Service) error {
+		_, err := s.GenerateSlots()
+		return err
+	}))
+	core.Schedule(logger, "TrackingFlush", cnf.Tracking.FlushInterval, forEachTenant(services, func(s core.Service) error {
+		_, err := s.FlushTracking()
+		return err
+	}))
+	core.Schedule(logger, "SlotPurge", cnf.Slots.PurgeInterval, forEachTenant(services, func(s core.Service) error {
+		_, err := s.PurgeDeletedSlots()
+		return err
+	}))
+	if cnf.Reconcile.Enabled {
+		logger.Infof("Scheduling reconciliation every %s over the last %d days", cnf.Reconcile.Interval, cnf.Reconcile.LookbackDays)
+		for _, reconciler := range reconcilers {
+			reconciler.Start(cnf.Reconcile.Interval, cnf.Reconcile.LookbackDays, cnf.Reconcile.AutoRepair)
+		}
+	}
+
+	r, _ := rest.Handler(logger, services, cnf.Tenancy.AuthSecret, writer)
 
-	r, _ := rest.Handler(logger, service, writer)
+	if err := serve(addr, r); err != nil {
+		log.Fatal(err)
+	}
+	// the events tracked since the last flush would be lost otherwise
+	if err := forEachTenant(services, func(s core.Service) error {
+		_, err := s.FlushTracking()
+		return err
+	})(); err != nil {
+		logger.Errorf("TrackingFlush:: Failed to flush on shutdown: %s", err)
+	}
+	accountService.Close()
+}
 
-	log.Fatal(r.Run(addr))
+// serve answers the requests on addr until the process is interrupted or
+// terminated, the requests in flight are given shutdownTimeout to finish
+func serve(addr string, handler http.Handler) error {
+	srv := &http.Server{Addr: addr, Handler: handler}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-quit:
+		log.Printf("Received %s, shutting down", sig)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+// forEachTenant runs the job for the service of every tenant, a failing
+// tenant doesn't keep the job from running for the others
+func forEachTenant(services map[string]core.Service, job func(core.Service) error) func() error {
+	return func() error {
+		var errs []error
+		for tenant, s := range services {
+			if err := job(s); err != nil {
+				errs = append(errs, fmt.Errorf("tenant %s: %w", tenant, err))
+			}
+		}
+		return errors.Join(errs...)
+	}
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/core"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// runReconcile implements `admgr reconcile`, it prints the mismatches between
+// the booked slots of a tenant and the payment providers in the date range
+func runReconcile(args []string, reconcilers map[string]*core.Reconciler) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	from := flags.String("from", models.DateToString(models.Today().AddDate(0, 0, -7)), "start date of the slots to reconcile")
+	to := flags.String("to", models.DateToString(models.Today()), "end date of the slots to reconcile")
+	format := flags.String("format", "json", "output format, json or csv")
+	output := flags.String("output", "", "file to write the report to, defaults to stdout")
+	repair := flags.Bool("repair", false, "repair the mismatches which can be fixed automatically")
+	tenant := flags.String("tenant", models.DefaultTenant, "tenant whose slots are reconciled")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	reconciler, ok := reconcilers[*tenant]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown --tenant %q\n", *tenant)
+		return 2
+	}
+	startDate, err := time.ParseInLocation(time.DateOnly, *from, models.Location())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --from date %q\n", *from)
+		return 2
+	}
+	endDate, err := time.ParseInLocation(time.DateOnly, *to, models.Location())
+	if err != nil || startDate.After(endDate) {
+		fmt.Fprintf(os.Stderr, "invalid --to date %q\n", *to)
+		return 2
+	}
+	if *format != "json" && *format != "csv" {
+		fmt.Fprintf(os.Stderr, "invalid --format %q, must be json or csv\n", *format)
+		return 2
+	}
+
+	report, err := reconciler.Run(startDate, endDate, *repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "reconciliation failed: %s\n", err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		fd, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create %s: %s\n", *output, err)
+			return 1
+		}
+		defer fd.Close()
+		w = fd
+	}
+	if *format == "csv" {
+		err = writeReconciliationCSV(w, report)
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write report: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func writeReconciliationCSV(w io.Writer, report *api.ReconciliationReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"type", "placement", "date", "position", "status", "txnid", "provider", "booked_by", "debited_by", "slot_amount", "debit_amount", "repaired"})
+	for _, m := range report.Mismatches {
+		cw.Write([]string{
+			m.Type,
+			m.Placement,
+			m.Date,
+			strconv.Itoa(int(m.Position)),
+			m.Status,
+			m.Txnid,
+			m.Provider,
+			m.BookedBy,
+			m.DebitedBy,
+			strconv.FormatFloat(m.SlotAmount, 'f', 2, 64),
+			strconv.FormatFloat(m.DebitAmount, 'f', 2, 64),
+			strconv.FormatBool(m.Repaired),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
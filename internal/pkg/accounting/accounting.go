@@ -2,49 +2,157 @@ package accounting
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"github.com/kiran-anand14/admgr/internal/pkg/models"
 	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 )
 
 const ContentTypeJSON = "application/json"
 
+// ErrCircuitOpen is returned while the circuit is open, the request was not sent
+var ErrCircuitOpen = models.NewError(
+	"Accounting service unavailable, please retry later",
+	models.DependentServiceRequestFailed,
+)
+
+const (
+	defaultTimeout                 = 30 * time.Second
+	defaultHealthCheckInterval     = 30 * time.Second
+	defaultMinRetryBackoff         = 200 * time.Millisecond
+	defaultMaxRetryBackoff         = 5 * time.Second
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerResetTimeout     = 30 * time.Second
+)
+
 type AccountingService interface {
 	Debit(slots []*mysql.Slot, uid, txnid string) error
 	Status(txnids []string) ([]*AccountingStatusResponse, error)
+	State() string
+	// ForTenant returns a client which sends the tenant as the source of its
+	// requests, it shares the connections and the circuit breaker
+	ForTenant(tenant string) AccountingService
+	// Close stops the health checks of the client, it does nothing on the
+	// clients of tenants which share them
+	Close()
 }
 
 type accountingService struct {
-	url        string
-	source     string
-	log        *logrus.Logger
-	restClient *http.Client
+	url             string
+	source          string
+	log             *logrus.Logger
+	restClient      *http.Client
+	signingSecret   string
+	breaker         *CircuitBreaker
+	maxRetries      int
+	minRetryBackoff time.Duration
+	maxRetryBackoff time.Duration
+	// stop ends the health checks, it's closed once by Close
+	stop     chan struct{}
+	stopOnce *sync.Once
 }
 
-func (a accountingService) Status(txnids []string) ([]*AccountingStatusResponse, error) {
+func (a *accountingService) State() string {
+	return a.breaker.State()
+}
 
-	reqBody, _ := json.Marshal(txnids)
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/status", a.url), bytes.NewReader(reqBody))
-	if err != nil {
-		return nil, models.NewError(
-			fmt.Sprintf("RestRequestFormation failed %s", err.Error()),
-			models.DecodeFailureError,
-		)
+func (a *accountingService) Close() {
+	a.stopOnce.Do(func() { close(a.stop) })
+}
+
+func (a *accountingService) ForTenant(tenant string) AccountingService {
+	return &tenantClient{accountingService: a, source: tenant}
+}
+
+// tenantClient is the client of a tenant, it only overrides the source of
+// the shared client and leaves its health checks to the shared one
+type tenantClient struct {
+	*accountingService
+	source string
+}
+
+func (t *tenantClient) Debit(slots []*mysql.Slot, uid, txnid string) error {
+	return t.debit(t.source, slots, uid, txnid)
+}
+
+func (t *tenantClient) ForTenant(tenant string) AccountingService {
+	return t.accountingService.ForTenant(tenant)
+}
+
+func (t *tenantClient) Close() {}
+
+// do sends the request through the circuit breaker, idempotent requests are
+// retried on transport errors and 5xx responses with a jittered backoff
+func (a *accountingService) do(method, path string, body []byte, idempotent bool) (*http.Response, error) {
+	attempts := 1
+	if idempotent {
+		attempts += a.maxRetries
 	}
-	a.log.Debugf("AccountingHandler: %s %s", req.Method, req.URL.String())
-	res, err := a.restClient.Do(req)
-	if err != nil || res.StatusCode != http.StatusOK {
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(backoff(i-1, a.minRetryBackoff, a.maxRetryBackoff))
+		}
+		if !a.breaker.Allow() {
+			a.log.Warnf("AccountingHandler: circuit %s, rejecting %s %s", a.breaker.State(), method, path)
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, ErrCircuitOpen
+		}
+		req, err := http.NewRequest(method, fmt.Sprintf("%s%s", a.url, path), bytes.NewReader(body))
+		if err != nil {
+			return nil, models.NewError(
+				fmt.Sprintf("RestRequestFormation failed %s", err.Error()),
+				models.DecodeFailureError,
+			)
+		}
+		req.Header.Set("Content-Type", ContentTypeJSON)
+		if a.signingSecret != "" {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set(HeaderTimestamp, timestamp)
+			req.Header.Set(HeaderSignature, Sign(a.signingSecret, method, path, timestamp, body))
+		}
+		a.log.Debugf("AccountingHandler: %s %s [Attempt: %d]", req.Method, req.URL.String(), i+1)
+		res, err := a.restClient.Do(req)
+		if err == nil && res.StatusCode < http.StatusInternalServerError {
+			a.breaker.Success()
+			return res, nil
+		}
+		a.breaker.Failure()
 		statusCode := -1
 		if res != nil {
 			statusCode = res.StatusCode
+			res.Body.Close()
 		}
-		a.log.Errorf("DebitTransactionFailed::[StatusCode: %d, Error: %v]", statusCode, err)
+		a.log.Errorf("AccountingRequestFailed::[Path: %s, StatusCode: %d, Attempt: %d, Error: %v]", path, statusCode, i+1, err)
+		lastErr = models.NewError(
+			fmt.Sprintf("Accounting request %s failed", path),
+			models.DependentServiceRequestFailed,
+		)
+	}
+	return nil, lastErr
+}
+
+func (a *accountingService) Status(txnids []string) ([]*AccountingStatusResponse, error) {
+	reqBody, _ := json.Marshal(txnids)
+	res, err := a.do(http.MethodPost, "/status", reqBody, true)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		a.log.Errorf("StatusRequestFailed::[StatusCode: %d]", res.StatusCode)
 		return nil, models.NewError(
-			"Debit transaction failed",
+			"Transaction status request failed",
 			models.DependentServiceRequestFailed,
 		)
 	}
@@ -53,7 +161,11 @@ func (a accountingService) Status(txnids []string) ([]*AccountingStatusResponse,
 	return statusResponse, nil
 }
 
-func (a accountingService) Debit(slots []*mysql.Slot, uid, txnid string) error {
+func (a *accountingService) Debit(slots []*mysql.Slot, uid, txnid string) error {
+	return a.debit(a.source, slots, uid, txnid)
+}
+
+func (a *accountingService) debit(source string, slots []*mysql.Slot, uid, txnid string) error {
 	var metaSlots []AccountingMetadataSlot
 	var totalAmount float64
 	for _, s := range slots {
@@ -65,7 +177,7 @@ func (a accountingService) Debit(slots []*mysql.Slot, uid, txnid string) error {
 		totalAmount += *s.Cost
 	}
 	accountRequest := AccountingRequestBody{
-		Source: a.source,
+		Source: source,
 		Uid:    uid,
 		Amount: totalAmount,
 		Txnid:  txnid,
@@ -81,20 +193,14 @@ func (a accountingService) Debit(slots []*mysql.Slot, uid, txnid string) error {
 			models.DecodeFailureError,
 		)
 	}
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/debit", a.url), bytes.NewBuffer(jsonPayload))
+	// a debit is not safe to repeat, so it is attempted only once
+	res, err := a.do(http.MethodPost, "/debit", jsonPayload, false)
 	if err != nil {
-		return models.NewError(
-			fmt.Sprintf("RestRequestFormation failed %s", err.Error()),
-			models.DecodeFailureError,
-		)
+		return err
 	}
-	res, err := a.restClient.Do(req)
-	if err != nil || res.StatusCode != http.StatusOK {
-		statusCode := -1
-		if res != nil {
-			statusCode = res.StatusCode
-		}
-		a.log.Errorf("DebitTransactionFailed::[StatusCode: %d, Error: %v]", statusCode, err)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		a.log.Errorf("DebitTransactionFailed::[StatusCode: %d]", res.StatusCode)
 		return models.NewError(
 			"Debit transaction failed",
 			models.InternalProcessingError,
@@ -103,38 +209,126 @@ func (a accountingService) Debit(slots []*mysql.Slot, uid, txnid string) error {
 	return nil
 }
 
-func NewAccountingService(_log *logrus.Logger, conf models.AccountingServiceConf, source string) AccountingService {
-	accService := accountingService{
+// monitor polls the health check endpoint and feeds the result into the
+// circuit breaker, so that the client state is known before the first call.
+// An open circuit is only probed once its reset timeout has passed, as the
+// trial call of the breaker. It runs until the client is closed
+func (a *accountingService) monitor(healthCheckUrl string, interval time.Duration) {
+	client := &http.Client{Timeout: interval, Transport: a.restClient.Transport}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if a.breaker.Allow() {
+			a.healthCheck(client, healthCheckUrl)
+		}
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *accountingService) healthCheck(client *http.Client, healthCheckUrl string) {
+	res, err := client.Get(healthCheckUrl)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	if err == nil && res.StatusCode == http.StatusOK {
+		if a.breaker.State() != BreakerStateClosed {
+			a.log.Infof("AccountingServiceHealthCheck:: service is active on %s, recieved acknowledgement", healthCheckUrl)
+		}
+		a.breaker.CheckSuccess()
+		return
+	}
+	statusCode := -1
+	if res != nil {
+		statusCode = res.StatusCode
+	}
+	a.log.Errorf("AccountingServiceHealthCheck:: failed to check accounting service status [Url: %s, StatusCode: %d, Error: %v]", healthCheckUrl, statusCode, err)
+	a.breaker.CheckFailure()
+}
+
+// NewAccountingService returns the client of the accounting service, it fails
+// when the TLS configuration can't be loaded
+func NewAccountingService(_log *logrus.Logger, conf models.AccountingServiceConf, source string) (AccountingService, error) {
+	if conf.Timeout <= 0 {
+		conf.Timeout = defaultTimeout
+	}
+	if conf.HealthCheckInterval == 0 {
+		conf.HealthCheckInterval = defaultHealthCheckInterval
+	}
+	if conf.MinRetryBackoff <= 0 {
+		conf.MinRetryBackoff = defaultMinRetryBackoff
+	}
+	if conf.MaxRetryBackoff < conf.MinRetryBackoff {
+		conf.MaxRetryBackoff = defaultMaxRetryBackoff
+	}
+	if conf.BreakerFailureThreshold <= 0 {
+		conf.BreakerFailureThreshold = defaultBreakerFailureThreshold
+	}
+	if conf.BreakerResetTimeout <= 0 {
+		conf.BreakerResetTimeout = defaultBreakerResetTimeout
+	}
+	tlsConfig, err := newTLSConfig(conf)
+	if err != nil {
+		return nil, fmt.Errorf("AccountingServiceInitialization:: failed to load TLS configuration, Error: %w", err)
+	}
+	// the clone keeps the timeouts, connection limits, proxy and HTTP/2 of the default transport
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	accService := &accountingService{
 		url:    fmt.Sprintf("%s://%s:%s", conf.Scheme, conf.Host, conf.Port),
 		log:    _log,
 		source: source,
 		restClient: &http.Client{
-			Timeout: 2 * time.Minute,
+			Timeout:   conf.Timeout,
+			Transport: transport,
 		},
+		signingSecret:   conf.SigningSecret,
+		breaker:         NewCircuitBreaker(conf.BreakerFailureThreshold, conf.BreakerResetTimeout, nil),
+		maxRetries:      conf.MaxRetries,
+		minRetryBackoff: conf.MinRetryBackoff,
+		maxRetryBackoff: conf.MaxRetryBackoff,
+		stop:            make(chan struct{}),
+		stopOnce:        &sync.Once{},
 	}
-	retries := 0
-	var err *models.Error
-	for {
-		retries++
-		healthCheckUrl := fmt.Sprintf("%s/%s", accService.url, conf.HealthCheckPath)
-		res, err := http.Get(healthCheckUrl)
-		if err == nil && res.StatusCode == http.StatusOK {
-			_log.Infof("AccountingServiceInitialization:: service is active on %s, recieved acknowledgement", healthCheckUrl)
-			break
+	if conf.HealthCheckInterval < 0 {
+		_log.Warnf("AccountingServiceInitialization:: health checks are disabled")
+		return accService, nil
+	}
+	healthCheckUrl := fmt.Sprintf("%s/%s", accService.url, conf.HealthCheckPath)
+	_log.Infof("AccountingServiceInitialization:: monitoring accounting service on %s every %s", healthCheckUrl, conf.HealthCheckInterval)
+	go accService.monitor(healthCheckUrl, conf.HealthCheckInterval)
+	return accService, nil
+}
+
+// newTLSConfig loads the client certificate for mutual TLS and the CA used
+// to verify the accounting service, it returns nil when neither is configured
+func newTLSConfig(conf models.AccountingServiceConf) (*tls.Config, error) {
+	if conf.TLSCertPath == "" && conf.TLSKeyPath == "" && conf.TLSCAPath == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if conf.TLSCertPath != "" || conf.TLSKeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCertPath, conf.TLSKeyPath)
+		if err != nil {
+			return nil, err
 		}
-		if err == nil {
-			err = models.NewError(
-				fmt.Sprintf("Request failed on url %s with statusCode: %d", healthCheckUrl, res.StatusCode),
-				models.DependentServiceRequestFailed)
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if conf.TLSCAPath != "" {
+		ca, err := os.ReadFile(conf.TLSCAPath)
+		if err != nil {
+			return nil, err
 		}
-		_log.Errorf("AccountingServiceInitialization:: failed to check accounting service status, Error: %s, retrying %d", err, retries)
-		if retries > 10 {
-			break
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", conf.TLSCAPath)
 		}
-		time.Sleep(10 * time.Second)
-	}
-	if err != nil {
-		_log.Fatalf("AccountingServiceInitialization:: Retries %d done for accounting service, but couldn't established the connection, Error: %s", retries, err)
+		tlsConfig.RootCAs = pool
 	}
-	return accService
+	return tlsConfig, nil
 }
@@ -0,0 +1,142 @@
+package accounting
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerStateClosed   = "closed"
+	BreakerStateOpen     = "open"
+	BreakerStateHalfOpen = "half-open"
+)
+
+// CircuitBreaker stops calls to the accounting service after a run of
+// consecutive failures of calls or of health checks, which are counted
+// apart so that a passing health check doesn't hide failing calls. Once
+// resetTimeout has passed a single trial call is let through and its
+// outcome decides whether the circuit closes again
+type CircuitBreaker struct {
+	mu            sync.Mutex
+	state         string
+	failures      int
+	checkFailures int
+	threshold     int
+	resetTimeout  time.Duration
+	openedAt      time.Time
+	trialInFlight bool
+	// now is the clock of the breaker, time.Now unless given
+	now func() time.Time
+}
+
+// NewCircuitBreaker returns a closed breaker, now is its clock and defaults
+// to time.Now when nil
+func NewCircuitBreaker(threshold int, resetTimeout time.Duration, now func() time.Time) *CircuitBreaker {
+	if now == nil {
+		now = time.Now
+	}
+	return &CircuitBreaker{
+		state:        BreakerStateClosed,
+		threshold:    threshold,
+		resetTimeout: resetTimeout,
+		now:          now,
+	}
+}
+
+// Allow reports whether a call may be made in the current state
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerStateOpen:
+		if b.now().Sub(b.openedAt) < b.resetTimeout {
+			return false
+		}
+		b.state = BreakerStateHalfOpen
+		b.trialInFlight = true
+		return true
+	case BreakerStateHalfOpen:
+		if b.trialInFlight {
+			return false
+		}
+		b.trialInFlight = true
+		return true
+	}
+	return true
+}
+
+// Success records a successful call, the circuit only closes again from
+// half-open, the late success of a call made before it opened is ignored
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerStateHalfOpen:
+		b.state = BreakerStateClosed
+		b.trialInFlight = false
+		b.failures = 0
+		b.checkFailures = 0
+	case BreakerStateClosed:
+		b.failures = 0
+	}
+}
+
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trip(b.failures)
+}
+
+// CheckSuccess records a passing health check, it closes a half-open circuit
+// like Success but leaves the failures of calls of a closed one alone
+func (b *CircuitBreaker) CheckSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkFailures = 0
+	if b.state == BreakerStateHalfOpen {
+		b.state = BreakerStateClosed
+		b.trialInFlight = false
+		b.failures = 0
+	}
+}
+
+// CheckFailure records a failed health check
+func (b *CircuitBreaker) CheckFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checkFailures++
+	b.trip(b.checkFailures)
+}
+
+// trip opens the circuit after a failed trial call, or once failures reach
+// the threshold while closed
+func (b *CircuitBreaker) trip(failures int) {
+	if b.state == BreakerStateHalfOpen || (b.state == BreakerStateClosed && failures >= b.threshold) {
+		b.state = BreakerStateOpen
+		b.openedAt = b.now()
+	}
+	b.trialInFlight = false
+}
+
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// backoff returns the wait before the given retry attempt, it grows
+// exponentially from min and is capped at max, half of it is randomized
+// so that concurrent callers don't retry in lockstep
+func backoff(attempt int, min, max time.Duration) time.Duration {
+	d := min << attempt
+	if d > max || d <= 0 {
+		d = max
+	}
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
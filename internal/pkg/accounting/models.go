@@ -24,5 +24,19 @@ type AccountingStatusResponse struct {
 	Txnid    string             `json:"txnid,omitempty"`
 	UID      string             `json:"uid,omitempty"`
 	Created  time.Time          `json:"created,omitempty"`
+	Amount   float64            `json:"amount,omitempty"`
 	Metadata AccountingMetadata `json:"metadata,omitempty"`
 }
+
+// DebitedAmount returns the amount of the transaction, falling back to the
+// sum of the slot costs when the provider doesn't report it
+func (r *AccountingStatusResponse) DebitedAmount() float64 {
+	if r.Amount != 0 {
+		return r.Amount
+	}
+	var total float64
+	for _, s := range r.Metadata.Slots {
+		total += s.Cost
+	}
+	return total
+}
@@ -0,0 +1,44 @@
+package accounting
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderTimestamp = "X-Admgr-Timestamp"
+	HeaderSignature = "X-Admgr-Signature"
+
+	// MaxSignatureSkew is the maximum age of a signed request accepted by VerifySignature
+	MaxSignatureSkew = 5 * time.Minute
+)
+
+// Sign returns the hex encoded HMAC-SHA256 of the request method, path,
+// unix timestamp and body, each separated by a newline
+func Sign(secret, method, path, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the signature against the request and rejects
+// timestamps which are more than MaxSignatureSkew away from now
+func VerifySignature(secret, method, path, timestamp, signature string, body []byte) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > MaxSignatureSkew || skew < -MaxSignatureSkew {
+		return fmt.Errorf("timestamp %s outside of allowed skew %s", timestamp, MaxSignatureSkew)
+	}
+	expected := Sign(secret, method, path, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"encoding/json"
+	"time"
+
 	"github.com/kiran-anand14/admgr/internal/pkg/models"
 )
 
@@ -10,33 +13,497 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// Placement of the slot requests is the id of a placement, the default
+// placement is used when it's empty
 type CreateSlotRequestBody struct {
+	Placement string          `json:"placement,omitempty"`
 	StartDate models.JSONDate `json:"start_date,omitempty" binding:"required,date" validate:"json_date"`
 	EndDate   models.JSONDate `json:"end_date,omitempty" binding:"required,date,gtefield=StartDate" validate:"json_date"`
 	Position  []int32         `json:"position,omitempty" binding:"required" validate:"range"`
 	Cost      *float64        `json:"cost,omitempty" binding:"required,min=0" validate:"required"`
 }
 
+// CampaignID of a reservation charges the slot to a campaign of the
+// advertiser, it's only read when reserving
 type ReserveSlotRequestBody struct {
-	Date     models.JSONDate `json:"date,omitempty" validate:"json_date"`
-	Position *int32          `json:"position" validate:"required"`
+	Placement  string          `json:"placement,omitempty"`
+	Date       models.JSONDate `json:"date,omitempty" validate:"json_date"`
+	Position   *int32          `json:"position" validate:"required"`
+	CampaignID string          `json:"campaign_id,omitempty"`
 }
 
+// Date of the slots is a day of the business time zone named by Timezone
 type GetSlotsResponse struct {
-	Date  string          `json:"date"`
-	Slots []*SlotResponse `json:"slots,omitempty"`
+	Placement string          `json:"placement"`
+	Date      string          `json:"date"`
+	Timezone  string          `json:"timezone"`
+	Slots     []*SlotResponse `json:"slots,omitempty"`
 }
 
+// Start and End of a slot are RFC3339 times, the slots of a whole day run
+// from midnight to midnight
 type SlotResponse struct {
+	Start      string           `json:"start"`
+	End        string           `json:"end"`
 	Position   int32            `json:"position"`
 	Cost       float64          `json:"cost"`
 	Status     string           `json:"status"`
 	BookedBy   *string          `json:"booked_by,omitempty"`
 	BookedDate *models.JSONDate `json:"booked_date,omitempty"`
+	Creative   *SlotCreative    `json:"creative,omitempty"`
+	// CreativeIssue flags a booked slot whose creative is missing, pending or
+	// rejected once the review cut-off before its start has passed
+	CreativeIssue string `json:"creative_issue,omitempty"`
+	// HouseAd is served instead of the creative of a flagged slot
+	HouseAd *SlotCreative `json:"house_ad,omitempty"`
+	// Delivery counts the tracked impressions and clicks of the slot
+	Delivery *DeliveryStats `json:"delivery,omitempty"`
+}
+
+type DeliveryStats struct {
+	Impressions int64 `json:"impressions"`
+	Clicks      int64 `json:"clicks"`
+}
+
+// SlotCreative is the creative attached to a booked slot, Url serves its content
+type SlotCreative struct {
+	Id     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	Format string `json:"format,omitempty"`
+	Status string `json:"status,omitempty"`
+	Url    string `json:"url,omitempty"`
 }
 
 type DeleteSlotRequestBody struct {
+	Placement string          `json:"placement,omitempty"`
 	StartDate models.JSONDate `json:"start_date,omitempty" binding:"required,date" validate:"json_date"`
 	EndDate   models.JSONDate `json:"end_date,omitempty" binding:"required,date,gtefield=StartDate" validate:"json_date"`
 	Position  []int32         `json:"position,omitempty" binding:"required" validate:"range"`
 }
+
+type ReadinessResponse struct {
+	Ready        bool              `json:"ready"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+type PaymentProfileRequestBody struct {
+	Provider string `json:"provider"`
+}
+
+type PaymentProfileResponse struct {
+	Uid      string `json:"uid"`
+	Provider string `json:"provider"`
+}
+
+type WalletTopUpRequestBody struct {
+	Amount *float64 `json:"amount" validate:"required"`
+}
+
+type WalletResponse struct {
+	Uid     string  `json:"uid"`
+	Balance float64 `json:"balance"`
+}
+
+type WalletStatementResponse struct {
+	Uid     string                 `json:"uid"`
+	Balance float64                `json:"balance"`
+	Entries []*WalletEntryResponse `json:"entries"`
+}
+
+type WalletEntryResponse struct {
+	Reference    string    `json:"reference"`
+	Kind         string    `json:"kind"`
+	Amount       float64   `json:"amount"`
+	BalanceAfter float64   `json:"balance_after"`
+	Created      time.Time `json:"created"`
+}
+
+type ReconciliationReport struct {
+	StartDate    string                    `json:"start_date"`
+	EndDate      string                    `json:"end_date"`
+	Generated    time.Time                 `json:"generated"`
+	SlotsChecked int                       `json:"slots_checked"`
+	Transactions int                       `json:"transactions"`
+	Mismatches   []*ReconciliationMismatch `json:"mismatches"`
+}
+
+type ReconciliationMismatch struct {
+	Type        string  `json:"type"`
+	Placement   string  `json:"placement"`
+	Date        string  `json:"date"`
+	Position    int32   `json:"position"`
+	Status      string  `json:"status"`
+	Txnid       string  `json:"txnid,omitempty"`
+	Provider    string  `json:"provider,omitempty"`
+	BookedBy    string  `json:"booked_by,omitempty"`
+	DebitedBy   string  `json:"debited_by,omitempty"`
+	SlotAmount  float64 `json:"slot_amount"`
+	DebitAmount float64 `json:"debit_amount"`
+	Repaired    bool    `json:"repaired"`
+}
+
+type HoldResponse struct {
+	HoldId    string              `json:"hold_id"`
+	Uid       string              `json:"uid"`
+	Status    string              `json:"status"`
+	ExpiresAt time.Time           `json:"expires_at"`
+	Amount    float64             `json:"amount"`
+	Slots     []*HoldSlotResponse `json:"slots"`
+}
+
+type HoldSlotResponse struct {
+	Placement string  `json:"placement"`
+	Date      string  `json:"date"`
+	Position  int32   `json:"position"`
+	Cost      float64 `json:"cost"`
+}
+
+type CartResponse struct {
+	CartId string              `json:"cart_id"`
+	Uid    string              `json:"uid"`
+	Status string              `json:"status"`
+	Items  []*CartItemResponse `json:"items"`
+}
+
+type CartItemResponse struct {
+	Placement    string   `json:"placement"`
+	Date         string   `json:"date"`
+	Position     int32    `json:"position"`
+	Availability string   `json:"availability,omitempty"`
+	Cost         *float64 `json:"cost,omitempty"`
+}
+
+type CartValidationResponse struct {
+	CartId    string              `json:"cart_id"`
+	Available bool                `json:"available"`
+	Amount    float64             `json:"amount"`
+	Items     []*CartItemResponse `json:"items"`
+}
+
+type CartCheckoutResponse struct {
+	CartId  string              `json:"cart_id"`
+	Status  string              `json:"status"`
+	Amount  float64             `json:"amount"`
+	Booked  []*CartItemResponse `json:"booked"`
+	Skipped []*CartItemResponse `json:"skipped"`
+}
+
+type WaitlistEntryResponse struct {
+	Id        string  `json:"id"`
+	Placement string  `json:"placement"`
+	Date      string  `json:"date"`
+	Position  int32   `json:"position"`
+	Uid       string  `json:"uid"`
+	Status    string  `json:"status"`
+	HoldId    *string `json:"hold_id,omitempty"`
+}
+
+// WaitlistOfferEvent is the data of the waitlist offer events
+type WaitlistOfferEvent struct {
+	EntryId   string    `json:"entry_id"`
+	Uid       string    `json:"uid"`
+	Placement string    `json:"placement"`
+	Date      string    `json:"date"`
+	Position  int32     `json:"position"`
+	HoldId    string    `json:"hold_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AuctionRequestBody struct {
+	Placement    string          `json:"placement,omitempty"`
+	StartDate    models.JSONDate `json:"start_date,omitempty" validate:"json_date"`
+	EndDate      models.JSONDate `json:"end_date,omitempty" validate:"json_date"`
+	Position     []int32         `json:"position,omitempty" validate:"range"`
+	ReservePrice *float64        `json:"reserve_price" validate:"required"`
+	ClosesAt     *time.Time      `json:"closes_at" validate:"required"`
+	// Pricing is first or second, the configured default is used when empty
+	Pricing string `json:"pricing,omitempty"`
+}
+
+type AuctionResponse struct {
+	Id           string    `json:"id"`
+	Placement    string    `json:"placement"`
+	Date         string    `json:"date"`
+	Position     int32     `json:"position"`
+	ReservePrice float64   `json:"reserve_price"`
+	Pricing      string    `json:"pricing"`
+	Status       string    `json:"status"`
+	ClosesAt     time.Time `json:"closes_at"`
+	WinnerUid    *string   `json:"winner_uid,omitempty"`
+	Price        *float64  `json:"price,omitempty"`
+}
+
+type BidRequestBody struct {
+	Amount *float64 `json:"amount" validate:"required"`
+}
+
+type BidResponse struct {
+	Id        string  `json:"id"`
+	AuctionId string  `json:"auction_id"`
+	Uid       string  `json:"uid"`
+	Amount    float64 `json:"amount"`
+	Status    string  `json:"status"`
+}
+
+type TemplateRequestBody struct {
+	Name string `json:"name"`
+	// Placement of the generated slots, the default placement when empty
+	Placement string `json:"placement,omitempty"`
+	// Active defaults to true
+	Active *bool                  `json:"active"`
+	Rules  []*TemplateRuleRequest `json:"rules"`
+}
+
+type TemplateRuleRequest struct {
+	Weekdays []string `json:"weekdays"`
+	Position []int32  `json:"position,omitempty" validate:"range"`
+	Cost     *float64 `json:"cost,omitempty" validate:"required"`
+}
+
+type TemplateResponse struct {
+	Id        string                  `json:"id"`
+	Name      string                  `json:"name"`
+	Placement string                  `json:"placement"`
+	Active    bool                    `json:"active"`
+	Rules     []*TemplateRuleResponse `json:"rules"`
+}
+
+type TemplateRuleResponse struct {
+	Weekdays []string `json:"weekdays"`
+	Position []int32  `json:"position"`
+	Cost     float64  `json:"cost"`
+}
+
+type CalendarDayRequestBody struct {
+	Kind   *string `json:"kind" validate:"required"`
+	Uplift float64 `json:"uplift"`
+	Reason string  `json:"reason"`
+}
+
+type CalendarDayResponse struct {
+	Date   string  `json:"date"`
+	Kind   string  `json:"kind"`
+	Uplift float64 `json:"uplift"`
+	Reason string  `json:"reason"`
+}
+
+type CalendarImportResponse struct {
+	Events int `json:"events"`
+	Days   int `json:"days"`
+}
+
+type PlacementRequestBody struct {
+	// Id is only read on creation, e.g. homepage-banner
+	Id   string `json:"id,omitempty"`
+	Name string `json:"name"`
+	// MaxPositions limits the positions of a day, zero means no limit
+	MaxPositions int32 `json:"max_positions"`
+	// Granularity of the slots, day (default), hour or daypart
+	Granularity string         `json:"granularity,omitempty"`
+	DayParts    []*DayPartBody `json:"day_parts,omitempty"`
+	// Creatives restricts the creatives which can be attached to the slots
+	Creatives *CreativeSpecBody `json:"creatives,omitempty"`
+	// HouseCreativeId is an approved creative served instead of the creatives
+	// which weren't approved in time
+	HouseCreativeId string `json:"house_creative_id,omitempty"`
+}
+
+// CreativeSpecBody restricts the creatives of a placement to the formats,
+// e.g. image/png or text/html, the size in bytes and the dimensions of
+// images, empty or zero values leave them unrestricted
+type CreativeSpecBody struct {
+	Formats []string `json:"formats,omitempty"`
+	MaxSize int64    `json:"max_size,omitempty"`
+	Width   int32    `json:"width,omitempty"`
+	Height  int32    `json:"height,omitempty"`
+}
+
+// DayPartBody is a window of the days of a placement, e.g. prime time from
+// 19:00 to 23:00, an end at or before the start lies on the next day
+type DayPartBody struct {
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type PlacementResponse struct {
+	Id              string            `json:"id"`
+	Name            string            `json:"name"`
+	MaxPositions    int32             `json:"max_positions"`
+	Granularity     string            `json:"granularity"`
+	DayParts        []*DayPartBody    `json:"day_parts,omitempty"`
+	Creatives       *CreativeSpecBody `json:"creatives,omitempty"`
+	HouseCreativeId string            `json:"house_creative_id,omitempty"`
+}
+
+type AdvertiserRequestBody struct {
+	// Id is only read on creation, it's the uid the advertiser books with
+	Id    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+type AdvertiserResponse struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+type CampaignRequestBody struct {
+	// AdvertiserId is only read on creation
+	AdvertiserId string `json:"advertiser_id,omitempty"`
+	Name         string `json:"name"`
+	// Budget limits the cost of the reserved slots, zero means no limit
+	Budget float64 `json:"budget"`
+	// Status is active (default) or paused, paused campaigns take no reservations
+	Status string `json:"status,omitempty"`
+}
+
+// Spent of a campaign is the cost of its booked and held slots
+type CampaignResponse struct {
+	Id           string  `json:"id"`
+	AdvertiserId string  `json:"advertiser_id"`
+	Name         string  `json:"name"`
+	Budget       float64 `json:"budget"`
+	Spent        float64 `json:"spent"`
+	Status       string  `json:"status"`
+}
+
+// Width and Height of a creative are only set for images
+type CreativeResponse struct {
+	Id           string `json:"id"`
+	AdvertiserId string `json:"advertiser_id"`
+	Name         string `json:"name"`
+	Format       string `json:"format"`
+	Size         int64  `json:"size"`
+	Width        int32  `json:"width,omitempty"`
+	Height       int32  `json:"height,omitempty"`
+	Url          string `json:"url"`
+	ClickUrl     string `json:"click_url,omitempty"`
+	// Status is the review state, pending, approved or rejected
+	Status       string     `json:"status"`
+	ReviewReason string     `json:"review_reason,omitempty"`
+	ReviewedBy   *string    `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// CreativeReviewRequestBody approves or rejects a creative, rejections need a reason
+type CreativeReviewRequestBody struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AttachCreativeRequestBody attaches a creative to a booked slot, an empty
+// CreativeID detaches the creative of the slot
+type AttachCreativeRequestBody struct {
+	Placement  string          `json:"placement,omitempty"`
+	Date       models.JSONDate `json:"date,omitempty" validate:"json_date"`
+	Position   *int32          `json:"position" validate:"required"`
+	CreativeID string          `json:"creative_id"`
+}
+
+// ServeRequestBody asks for the creative to show at the position of the
+// placement at Date, a date or a time within the window of the slot
+type ServeRequestBody struct {
+	Placement string          `json:"placement,omitempty"`
+	Date      models.JSONDate `json:"date"`
+	Position  *int32          `json:"position" validate:"required"`
+}
+
+// ServeResponse is the creative to show at a position. Source is booked for
+// the approved creative of the advertiser who booked the slot, house for the
+// house ad of the placement and none when nothing is to be shown
+type ServeResponse struct {
+	Placement string        `json:"placement"`
+	Position  int32         `json:"position"`
+	Start     string        `json:"start,omitempty"`
+	End       string        `json:"end,omitempty"`
+	Status    string        `json:"status,omitempty"`
+	Source    string        `json:"source"`
+	Creative  *SlotCreative `json:"creative,omitempty"`
+	// ImpressionUrl and ClickUrl track the delivery of the served creative
+	ImpressionUrl string `json:"impression_url,omitempty"`
+	ClickUrl      string `json:"click_url,omitempty"`
+}
+
+// OccupancyReportRow is the occupancy of a group of slots, Rate is the share
+// of the sellable slots, which are not closed, that are booked
+type OccupancyReportRow struct {
+	Key      string  `json:"key"`
+	Total    int64   `json:"total"`
+	Sellable int64   `json:"sellable"`
+	Booked   int64   `json:"booked"`
+	Rate     float64 `json:"rate"`
+}
+
+type RevenueReportRow struct {
+	Period   string  `json:"period"`
+	Bookings int64   `json:"bookings"`
+	Revenue  float64 `json:"revenue"`
+}
+
+type AdvertiserSpendRow struct {
+	AdvertiserId string  `json:"advertiser_id"`
+	Name         string  `json:"name,omitempty"`
+	Bookings     int64   `json:"bookings"`
+	Spend        float64 `json:"spend"`
+}
+
+// LeadTimeReportRow is the time in days between the bookings of a period and
+// the start of their slots
+type LeadTimeReportRow struct {
+	Period   string  `json:"period"`
+	Bookings int64   `json:"bookings"`
+	AvgDays  float64 `json:"avg_days"`
+	MinDays  int64   `json:"min_days"`
+	MaxDays  int64   `json:"max_days"`
+}
+
+// SlotImportResponse reports an import of slots, Rows counts the rows of the
+// file and Slots the slots of its valid rows. Created is only set when the
+// slots were created, which takes a valid file and no dry run
+type SlotImportResponse struct {
+	DryRun  bool               `json:"dry_run"`
+	Rows    int                `json:"rows"`
+	Slots   int                `json:"slots"`
+	Created int                `json:"created"`
+	Errors  []*SlotImportError `json:"errors"`
+}
+
+// SlotImportError is the error of a row of the file, Row counts from 1 like spreadsheets
+type SlotImportError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// BookingExportRow is a slot of an export with the transaction of its
+// booking, the fields of the transaction are empty for slots without one
+type BookingExportRow struct {
+	Placement  string  `json:"placement"`
+	Date       string  `json:"date"`
+	EndsAt     string  `json:"ends_at,omitempty"`
+	Position   int32   `json:"position"`
+	Status     string  `json:"status"`
+	Cost       float64 `json:"cost"`
+	Txnid      string  `json:"txnid,omitempty"`
+	Provider   string  `json:"provider,omitempty"`
+	CampaignId string  `json:"campaign_id,omitempty"`
+	BookedBy   string  `json:"booked_by,omitempty"`
+	BookedDate string  `json:"booked_date,omitempty"`
+	CreativeId string  `json:"creative_id,omitempty"`
+}
+
+// SlotAuditResponse is an entry of the audit log of the slots, Before and
+// After hold the fields of the slot which the change altered
+type SlotAuditResponse struct {
+	Id        uint64          `json:"id"`
+	Placement string          `json:"placement"`
+	Date      string          `json:"date"`
+	Position  int32           `json:"position"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	RequestId string          `json:"request_id,omitempty"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Created   time.Time       `json:"created"`
+}
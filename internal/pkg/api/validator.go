@@ -54,10 +54,10 @@ func ValidateWithTags(s interface{}, prefix interface{}) error {
 					return fmt.Errorf("%v%s field is required", prefix, field.Name)
 				}
 			}
-			date, _ := time.Parse(time.DateOnly, time.Time(value.Interface().(models.JSONDate)).Format(time.DateOnly))
-			now, _ := time.Parse(time.DateOnly, time.Now().Format(time.DateOnly))
-			if date.Before(now) {
-				return fmt.Errorf("%s field must be date after current date", date.Format(time.DateOnly))
+			// the current date is the one of the business time zone, not of the server
+			date := models.StartOfDay(time.Time(value.Interface().(models.JSONDate)))
+			if date.Before(models.Today()) {
+				return fmt.Errorf("%s field must be date after current date in %s", models.DateToString(date), models.Location())
 			}
 		}
 	}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Claims are the claims admgr reads from a token, the tenant selects the
+// publisher the request belongs to
+type Claims struct {
+	Subject   string `json:"sub,omitempty"`
+	Tenant    string `json:"tenant"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// NewToken returns a JWT of the claims signed with HMAC-SHA256
+func NewToken(secret string, claims *Claims) (string, error) {
+	h, err := json.Marshal(header{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := encoding.EncodeToString(h) + "." + encoding.EncodeToString(c)
+	return unsigned + "." + sign(secret, unsigned), nil
+}
+
+// ParseToken verifies the HS256 signature and the expiry of the JWT and
+// returns its claims, tokens without a tenant are rejected
+func ParseToken(secret, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var h header
+	if err := decode(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+	if h.Alg != "HS256" {
+		return nil, fmt.Errorf("unsupported token algorithm %q", h.Alg)
+	}
+	if !hmac.Equal([]byte(sign(secret, parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return nil, errors.New("signature mismatch")
+	}
+	var claims Claims
+	if err := decode(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if claims.ExpiresAt != 0 && time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New("token expired")
+	}
+	if claims.Tenant == "" {
+		return nil, errors.New("token has no tenant")
+	}
+	return &claims, nil
+}
+
+// SignValues returns the HMAC-SHA256 signature of the query values, e.g. of
+// tracking urls, the sig value itself is left out
+func SignValues(secret string, values url.Values) string {
+	unsigned := make(url.Values, len(values))
+	for k, v := range values {
+		if k != "sig" {
+			unsigned[k] = v
+		}
+	}
+	return sign(secret, unsigned.Encode())
+}
+
+// VerifyValues checks the sig value of the query values
+func VerifyValues(secret string, values url.Values) bool {
+	return hmac.Equal([]byte(SignValues(secret, values)), []byte(values.Get("sig")))
+}
+
+func sign(secret, unsigned string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return encoding.EncodeToString(mac.Sum(nil))
+}
+
+func decode(part string, v interface{}) error {
+	data, err := encoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,289 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// CreateAuctions auctions every slot of the range, the slots must be open
+// and the auction must close before the first day of the range
+func (s *service) CreateAuctions(reqBody *api.AuctionRequestBody) ([]*api.AuctionResponse, error) {
+	startDate, endDate := time.Time(reqBody.StartDate), time.Time(reqBody.EndDate)
+	if startDate.After(endDate) {
+		return nil, models.NewError(
+			fmt.Sprintf("BadParameterValue: start_date[%s] should be less than or equal to end_date[%s]", models.DateToString(startDate), models.DateToString(endDate)),
+			models.DecodeFailureError,
+		)
+	}
+	if *reqBody.ReservePrice < 0 {
+		return nil, models.NewError("BadParameterValue: reserve_price cannot be negative", models.DecodeFailureError)
+	}
+	if !reqBody.ClosesAt.After(time.Now()) || !reqBody.ClosesAt.Before(startDate) {
+		return nil, models.NewError(
+			fmt.Sprintf("BadParameterValue: closes_at must be in the future and before start_date[%s]", models.DateToString(startDate)),
+			models.DecodeFailureError,
+		)
+	}
+	pricing := reqBody.Pricing
+	if pricing == "" {
+		pricing = s.conf.AuctionPricing
+	}
+	if pricing != models.AuctionPricingFirst && pricing != models.AuctionPricingSecond {
+		return nil, models.NewError(
+			fmt.Sprintf("BadParameterValue: pricing must be %s or %s", models.AuctionPricingFirst, models.AuctionPricingSecond),
+			models.DecodeFailureError,
+		)
+	}
+
+	slots, err := s.rep.SearchSlotsInRange(&mysql.GetOptions{
+		Placement:     placementID(reqBody.Placement),
+		StartDate:     startDate,
+		EndDate:       endDate,
+		PositionStart: models.Int32ToString(reqBody.Position[0]),
+		PositionEnd:   models.Int32ToString(reqBody.Position[1]),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) == 0 {
+		return nil, models.NewError(
+			fmt.Sprintf("No slots found [start_date: %s, end_date: %s]", models.DateToString(startDate), models.DateToString(endDate)),
+			models.ResourceNotFoundError,
+		)
+	}
+	auctions := make([]*mysql.Auction, 0, len(slots))
+	for _, slot := range slots {
+		auctions = append(auctions, &mysql.Auction{
+			ID:           uuid.New().String(),
+			Placement:    slot.Placement,
+			Date:         slot.Date,
+			Position:     slot.Position,
+			ReservePrice: *reqBody.ReservePrice,
+			Pricing:      pricing,
+			Status:       models.AuctionStatusOpen,
+			ClosesAt:     *reqBody.ClosesAt,
+		})
+	}
+	if err = s.rep.CreateAuctions(auctions); err != nil {
+		return nil, err
+	}
+	s.log.Infof("Total %d slots auctioned until %s", len(auctions), reqBody.ClosesAt.Format(time.RFC3339))
+	res := make([]*api.AuctionResponse, 0, len(auctions))
+	for _, auction := range auctions {
+		res = append(res, auctionResponse(auction))
+	}
+	return res, nil
+}
+
+func (s *service) GetAuctions(filters map[string]string) ([]*api.AuctionResponse, error) {
+	startDate, err := time.ParseInLocation(time.DateOnly, filters["start_date"], models.Location())
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("start_date: %s decode failed", filters["start_date"]), models.DecodeFailureError)
+	}
+	endDate, err := time.ParseInLocation(time.DateOnly, filters["end_date"], models.Location())
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("end_date: %s decode failed", filters["end_date"]), models.DecodeFailureError)
+	}
+	auctions, err := s.rep.Auctions(filters["placement"], startDate, endDate, filters["status"])
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.AuctionResponse, 0, len(auctions))
+	for _, auction := range auctions {
+		res = append(res, auctionResponse(auction))
+	}
+	return res, nil
+}
+
+func (s *service) GetAuction(id string) (*api.AuctionResponse, error) {
+	auction, err := s.rep.GetAuction(id)
+	if err != nil {
+		return nil, err
+	}
+	return auctionResponse(auction), nil
+}
+
+// PlaceBid records the sealed bid of the advertiser, bidding again before the
+// auction closes replaces the earlier amount
+func (s *service) PlaceBid(id, uid string, reqBody *api.BidRequestBody) (*api.BidResponse, error) {
+	auction, err := s.rep.GetAuction(id)
+	if err != nil {
+		return nil, err
+	}
+	if auction.Status != models.AuctionStatusOpen || !auction.ClosesAt.After(time.Now()) {
+		return nil, models.NewError(fmt.Sprintf("Auction %s is closed", id), models.ActionForbidden)
+	}
+	if err = s.checkBookable(uid, *auction.Date); err != nil {
+		return nil, err
+	}
+	if *reqBody.Amount < auction.ReservePrice {
+		return nil, models.NewError(
+			fmt.Sprintf("BadParameterValue: amount must be at least the reserve price %.2f", auction.ReservePrice),
+			models.DecodeFailureError,
+		)
+	}
+	bid, err := s.rep.SaveBid(&mysql.Bid{
+		ID:        uuid.New().String(),
+		AuctionID: id,
+		Uid:       uid,
+		Amount:    *reqBody.Amount,
+		Status:    models.BidStatusActive,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bidResponse(bid), nil
+}
+
+// CloseAuctions awards the auctions whose closing time passed, it returns
+// the number of auctions which were closed. An auction failing to close
+// doesn't keep the others open, the failures are returned together
+func (s *service) CloseAuctions() (int, error) {
+	auctions, err := s.rep.ClosedAuctions(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	closed := 0
+	var errs []error
+	for _, auction := range auctions {
+		done, err := s.closeAuction(auction)
+		if err != nil {
+			s.log.Errorf("CloseAuction:: failed to close auction %s [Error: %s]", auction.ID, err)
+			errs = append(errs, fmt.Errorf("auction %s: %w", auction.ID, err))
+			continue
+		}
+		if done {
+			closed++
+		}
+	}
+	if closed > 0 {
+		s.log.Infof("Total %d auctions closed", closed)
+	}
+	return closed, errors.Join(errs...)
+}
+
+// closeAuction offers the slot to the bidders from the highest bid down, the
+// first bidder whose debit succeeds wins. The auction stays open when the
+// payment provider is unavailable so that it's closed on the next run
+func (s *service) closeAuction(auction *mysql.Auction) (bool, error) {
+	bids, err := s.rep.AuctionBids(auction.ID)
+	if err != nil {
+		return false, err
+	}
+	var eligible []*mysql.Bid
+	for _, bid := range bids {
+		if bid.Status == models.BidStatusActive && bid.Amount >= auction.ReservePrice {
+			eligible = append(eligible, bid)
+		}
+	}
+
+	for i, bid := range eligible {
+		price := auctionPrice(auction, eligible, i)
+		providerName, err := s.pay.ProviderFor(bid.Uid)
+		if err != nil {
+			return false, err
+		}
+		hold := &mysql.Hold{
+			ID:        uuid.New().String(),
+			Uid:       bid.Uid,
+			Status:    models.HoldStatusActive,
+			ExpiresAt: time.Now().Add(s.conf.HoldTTL),
+		}
+		txn := &mysql.Transaction{
+			Txnid:     hold.ID,
+			Placement: auction.Placement,
+			Date:      auction.Date,
+			Position:  auction.Position,
+			Provider:  models.PtrString(providerName),
+		}
+		if err = s.rep.HoldAuctionSlot(auction, hold, txn, price); err != nil {
+			// the slot was taken out of the auction, e.g. after its hold expired
+			if mErr, ok := err.(*models.Error); ok && mErr.Type == models.ActionForbidden {
+				s.log.Errorf("CloseAuction:: %s, closing it unsold", err)
+				break
+			}
+			return false, err
+		}
+		if _, err = s.ConfirmHold(hold.ID, hold.Uid); err != nil {
+			// the slot stays with the hold until ExpireHolds settles whether it was paid
+			if debitUncertain(err) {
+				s.log.Errorf("CloseAuction:: debit of bid %s may have been taken, leaving hold %s to be settled [Auction: %s, Error: %s]", bid.ID, hold.ID, auction.ID, err)
+				return false, nil
+			}
+			if rErr := s.rep.ReturnAuctionSlot(auction, hold.ID); rErr != nil {
+				return false, rErr
+			}
+			if mErr, ok := err.(*models.Error); ok && mErr.Type == models.DependentServiceRequestFailed {
+				s.log.Errorf("CloseAuction:: payment provider unavailable, retrying auction %s later [Error: %s]", auction.ID, err)
+				return false, nil
+			}
+			s.log.Errorf("CloseAuction:: debit of bid %s failed, moving to the next bidder [Auction: %s, Error: %s]", bid.ID, auction.ID, err)
+			if err = s.rep.UpdateBidStatus(bid.ID, models.BidStatusFailed); err != nil {
+				return false, err
+			}
+			continue
+		}
+		if err = s.rep.UpdateBidStatus(bid.ID, models.BidStatusWon); err != nil {
+			return false, err
+		}
+		auction.Status = models.AuctionStatusAwarded
+		auction.WinnerUid = models.PtrString(bid.Uid)
+		auction.Price = &price
+		if err = s.rep.FinishAuction(auction); err != nil {
+			return false, err
+		}
+		s.log.Infof("Auction %s awarded to %s at %.2f", auction.ID, bid.Uid, price)
+		s.publish(models.EventAuctionAwarded, auctionResponse(auction))
+		return true, nil
+	}
+
+	auction.Status = models.AuctionStatusUnsold
+	if err = s.rep.FinishAuction(auction); err != nil {
+		return false, err
+	}
+	s.log.Infof("Auction %s closed unsold", auction.ID)
+	return true, nil
+}
+
+// auctionPrice is the amount the i-th eligible bidder pays, the own bid for
+// first price or the next bid, at least the reserve, for second price
+func auctionPrice(auction *mysql.Auction, eligible []*mysql.Bid, i int) float64 {
+	if auction.Pricing == models.AuctionPricingFirst {
+		return eligible[i].Amount
+	}
+	if i+1 < len(eligible) {
+		return eligible[i+1].Amount
+	}
+	return auction.ReservePrice
+}
+
+func auctionResponse(auction *mysql.Auction) *api.AuctionResponse {
+	return &api.AuctionResponse{
+		Id:           auction.ID,
+		Placement:    auction.Placement,
+		Date:         models.TimeToString(*auction.Date),
+		Position:     *auction.Position,
+		ReservePrice: auction.ReservePrice,
+		Pricing:      auction.Pricing,
+		Status:       auction.Status,
+		ClosesAt:     auction.ClosesAt,
+		WinnerUid:    auction.WinnerUid,
+		Price:        auction.Price,
+	}
+}
+
+func bidResponse(bid *mysql.Bid) *api.BidResponse {
+	return &api.BidResponse{
+		Id:        bid.ID,
+		AuctionId: bid.AuctionID,
+		Uid:       bid.Uid,
+		Amount:    bid.Amount,
+		Status:    bid.Status,
+	}
+}
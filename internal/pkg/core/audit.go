@@ -0,0 +1,105 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// defaultAuditLimit is the number of audit entries returned without limit param
+const defaultAuditLimit = 100
+
+// storageRepository is the repository of a mysql storage, it keeps the
+// audited copies of the storage behind the repository
+type storageRepository struct {
+	*mysql.Storage
+}
+
+// NewRepository returns the repository backed by the storage
+func NewRepository(s *mysql.Storage) Repository {
+	return storageRepository{s}
+}
+
+func (r storageRepository) WithAudit(actor, requestID string) Repository {
+	return storageRepository{r.Storage.WithAudit(actor, requestID)}
+}
+
+// WithAudit returns a copy of the service whose changes of slots are recorded
+// in the audit log as made by the actor, within the request
+func (s *service) WithAudit(actor, requestID string) Service {
+	as := *s
+	as.rep = s.rep.WithAudit(actor, requestID)
+	return &as
+}
+
+// GetSlotAudits returns the changes of the slots matching the filters, the
+// latest first. The uid param must name an operator
+func (s *service) GetSlotAudits(filters map[string]string) ([]*api.SlotAuditResponse, error) {
+	if !s.isOperator(filters["uid"]) {
+		return nil, models.NewError(fmt.Sprintf("%s is not allowed to read the audit log", filters["uid"]), models.ActionForbidden)
+	}
+	opts := &mysql.SlotAuditOptions{
+		Placement: filters["placement"],
+		Actor:     filters["actor"],
+		Limit:     defaultAuditLimit,
+	}
+	var err error
+	if date := filters["date"]; date != "" {
+		d, err := models.ParseTime(date)
+		if err != nil {
+			return nil, models.NewError(fmt.Sprintf("date: %s decode failed", date), models.DecodeFailureError)
+		}
+		opts.Date = &d
+	}
+	if position := filters["position"]; position != "" {
+		p, err := strconv.ParseInt(position, 10, 32)
+		if err != nil {
+			return nil, models.NewError(fmt.Sprintf("position: %s must be a number", position), models.DecodeFailureError)
+		}
+		opts.Position = models.PtrInt(int32(p))
+	}
+	if from := filters["from"]; from != "" {
+		if opts.From, err = models.ParseTime(from); err != nil {
+			return nil, models.NewError(fmt.Sprintf("from: %s decode failed", from), models.DecodeFailureError)
+		}
+	}
+	if to := filters["to"]; to != "" {
+		end, err := models.ParseTime(to)
+		if err != nil {
+			return nil, models.NewError(fmt.Sprintf("to: %s decode failed", to), models.DecodeFailureError)
+		}
+		opts.To = models.EndOfRange(end)
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && opts.From.After(opts.To) {
+		return nil, models.NewError(fmt.Sprintf("from[%s] cannot be greater than to[%s]", filters["from"], filters["to"]), models.DecodeFailureError)
+	}
+	if limit := filters["limit"]; limit != "" {
+		opts.Limit, err = strconv.Atoi(limit)
+		if err != nil || opts.Limit < 1 {
+			return nil, models.NewError(fmt.Sprintf("limit: %s must be a positive number", limit), models.DecodeFailureError)
+		}
+	}
+	audits, err := s.rep.SlotAudits(opts)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.SlotAuditResponse, 0, len(audits))
+	for _, a := range audits {
+		res = append(res, &api.SlotAuditResponse{
+			Id:        a.ID,
+			Placement: a.Placement,
+			Date:      models.TimeToString(a.Date),
+			Position:  a.Position,
+			Action:    a.Action,
+			Actor:     a.Actor,
+			RequestId: a.RequestID,
+			Before:    a.Before,
+			After:     a.After,
+			Created:   a.Created,
+		})
+	}
+	return res, nil
+}
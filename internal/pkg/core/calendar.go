@@ -0,0 +1,245 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/ical"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// SetCalendarDay marks the date, slots which already exist on it are kept
+// as they are, the marking applies to the slots created and booked afterwards
+func (s *service) SetCalendarDay(date string, reqBody *api.CalendarDayRequestBody) (*api.CalendarDayResponse, error) {
+	day, err := time.ParseInLocation(time.DateOnly, date, models.Location())
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("date: %s decode failed", date), models.DecodeFailureError)
+	}
+	calendarDay, err := calendarDay(day, *reqBody.Kind, reqBody.Uplift, reqBody.Reason)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.rep.SaveCalendarDays([]*mysql.CalendarDay{calendarDay}); err != nil {
+		return nil, err
+	}
+	return calendarDayResponse(calendarDay), nil
+}
+
+func (s *service) DeleteCalendarDay(date string) error {
+	day, err := time.ParseInLocation(time.DateOnly, date, models.Location())
+	if err != nil {
+		return models.NewError(fmt.Sprintf("date: %s decode failed", date), models.DecodeFailureError)
+	}
+	deleted, err := s.rep.DeleteCalendarDay(day)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return models.NewError(fmt.Sprintf("Calendar day %s not found", date), models.ResourceNotFoundError)
+	}
+	return nil
+}
+
+func (s *service) GetCalendar(filters map[string]string) ([]*api.CalendarDayResponse, error) {
+	startDate, err := time.ParseInLocation(time.DateOnly, filters["start_date"], models.Location())
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("start_date: %s decode failed", filters["start_date"]), models.DecodeFailureError)
+	}
+	endDate, err := time.ParseInLocation(time.DateOnly, filters["end_date"], models.Location())
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("end_date: %s decode failed", filters["end_date"]), models.DecodeFailureError)
+	}
+	if kind := filters["kind"]; kind != "" && !isCalendarKind(kind) {
+		return nil, models.NewError(fmt.Sprintf("BadParameterValue: invalid kind '%s'", kind), models.DecodeFailureError)
+	}
+	days, err := s.rep.CalendarDays(startDate, endDate, filters["kind"])
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.CalendarDayResponse, 0, len(days))
+	for _, day := range days {
+		res = append(res, calendarDayResponse(day))
+	}
+	return res, nil
+}
+
+// ImportCalendar marks the days of the events of an iCalendar file. The
+// kind of an event is its category when it is one of blackout, holiday or
+// restricted, the kind parameter otherwise. Recurring events are expanded
+// until the until parameter, a year from today by default
+func (s *service) ImportCalendar(file io.Reader, params map[string]string) (*api.CalendarImportResponse, error) {
+	if !isCalendarKind(params["kind"]) {
+		return nil, models.NewError(fmt.Sprintf("BadParameterValue: invalid kind '%s'", params["kind"]), models.DecodeFailureError)
+	}
+	var uplift float64
+	if params["uplift"] != "" {
+		var err error
+		if uplift, err = strconv.ParseFloat(params["uplift"], 64); err != nil {
+			return nil, models.NewError(fmt.Sprintf("uplift: %s decode failed", params["uplift"]), models.DecodeFailureError)
+		}
+	}
+	until := models.Today().AddDate(1, 0, 0)
+	if params["until"] != "" {
+		var err error
+		if until, err = time.ParseInLocation(time.DateOnly, params["until"], models.Location()); err != nil {
+			return nil, models.NewError(fmt.Sprintf("until: %s decode failed", params["until"]), models.DecodeFailureError)
+		}
+	}
+	events, err := ical.Parse(file)
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("ParsingError: invalid iCalendar file, %s", err), models.DecodeFailureError)
+	}
+
+	// later events of the file win over the earlier ones on the same date
+	byDate := make(map[string]*mysql.CalendarDay)
+	var days []*mysql.CalendarDay
+	for _, event := range events {
+		kind := params["kind"]
+		for _, category := range event.Categories {
+			if isCalendarKind(strings.ToLower(category)) {
+				kind = strings.ToLower(category)
+			}
+		}
+		eventUplift := 0.0
+		if kind == models.CalendarHoliday {
+			eventUplift = uplift
+		}
+		for _, date := range event.Dates(until) {
+			day, err := calendarDay(date, kind, eventUplift, event.Summary)
+			if err != nil {
+				return nil, err
+			}
+			if existing, ok := byDate[models.DateToString(date)]; ok {
+				*existing = *day
+				continue
+			}
+			byDate[models.DateToString(date)] = day
+			days = append(days, day)
+		}
+	}
+	if len(days) > 0 {
+		if err = s.rep.SaveCalendarDays(days); err != nil {
+			return nil, err
+		}
+	}
+	s.log.Infof("Calendar import marked %d days from %d events", len(days), len(events))
+	return &api.CalendarImportResponse{Events: len(events), Days: len(days)}, nil
+}
+
+// calendar returns the marked days between start and end by date
+func (s *service) calendar(start, end time.Time) (map[string]*mysql.CalendarDay, error) {
+	days, err := s.rep.CalendarDays(start, end, "")
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]*mysql.CalendarDay, len(days))
+	for _, day := range days {
+		res[models.DateToString(*day.Date)] = day
+	}
+	return res, nil
+}
+
+// checkBookable refuses bookings of days which are over in the business time
+// zone, or of slots within a day which have started, on blackout days, and on
+// restricted days unless the advertiser is an operator
+func (s *service) checkBookable(uid string, dates ...time.Time) error {
+	if len(dates) == 0 {
+		return nil
+	}
+	today, now := models.Today(), time.Now()
+	start, end := dates[0], dates[0]
+	for _, date := range dates {
+		if date.Before(today) || (!models.IsDate(date) && date.Before(now)) {
+			return models.NewError(
+				fmt.Sprintf("Date %s is in the past in %s and cannot be booked", models.TimeToString(date), models.Location()),
+				models.ActionForbidden,
+			)
+		}
+		if date.Before(start) {
+			start = date
+		}
+		if date.After(end) {
+			end = date
+		}
+	}
+	days, err := s.calendar(start, end)
+	if err != nil {
+		return err
+	}
+	for _, date := range dates {
+		day, ok := days[models.DateToString(date)]
+		if !ok {
+			continue
+		}
+		if day.Kind == models.CalendarBlackout {
+			return models.NewError(fmt.Sprintf("Date %s is a blackout day and cannot be booked", models.DateToString(date)), models.ActionForbidden)
+		}
+		if day.Kind == models.CalendarRestricted && !s.isOperator(uid) {
+			return models.NewError(fmt.Sprintf("Date %s is restricted, only operators can book it", models.DateToString(date)), models.ActionForbidden)
+		}
+	}
+	return nil
+}
+
+func (s *service) isOperator(uid string) bool {
+	for _, operator := range s.conf.Operators {
+		if operator == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func requestDates(request []*api.ReserveSlotRequestBody) []time.Time {
+	dates := make([]time.Time, 0, len(request))
+	for _, r := range request {
+		dates = append(dates, time.Time(r.Date))
+	}
+	return dates
+}
+
+// dayCost is the cost of a slot created on the day, holidays add their uplift
+func dayCost(cost *float64, day *mysql.CalendarDay) *float64 {
+	if cost == nil || day == nil || day.Kind != models.CalendarHoliday || day.Uplift == 0 {
+		return cost
+	}
+	return models.PtrFloat(math.Round(*cost*(100+day.Uplift)) / 100)
+}
+
+func calendarDay(date time.Time, kind string, uplift float64, reason string) (*mysql.CalendarDay, error) {
+	if !isCalendarKind(kind) {
+		return nil, models.NewError(
+			fmt.Sprintf("BadParameterValue: kind must be one of %s, %s or %s", models.CalendarBlackout, models.CalendarHoliday, models.CalendarRestricted),
+			models.DecodeFailureError,
+		)
+	}
+	if uplift < 0 {
+		return nil, models.NewError("BadParameterValue: uplift cannot be negative", models.DecodeFailureError)
+	}
+	if kind != models.CalendarHoliday && uplift != 0 {
+		return nil, models.NewError("BadParameterValue: uplift only applies to holidays", models.DecodeFailureError)
+	}
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	return &mysql.CalendarDay{Date: models.PtrDate(date), Kind: kind, Uplift: uplift, Reason: reason}, nil
+}
+
+func isCalendarKind(kind string) bool {
+	return kind == models.CalendarBlackout || kind == models.CalendarHoliday || kind == models.CalendarRestricted
+}
+
+func calendarDayResponse(day *mysql.CalendarDay) *api.CalendarDayResponse {
+	return &api.CalendarDayResponse{
+		Date:   models.DateToString(*day.Date),
+		Kind:   day.Kind,
+		Uplift: day.Uplift,
+		Reason: day.Reason,
+	}
+}
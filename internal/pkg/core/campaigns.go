@@ -0,0 +1,256 @@
+package core
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+func (s *service) CreateAdvertiser(reqBody *api.AdvertiserRequestBody) (*api.AdvertiserResponse, error) {
+	if strings.TrimSpace(reqBody.Id) == "" || len(reqBody.Id) > 36 {
+		return nil, models.NewError("BadParameterValue: id must be the uid of the advertiser, up to 36 characters", models.DecodeFailureError)
+	}
+	advertiser := &mysql.Advertiser{ID: reqBody.Id}
+	if err := applyAdvertiserRequest(advertiser, reqBody); err != nil {
+		return nil, err
+	}
+	if _, err := s.rep.Create(advertiser); err != nil {
+		return nil, err
+	}
+	return advertiserResponse(advertiser), nil
+}
+
+func (s *service) GetAdvertisers() ([]*api.AdvertiserResponse, error) {
+	advertisers, err := s.rep.Advertisers()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.AdvertiserResponse, 0, len(advertisers))
+	for _, advertiser := range advertisers {
+		res = append(res, advertiserResponse(advertiser))
+	}
+	return res, nil
+}
+
+func (s *service) GetAdvertiser(id string) (*api.AdvertiserResponse, error) {
+	advertiser, err := s.rep.GetAdvertiser(id)
+	if err != nil {
+		return nil, err
+	}
+	return advertiserResponse(advertiser), nil
+}
+
+func (s *service) UpdateAdvertiser(id string, reqBody *api.AdvertiserRequestBody) (*api.AdvertiserResponse, error) {
+	advertiser, err := s.rep.GetAdvertiser(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = applyAdvertiserRequest(advertiser, reqBody); err != nil {
+		return nil, err
+	}
+	if err = s.rep.UpdateAdvertiser(advertiser); err != nil {
+		return nil, err
+	}
+	return advertiserResponse(advertiser), nil
+}
+
+// DeleteAdvertiser removes the profile of an advertiser without campaigns,
+// the slots it booked are kept
+func (s *service) DeleteAdvertiser(id string) error {
+	campaigns, err := s.rep.Campaigns(id)
+	if err != nil {
+		return err
+	}
+	if len(campaigns) > 0 {
+		return models.NewError(fmt.Sprintf("Advertiser %s still has campaigns", id), models.ActionForbidden)
+	}
+	deleted, err := s.rep.DeleteAdvertiser(id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return models.NewError(fmt.Sprintf("Advertiser %s not found", id), models.ResourceNotFoundError)
+	}
+	return nil
+}
+
+func (s *service) CreateCampaign(reqBody *api.CampaignRequestBody) (*api.CampaignResponse, error) {
+	if _, err := s.rep.GetAdvertiser(reqBody.AdvertiserId); err != nil {
+		return nil, err
+	}
+	campaign := &mysql.Campaign{ID: uuid.New().String(), AdvertiserID: reqBody.AdvertiserId}
+	if err := applyCampaignRequest(campaign, reqBody); err != nil {
+		return nil, err
+	}
+	if _, err := s.rep.Create(campaign); err != nil {
+		return nil, err
+	}
+	return campaignResponse(campaign, 0), nil
+}
+
+// GetCampaigns lists the campaigns, of one advertiser with the advertiser_id filter
+func (s *service) GetCampaigns(filters map[string]string) ([]*api.CampaignResponse, error) {
+	campaigns, err := s.rep.Campaigns(filters["advertiser_id"])
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		ids = append(ids, campaign.ID)
+	}
+	res := make([]*api.CampaignResponse, 0, len(campaigns))
+	if len(campaigns) == 0 {
+		return res, nil
+	}
+	spend, err := s.rep.CampaignSpend(ids...)
+	if err != nil {
+		return nil, err
+	}
+	for _, campaign := range campaigns {
+		res = append(res, campaignResponse(campaign, spend[campaign.ID]))
+	}
+	return res, nil
+}
+
+func (s *service) GetCampaign(id string) (*api.CampaignResponse, error) {
+	campaign, err := s.rep.GetCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+	spend, err := s.rep.CampaignSpend(id)
+	if err != nil {
+		return nil, err
+	}
+	return campaignResponse(campaign, spend[id]), nil
+}
+
+// UpdateCampaign renames, pauses or changes the budget of the campaign, the
+// budget cannot go below what the campaign has already spent
+func (s *service) UpdateCampaign(id string, reqBody *api.CampaignRequestBody) (*api.CampaignResponse, error) {
+	campaign, err := s.rep.GetCampaign(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = applyCampaignRequest(campaign, reqBody); err != nil {
+		return nil, err
+	}
+	spend, err := s.rep.CampaignSpend(id)
+	if err != nil {
+		return nil, err
+	}
+	if campaign.Budget > 0 && campaign.Budget < spend[id] {
+		return nil, models.NewError(
+			fmt.Sprintf("Campaign %s has spent %.2f, the budget cannot be lower", id, spend[id]),
+			models.ActionForbidden,
+		)
+	}
+	if err = s.rep.UpdateCampaign(campaign); err != nil {
+		return nil, err
+	}
+	return campaignResponse(campaign, spend[id]), nil
+}
+
+// DeleteCampaign removes a campaign without reserved slots
+func (s *service) DeleteCampaign(id string) error {
+	spend, err := s.rep.CampaignSpend(id)
+	if err != nil {
+		return err
+	}
+	if _, ok := spend[id]; ok {
+		return models.NewError(fmt.Sprintf("Campaign %s still has reserved slots", id), models.ActionForbidden)
+	}
+	deleted, err := s.rep.DeleteCampaign(id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return models.NewError(fmt.Sprintf("Campaign %s not found", id), models.ResourceNotFoundError)
+	}
+	return nil
+}
+
+// checkCampaigns refuses reservations for campaigns which don't exist, belong
+// to another advertiser or are paused, the budgets are enforced when the
+// transactions are created
+func (s *service) checkCampaigns(request []*api.ReserveSlotRequestBody, uid string) error {
+	checked := make(map[string]bool)
+	for _, r := range request {
+		if r.CampaignID == "" || checked[r.CampaignID] {
+			continue
+		}
+		campaign, err := s.rep.GetCampaign(r.CampaignID)
+		if err != nil {
+			return err
+		}
+		if campaign.AdvertiserID != uid {
+			return models.NewError(fmt.Sprintf("Campaign %s does not belong to %s", campaign.ID, uid), models.ActionForbidden)
+		}
+		if campaign.Status != models.CampaignStatusActive {
+			return models.NewError(fmt.Sprintf("Campaign %s is %s and takes no reservations", campaign.ID, campaign.Status), models.ActionForbidden)
+		}
+		checked[r.CampaignID] = true
+	}
+	return nil
+}
+
+func applyAdvertiserRequest(advertiser *mysql.Advertiser, reqBody *api.AdvertiserRequestBody) error {
+	if strings.TrimSpace(reqBody.Name) == "" {
+		return models.NewError("BadParameterValue: name cannot be empty", models.DecodeFailureError)
+	}
+	if reqBody.Email != "" {
+		if _, err := mail.ParseAddress(reqBody.Email); err != nil {
+			return models.NewError(fmt.Sprintf("BadParameterValue: invalid email %q", reqBody.Email), models.DecodeFailureError)
+		}
+	}
+	advertiser.Name = reqBody.Name
+	advertiser.Email = reqBody.Email
+	return nil
+}
+
+func applyCampaignRequest(campaign *mysql.Campaign, reqBody *api.CampaignRequestBody) error {
+	if strings.TrimSpace(reqBody.Name) == "" {
+		return models.NewError("BadParameterValue: name cannot be empty", models.DecodeFailureError)
+	}
+	if reqBody.Budget < 0 {
+		return models.NewError("BadParameterValue: budget cannot be negative", models.DecodeFailureError)
+	}
+	status := reqBody.Status
+	if status == "" {
+		status = models.CampaignStatusActive
+	}
+	if status != models.CampaignStatusActive && status != models.CampaignStatusPaused {
+		return models.NewError(
+			fmt.Sprintf("BadParameterValue: status must be %s or %s", models.CampaignStatusActive, models.CampaignStatusPaused),
+			models.DecodeFailureError,
+		)
+	}
+	campaign.Name = reqBody.Name
+	campaign.Budget = reqBody.Budget
+	campaign.Status = status
+	return nil
+}
+
+func advertiserResponse(advertiser *mysql.Advertiser) *api.AdvertiserResponse {
+	return &api.AdvertiserResponse{
+		Id:    advertiser.ID,
+		Name:  advertiser.Name,
+		Email: advertiser.Email,
+	}
+}
+
+func campaignResponse(campaign *mysql.Campaign, spent float64) *api.CampaignResponse {
+	return &api.CampaignResponse{
+		Id:           campaign.ID,
+		AdvertiserId: campaign.AdvertiserID,
+		Name:         campaign.Name,
+		Budget:       campaign.Budget,
+		Spent:        spent,
+		Status:       campaign.Status,
+	}
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+func (s *service) CreateCart(request []*api.ReserveSlotRequestBody, uid string) (*api.CartResponse, error) {
+	cart := &mysql.Cart{
+		ID:     uuid.New().String(),
+		Uid:    uid,
+		Status: models.CartStatusOpen,
+	}
+	if err := s.rep.CreateCart(cart, cartItems(cart.ID, request)); err != nil {
+		return nil, err
+	}
+	return s.GetCart(cart.ID, uid)
+}
+
+func (s *service) GetCart(id, uid string) (*api.CartResponse, error) {
+	cart, err := s.ownCart(id, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := &api.CartResponse{
+		CartId: cart.ID,
+		Uid:    cart.Uid,
+		Status: cart.Status,
+		Items:  make([]*api.CartItemResponse, 0, len(cart.Items)),
+	}
+	for _, item := range cart.Items {
+		res.Items = append(res.Items, &api.CartItemResponse{
+			Placement: item.Placement,
+			Date:      models.TimeToString(*item.Date),
+			Position:  *item.Position,
+		})
+	}
+	return res, nil
+}
+
+func (s *service) AddCartItems(id, uid string, request []*api.ReserveSlotRequestBody) (*api.CartResponse, error) {
+	if _, err := s.openCart(id, uid); err != nil {
+		return nil, err
+	}
+	if err := s.rep.AddCartItems(cartItems(id, request)); err != nil {
+		return nil, err
+	}
+	return s.GetCart(id, uid)
+}
+
+func (s *service) RemoveCartItems(id, uid string, request []*api.ReserveSlotRequestBody) (*api.CartResponse, error) {
+	if _, err := s.openCart(id, uid); err != nil {
+		return nil, err
+	}
+	if _, err := s.rep.RemoveCartItems(cartItems(id, request)); err != nil {
+		return nil, err
+	}
+	return s.GetCart(id, uid)
+}
+
+// ValidateCart reports the current availability and price of every item in
+// the cart, nothing is held so the result may change before checkout
+func (s *service) ValidateCart(id, uid string) (*api.CartValidationResponse, error) {
+	cart, err := s.ownCart(id, uid)
+	if err != nil {
+		return nil, err
+	}
+	return s.validateCart(cart)
+}
+
+// CheckoutCart reserves the items of the cart in a single reservation. Unless
+// allowPartial is set the checkout fails when any item is unavailable, else
+// the unavailable items are skipped, also when they are booked concurrently
+func (s *service) CheckoutCart(id, uid string, allowPartial bool) (*api.CartCheckoutResponse, error) {
+	cart, err := s.openCart(id, uid)
+	if err != nil {
+		return nil, err
+	}
+	if len(cart.Items) == 0 {
+		return nil, models.NewError(fmt.Sprintf("Cart %s is empty", id), models.ActionForbidden)
+	}
+	request, res, err := s.checkoutRequest(cart, allowPartial)
+	if err != nil {
+		return nil, err
+	}
+
+	// checking out first keeps a concurrent checkout of the same cart away
+	ok, err := s.rep.UpdateCartStatus(id, models.CartStatusOpen, models.CartStatusCheckedOut)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, models.NewError(fmt.Sprintf("Cart %s is already checked out", id), models.ActionForbidden)
+	}
+	for attempt := 1; ; attempt++ {
+		err = s.ReserveSlots(request, cart.Uid)
+		mErr, ok := err.(*models.Error)
+		if !ok || mErr.Type != models.ActionForbidden || !allowPartial || attempt == checkoutAttempts {
+			break
+		}
+		// items booked since the validation fail the whole reservation, the
+		// checkout goes on with the items which are still available
+		retry, retryRes, vErr := s.checkoutRequest(cart, allowPartial)
+		if vErr != nil {
+			err = vErr
+			break
+		}
+		if len(retry) == len(request) {
+			break
+		}
+		s.log.Infof("Cart %s lost %d items to other bookings during checkout, retrying", id, len(request)-len(retry))
+		request, res = retry, retryRes
+	}
+	if err != nil {
+		if _, rErr := s.rep.UpdateCartStatus(id, models.CartStatusCheckedOut, models.CartStatusOpen); rErr != nil {
+			s.log.Errorf("CheckoutCart:: failed to reopen cart %s [Error: %s]", id, rErr)
+		}
+		return nil, err
+	}
+	s.log.Infof("Cart %s checked out with %d items, %d skipped", id, len(res.Booked), len(res.Skipped))
+	return res, nil
+}
+
+// checkoutRequest validates the cart and builds the reservation of its
+// available items with the checkout response
+func (s *service) checkoutRequest(cart *mysql.Cart, allowPartial bool) ([]*api.ReserveSlotRequestBody, *api.CartCheckoutResponse, error) {
+	validation, err := s.validateCart(cart)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := &api.CartCheckoutResponse{
+		CartId:  cart.ID,
+		Status:  models.CartStatusCheckedOut,
+		Booked:  make([]*api.CartItemResponse, 0),
+		Skipped: make([]*api.CartItemResponse, 0),
+	}
+	var request []*api.ReserveSlotRequestBody
+	// validation items follow the order of the cart items
+	for i, item := range validation.Items {
+		if item.Availability != models.ItemAvailable {
+			res.Skipped = append(res.Skipped, item)
+			continue
+		}
+		request = append(request, &api.ReserveSlotRequestBody{
+			Placement: cart.Items[i].Placement,
+			Date:      models.JSONDate(*cart.Items[i].Date),
+			Position:  cart.Items[i].Position,
+		})
+		res.Booked = append(res.Booked, item)
+		res.Amount += *item.Cost
+	}
+	if len(request) == 0 || (len(res.Skipped) > 0 && !allowPartial) {
+		var unavailable []string
+		for _, item := range res.Skipped {
+			unavailable = append(unavailable, fmt.Sprintf("[placement: %s, date: %s, position: %d, availability: %s]", item.Placement, item.Date, item.Position, item.Availability))
+		}
+		return nil, nil, models.NewError(
+			fmt.Sprintf("%d of %d items in cart %s are not available: %s", len(res.Skipped), len(validation.Items), cart.ID, strings.Join(unavailable, ", ")),
+			models.ActionForbidden,
+		)
+	}
+	return request, res, nil
+}
+
+// ownCart returns the cart of the advertiser, the carts of others are forbidden
+func (s *service) ownCart(id, uid string) (*mysql.Cart, error) {
+	cart, err := s.rep.GetCart(id)
+	if err != nil {
+		return nil, err
+	}
+	if cart.Uid != uid {
+		return nil, models.NewError(fmt.Sprintf("Cart %s does not belong to %s", id, uid), models.ActionForbidden)
+	}
+	return cart, nil
+}
+
+func (s *service) openCart(id, uid string) (*mysql.Cart, error) {
+	cart, err := s.ownCart(id, uid)
+	if err != nil {
+		return nil, err
+	}
+	if cart.Status != models.CartStatusOpen {
+		return nil, models.NewError(fmt.Sprintf("Cart %s is %s", id, cart.Status), models.ActionForbidden)
+	}
+	return cart, nil
+}
+
+func (s *service) validateCart(cart *mysql.Cart) (*api.CartValidationResponse, error) {
+	res := &api.CartValidationResponse{
+		CartId:    cart.ID,
+		Available: len(cart.Items) > 0,
+		Items:     make([]*api.CartItemResponse, 0, len(cart.Items)),
+	}
+	for _, item := range cart.Items {
+		pos := models.Int32ToString(*item.Position)
+		slots, err := s.rep.SearchSlotsInRange(&mysql.GetOptions{
+			Placement:     item.Placement,
+			Start:         item.Date,
+			PositionStart: pos,
+			PositionEnd:   pos,
+		})
+		if err != nil {
+			return nil, err
+		}
+		itemRes := &api.CartItemResponse{
+			Placement:    item.Placement,
+			Date:         models.TimeToString(*item.Date),
+			Position:     *item.Position,
+			Availability: models.ItemNotFound,
+		}
+		if len(slots) > 0 {
+			itemRes.Availability = itemAvailability(*slots[0].Status)
+			itemRes.Cost = slots[0].Cost
+		}
+		if itemRes.Availability == models.ItemAvailable {
+			res.Amount += *itemRes.Cost
+		} else {
+			res.Available = false
+		}
+		res.Items = append(res.Items, itemRes)
+	}
+	return res, nil
+}
+
+func itemAvailability(slotStatus string) string {
+	switch slotStatus {
+	case models.SlotStatusOpen:
+		return models.ItemAvailable
+	case models.SlotStatusHold:
+		return models.ItemHeld
+	}
+	return slotStatus
+}
+
+func cartItems(id string, request []*api.ReserveSlotRequestBody) []*mysql.CartItem {
+	items := make([]*mysql.CartItem, 0, len(request))
+	for _, r := range request {
+		items = append(items, &mysql.CartItem{
+			CartID:    id,
+			Placement: placementID(r.Placement),
+			Date:      models.PtrDate(time.Time(r.Date)),
+			Position:  r.Position,
+		})
+	}
+	return items
+}
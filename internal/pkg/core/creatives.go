@@ -0,0 +1,330 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// supportedCreativeFormats are the formats creatives can be uploaded in,
+// images are checked by decoding their header, html and text must be UTF-8
+var supportedCreativeFormats = map[string]bool{
+	models.CreativeFormatPNG:  true,
+	models.CreativeFormatJPEG: true,
+	models.CreativeFormatGIF:  true,
+	models.CreativeFormatHTML: true,
+	models.CreativeFormatText: true,
+}
+
+// CreateCreative stores the uploaded content as a creative of the advertiser
+// named by the uid param, it waits for the review of an operator. Clicks on
+// it are redirected to the click_url param. The format
+// is taken from the content_type param and detected from the content when
+// it's missing or application/octet-stream
+func (s *service) CreateCreative(content io.Reader, params map[string]string) (*api.CreativeResponse, error) {
+	if s.conf.Blobs == nil {
+		return nil, models.NewError("CreateCreativeFailed:: No blob store is configured for creatives", models.InternalProcessingError)
+	}
+	uid := params["uid"]
+	if _, err := s.rep.GetAdvertiser(uid); err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(params["name"])
+	if name == "" || len(name) > 100 {
+		return nil, models.NewError("BadParameterValue: name must be 1 to 100 characters", models.DecodeFailureError)
+	}
+	clickURL := params["click_url"]
+	if clickURL != "" {
+		u, err := url.Parse(clickURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(clickURL) > 2048 {
+			return nil, models.NewError("BadParameterValue: click_url must be an absolute http(s) url", models.DecodeFailureError)
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(content, s.conf.CreativeMaxSize+1))
+	if err != nil {
+		return nil, models.NewError("ParsingError: Invalid request body provided", models.DecodeFailureError)
+	}
+	if len(data) == 0 {
+		return nil, models.NewError("BadParameterValue: creative cannot be empty", models.DecodeFailureError)
+	}
+	if int64(len(data)) > s.conf.CreativeMaxSize {
+		return nil, models.NewError(fmt.Sprintf("BadParameterValue: creative exceeds %d bytes", s.conf.CreativeMaxSize), models.DecodeFailureError)
+	}
+
+	creative := &mysql.Creative{
+		ID:           uuid.New().String(),
+		AdvertiserID: uid,
+		Name:         name,
+		ClickURL:     clickURL,
+		Size:         int64(len(data)),
+		Status:       models.CreativeStatusPending,
+	}
+	if creative.Format, err = creativeFormat(params["content_type"], data); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(creative.Format, "image/") {
+		config, kind, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || "image/"+kind != creative.Format {
+			return nil, models.NewError(fmt.Sprintf("BadParameterValue: creative is not a valid %s image", creative.Format), models.DecodeFailureError)
+		}
+		creative.Width = int32(config.Width)
+		creative.Height = int32(config.Height)
+	} else if !utf8.Valid(data) {
+		return nil, models.NewError(fmt.Sprintf("BadParameterValue: %s creatives must be UTF-8", creative.Format), models.DecodeFailureError)
+	}
+
+	creative.BlobKey = fmt.Sprintf("creatives/%s/%s", s.conf.Tenant, creative.ID)
+	if err = s.conf.Blobs.Put(creative.BlobKey, bytes.NewReader(data)); err != nil {
+		s.log.Errorf("CreateCreativeFailed:: [Id: %s, Error: %s]", creative.ID, err)
+		return nil, models.NewError("CreateCreativeFailed:: Internal server error", models.InternalProcessingError)
+	}
+	if _, err = s.rep.Create(creative); err != nil {
+		if err := s.conf.Blobs.Delete(creative.BlobKey); err != nil {
+			s.log.Errorf("DeleteCreativeBlobFailed:: [Key: %s, Error: %s]", creative.BlobKey, err)
+		}
+		return nil, err
+	}
+	res := creativeResponse(creative)
+	s.publish(models.EventCreativeSubmitted, res)
+	return res, nil
+}
+
+// GetCreatives lists the creatives, of one advertiser with the uid filter and
+// in one review state with the status filter
+func (s *service) GetCreatives(filters map[string]string) ([]*api.CreativeResponse, error) {
+	creatives, err := s.rep.Creatives(filters["uid"], filters["status"])
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.CreativeResponse, 0, len(creatives))
+	for _, creative := range creatives {
+		res = append(res, creativeResponse(creative))
+	}
+	return res, nil
+}
+
+func (s *service) GetCreative(id string) (*api.CreativeResponse, error) {
+	creative, err := s.rep.GetCreative(id)
+	if err != nil {
+		return nil, err
+	}
+	return creativeResponse(creative), nil
+}
+
+// CreativeContent opens the content of the creative, the caller closes it
+func (s *service) CreativeContent(id string) (io.ReadCloser, *api.CreativeResponse, error) {
+	if s.conf.Blobs == nil {
+		return nil, nil, models.NewError("CreativeContentFailed:: No blob store is configured for creatives", models.InternalProcessingError)
+	}
+	creative, err := s.rep.GetCreative(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := s.conf.Blobs.Open(creative.BlobKey)
+	if err != nil {
+		s.log.Errorf("CreativeContentFailed:: [Id: %s, Key: %s, Error: %s]", id, creative.BlobKey, err)
+		return nil, nil, models.NewError("CreativeContentFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return content, creativeResponse(creative), nil
+}
+
+// DeleteCreative removes a creative which is not attached to any slot
+func (s *service) DeleteCreative(id string) error {
+	creative, err := s.rep.GetCreative(id)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.rep.DeleteCreative(id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return models.NewError(fmt.Sprintf("Creative %s not found", id), models.ResourceNotFoundError)
+	}
+	if s.conf.Blobs != nil {
+		if err = s.conf.Blobs.Delete(creative.BlobKey); err != nil {
+			s.log.Errorf("DeleteCreativeBlobFailed:: [Key: %s, Error: %s]", creative.BlobKey, err)
+		}
+	}
+	return nil
+}
+
+// AttachCreatives attaches the creatives to the slots uid booked, or detaches
+// them for an empty creative_id. The creatives must belong to uid, must not be
+// rejected and fit the formats, size and dimensions of the placements of the
+// slots. All requests are checked before the creatives are attached in one
+// database transaction
+func (s *service) AttachCreatives(request []*api.AttachCreativeRequestBody, uid string) error {
+	placements := make(map[string]*mysql.Placement)
+	creatives := make(map[string]*mysql.Creative)
+	slots := make([]*mysql.Slot, 0, len(request))
+	for _, r := range request {
+		date := time.Time(r.Date)
+		pos := models.Int32ToString(*r.Position)
+		getOptions := &mysql.GetOptions{
+			Placement:     placementID(r.Placement),
+			Start:         &date,
+			PositionStart: pos,
+			PositionEnd:   pos,
+			Status:        models.SlotStatusBooked,
+			Uid:           uid,
+		}
+		slot, err := s.rep.SearchSlotsInRange(getOptions)
+		if err != nil {
+			return err
+		}
+		if len(slot) == 0 {
+			return models.NewError(
+				fmt.Sprintf("Slot with [placement: %s, date: %s, position: %d] is not booked by %s", getOptions.Placement, models.TimeToString(date), *r.Position, uid),
+				models.ActionForbidden,
+			)
+		}
+		slots = append(slots, slot[0])
+		if r.CreativeID == "" {
+			continue
+		}
+		creative, ok := creatives[r.CreativeID]
+		if !ok {
+			if creative, err = s.rep.GetCreative(r.CreativeID); err != nil {
+				return err
+			}
+			if creative.AdvertiserID != uid {
+				return models.NewError(fmt.Sprintf("Creative %s does not belong to %s", creative.ID, uid), models.ActionForbidden)
+			}
+			if creative.Status == models.CreativeStatusRejected {
+				return models.NewError(fmt.Sprintf("Creative %s was rejected: %s", creative.ID, creative.ReviewReason), models.ActionForbidden)
+			}
+			creatives[creative.ID] = creative
+		}
+		placement, ok := placements[getOptions.Placement]
+		if !ok {
+			if placement, err = s.rep.GetPlacement(getOptions.Placement); err != nil {
+				return err
+			}
+			placements[placement.ID] = placement
+		}
+		if err = checkCreativeFits(placement, creative); err != nil {
+			return err
+		}
+	}
+	creativeIDs := make([]*string, len(request))
+	for i, r := range request {
+		if r.CreativeID != "" {
+			creativeIDs[i] = models.PtrString(r.CreativeID)
+		}
+	}
+	return s.rep.AttachCreatives(slots, uid, creativeIDs)
+}
+
+// checkCreativeFits refuses creatives the placement doesn't accept
+func checkCreativeFits(placement *mysql.Placement, creative *mysql.Creative) error {
+	if formats := creativeFormats(placement); len(formats) > 0 {
+		accepted := false
+		for _, format := range formats {
+			accepted = accepted || format == creative.Format
+		}
+		if !accepted {
+			return models.NewError(
+				fmt.Sprintf("Placement %s accepts %s creatives, creative %s is %s", placement.ID, strings.Join(formats, ", "), creative.ID, creative.Format),
+				models.ActionForbidden,
+			)
+		}
+	}
+	if placement.CreativeMaxSize > 0 && creative.Size > placement.CreativeMaxSize {
+		return models.NewError(
+			fmt.Sprintf("Placement %s accepts creatives up to %d bytes, creative %s has %d", placement.ID, placement.CreativeMaxSize, creative.ID, creative.Size),
+			models.ActionForbidden,
+		)
+	}
+	if !strings.HasPrefix(creative.Format, "image/") {
+		return nil
+	}
+	if (placement.CreativeWidth > 0 && creative.Width != placement.CreativeWidth) ||
+		(placement.CreativeHeight > 0 && creative.Height != placement.CreativeHeight) {
+		return models.NewError(
+			fmt.Sprintf("Placement %s accepts images of %dx%d, creative %s is %dx%d",
+				placement.ID, placement.CreativeWidth, placement.CreativeHeight, creative.ID, creative.Width, creative.Height),
+			models.ActionForbidden,
+		)
+	}
+	return nil
+}
+
+// creativeFormat returns the supported format of the content, detecting it
+// when the content type is missing or generic
+func creativeFormat(contentType string, data []byte) (string, error) {
+	if contentType == "" || strings.HasPrefix(contentType, "application/octet-stream") {
+		contentType = http.DetectContentType(data)
+	}
+	format, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !supportedCreativeFormats[format] {
+		return "", models.NewError(fmt.Sprintf("BadParameterValue: unsupported creative format %q", contentType), models.DecodeFailureError)
+	}
+	return format, nil
+}
+
+// applyCreativeSpec sets the creatives the placement accepts
+func applyCreativeSpec(placement *mysql.Placement, spec *api.CreativeSpecBody) error {
+	if spec == nil {
+		spec = &api.CreativeSpecBody{}
+	}
+	for _, format := range spec.Formats {
+		if !supportedCreativeFormats[format] {
+			return models.NewError(fmt.Sprintf("BadParameterValue: unsupported creative format %q", format), models.DecodeFailureError)
+		}
+	}
+	if spec.MaxSize < 0 || spec.Width < 0 || spec.Height < 0 {
+		return models.NewError("BadParameterValue: creative max_size, width and height cannot be negative", models.DecodeFailureError)
+	}
+	placement.CreativeFormats = strings.Join(spec.Formats, ",")
+	placement.CreativeMaxSize = spec.MaxSize
+	placement.CreativeWidth = spec.Width
+	placement.CreativeHeight = spec.Height
+	return nil
+}
+
+func creativeFormats(placement *mysql.Placement) []string {
+	if placement.CreativeFormats == "" {
+		return nil
+	}
+	return strings.Split(placement.CreativeFormats, ",")
+}
+
+// creativeURL is the path serving the content of the creative
+func creativeURL(id string) string {
+	return "/creatives/" + id + "/content"
+}
+
+func creativeResponse(creative *mysql.Creative) *api.CreativeResponse {
+	return &api.CreativeResponse{
+		Id:           creative.ID,
+		AdvertiserId: creative.AdvertiserID,
+		Name:         creative.Name,
+		Format:       creative.Format,
+		Size:         creative.Size,
+		Width:        creative.Width,
+		Height:       creative.Height,
+		Url:          creativeURL(creative.ID),
+		ClickUrl:     creative.ClickURL,
+		Status:       creative.Status,
+		ReviewReason: creative.ReviewReason,
+		ReviewedBy:   creative.ReviewedBy,
+		ReviewedAt:   creative.ReviewedAt,
+	}
+}
@@ -1,3 +1,91 @@
 package core
 
+import (
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/blob"
+	"github.com/kiran-anand14/admgr/internal/pkg/events"
+)
+
 // Any constants which are needed by core package can be defined here.
+
+const (
+	DefaultHoldTTL          = 15 * time.Minute
+	DefaultWaitlistOfferTTL = 30 * time.Minute
+	// HoldConfirmTimeout is how long a hold can be confirming before its
+	// confirmation is taken as abandoned, e.g. by a crash
+	HoldConfirmTimeout = 10 * time.Minute
+	// checkoutAttempts bounds the reservations of a partial checkout which
+	// loses items to concurrent bookings
+	checkoutAttempts = 3
+	// exportRowGroupSize is the number of rows the parquet exports keep in
+	// memory per row group
+	exportRowGroupSize = 10000
+	// DefaultTemplateDaysAhead is how many days ahead templates generate slots
+	DefaultTemplateDaysAhead = 30
+	// DefaultCreativeMaxSize is the largest creative in bytes, placements can lower it
+	DefaultCreativeMaxSize = 5 << 20
+	// DefaultCreativeReviewCutoff is how long before their start booked slots
+	// need an approved creative
+	DefaultCreativeReviewCutoff = 24 * time.Hour
+	// DefaultServeCacheTTL bounds how long serving misses the changes of other instances
+	DefaultServeCacheTTL = time.Minute
+	// DefaultTrackingURLTTL is how long the served tracking urls are counted
+	DefaultTrackingURLTTL = time.Hour
+	// DefaultSlotRetention keeps the deleted slots for a month
+	DefaultSlotRetention = 30 * 24 * time.Hour
+)
+
+// Waits between the attempts to revert the failed reservations at startup
+const (
+	revertMinBackoff = time.Second
+	revertMaxBackoff = 5 * time.Minute
+)
+
+// weekdays are the short names used by template rules
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Config holds the settings of the core service, zero values fall back to the defaults
+type Config struct {
+	HoldTTL time.Duration
+	// WaitlistOfferTTL is how long a waitlisted advertiser holds an opened slot
+	WaitlistOfferTTL time.Duration
+	// TemplateDaysAhead is how many days ahead inventory templates generate slots
+	TemplateDaysAhead int
+	// AuctionPricing is the default pricing of auctions, first or second price
+	AuctionPricing string
+	// Events receives the notifications, they are logged when nil
+	Events events.Publisher
+	// Operators are the uids which can book restricted calendar days and
+	// review creatives
+	Operators []string
+	// Tenant is the tenant the service works for, it is added to the events
+	Tenant string
+	// Blobs stores the content of the creatives, uploads are refused when nil
+	Blobs blob.Store
+	// CreativeMaxSize is the largest creative in bytes
+	CreativeMaxSize int64
+	// CreativeReviewCutoff is how long before their start booked slots are
+	// flagged when their creative isn't approved
+	CreativeReviewCutoff time.Duration
+	// HouseAdFallback serves the house ad of the placement for flagged slots
+	HouseAdFallback bool
+	// ServeCacheTTL is how long the serving cache keeps a day, the changes
+	// made through this instance clear it right away
+	ServeCacheTTL time.Duration
+	// TrackingSecret signs the tracking urls, so that their counts cannot be forged
+	TrackingSecret string
+	// TrackingURLTTL is how long the served tracking urls are counted, later
+	// requests of them are refused
+	TrackingURLTTL time.Duration
+	// SlotRetention is how long deleted slots can be restored before they are purged
+	SlotRetention time.Duration
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// RestoreSlots brings back the deleted slots of the requests. As for created
+// slots, a restored position must follow an existing or restored position of
+// its time window. The uid must name an operator
+func (s *service) RestoreSlots(reqBody []*api.DeleteSlotRequestBody, uid string) (int, error) {
+	if !s.isOperator(uid) {
+		return 0, models.NewError(fmt.Sprintf("%s is not allowed to restore slots", uid), models.ActionForbidden)
+	}
+	var slots []*mysql.Slot
+	restoring := make(map[string]bool)
+	for _, req := range reqBody {
+		startDate := time.Time(req.StartDate)
+		endDate := time.Time(req.EndDate)
+		if startDate.After(endDate) {
+			return 0, models.NewError(
+				fmt.Sprintf("start_date[%s] cannot be greater than end_date[%s]", models.DateToString(startDate), models.DateToString(endDate)),
+				models.DecodeFailureError,
+			)
+		}
+		placement, err := s.placement(req.Placement)
+		if err != nil {
+			return 0, err
+		}
+		if placement.MaxPositions > 0 && req.Position[1] > placement.MaxPositions {
+			return 0, models.NewError(
+				fmt.Sprintf("BadParameterValue: position %d exceeds the %d positions of placement %s", req.Position[1], placement.MaxPositions, placement.ID),
+				models.DecodeFailureError,
+			)
+		}
+		deleted, err := s.rep.SearchSlotsInRange(&mysql.GetOptions{
+			Placement:     placement.ID,
+			StartDate:     startDate,
+			EndDate:       endDate,
+			PositionStart: models.Int32ToString(req.Position[0]),
+			PositionEnd:   models.Int32ToString(req.Position[1]),
+			Query:         "deleted_at IS NOT NULL",
+			WithDeleted:   true,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if len(deleted) == 0 {
+			return 0, models.NewError(
+				fmt.Sprintf("deleted records not found with [start_date: %s, end_date: %s]", models.DateToString(startDate), models.DateToString(endDate)),
+				models.DetailedResourceInfoNotFound,
+			)
+		}
+		for _, slot := range deleted {
+			restoring[slotKey(slot.Placement, *slot.Date, *slot.Position)] = true
+		}
+		slots = append(slots, deleted...)
+	}
+	for _, slot := range slots {
+		preceding := *slot.Position - 1
+		if preceding < 1 || restoring[slotKey(slot.Placement, *slot.Date, preceding)] {
+			continue
+		}
+		pos := models.Int32ToString(preceding)
+		preSlots, err := s.rep.SearchSlotsInRange(&mysql.GetOptions{
+			Placement:     slot.Placement,
+			Start:         slot.Date,
+			PositionStart: pos,
+			PositionEnd:   pos,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if len(preSlots) == 0 {
+			return 0, models.NewError(
+				fmt.Sprintf("Cannot restore position %d of %s, record with position '%d' doesn't exist", *slot.Position, models.TimeToString(*slot.Date), preceding),
+				models.ActionForbidden,
+			)
+		}
+	}
+	return s.rep.RestoreSlots(slots)
+}
+
+// PurgeDeletedSlots removes the slots deleted longer than the retention ago for good
+func (s *service) PurgeDeletedSlots() (int, error) {
+	return s.rep.PurgeDeletedSlots(time.Now().Add(-s.conf.SlotRetention))
+}
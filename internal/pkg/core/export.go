@@ -0,0 +1,279 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/pqarrow"
+	"github.com/sirupsen/logrus"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// exportSchema holds the columns of the exports, in the order of the csv and
+// parquet columns. The nullable columns are optional in parquet
+var exportSchema = arrow.NewSchema([]arrow.Field{
+	{Name: "placement", Type: arrow.BinaryTypes.String},
+	{Name: "date", Type: arrow.FixedWidthTypes.Timestamp_ms},
+	{Name: "ends_at", Type: arrow.FixedWidthTypes.Timestamp_ms, Nullable: true},
+	{Name: "position", Type: arrow.PrimitiveTypes.Int32},
+	{Name: "status", Type: arrow.BinaryTypes.String},
+	{Name: "cost", Type: arrow.PrimitiveTypes.Float64},
+	{Name: "txnid", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "provider", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "campaign_id", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "booked_by", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "booked_date", Type: arrow.FixedWidthTypes.Timestamp_ms, Nullable: true},
+	{Name: "creative_id", Type: arrow.BinaryTypes.String, Nullable: true},
+}, nil)
+
+// Exporter writes the slots with the transactions of their bookings, they
+// are streamed from the storage so that exports of any size fit in memory
+type Exporter struct {
+	log *logrus.Logger
+	rep Repository
+}
+
+func NewExporter(r Repository, log *logrus.Logger) *Exporter {
+	return &Exporter{log: log, rep: r}
+}
+
+// exportWriter writes the rows of an export in a format
+type exportWriter interface {
+	write(row *mysql.BookingRow) error
+	close() error
+}
+
+// ExportOptions reads the range (start_date and end_date), the placement and
+// the comma separated statuses of an export
+func ExportOptions(params map[string]string) (*mysql.ExportOptions, error) {
+	start, err := models.ParseTime(params["start_date"])
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("start_date: %s decode failed", params["start_date"]), models.DecodeFailureError)
+	}
+	end, err := models.ParseTime(params["end_date"])
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("end_date: %s decode failed", params["end_date"]), models.DecodeFailureError)
+	}
+	if start.After(end) {
+		return nil, models.NewError(fmt.Sprintf("start_date[%s] cannot be greater than end_date[%s]", models.TimeToString(start), models.TimeToString(end)), models.DecodeFailureError)
+	}
+	opts := &mysql.ExportOptions{Placement: params["placement"], Start: start, End: models.EndOfRange(end)}
+	if params["status"] != "" {
+		for _, status := range strings.Split(params["status"], ",") {
+			status = strings.TrimSpace(status)
+			switch status {
+			case models.SlotStatusOpen, models.SlotStatusClosed, models.SlotStatusHold, models.SlotStatusBooked, models.SlotStatusAuction:
+				opts.Statuses = append(opts.Statuses, status)
+			default:
+				return nil, models.NewError(fmt.Sprintf("status: invalid status '%s'", status), models.DecodeFailureError)
+			}
+		}
+	}
+	return opts, nil
+}
+
+// Export writes the slots of the options in the format, csv, ndjson or
+// parquet, and returns the number of rows. Nothing is written before the
+// first row is read, so that failing queries leave w untouched
+func (e *Exporter) Export(w io.Writer, format string, opts *mysql.ExportOptions) (int, error) {
+	if format != models.ExportFormatCSV && format != models.ExportFormatNDJSON && format != models.ExportFormatParquet {
+		return 0, models.NewError(fmt.Sprintf("format: %s must be %s, %s or %s", format, models.ExportFormatCSV, models.ExportFormatNDJSON, models.ExportFormatParquet), models.DecodeFailureError)
+	}
+	var out exportWriter
+	rows := 0
+	err := e.rep.EachBooking(opts, func(row *mysql.BookingRow) error {
+		if out == nil {
+			var err error
+			if out, err = newExportWriter(w, format); err != nil {
+				return err
+			}
+		}
+		rows++
+		return out.write(row)
+	})
+	if err != nil {
+		return rows, err
+	}
+	if out == nil {
+		if out, err = newExportWriter(w, format); err != nil {
+			return 0, err
+		}
+	}
+	if err = out.close(); err != nil {
+		return rows, err
+	}
+	e.log.Infof("Export:: [Format: %s, Start: %s, End: %s, Rows: %d]", format, models.TimeToString(opts.Start), models.TimeToString(opts.End), rows)
+	return rows, nil
+}
+
+// ExportSlots writes the slots and bookings selected by the params on behalf
+// of the operator uid
+func (s *service) ExportSlots(w io.Writer, params map[string]string) (int, error) {
+	if !s.isOperator(params["uid"]) {
+		return 0, models.NewError(fmt.Sprintf("%s is not allowed to export bookings", params["uid"]), models.ActionForbidden)
+	}
+	opts, err := ExportOptions(params)
+	if err != nil {
+		return 0, err
+	}
+	return NewExporter(s.rep, s.log).Export(w, params["format"], opts)
+}
+
+func newExportWriter(w io.Writer, format string) (exportWriter, error) {
+	switch format {
+	case models.ExportFormatNDJSON:
+		return &ndjsonExport{enc: json.NewEncoder(w)}, nil
+	case models.ExportFormatParquet:
+		return newParquetExport(w)
+	default:
+		return newCSVExport(w), nil
+	}
+}
+
+type csvExport struct {
+	w *csv.Writer
+}
+
+func newCSVExport(w io.Writer) *csvExport {
+	e := &csvExport{w: csv.NewWriter(w)}
+	header := make([]string, 0, len(exportSchema.Fields()))
+	for _, f := range exportSchema.Fields() {
+		header = append(header, f.Name)
+	}
+	e.w.Write(header)
+	return e
+}
+
+func (e *csvExport) write(row *mysql.BookingRow) error {
+	r := bookingExportRow(row)
+	return e.w.Write([]string{
+		r.Placement, r.Date, r.EndsAt, models.Int32ToString(r.Position), r.Status, strconv.FormatFloat(r.Cost, 'f', 2, 64),
+		r.Txnid, r.Provider, r.CampaignId, r.BookedBy, r.BookedDate, r.CreativeId,
+	})
+}
+
+func (e *csvExport) close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonExport struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExport) write(row *mysql.BookingRow) error {
+	return e.enc.Encode(bookingExportRow(row))
+}
+
+func (e *ndjsonExport) close() error {
+	return nil
+}
+
+// parquetExport builds the rows of a row group in memory and writes them
+// once the row group is full
+type parquetExport struct {
+	w    *pqarrow.FileWriter
+	b    *array.RecordBuilder
+	rows int
+}
+
+func newParquetExport(w io.Writer) (*parquetExport, error) {
+	props := parquet.NewWriterProperties(parquet.WithMaxRowGroupLength(exportRowGroupSize))
+	// the writer closes its sink, which belongs to the caller
+	fw, err := pqarrow.NewFileWriter(exportSchema, struct{ io.Writer }{w}, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("ExportFailed:: %s", err), models.InternalProcessingError)
+	}
+	return &parquetExport{w: fw, b: array.NewRecordBuilder(memory.DefaultAllocator, exportSchema)}, nil
+}
+
+func (e *parquetExport) write(row *mysql.BookingRow) error {
+	e.b.Field(0).(*array.StringBuilder).Append(row.Placement)
+	e.b.Field(1).(*array.TimestampBuilder).Append(arrow.Timestamp(row.Date.UnixMilli()))
+	appendTime(e.b.Field(2), row.EndsAt)
+	e.b.Field(3).(*array.Int32Builder).Append(row.Position)
+	e.b.Field(4).(*array.StringBuilder).Append(row.Status)
+	e.b.Field(5).(*array.Float64Builder).Append(row.Cost)
+	appendString(e.b.Field(6), row.Txnid)
+	appendString(e.b.Field(7), row.Provider)
+	appendString(e.b.Field(8), row.CampaignID)
+	appendString(e.b.Field(9), row.BookedBy)
+	appendTime(e.b.Field(10), row.BookedDate)
+	appendString(e.b.Field(11), row.CreativeID)
+	if e.rows++; e.rows == exportRowGroupSize {
+		return e.flush()
+	}
+	return nil
+}
+
+// flush writes the built rows as a row group
+func (e *parquetExport) flush() error {
+	rec := e.b.NewRecord()
+	defer rec.Release()
+	e.rows = 0
+	return e.w.Write(rec)
+}
+
+func (e *parquetExport) close() error {
+	defer e.b.Release()
+	if e.rows > 0 {
+		if err := e.flush(); err != nil {
+			return err
+		}
+	}
+	return e.w.Close()
+}
+
+// bookingExportRow formats the times of the row in RFC3339 in the business
+// time zone
+func bookingExportRow(row *mysql.BookingRow) *api.BookingExportRow {
+	r := &api.BookingExportRow{
+		Placement:  row.Placement,
+		Date:       row.Date.In(models.Location()).Format(time.RFC3339),
+		Position:   row.Position,
+		Status:     row.Status,
+		Cost:       row.Cost,
+		Txnid:      models.StringValue(row.Txnid),
+		Provider:   models.StringValue(row.Provider),
+		CampaignId: models.StringValue(row.CampaignID),
+		BookedBy:   models.StringValue(row.BookedBy),
+		CreativeId: models.StringValue(row.CreativeID),
+	}
+	if row.EndsAt != nil {
+		r.EndsAt = row.EndsAt.In(models.Location()).Format(time.RFC3339)
+	}
+	if row.BookedDate != nil {
+		r.BookedDate = row.BookedDate.In(models.Location()).Format(time.RFC3339)
+	}
+	return r
+}
+
+// appendString and appendTime append null for the missing values of
+// optional parquet columns
+func appendString(b array.Builder, v *string) {
+	if v == nil {
+		b.AppendNull()
+		return
+	}
+	b.(*array.StringBuilder).Append(*v)
+}
+
+func appendTime(b array.Builder, v *time.Time) {
+	if v == nil {
+		b.AppendNull()
+		return
+	}
+	b.(*array.TimestampBuilder).Append(arrow.Timestamp(v.UnixMilli()))
+}
@@ -0,0 +1,275 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// CreateHold puts the requested slots on hold for the advertiser until the
+// hold is confirmed, released or expires after the configured TTL
+func (s *service) CreateHold(holdRequest []*api.ReserveSlotRequestBody, uid string) (*api.HoldResponse, error) {
+	hold, err := s.createHold(holdRequest, uid, s.conf.HoldTTL)
+	if err != nil {
+		return nil, err
+	}
+	return s.holdResponse(hold)
+}
+
+func (s *service) createHold(holdRequest []*api.ReserveSlotRequestBody, uid string, ttl time.Duration) (*mysql.Hold, error) {
+	providerName, err := s.pay.ProviderFor(uid)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkBookable(uid, requestDates(holdRequest)...); err != nil {
+		return nil, err
+	}
+	hold := &mysql.Hold{
+		ID:        uuid.New().String(),
+		Uid:       uid,
+		Status:    models.HoldStatusActive,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	var transactions []*mysql.Transaction
+	for _, r := range holdRequest {
+		transactions = append(transactions, &mysql.Transaction{
+			Txnid:     hold.ID,
+			Placement: placementID(r.Placement),
+			Date:      models.PtrDate(time.Time(r.Date)),
+			Position:  r.Position,
+			Provider:  models.PtrString(providerName),
+		})
+	}
+	if err = s.rep.CreateHold(hold, transactions); err != nil {
+		return nil, err
+	}
+	s.log.Infof("Hold %s created for %s on %d slots until %s", hold.ID, uid, len(transactions), hold.ExpiresAt.Format(time.RFC3339))
+	return hold, nil
+}
+
+func (s *service) GetHold(id string) (*api.HoldResponse, error) {
+	hold, err := s.rep.GetHold(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.holdResponse(hold)
+}
+
+// ConfirmHold debits the advertiser and books the held slots, the hold stays
+// active when the debit fails so that it can be confirmed again until it expires.
+// When the debit may have been taken the hold stays confirming, ExpireHolds
+// settles it with the provider once the confirmation times out
+func (s *service) ConfirmHold(id, uid string) (*api.HoldResponse, error) {
+	hold, err := s.rep.GetHold(id)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Uid != uid {
+		return nil, models.NewError(fmt.Sprintf("Hold %s does not belong to %s", id, uid), models.ActionForbidden)
+	}
+	if hold.Status != models.HoldStatusActive || !hold.ExpiresAt.After(time.Now()) {
+		return nil, models.NewError(fmt.Sprintf("Hold %s is %s and cannot be confirmed", id, holdStatus(hold)), models.ActionForbidden)
+	}
+	// moving to confirming keeps the expiry job away while the debit is in flight
+	ok, err := s.rep.UpdateHoldStatus(id, models.HoldStatusActive, models.HoldStatusConfirming)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, models.NewError(fmt.Sprintf("Hold %s is no longer active", id), models.ActionForbidden)
+	}
+
+	provider, err := s.bookHold(hold)
+	if err != nil {
+		if debitUncertain(err) {
+			s.log.Errorf("ConfirmHold:: debit of hold %s may have been taken, leaving it to be settled [Error: %s]", id, err)
+			return nil, err
+		}
+		if _, rErr := s.rep.UpdateHoldStatus(id, models.HoldStatusConfirming, models.HoldStatusActive); rErr != nil {
+			s.log.Errorf("ConfirmHold:: failed to reactivate hold %s [Error: %s]", id, rErr)
+		}
+		return nil, err
+	}
+	if _, err = s.rep.UpdateHoldStatus(id, models.HoldStatusConfirming, models.HoldStatusConfirmed); err != nil {
+		return nil, err
+	}
+	hold.Status = models.HoldStatusConfirmed
+	s.log.Infof("Hold %s confirmed through %s", id, provider)
+	return s.holdResponse(hold)
+}
+
+// debitUncertain reports whether a failed debit may still have been taken,
+// which is the case when the provider got the request but didn't answer it
+func debitUncertain(err error) bool {
+	mErr, ok := err.(*models.Error)
+	return ok && mErr.Type == models.DependentServiceRequestFailed && err != accounting.ErrCircuitOpen
+}
+
+// bookHold charges the advertiser for the held slots and books them through
+// the provider chosen when the hold was created
+func (s *service) bookHold(hold *mysql.Hold) (string, error) {
+	slots, err := s.rep.SlotsByTxnid(hold.ID)
+	if err != nil {
+		return "", err
+	}
+	if len(slots) == 0 {
+		return "", models.NewError(fmt.Sprintf("Slots of hold %s not found", hold.ID), models.InternalProcessingError)
+	}
+	providerName := transactionProvider(slots[0].Transaction)
+	provider, err := s.pay.Get(providerName)
+	if err != nil {
+		return "", err
+	}
+	for _, slot := range slots {
+		slot.BookedBy = models.PtrString(hold.Uid)
+		slot.BookedDate = models.PtrDate(time.Now())
+		slot.Status = models.PtrString(models.SlotStatusBooked)
+		slot.Transaction = nil
+	}
+	return providerName, s.chargeAndBook(provider, slots, hold.Uid, hold.ID)
+}
+
+func (s *service) ReleaseHold(id, uid string) error {
+	hold, err := s.rep.GetHold(id)
+	if err != nil {
+		return err
+	}
+	if hold.Uid != uid {
+		return models.NewError(fmt.Sprintf("Hold %s does not belong to %s", id, uid), models.ActionForbidden)
+	}
+	released, err := s.rep.ReleaseHold(id, models.HoldStatusReleased)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return models.NewError(fmt.Sprintf("Hold %s is %s and cannot be released", id, holdStatus(hold)), models.ActionForbidden)
+	}
+	s.log.Infof("Hold %s released", id)
+	s.offerOpenedSlots()
+	return nil
+}
+
+// ExpireHolds releases the active holds past their expiry and settles the
+// holds whose confirmation was abandoned
+func (s *service) ExpireHolds() (int, error) {
+	now := time.Now()
+	holds, err := s.rep.ExpiredHolds(now, now.Add(-HoldConfirmTimeout))
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, hold := range holds {
+		var released bool
+		if hold.Status == models.HoldStatusConfirming {
+			released, err = s.settleConfirmation(hold)
+		} else {
+			released, err = s.rep.ReleaseHold(hold.ID, models.HoldStatusExpired)
+		}
+		if err != nil {
+			return expired, err
+		}
+		if released {
+			expired++
+		}
+	}
+	if expired > 0 {
+		s.log.Infof("Total %d holds expired", expired)
+		s.offerOpenedSlots()
+	}
+	return expired, nil
+}
+
+// settleConfirmation settles a hold whose confirmation was abandoned. The
+// held slots are booked when the provider debited the hold, it expires
+// otherwise. It returns whether the hold was released
+func (s *service) settleConfirmation(hold *mysql.Hold) (bool, error) {
+	slots, err := s.rep.SlotsByTxnid(hold.ID)
+	if err != nil {
+		return false, err
+	}
+	var debits []*accounting.AccountingStatusResponse
+	if len(slots) > 0 {
+		provider, err := s.pay.Get(transactionProvider(slots[0].Transaction))
+		if err != nil {
+			return false, err
+		}
+		if debits, err = provider.Status([]string{hold.ID}); err != nil {
+			return false, err
+		}
+	}
+	var debit *accounting.AccountingStatusResponse
+	for _, d := range debits {
+		if d.DebitedAmount() >= 0.01 {
+			debit = d
+		}
+	}
+	if debit == nil {
+		if _, err = s.rep.UpdateHoldStatus(hold.ID, models.HoldStatusConfirming, models.HoldStatusActive); err != nil {
+			return false, err
+		}
+		return s.rep.ReleaseHold(hold.ID, models.HoldStatusExpired)
+	}
+	var held []*mysql.Slot
+	for _, slot := range slots {
+		if *slot.Status != models.SlotStatusHold {
+			continue
+		}
+		slot.Status = models.PtrString(models.SlotStatusBooked)
+		slot.BookedBy = models.PtrString(hold.Uid)
+		slot.BookedDate = models.PtrDate(debit.Created)
+		slot.Transaction = nil
+		held = append(held, slot)
+	}
+	if len(held) > 0 {
+		if _, err = s.rep.UpdateSlots(held); err != nil {
+			return false, err
+		}
+	}
+	if _, err = s.rep.UpdateHoldStatus(hold.ID, models.HoldStatusConfirming, models.HoldStatusConfirmed); err != nil {
+		return false, err
+	}
+	s.log.Infof("Hold %s confirmed, its confirmation was abandoned after the debit", hold.ID)
+	return false, nil
+}
+
+func (s *service) holdResponse(hold *mysql.Hold) (*api.HoldResponse, error) {
+	res := &api.HoldResponse{
+		HoldId:    hold.ID,
+		Uid:       hold.Uid,
+		Status:    holdStatus(hold),
+		ExpiresAt: hold.ExpiresAt,
+		Slots:     make([]*api.HoldSlotResponse, 0),
+	}
+	// released and expired holds no longer own their slots
+	if hold.Status != models.HoldStatusActive && hold.Status != models.HoldStatusConfirmed {
+		return res, nil
+	}
+	slots, err := s.rep.SlotsByTxnid(hold.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range slots {
+		res.Slots = append(res.Slots, &api.HoldSlotResponse{
+			Placement: slot.Placement,
+			Date:      models.TimeToString(*slot.Date),
+			Position:  *slot.Position,
+			Cost:      *slot.Cost,
+		})
+		res.Amount += *slot.Cost
+	}
+	return res, nil
+}
+
+// holdStatus reports active holds past their expiry as expired, before the
+// expiry job gets to them
+func holdStatus(hold *mysql.Hold) string {
+	if hold.Status == models.HoldStatusActive && !hold.ExpiresAt.After(time.Now()) {
+		return models.HoldStatusExpired
+	}
+	return hold.Status
+}
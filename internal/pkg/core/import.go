@@ -0,0 +1,284 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/sheet"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+const (
+	// maxImportSize bounds the size of an imported spreadsheet in bytes
+	maxImportSize = 10 << 20
+	// maxImportRows bounds the rows of an imported spreadsheet
+	maxImportRows = 10000
+)
+
+// excelEpoch is day zero of the serial dates of spreadsheets
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// importRow is a row of an imported spreadsheet with the slots it creates
+type importRow struct {
+	line  int
+	req   *api.CreateSlotRequestBody
+	slots []*mysql.Slot
+}
+
+// ImportSlots creates the slots of the rows of a CSV or XLSX spreadsheet,
+// whose header names the date, position and cost columns and optionally the
+// placement column. Every row is checked like a request to CreateSlots, the
+// rows may follow the positions of each other. Nothing is created in a dry
+// run, the slots of the valid rows are created in one transaction, unless
+// the import is atomic, which it is by default, and a row is invalid
+func (s *service) ImportSlots(file io.Reader, params map[string]string) (*api.SlotImportResponse, error) {
+	format, err := importFormat(params)
+	if err != nil {
+		return nil, err
+	}
+	dryRun := params["dry_run"] == "true"
+	atomic := params["atomic"] != "false"
+	data, err := io.ReadAll(io.LimitReader(file, maxImportSize+1))
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("ParsingError: failed to read the %s file, %s", format, err), models.DecodeFailureError)
+	}
+	if len(data) > maxImportSize {
+		return nil, models.NewError(fmt.Sprintf("BadParameterValue: the file is larger than %d bytes", maxImportSize), models.DecodeFailureError)
+	}
+	lines, err := sheet.Read(bytes.NewReader(data), format)
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("ParsingError: invalid %s file, %s", format, err), models.DecodeFailureError)
+	}
+	header := 0
+	for header < len(lines) && isEmptyRow(lines[header]) {
+		header++
+	}
+	if header == len(lines) {
+		return nil, models.NewError("ParsingError: the file has no header row", models.DecodeFailureError)
+	}
+	columns := make(map[string]int)
+	for i, name := range lines[header] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "position", "cost"} {
+		if _, ok := columns[name]; !ok {
+			return nil, models.NewError(fmt.Sprintf("ParsingError: the header has no %s column", name), models.DecodeFailureError)
+		}
+	}
+	if len(lines)-header-1 > maxImportRows {
+		return nil, models.NewError(fmt.Sprintf("BadParameterValue: the file has more than %d rows", maxImportRows), models.DecodeFailureError)
+	}
+
+	res := &api.SlotImportResponse{DryRun: dryRun, Errors: []*api.SlotImportError{}}
+	var rows []*importRow
+	for i := header + 1; i < len(lines); i++ {
+		if isEmptyRow(lines[i]) {
+			continue
+		}
+		res.Rows++
+		req, err := importRequest(lines[i], columns, params["placement"])
+		if err == nil {
+			err = api.ValidateWithTags(req, "")
+		}
+		if err != nil {
+			res.Errors = append(res.Errors, &api.SlotImportError{Row: i + 1, Error: err.Error()})
+			continue
+		}
+		rows = append(rows, &importRow{line: i + 1, req: req})
+	}
+
+	// the rows are checked by position, so that they can follow the rows
+	// before them whatever their order in the file
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i].req, rows[j].req
+		if a.Placement != b.Placement {
+			return a.Placement < b.Placement
+		}
+		if !time.Time(a.StartDate).Equal(time.Time(b.StartDate)) {
+			return time.Time(a.StartDate).Before(time.Time(b.StartDate))
+		}
+		return a.Position[0] < b.Position[0]
+	})
+	preceding := make(map[string]bool)
+	lineOf := make(map[string]int)
+	var valid []*importRow
+	for _, row := range rows {
+		slots, err := s.newSlots(row.req, preceding)
+		if err == nil {
+			err = duplicateSlots(slots, lineOf)
+		}
+		if err != nil {
+			res.Errors = append(res.Errors, &api.SlotImportError{Row: row.line, Error: err.Error()})
+			continue
+		}
+		for _, slot := range slots {
+			key := slotKey(slot.Placement, *slot.Date, *slot.Position)
+			preceding[key] = true
+			lineOf[key] = row.line
+		}
+		row.slots = slots
+		valid = append(valid, row)
+	}
+	valid, err = s.skipExistingRows(valid, res)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res.Errors, func(i, j int) bool { return res.Errors[i].Row < res.Errors[j].Row })
+
+	var slots []*mysql.Slot
+	for _, row := range valid {
+		slots = append(slots, row.slots...)
+	}
+	res.Slots = len(slots)
+	if dryRun || (atomic && len(res.Errors) > 0) || len(slots) == 0 {
+		return res, nil
+	}
+	if res.Created, err = s.rep.Create(slots); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// skipExistingRows reports the rows with slots which already exist and
+// returns the others
+func (s *service) skipExistingRows(rows []*importRow, res *api.SlotImportResponse) ([]*importRow, error) {
+	ranges := make(map[string][2]time.Time)
+	for _, row := range rows {
+		for _, slot := range row.slots {
+			r, ok := ranges[slot.Placement]
+			if !ok || slot.Date.Before(r[0]) {
+				r[0] = *slot.Date
+			}
+			if !ok || slot.Date.After(r[1]) {
+				r[1] = *slot.Date
+			}
+			ranges[slot.Placement] = r
+		}
+	}
+	existing := make(map[string]bool)
+	for placement, r := range ranges {
+		slots, err := s.rep.SearchSlotsInRange(&mysql.GetOptions{Placement: placement, StartDate: r[0], EndDate: r[1]})
+		if err != nil {
+			return nil, err
+		}
+		for _, slot := range slots {
+			existing[slotKey(slot.Placement, *slot.Date, *slot.Position)] = true
+		}
+	}
+	var valid []*importRow
+	for _, row := range rows {
+		var err error
+		for _, slot := range row.slots {
+			if existing[slotKey(slot.Placement, *slot.Date, *slot.Position)] {
+				err = fmt.Errorf("slot of placement %s at %s position %d already exists", slot.Placement, models.TimeToString(*slot.Date), *slot.Position)
+				break
+			}
+		}
+		if err != nil {
+			res.Errors = append(res.Errors, &api.SlotImportError{Row: row.line, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, row)
+	}
+	return valid, nil
+}
+
+func duplicateSlots(slots []*mysql.Slot, lineOf map[string]int) error {
+	for _, slot := range slots {
+		if line, ok := lineOf[slotKey(slot.Placement, *slot.Date, *slot.Position)]; ok {
+			return fmt.Errorf("position %d at %s is already in row %d", *slot.Position, models.TimeToString(*slot.Date), line)
+		}
+	}
+	return nil
+}
+
+// importRequest reads the request to create slots of a row, the position is
+// a number or a range like 1-3
+func importRequest(row []string, columns map[string]int, placement string) (*api.CreateSlotRequestBody, error) {
+	cell := func(name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+	if p := cell("placement"); p != "" {
+		placement = p
+	}
+	date, err := parseImportDate(cell("date"))
+	if err != nil {
+		return nil, fmt.Errorf("date: '%s' must be a date like 2023-05-04", cell("date"))
+	}
+	position := cell("position")
+	first, last, isRange := strings.Cut(position, "-")
+	if !isRange {
+		last = first
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 32)
+	if err != nil || start < 1 {
+		return nil, fmt.Errorf("position: '%s' must be a position or a range of positions like 1-3", position)
+	}
+	end, err := strconv.ParseInt(strings.TrimSpace(last), 10, 32)
+	if err != nil || end < start {
+		return nil, fmt.Errorf("position: '%s' must be a position or a range of positions like 1-3", position)
+	}
+	cost, err := strconv.ParseFloat(cell("cost"), 64)
+	if err != nil || cost < 0 {
+		return nil, fmt.Errorf("cost: '%s' must be a number not less than 0", cell("cost"))
+	}
+	return &api.CreateSlotRequestBody{
+		Placement: placement,
+		StartDate: models.JSONDate(date),
+		EndDate:   models.JSONDate(date),
+		Position:  []int32{int32(start), int32(end)},
+		Cost:      &cost,
+	}, nil
+}
+
+// parseImportDate reads a date, or the serial number spreadsheets store
+// dates as
+func parseImportDate(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, models.Location()); err == nil {
+		return t, nil
+	}
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil || serial < 1 {
+		return time.Time{}, fmt.Errorf("invalid date %s", value)
+	}
+	date := excelEpoch.AddDate(0, 0, int(serial))
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, models.Location()), nil
+}
+
+// importFormat returns the format of the spreadsheet from the format param,
+// or else from its content type
+func importFormat(params map[string]string) (string, error) {
+	format := params["format"]
+	if format == "" {
+		switch params["content_type"] {
+		case "text/csv", "application/csv":
+			format = sheet.FormatCSV
+		case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+			format = sheet.FormatXLSX
+		}
+	}
+	if format != sheet.FormatCSV && format != sheet.FormatXLSX {
+		return "", models.NewError(fmt.Sprintf("BadParameterValue: format must be %s or %s", sheet.FormatCSV, sheet.FormatXLSX), models.DecodeFailureError)
+	}
+	return format, nil
+}
+
+func isEmptyRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,21 @@
+package core
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Schedule runs job every interval in the background, failures are logged
+// and the job runs again on the next tick
+func Schedule(log *logrus.Logger, name string, interval time.Duration, job func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := job(); err != nil {
+				log.Errorf("%sJobFailed:: %s", name, err)
+			}
+		}
+	}()
+}
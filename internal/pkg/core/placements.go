@@ -0,0 +1,251 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+var placementIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+func (s *service) CreatePlacement(reqBody *api.PlacementRequestBody) (*api.PlacementResponse, error) {
+	if !placementIDPattern.MatchString(reqBody.Id) {
+		return nil, models.NewError("BadParameterValue: id must be up to 64 lower case letters, digits, '-' or '_'", models.DecodeFailureError)
+	}
+	placement := &mysql.Placement{ID: reqBody.Id}
+	if err := applyPlacementRequest(placement, reqBody); err != nil {
+		return nil, err
+	}
+	if err := s.checkHouseCreative(placement); err != nil {
+		return nil, err
+	}
+	if _, err := s.rep.Create(placement); err != nil {
+		return nil, err
+	}
+	return placementResponse(placement), nil
+}
+
+func (s *service) GetPlacements() ([]*api.PlacementResponse, error) {
+	placements, err := s.rep.Placements()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.PlacementResponse, 0, len(placements))
+	for _, placement := range placements {
+		res = append(res, placementResponse(placement))
+	}
+	return res, nil
+}
+
+func (s *service) GetPlacement(id string) (*api.PlacementResponse, error) {
+	placement, err := s.rep.GetPlacement(id)
+	if err != nil {
+		return nil, err
+	}
+	return placementResponse(placement), nil
+}
+
+// UpdatePlacement renames the placement or changes its position limit, which
+// cannot go below the positions its slots already use
+func (s *service) UpdatePlacement(id string, reqBody *api.PlacementRequestBody) (*api.PlacementResponse, error) {
+	placement, err := s.rep.GetPlacement(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = applyPlacementRequest(placement, reqBody); err != nil {
+		return nil, err
+	}
+	if err = s.checkHouseCreative(placement); err != nil {
+		return nil, err
+	}
+	if placement.MaxPositions > 0 {
+		used, err := s.rep.MaxPosition(id)
+		if err != nil {
+			return nil, err
+		}
+		if used > placement.MaxPositions {
+			return nil, models.NewError(
+				fmt.Sprintf("Placement %s has slots up to position %d, max_positions cannot be lower", id, used),
+				models.ActionForbidden,
+			)
+		}
+	}
+	if err = s.rep.UpdatePlacement(placement); err != nil {
+		return nil, err
+	}
+	return placementResponse(placement), nil
+}
+
+// DeletePlacement removes a placement without slots or templates, the
+// default placement is kept
+func (s *service) DeletePlacement(id string) error {
+	if id == models.DefaultPlacement {
+		return models.NewError("The default placement cannot be deleted", models.ActionForbidden)
+	}
+	used, err := s.rep.MaxPosition(id)
+	if err != nil {
+		return err
+	}
+	if used > 0 {
+		return models.NewError(fmt.Sprintf("Placement %s still has slots", id), models.ActionForbidden)
+	}
+	templates, err := s.rep.Templates(false)
+	if err != nil {
+		return err
+	}
+	for _, template := range templates {
+		if template.Placement == id {
+			return models.NewError(fmt.Sprintf("Placement %s is used by template %s", id, template.ID), models.ActionForbidden)
+		}
+	}
+	deleted, err := s.rep.DeletePlacement(id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return models.NewError(fmt.Sprintf("Placement %s not found", id), models.ResourceNotFoundError)
+	}
+	return nil
+}
+
+// placement returns the placement of a request, the default one when id is empty
+func (s *service) placement(id string) (*mysql.Placement, error) {
+	return s.rep.GetPlacement(placementID(id))
+}
+
+func placementID(id string) string {
+	if id == "" {
+		return models.DefaultPlacement
+	}
+	return id
+}
+
+func applyPlacementRequest(placement *mysql.Placement, reqBody *api.PlacementRequestBody) error {
+	if strings.TrimSpace(reqBody.Name) == "" {
+		return models.NewError("BadParameterValue: name cannot be empty", models.DecodeFailureError)
+	}
+	if reqBody.MaxPositions < 0 {
+		return models.NewError("BadParameterValue: max_positions cannot be negative", models.DecodeFailureError)
+	}
+	granularity := reqBody.Granularity
+	if granularity == "" {
+		granularity = models.GranularityDay
+	}
+	switch granularity {
+	case models.GranularityDay, models.GranularityHour:
+		if len(reqBody.DayParts) > 0 {
+			return models.NewError("BadParameterValue: day_parts are only allowed with granularity daypart", models.DecodeFailureError)
+		}
+	case models.GranularityDayPart:
+		if len(reqBody.DayParts) == 0 {
+			return models.NewError("BadParameterValue: granularity daypart needs day_parts", models.DecodeFailureError)
+		}
+	default:
+		return models.NewError(fmt.Sprintf("BadParameterValue: unknown granularity %q", reqBody.Granularity), models.DecodeFailureError)
+	}
+	parts := make([]*mysql.DayPart, 0, len(reqBody.DayParts))
+	names := make(map[string]bool)
+	for _, part := range reqBody.DayParts {
+		if strings.TrimSpace(part.Name) == "" || names[part.Name] {
+			return models.NewError("BadParameterValue: day parts need unique names", models.DecodeFailureError)
+		}
+		names[part.Name] = true
+		if _, err := time.Parse(timeOfDay, part.Start); err != nil {
+			return models.NewError(fmt.Sprintf("BadParameterValue: start %q of day part %s must be HH:MM", part.Start, part.Name), models.DecodeFailureError)
+		}
+		if _, err := time.Parse(timeOfDay, part.End); err != nil {
+			return models.NewError(fmt.Sprintf("BadParameterValue: end %q of day part %s must be HH:MM", part.End, part.Name), models.DecodeFailureError)
+		}
+		parts = append(parts, &mysql.DayPart{PlacementID: placement.ID, Name: part.Name, Start: part.Start, End: part.End})
+	}
+	if err := applyCreativeSpec(placement, reqBody.Creatives); err != nil {
+		return err
+	}
+	placement.Name = reqBody.Name
+	placement.MaxPositions = reqBody.MaxPositions
+	placement.Granularity = granularity
+	placement.DayParts = parts
+	placement.HouseCreativeID = nil
+	if reqBody.HouseCreativeId != "" {
+		placement.HouseCreativeID = models.PtrString(reqBody.HouseCreativeId)
+	}
+	return nil
+}
+
+func placementResponse(placement *mysql.Placement) *api.PlacementResponse {
+	res := &api.PlacementResponse{
+		Id:           placement.ID,
+		Name:         placement.Name,
+		MaxPositions: placement.MaxPositions,
+		Granularity:  placement.Granularity,
+	}
+	if placement.HouseCreativeID != nil {
+		res.HouseCreativeId = *placement.HouseCreativeID
+	}
+	for _, part := range placement.DayParts {
+		res.DayParts = append(res.DayParts, &api.DayPartBody{Name: part.Name, Start: part.Start, End: part.End})
+	}
+	if placement.CreativeFormats != "" || placement.CreativeMaxSize > 0 || placement.CreativeWidth > 0 || placement.CreativeHeight > 0 {
+		res.Creatives = &api.CreativeSpecBody{
+			Formats: creativeFormats(placement),
+			MaxSize: placement.CreativeMaxSize,
+			Width:   placement.CreativeWidth,
+			Height:  placement.CreativeHeight,
+		}
+	}
+	return res
+}
+
+// slotWindows returns the start and end of the slots of the placement which
+// start between start and end, both included, a date as end includes its
+// whole day
+func slotWindows(placement *mysql.Placement, start, end time.Time) ([][2]time.Time, error) {
+	var windows [][2]time.Time
+	last := models.EndOfRange(end)
+	switch placement.Granularity {
+	case models.GranularityHour:
+		if start.Minute() != 0 || start.Second() != 0 || start.Nanosecond() != 0 {
+			return nil, models.NewError(
+				fmt.Sprintf("BadParameterValue: start_date[%s] must be on the hour for placement %s", models.TimeToString(start), placement.ID),
+				models.DecodeFailureError,
+			)
+		}
+		for t := start; !t.After(last); t = t.Add(time.Hour) {
+			windows = append(windows, [2]time.Time{t, t.Add(time.Hour)})
+		}
+	case models.GranularityDayPart:
+		for day := models.StartOfDay(start); !day.After(last); day = day.AddDate(0, 0, 1) {
+			for _, part := range placement.DayParts {
+				from := atTimeOfDay(day, part.Start)
+				to := atTimeOfDay(day, part.End)
+				if !to.After(from) {
+					to = to.AddDate(0, 0, 1)
+				}
+				if from.Before(start) || from.After(last) {
+					continue
+				}
+				windows = append(windows, [2]time.Time{from, to})
+			}
+		}
+		sort.Slice(windows, func(i, j int) bool { return windows[i][0].Before(windows[j][0]) })
+	default:
+		for day := models.StartOfDay(start); !day.After(last); day = day.AddDate(0, 0, 1) {
+			windows = append(windows, [2]time.Time{day, day.AddDate(0, 0, 1)})
+		}
+	}
+	return windows, nil
+}
+
+const timeOfDay = "15:04"
+
+// atTimeOfDay returns the time of day, as HH:MM, on the day
+func atTimeOfDay(day time.Time, value string) time.Time {
+	t, _ := time.Parse(timeOfDay, value)
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, models.Location())
+}
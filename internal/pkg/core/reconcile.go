@@ -0,0 +1,276 @@
+package core
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/payment"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+// Reconciler checks the booked slots against the debits known to the
+// payment providers and optionally repairs the differences
+type Reconciler struct {
+	log *logrus.Logger
+	pay *payment.Registry
+	rep Repository
+}
+
+func NewReconciler(r Repository, p *payment.Registry, log *logrus.Logger) *Reconciler {
+	return &Reconciler{
+		log: log,
+		rep: r,
+		pay: p,
+	}
+}
+
+// Start runs the reconciliation over the last lookbackDays days in the
+// background, once right away and then every interval
+func (r *Reconciler) Start(interval time.Duration, lookbackDays int, repair bool) {
+	job := func() error {
+		end := time.Now()
+		report, err := r.Run(end.AddDate(0, 0, -lookbackDays), end, repair)
+		if err != nil {
+			return err
+		}
+		r.log.Infof("ReconciliationJob:: [StartDate: %s, EndDate: %s, SlotsChecked: %d, Mismatches: %d]",
+			report.StartDate, report.EndDate, report.SlotsChecked, len(report.Mismatches))
+		return nil
+	}
+	go func() {
+		if err := job(); err != nil {
+			r.log.Errorf("ReconciliationJobFailed:: %s", err)
+		}
+	}()
+	Schedule(r.log, "Reconciliation", interval, job)
+}
+
+// Run compares the slots and transactions dated between start and end with
+// the providers' status of the transactions. Slots on hold are skipped, they
+// are in flight and handled by the reservation itself. The transactions which
+// were released from all their slots are checked too, a debit still held for
+// them is an orphan
+func (r *Reconciler) Run(start, end time.Time, repair bool) (*api.ReconciliationReport, error) {
+	slots, err := r.rep.SearchSlotsInRange(&mysql.GetOptions{
+		StartDate:          start,
+		EndDate:            end,
+		PreloadTransaction: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	releasedTxns, err := r.rep.ReleasedTransactions(start, end)
+	if err != nil {
+		return nil, err
+	}
+	report := &api.ReconciliationReport{
+		StartDate:    models.DateToString(start),
+		EndDate:      models.DateToString(end),
+		Generated:    time.Now(),
+		SlotsChecked: len(slots),
+		Mismatches:   make([]*api.ReconciliationMismatch, 0),
+	}
+
+	txnSlots := make(map[string][]*mysql.Slot)
+	txnIds := make(map[string][]string)
+	for _, slot := range slots {
+		if *slot.Status == models.SlotStatusHold {
+			continue
+		}
+		if slot.Transaction == nil {
+			if *slot.Status == models.SlotStatusBooked {
+				report.Mismatches = append(report.Mismatches, newMismatch(models.MismatchMissingDebit, slot, "", nil))
+			}
+			continue
+		}
+		txnid := slot.Transaction.Txnid
+		if _, ok := txnSlots[txnid]; !ok {
+			provider := transactionProvider(slot.Transaction)
+			txnIds[provider] = append(txnIds[provider], txnid)
+		}
+		txnSlots[txnid] = append(txnSlots[txnid], slot)
+	}
+	released := make(map[string][]*mysql.ReleasedTransaction)
+	for _, txn := range releasedTxns {
+		if _, ok := txnSlots[txn.Txnid]; ok {
+			continue
+		}
+		if _, ok := released[txn.Txnid]; !ok {
+			provider := releasedProvider(txn)
+			txnIds[provider] = append(txnIds[provider], txn.Txnid)
+		}
+		released[txn.Txnid] = append(released[txn.Txnid], txn)
+	}
+	report.Transactions = len(txnSlots) + len(released)
+
+	debits := make(map[string]*accounting.AccountingStatusResponse)
+	for provider, ids := range txnIds {
+		p, err := r.pay.Get(provider)
+		if err != nil {
+			return nil, err
+		}
+		res, err := p.Status(ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, status := range res {
+			debits[status.Txnid] = status
+		}
+	}
+
+	for txnid, group := range txnSlots {
+		provider := transactionProvider(group[0].Transaction)
+		debit, debited := debits[txnid]
+		var booked []*mysql.Slot
+		var amount float64
+		for _, slot := range group {
+			switch {
+			case *slot.Status == models.SlotStatusBooked && !debited:
+				report.Mismatches = append(report.Mismatches, newMismatch(models.MismatchMissingDebit, slot, provider, nil))
+			case *slot.Status != models.SlotStatusBooked && debited:
+				report.Mismatches = append(report.Mismatches, newMismatch(models.MismatchOrphanDebit, slot, provider, debit))
+			case debited && (slot.BookedBy == nil || *slot.BookedBy != debit.UID):
+				report.Mismatches = append(report.Mismatches, newMismatch(models.MismatchBookedByMismatch, slot, provider, debit))
+			}
+			if *slot.Status == models.SlotStatusBooked {
+				booked = append(booked, slot)
+				amount += *slot.Cost
+			}
+		}
+		if debited && len(booked) > 0 && math.Abs(amount-debit.DebitedAmount()) >= 0.01 {
+			mismatch := newMismatch(models.MismatchAmount, booked[0], provider, debit)
+			mismatch.SlotAmount = math.Round(amount*100) / 100
+			report.Mismatches = append(report.Mismatches, mismatch)
+		}
+	}
+
+	slotMap := make(map[string]*mysql.Slot)
+	for _, slot := range slots {
+		slotMap[slotKey(slot.Placement, *slot.Date, *slot.Position)] = slot
+	}
+	for txnid, group := range released {
+		debit, debited := debits[txnid]
+		if !debited || debit.DebitedAmount() < 0.01 {
+			continue
+		}
+		for _, txn := range group {
+			slot, ok := slotMap[slotKey(txn.Placement, *txn.Date, *txn.Position)]
+			if !ok {
+				// the slot was deleted since, its status is unknown
+				slot = &mysql.Slot{Placement: txn.Placement, Date: txn.Date, Position: txn.Position, Status: models.PtrString(""), Cost: models.PtrFloat(0)}
+			}
+			mismatch := newMismatch(models.MismatchOrphanDebit, slot, releasedProvider(txn), debit)
+			mismatch.Txnid = txnid
+			report.Mismatches = append(report.Mismatches, mismatch)
+		}
+	}
+
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		a, b := report.Mismatches[i], report.Mismatches[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		return a.Position < b.Position
+	})
+
+	if repair {
+		r.repair(report, slotMap)
+	}
+	return report, nil
+}
+
+// repair applies the fixes which are safe to make automatically, a booked slot
+// which was never paid for is opened again, a paid slot which isn't booked is
+// booked for the payer and a booking made for another user is corrected, amount
+// mismatches, the debits of released transactions, which may have been released
+// on purpose, and the mismatches of slots which no longer exist are only reported
+func (r *Reconciler) repair(report *api.ReconciliationReport, slotMap map[string]*mysql.Slot) {
+	for _, m := range report.Mismatches {
+		date, _ := models.ParseTime(m.Date)
+		slot, ok := slotMap[slotKey(m.Placement, date, m.Position)]
+		if !ok {
+			continue
+		}
+		var err error
+		switch m.Type {
+		case models.MismatchMissingDebit:
+			_, err = r.rep.ReleaseSlots([]*mysql.Slot{slot})
+		case models.MismatchOrphanDebit:
+			if *slot.Status != models.SlotStatusOpen || slot.Transaction == nil || slot.Transaction.Txnid != m.Txnid {
+				continue
+			}
+			fallthrough
+		case models.MismatchBookedByMismatch:
+			_, err = r.rep.UpdateSlots([]*mysql.Slot{{
+				Placement:  slot.Placement,
+				Date:       slot.Date,
+				Position:   slot.Position,
+				Status:     models.PtrString(models.SlotStatusBooked),
+				BookedBy:   models.PtrString(m.DebitedBy),
+				BookedDate: slotBookedDate(slot),
+			}})
+		default:
+			continue
+		}
+		if err != nil {
+			r.log.Errorf("ReconciliationRepairFailed:: [Type: %s, Placement: %s, Date: %s, Position: %d, Error: %s]", m.Type, m.Placement, m.Date, m.Position, err)
+			continue
+		}
+		m.Repaired = true
+		r.log.Infof("ReconciliationRepaired:: [Type: %s, Placement: %s, Date: %s, Position: %d]", m.Type, m.Placement, m.Date, m.Position)
+	}
+}
+
+func newMismatch(kind string, slot *mysql.Slot, provider string, debit *accounting.AccountingStatusResponse) *api.ReconciliationMismatch {
+	m := &api.ReconciliationMismatch{
+		Type:       kind,
+		Placement:  slot.Placement,
+		Date:       models.TimeToString(*slot.Date),
+		Position:   *slot.Position,
+		Status:     *slot.Status,
+		Provider:   provider,
+		SlotAmount: *slot.Cost,
+	}
+	if slot.Transaction != nil {
+		m.Txnid = slot.Transaction.Txnid
+	}
+	if slot.BookedBy != nil {
+		m.BookedBy = *slot.BookedBy
+	}
+	if debit != nil {
+		m.DebitedBy = debit.UID
+		m.DebitAmount = debit.DebitedAmount()
+	}
+	return m
+}
+
+func transactionProvider(txn *mysql.Transaction) string {
+	// transactions created before providers were introduced went to accounting
+	if txn.Provider == nil {
+		return payment.ProviderAccounting
+	}
+	return *txn.Provider
+}
+
+func releasedProvider(txn *mysql.ReleasedTransaction) string {
+	return transactionProvider(&mysql.Transaction{Provider: txn.Provider})
+}
+
+func slotBookedDate(slot *mysql.Slot) *time.Time {
+	if slot.BookedDate != nil {
+		return slot.BookedDate
+	}
+	if slot.Transaction != nil {
+		return models.PtrDate(slot.Transaction.Created)
+	}
+	return models.PtrDate(time.Now())
+}
+
+func slotKey(placement string, date time.Time, position int32) string {
+	return placement + ":" + models.TimeToString(date) + ":" + models.Int32ToString(position)
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// defaultReportLimit is the number of top advertisers without limit param
+const defaultReportLimit = 10
+
+// reportOptions checks that the uid param names an operator and reads the
+// range, placement and group of a report, the first group is the default
+func (s *service) reportOptions(filters map[string]string, groups ...string) (*mysql.ReportOptions, error) {
+	if !s.isOperator(filters["uid"]) {
+		return nil, models.NewError(fmt.Sprintf("%s is not allowed to read reports", filters["uid"]), models.ActionForbidden)
+	}
+	start, err := models.ParseTime(filters["start_date"])
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("start_date: %s decode failed", filters["start_date"]), models.DecodeFailureError)
+	}
+	end, err := models.ParseTime(filters["end_date"])
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("end_date: %s decode failed", filters["end_date"]), models.DecodeFailureError)
+	}
+	if start.After(end) {
+		return nil, models.NewError(fmt.Sprintf("start_date[%s] cannot be greater than end_date[%s]", models.TimeToString(start), models.TimeToString(end)), models.DecodeFailureError)
+	}
+	opts := &mysql.ReportOptions{
+		Placement: filters["placement"],
+		Start:     start,
+		End:       models.EndOfRange(end),
+		Limit:     defaultReportLimit,
+	}
+	if len(groups) > 0 {
+		opts.GroupBy = groups[0]
+		if groupBy := filters["group_by"]; groupBy != "" {
+			opts.GroupBy = ""
+			for _, group := range groups {
+				if group == groupBy {
+					opts.GroupBy = group
+				}
+			}
+			if opts.GroupBy == "" {
+				return nil, models.NewError(fmt.Sprintf("group_by: %s must be one of %s", groupBy, strings.Join(groups, ", ")), models.DecodeFailureError)
+			}
+		}
+	}
+	if limit := filters["limit"]; limit != "" {
+		opts.Limit, err = strconv.Atoi(limit)
+		if err != nil || opts.Limit < 1 {
+			return nil, models.NewError(fmt.Sprintf("limit: %s must be a positive number", limit), models.DecodeFailureError)
+		}
+	}
+	return opts, nil
+}
+
+// OccupancyReport returns how many of the slots starting within the range are
+// booked, by date, position or weekday
+func (s *service) OccupancyReport(filters map[string]string) ([]*api.OccupancyReportRow, error) {
+	opts, err := s.reportOptions(filters, models.ReportGroupDate, models.ReportGroupPosition, models.ReportGroupWeekday)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.rep.OccupancyReport(opts)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.OccupancyReportRow, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, &api.OccupancyReportRow{
+			Key:      row.Key,
+			Total:    row.Total,
+			Sellable: row.Sellable,
+			Booked:   row.Booked,
+			Rate:     roundReport(row.Rate),
+		})
+	}
+	return res, nil
+}
+
+// RevenueReport returns the cost of the slots booked within the range, by
+// day, week or month of their booking
+func (s *service) RevenueReport(filters map[string]string) ([]*api.RevenueReportRow, error) {
+	opts, err := s.reportOptions(filters, models.ReportGroupDay, models.ReportGroupWeek, models.ReportGroupMonth)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.rep.RevenueReport(opts)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.RevenueReportRow, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, &api.RevenueReportRow{Period: row.Period, Bookings: row.Bookings, Revenue: roundReport(row.Revenue)})
+	}
+	return res, nil
+}
+
+// TopAdvertisersReport returns the advertisers who spent the most on the
+// slots booked within the range
+func (s *service) TopAdvertisersReport(filters map[string]string) ([]*api.AdvertiserSpendRow, error) {
+	opts, err := s.reportOptions(filters)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.rep.TopAdvertisers(opts)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.AdvertiserSpendRow, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, &api.AdvertiserSpendRow{AdvertiserId: row.AdvertiserID, Name: row.Name, Bookings: row.Bookings, Spend: roundReport(row.Spend)})
+	}
+	return res, nil
+}
+
+// LeadTimeReport returns the days between the bookings within the range and
+// the start of their slots, by day, week or month of the booking
+func (s *service) LeadTimeReport(filters map[string]string) ([]*api.LeadTimeReportRow, error) {
+	opts, err := s.reportOptions(filters, models.ReportGroupMonth, models.ReportGroupWeek, models.ReportGroupDay)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.rep.LeadTimeReport(opts)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.LeadTimeReportRow, 0, len(rows))
+	for _, row := range rows {
+		res = append(res, &api.LeadTimeReportRow{
+			Period:   row.Period,
+			Bookings: row.Bookings,
+			AvgDays:  roundReport(row.AvgDays),
+			MinDays:  row.MinDays,
+			MaxDays:  row.MaxDays,
+		})
+	}
+	return res, nil
+}
+
+func roundReport(v float64) float64 {
+	return math.Round(v*100) / 100
+}
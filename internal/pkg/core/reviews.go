@@ -0,0 +1,180 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// creativeReviews are the review states a creative can move to from its
+// current one, approved creatives can still be rejected and rejected ones
+// approved on a second look
+var creativeReviews = map[string][]string{
+	models.CreativeStatusPending:  {models.CreativeStatusApproved, models.CreativeStatusRejected},
+	models.CreativeStatusApproved: {models.CreativeStatusRejected},
+	models.CreativeStatusRejected: {models.CreativeStatusApproved},
+}
+
+// GetCreativeReviews is the review queue of the operators, the pending
+// creatives in the order they were uploaded
+func (s *service) GetCreativeReviews(uid string) ([]*api.CreativeResponse, error) {
+	if !s.isOperator(uid) {
+		return nil, models.NewError(fmt.Sprintf("%s is not allowed to review creatives", uid), models.ActionForbidden)
+	}
+	return s.GetCreatives(map[string]string{"status": models.CreativeStatusPending})
+}
+
+// ReviewCreative approves or rejects the creative on behalf of the operator
+// uid and publishes the transition
+func (s *service) ReviewCreative(id, uid string, reqBody *api.CreativeReviewRequestBody) (*api.CreativeResponse, error) {
+	if !s.isOperator(uid) {
+		return nil, models.NewError(fmt.Sprintf("%s is not allowed to review creatives", uid), models.ActionForbidden)
+	}
+	reason := strings.TrimSpace(reqBody.Reason)
+	switch reqBody.Status {
+	case models.CreativeStatusApproved:
+	case models.CreativeStatusRejected:
+		if reason == "" {
+			return nil, models.NewError("BadParameterValue: a rejection needs a reason", models.DecodeFailureError)
+		}
+	default:
+		return nil, models.NewError(
+			fmt.Sprintf("BadParameterValue: status must be %s or %s", models.CreativeStatusApproved, models.CreativeStatusRejected),
+			models.DecodeFailureError,
+		)
+	}
+	if len(reason) > 500 {
+		return nil, models.NewError("BadParameterValue: reason cannot exceed 500 characters", models.DecodeFailureError)
+	}
+	creative, err := s.rep.GetCreative(id)
+	if err != nil {
+		return nil, err
+	}
+	allowed := false
+	for _, status := range creativeReviews[creative.Status] {
+		allowed = allowed || status == reqBody.Status
+	}
+	if !allowed {
+		return nil, models.NewError(fmt.Sprintf("Creative %s is %s and cannot be %s", id, creative.Status, reqBody.Status), models.ActionForbidden)
+	}
+	lastStatus := creative.Status
+	now := time.Now()
+	creative.Status = reqBody.Status
+	creative.ReviewReason = reason
+	creative.ReviewedBy = models.PtrString(uid)
+	creative.ReviewedAt = &now
+	reviewed, err := s.rep.ReviewCreative(creative, lastStatus)
+	if err != nil {
+		return nil, err
+	}
+	if !reviewed {
+		return nil, models.NewError(fmt.Sprintf("Creative %s was reviewed meanwhile", id), models.ActionForbidden)
+	}
+	res := creativeResponse(creative)
+	if creative.Status == models.CreativeStatusApproved {
+		s.publish(models.EventCreativeApproved, res)
+	} else {
+		s.publish(models.EventCreativeRejected, res)
+	}
+	return res, nil
+}
+
+// checkHouseCreative refuses house ads which aren't approved
+func (s *service) checkHouseCreative(placement *mysql.Placement) error {
+	if placement.HouseCreativeID == nil {
+		return nil
+	}
+	creative, err := s.rep.GetCreative(*placement.HouseCreativeID)
+	if err != nil {
+		return err
+	}
+	if creative.Status != models.CreativeStatusApproved {
+		return models.NewError(fmt.Sprintf("House creative %s is %s, it must be approved", creative.ID, creative.Status), models.ActionForbidden)
+	}
+	return nil
+}
+
+// describeCreatives adds the names, formats and review states of the
+// creatives attached to the slots. Booked slots past the review cut-off
+// without an approved creative are flagged, and get the house ad of their
+// placement when the fallback is enabled
+func (s *service) describeCreatives(res []*api.GetSlotsResponse) error {
+	var ids []string
+	placements := make(map[string]*mysql.Placement)
+	for _, group := range res {
+		for _, slot := range group.Slots {
+			if slot.Creative != nil {
+				ids = append(ids, slot.Creative.Id)
+			}
+		}
+		if _, ok := placements[group.Placement]; ok || !s.conf.HouseAdFallback {
+			continue
+		}
+		placement, err := s.rep.GetPlacement(group.Placement)
+		if err != nil {
+			return err
+		}
+		placements[group.Placement] = placement
+		if placement.HouseCreativeID != nil {
+			ids = append(ids, *placement.HouseCreativeID)
+		}
+	}
+	creatives, err := s.rep.CreativesByIDs(ids)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(s.conf.CreativeReviewCutoff)
+	for _, group := range res {
+		for _, slot := range group.Slots {
+			if slot.Creative != nil {
+				if creative, ok := creatives[slot.Creative.Id]; ok {
+					slot.Creative.Name = creative.Name
+					slot.Creative.Format = creative.Format
+					slot.Creative.Status = creative.Status
+				}
+			}
+			slot.CreativeIssue = creativeIssue(slot, cutoff)
+			placement := placements[group.Placement]
+			if slot.CreativeIssue == "" || placement == nil || placement.HouseCreativeID == nil {
+				continue
+			}
+			if house, ok := creatives[*placement.HouseCreativeID]; ok && house.Status == models.CreativeStatusApproved {
+				slot.HouseAd = slotCreative(house)
+			}
+		}
+	}
+	return nil
+}
+
+// creativeIssue returns why a booked slot starting before the cut-off has no
+// approved creative, empty when it has one or the cut-off is still ahead
+func creativeIssue(slot *api.SlotResponse, cutoff time.Time) string {
+	if slot.Status != models.SlotStatusBooked {
+		return ""
+	}
+	start, err := time.Parse(time.RFC3339, slot.Start)
+	if err != nil || start.After(cutoff) {
+		return ""
+	}
+	if slot.Creative == nil || slot.Creative.Status == "" {
+		return models.CreativeIssueMissing
+	}
+	if slot.Creative.Status != models.CreativeStatusApproved {
+		return slot.Creative.Status
+	}
+	return ""
+}
+
+func slotCreative(creative *mysql.Creative) *api.SlotCreative {
+	return &api.SlotCreative{
+		Id:     creative.ID,
+		Name:   creative.Name,
+		Format: creative.Format,
+		Status: creative.Status,
+		Url:    creativeURL(creative.ID),
+	}
+}
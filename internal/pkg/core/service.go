@@ -1,13 +1,18 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
 	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/events"
 	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/payment"
 	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
 	"github.com/sirupsen/logrus"
+	"io"
+	"sync"
 	"time"
 )
 
@@ -18,45 +23,267 @@ type Service interface {
 	GetSlots(filters map[string]string) ([]*api.GetSlotsResponse, error)
 	ReserveSlots(request []*api.ReserveSlotRequestBody, uid string) error
 	DeleteSlots(reqBody []*api.DeleteSlotRequestBody) error
+	Readiness() *api.ReadinessResponse
+	GetPaymentProfile(uid string) (*api.PaymentProfileResponse, error)
+	SetPaymentProfile(uid string, reqBody *api.PaymentProfileRequestBody) error
+	CancelReservation(request []*api.ReserveSlotRequestBody, uid string) error
+	TopUpWallet(uid string, reqBody *api.WalletTopUpRequestBody) (*api.WalletResponse, error)
+	GetWallet(uid string) (*api.WalletResponse, error)
+	GetWalletStatement(uid string, filters map[string]string) (*api.WalletStatementResponse, error)
+	CreateHold(request []*api.ReserveSlotRequestBody, uid string) (*api.HoldResponse, error)
+	GetHold(id string) (*api.HoldResponse, error)
+	ConfirmHold(id, uid string) (*api.HoldResponse, error)
+	ReleaseHold(id, uid string) error
+	ExpireHolds() (int, error)
+	CreateCart(request []*api.ReserveSlotRequestBody, uid string) (*api.CartResponse, error)
+	GetCart(id, uid string) (*api.CartResponse, error)
+	AddCartItems(id, uid string, request []*api.ReserveSlotRequestBody) (*api.CartResponse, error)
+	RemoveCartItems(id, uid string, request []*api.ReserveSlotRequestBody) (*api.CartResponse, error)
+	ValidateCart(id, uid string) (*api.CartValidationResponse, error)
+	CheckoutCart(id, uid string, allowPartial bool) (*api.CartCheckoutResponse, error)
+	JoinWaitlist(request []*api.ReserveSlotRequestBody, uid string) ([]*api.WaitlistEntryResponse, error)
+	GetWaitlist(uid string) ([]*api.WaitlistEntryResponse, error)
+	LeaveWaitlist(id, uid string) error
+	ProcessWaitlist() (int, error)
+	CreateAuctions(reqBody *api.AuctionRequestBody) ([]*api.AuctionResponse, error)
+	GetAuctions(filters map[string]string) ([]*api.AuctionResponse, error)
+	GetAuction(id string) (*api.AuctionResponse, error)
+	PlaceBid(id, uid string, reqBody *api.BidRequestBody) (*api.BidResponse, error)
+	CloseAuctions() (int, error)
+	CreateTemplate(reqBody *api.TemplateRequestBody) (*api.TemplateResponse, error)
+	GetTemplates() ([]*api.TemplateResponse, error)
+	GetTemplate(id string) (*api.TemplateResponse, error)
+	UpdateTemplate(id string, reqBody *api.TemplateRequestBody) (*api.TemplateResponse, error)
+	DeleteTemplate(id string) error
+	PreviewTemplate(id string, filters map[string]string) ([]*api.GetSlotsResponse, error)
+	GenerateSlots() (int, error)
+	SetCalendarDay(date string, reqBody *api.CalendarDayRequestBody) (*api.CalendarDayResponse, error)
+	DeleteCalendarDay(date string) error
+	GetCalendar(filters map[string]string) ([]*api.CalendarDayResponse, error)
+	ImportCalendar(file io.Reader, params map[string]string) (*api.CalendarImportResponse, error)
+	CreatePlacement(reqBody *api.PlacementRequestBody) (*api.PlacementResponse, error)
+	GetPlacements() ([]*api.PlacementResponse, error)
+	GetPlacement(id string) (*api.PlacementResponse, error)
+	UpdatePlacement(id string, reqBody *api.PlacementRequestBody) (*api.PlacementResponse, error)
+	DeletePlacement(id string) error
+	CreateAdvertiser(reqBody *api.AdvertiserRequestBody) (*api.AdvertiserResponse, error)
+	GetAdvertisers() ([]*api.AdvertiserResponse, error)
+	GetAdvertiser(id string) (*api.AdvertiserResponse, error)
+	UpdateAdvertiser(id string, reqBody *api.AdvertiserRequestBody) (*api.AdvertiserResponse, error)
+	DeleteAdvertiser(id string) error
+	CreateCampaign(reqBody *api.CampaignRequestBody) (*api.CampaignResponse, error)
+	GetCampaigns(filters map[string]string) ([]*api.CampaignResponse, error)
+	GetCampaign(id string) (*api.CampaignResponse, error)
+	UpdateCampaign(id string, reqBody *api.CampaignRequestBody) (*api.CampaignResponse, error)
+	DeleteCampaign(id string) error
+	CreateCreative(content io.Reader, params map[string]string) (*api.CreativeResponse, error)
+	GetCreatives(filters map[string]string) ([]*api.CreativeResponse, error)
+	GetCreative(id string) (*api.CreativeResponse, error)
+	CreativeContent(id string) (io.ReadCloser, *api.CreativeResponse, error)
+	DeleteCreative(id string) error
+	GetCreativeReviews(uid string) ([]*api.CreativeResponse, error)
+	ReviewCreative(id, uid string, reqBody *api.CreativeReviewRequestBody) (*api.CreativeResponse, error)
+	AttachCreatives(request []*api.AttachCreativeRequestBody, uid string) error
+	Serve(request []*api.ServeRequestBody) ([]*api.ServeResponse, error)
+	Track(kind string, params map[string]string) (string, error)
+	FlushTracking() (int, error)
+	OccupancyReport(filters map[string]string) ([]*api.OccupancyReportRow, error)
+	RevenueReport(filters map[string]string) ([]*api.RevenueReportRow, error)
+	TopAdvertisersReport(filters map[string]string) ([]*api.AdvertiserSpendRow, error)
+	LeadTimeReport(filters map[string]string) ([]*api.LeadTimeReportRow, error)
+	ImportSlots(file io.Reader, params map[string]string) (*api.SlotImportResponse, error)
+	ExportSlots(w io.Writer, params map[string]string) (int, error)
+	GetSlotAudits(filters map[string]string) ([]*api.SlotAuditResponse, error)
+	WithAudit(actor, requestID string) Service
+	RestoreSlots(reqBody []*api.DeleteSlotRequestBody, uid string) (int, error)
+	PurgeDeletedSlots() (int, error)
 }
 
 // Repository provides access to User repository.
 type Repository interface {
 	Create(interface{}) (int, error)
 	UpdateSlots(slots []*mysql.Slot) (int, error)
+	ReleaseSlots(slots []*mysql.Slot) (int, error)
 	SearchSlotsInRange(options *mysql.GetOptions) ([]*mysql.Slot, error)
 	SearchSlotsByStatus(options *mysql.GetOptions) ([]*mysql.Slot, error)
 	UpdateSlotsStatus(slots []*mysql.Slot, lastStatus, newStatus string) error
 	Delete(records interface{}) (int, error)
+	GetPaymentProfile(uid string) (*mysql.PaymentProfile, error)
+	SavePaymentProfile(profile *mysql.PaymentProfile) error
+	TopUpWallet(uid string, amount float64) (*mysql.LedgerAccount, error)
+	GetWallet(uid string) (*mysql.LedgerAccount, error)
+	WalletStatement(uid string, start, end time.Time) ([]*mysql.LedgerEntry, error)
+	CreateHold(hold *mysql.Hold, transactions []*mysql.Transaction) error
+	GetHold(id string) (*mysql.Hold, error)
+	UpdateHoldStatus(id, lastStatus, newStatus string) (bool, error)
+	ReleaseHold(id, newStatus string) (bool, error)
+	SlotsByTxnid(txnid string) ([]*mysql.Slot, error)
+	ExpiredHolds(now, staleConfirming time.Time) ([]*mysql.Hold, error)
+	ActiveHoldIDs() ([]string, error)
+	CreateCart(cart *mysql.Cart, items []*mysql.CartItem) error
+	GetCart(id string) (*mysql.Cart, error)
+	AddCartItems(items []*mysql.CartItem) error
+	RemoveCartItems(items []*mysql.CartItem) (int, error)
+	UpdateCartStatus(id, lastStatus, newStatus string) (bool, error)
+	CreateWaitlistEntries(entries []*mysql.WaitlistEntry) error
+	GetWaitlistEntry(id string) (*mysql.WaitlistEntry, error)
+	WaitlistEntries(uid, status string) ([]*mysql.WaitlistEntry, error)
+	NextWaitlistOffers() ([]*mysql.WaitlistEntry, error)
+	UpdateWaitlistEntry(id, lastStatus, newStatus string, holdID *string) (bool, error)
+	CreateAuctions(auctions []*mysql.Auction) error
+	GetAuction(id string) (*mysql.Auction, error)
+	Auctions(placement string, start, end time.Time, status string) ([]*mysql.Auction, error)
+	ClosedAuctions(now time.Time) ([]*mysql.Auction, error)
+	SaveBid(bid *mysql.Bid) (*mysql.Bid, error)
+	AuctionBids(auctionID string) ([]*mysql.Bid, error)
+	UpdateBidStatus(id, status string) error
+	HoldAuctionSlot(auction *mysql.Auction, hold *mysql.Hold, txn *mysql.Transaction, price float64) error
+	ReturnAuctionSlot(auction *mysql.Auction, holdID string) error
+	FinishAuction(auction *mysql.Auction) error
+	CreateTemplate(template *mysql.InventoryTemplate) error
+	GetTemplate(id string) (*mysql.InventoryTemplate, error)
+	Templates(activeOnly bool) ([]*mysql.InventoryTemplate, error)
+	UpdateTemplate(template *mysql.InventoryTemplate) error
+	DeleteTemplate(id string) (int, error)
+	CreateMissingSlots(slots []*mysql.Slot) (int, error)
+	SaveCalendarDays(days []*mysql.CalendarDay) error
+	DeleteCalendarDay(date time.Time) (int, error)
+	CalendarDays(start, end time.Time, kind string) ([]*mysql.CalendarDay, error)
+	GetPlacement(id string) (*mysql.Placement, error)
+	Placements() ([]*mysql.Placement, error)
+	UpdatePlacement(placement *mysql.Placement) error
+	DeletePlacement(id string) (int, error)
+	MaxPosition(placement string) (int32, error)
+	GetAdvertiser(id string) (*mysql.Advertiser, error)
+	Advertisers() ([]*mysql.Advertiser, error)
+	UpdateAdvertiser(advertiser *mysql.Advertiser) error
+	DeleteAdvertiser(id string) (int, error)
+	GetCampaign(id string) (*mysql.Campaign, error)
+	Campaigns(advertiserID string) ([]*mysql.Campaign, error)
+	UpdateCampaign(campaign *mysql.Campaign) error
+	DeleteCampaign(id string) (int, error)
+	CampaignSpend(ids ...string) (map[string]float64, error)
+	CreateTransactions(transactions []*mysql.Transaction, amounts map[string]float64) error
+	GetCreative(id string) (*mysql.Creative, error)
+	Creatives(advertiserID, status string) ([]*mysql.Creative, error)
+	CreativesByIDs(ids []string) (map[string]*mysql.Creative, error)
+	DeleteCreative(id string) (int, error)
+	ReviewCreative(creative *mysql.Creative, lastStatus string) (bool, error)
+	AttachCreatives(slots []*mysql.Slot, uid string, creativeIDs []*string) error
+	OnChange(listener func(tenant string))
+	AddDeliveryStats(stats []*mysql.DeliveryStat) error
+	DeliveryStats(placement string, start, end time.Time) ([]*mysql.DeliveryStat, error)
+	OccupancyReport(opts *mysql.ReportOptions) ([]*mysql.OccupancyRow, error)
+	RevenueReport(opts *mysql.ReportOptions) ([]*mysql.RevenueRow, error)
+	TopAdvertisers(opts *mysql.ReportOptions) ([]*mysql.AdvertiserSpendRow, error)
+	LeadTimeReport(opts *mysql.ReportOptions) ([]*mysql.LeadTimeRow, error)
+	EachBooking(opts *mysql.ExportOptions, fn func(*mysql.BookingRow) error) error
+	SlotAudits(opts *mysql.SlotAuditOptions) ([]*mysql.SlotAudit, error)
+	ReleasedTransactions(start, end time.Time) ([]*mysql.ReleasedTransaction, error)
+	// WithAudit returns a copy of the repository whose changes of slots are
+	// recorded in the audit log as made by the actor, within the request
+	WithAudit(actor, requestID string) Repository
+	RestoreSlots(slots []*mysql.Slot) (int, error)
+	PurgeDeletedSlots(before time.Time) (int, error)
 }
 
 type service struct {
-	log *logrus.Logger
-	acc accounting.AccountingService
-	rep Repository
+	log  *logrus.Logger
+	pay  *payment.Registry
+	rep  Repository
+	conf Config
+	// waitlistMu serializes the waitlist offers, it's shared by the copies of WithAudit
+	waitlistMu *sync.Mutex
+	serving    *servingCache
+	delivery   *deliveryBuffer
 }
 
 // NewService creates an adding service with the necessary dependencies
-func NewService(r Repository, a accounting.AccountingService, log *logrus.Logger) Service {
-	s := service{
-		log: log,
-		rep: r,
-		acc: a,
-	}
-	retry := 1
-	for {
-		if err := s.revertFailedReservations(); err != nil {
-			s.log.Errorf("CoreServiceInitialization: Failed to revert reservations [Error: %s, Retrying: %d]", err, retry)
-			if retry > 10 {
-				s.log.Fatal("ReachedMaximumRetires: Failed CoreServiceInitialization")
-			}
-			time.Sleep(time.Second * 10)
-			retry++
-			continue
+func NewService(r Repository, p *payment.Registry, conf Config, log *logrus.Logger) Service {
+	if conf.HoldTTL <= 0 {
+		conf.HoldTTL = DefaultHoldTTL
+	}
+	if conf.WaitlistOfferTTL <= 0 {
+		conf.WaitlistOfferTTL = DefaultWaitlistOfferTTL
+	}
+	if conf.TemplateDaysAhead <= 0 {
+		conf.TemplateDaysAhead = DefaultTemplateDaysAhead
+	}
+	if conf.AuctionPricing == "" {
+		conf.AuctionPricing = models.AuctionPricingSecond
+	}
+	if conf.Events == nil {
+		conf.Events = events.NewLogPublisher(log)
+	}
+	if conf.Tenant == "" {
+		conf.Tenant = models.DefaultTenant
+	}
+	if conf.CreativeMaxSize <= 0 {
+		conf.CreativeMaxSize = DefaultCreativeMaxSize
+	}
+	if conf.CreativeReviewCutoff <= 0 {
+		conf.CreativeReviewCutoff = DefaultCreativeReviewCutoff
+	}
+	if conf.ServeCacheTTL <= 0 {
+		conf.ServeCacheTTL = DefaultServeCacheTTL
+	}
+	if conf.TrackingURLTTL <= 0 {
+		conf.TrackingURLTTL = DefaultTrackingURLTTL
+	}
+	if conf.SlotRetention <= 0 {
+		conf.SlotRetention = DefaultSlotRetention
+	}
+	s := &service{
+		log:        log,
+		rep:        r,
+		pay:        p,
+		conf:       conf,
+		waitlistMu: &sync.Mutex{},
+		serving:    newServingCache(conf.ServeCacheTTL),
+		delivery:   newDeliveryBuffer(),
+	}
+	r.OnChange(func(tenant string) {
+		if tenant == "" || tenant == conf.Tenant {
+			s.serving.invalidate()
+		}
+	})
+	go s.revertInBackground()
+	s.warmServing()
+	return s
+}
+
+// revertInBackground reverts the failed reservations without holding up the
+// startup, it's retried with a growing backoff until every provider answered
+func (s *service) revertInBackground() {
+	for attempt := 0; ; attempt++ {
+		err := s.revertFailedReservations()
+		if err == nil {
+			return
 		}
-		break
+		wait := revertBackoff(attempt)
+		s.log.Errorf("CoreServiceInitialization: Failed to revert reservations [Error: %s, Attempt: %d, RetryIn: %s]", err, attempt+1, wait)
+		time.Sleep(wait)
 	}
-	return &s
+}
+
+// revertBackoff doubles the wait before the next revert from
+// revertMinBackoff up to revertMaxBackoff
+func revertBackoff(attempt int) time.Duration {
+	if attempt > 16 {
+		return revertMaxBackoff
+	}
+	wait := revertMinBackoff << attempt
+	if wait > revertMaxBackoff {
+		return revertMaxBackoff
+	}
+	return wait
+}
+
+// publish sends the event on behalf of the tenant of the service
+func (s *service) publish(eventType string, data interface{}) {
+	event := events.New(eventType, data)
+	event.Tenant = s.conf.Tenant
+	s.conf.Events.Publish(event)
 }
 
 func (s *service) revertFailedReservations() error {
@@ -71,47 +298,86 @@ func (s *service) revertFailedReservations() error {
 	}
 	s.log.Infof("Total %d slots found to be on hold status", len(slots))
 
+	// slots of holds waiting for confirmation are left alone, they expire on their own
+	activeHolds := make(map[string]bool)
+	holdIds, err := s.rep.ActiveHoldIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range holdIds {
+		activeHolds[id] = true
+	}
+
 	var slotsToUpdate []*mysql.Slot
-	var txnIds []string
-	slotMap := make(map[string]*mysql.Slot)
+	txnIds := make(map[string][]string)
+	// all slots of a reservation share its txnid
+	slotMap := make(map[string][]*mysql.Slot)
 
 	for _, slot := range slots {
+		if slot.Transaction != nil && activeHolds[slot.Transaction.Txnid] {
+			continue
+		}
 		if slot.Transaction == nil {
 			s.log.Warnf("Transaction not found for [Slot: %s, Status: %v], Reverting status to '%s'", slotIdFromSlot([]*mysql.Slot{slot}), slot.Status, models.SlotStatusOpen)
 			slot.Status = models.PtrString(models.SlotStatusOpen)
 			slotsToUpdate = append(slotsToUpdate, slot)
 		} else {
-			txnIds = append(txnIds, slot.Transaction.Txnid)
-			slotMap[slot.Transaction.Txnid] = slot
+			provider := transactionProvider(slot.Transaction)
+			txnIds[provider] = append(txnIds[provider], slot.Transaction.Txnid)
+			slotMap[slot.Transaction.Txnid] = append(slotMap[slot.Transaction.Txnid], slot)
 		}
 	}
 
-	resp, err := s.acc.Status(txnIds)
-	if err != nil {
-		s.log.Errorf("Error while communicating with the accounting service: %s", err.Error())
-		return err
+	// the slots of providers which cannot be asked are left on hold until the next attempt
+	var resp []*accounting.AccountingStatusResponse
+	var unavailable []error
+	for provider, ids := range txnIds {
+		p, err := s.pay.Get(provider)
+		if err == nil && !s.pay.Available(provider) {
+			err = fmt.Errorf("circuit of provider %s is open", provider)
+		}
+		var providerResp []*accounting.AccountingStatusResponse
+		if err == nil {
+			providerResp, err = p.Status(ids)
+		}
+		if err != nil {
+			s.log.Errorf("Error while fetching transaction status from provider %s: %s", provider, err.Error())
+			unavailable = append(unavailable, err)
+			for _, id := range ids {
+				delete(slotMap, id)
+			}
+			continue
+		}
+		resp = append(resp, providerResp...)
 	}
 
 	for _, txn := range resp {
-		slot, ok := slotMap[txn.Txnid]
+		txnSlots, ok := slotMap[txn.Txnid]
 		if !ok {
 			s.log.Errorf("ID not found in slot map: %s", txn.Txnid)
 			continue
 		}
 
-		slot.BookedDate = models.PtrDate(txn.Created)
-		slot.BookedBy = models.PtrString(txn.UID)
-		slot.Status = models.PtrString(models.SlotStatusBooked)
+		for _, slot := range txnSlots {
+			slot.BookedDate = models.PtrDate(txn.Created)
+			slot.BookedBy = models.PtrString(txn.UID)
+			slot.Status = models.PtrString(models.SlotStatusBooked)
+		}
 		delete(slotMap, txn.Txnid)
 
-		slotsToUpdate = append(slotsToUpdate, slot)
+		slotsToUpdate = append(slotsToUpdate, txnSlots...)
 	}
 
-	for _, slot := range slotMap {
-		slot.Status = models.PtrString(models.SlotStatusOpen)
-		slotsToUpdate = append(slotsToUpdate, slot)
+	for _, txnSlots := range slotMap {
+		for _, slot := range txnSlots {
+			slot.Status = models.PtrString(models.SlotStatusOpen)
+		}
+		slotsToUpdate = append(slotsToUpdate, txnSlots...)
 	}
 
+	if len(slotsToUpdate) == 0 {
+		return errors.Join(unavailable...)
+	}
 	s.log.Infof("Fetched transaction status successfully. Changing status to booked for %s", slotIdFromSlot(slotsToUpdate))
 
 	updateCount, err := s.rep.UpdateSlots(slotsToUpdate)
@@ -121,41 +387,91 @@ func (s *service) revertFailedReservations() error {
 	}
 
 	s.log.Infof("Total %d slot(s) status updated", updateCount)
-	return nil
+	for _, slot := range slotsToUpdate {
+		if *slot.Status == models.SlotStatusOpen {
+			s.offerOpenedSlots()
+			break
+		}
+	}
+	return errors.Join(unavailable...)
+}
+
+// Readiness reports whether the service can take reservations, it is not
+// ready while the default provider cannot be called. The other providers
+// only fail the reservations of the advertisers whose profile selects them
+func (s *service) Readiness() *api.ReadinessResponse {
+	return &api.ReadinessResponse{
+		Ready:        s.pay.Available(s.pay.Default()),
+		Dependencies: s.pay.States(),
+	}
 }
 
 func slotIdFromSlot(slots []*mysql.Slot) string {
 	res := ""
 	for _, s := range slots {
-		res += fmt.Sprintf("[Slots: %s-%d, Status: %s],", s.Date.Format(time.DateOnly), *s.Position, *s.Status)
+		res += fmt.Sprintf("[Slots: %s/%s-%d, Status: %s],", s.Placement, models.TimeToString(*s.Date), *s.Position, *s.Status)
 	}
 	return res
 }
 
 func (s *service) CreateSlots(createReqBody []*api.CreateSlotRequestBody) error {
+	_, err := s.createSlots(createReqBody, false)
+	return err
+}
+
+// createSlots adds the slots of the requests. With skipExisting the requests
+// are created one after another, so that a request can follow the positions
+// of the previous one, and the slots which already exist are left untouched
+func (s *service) createSlots(createReqBody []*api.CreateSlotRequestBody, skipExisting bool) (int, error) {
 	// any validation can be done here
 	var slotsToCreate []*mysql.Slot
+	created := 0
 	for _, req := range createReqBody {
-		startDate := time.Time(req.StartDate)
-		endDate := time.Time(req.EndDate)
-		if startDate.After(endDate) {
-			return models.NewError(
-				fmt.Sprintf("BadParameterValue: start_date[%s] should be less than or equal to end_date[%s]", startDate.Format(time.DateOnly), endDate.Format(time.DateOnly)),
-				models.DecodeFailureError,
-			)
-		}
-		slots, err := s.fetchSlotsFromReqBody(req, models.PtrString(models.SlotStatusOpen))
+		slots, err := s.newSlots(req, nil)
 		if err != nil {
-			return err
+			return created, err
+		}
+		if skipExisting {
+			n, err := s.rep.CreateMissingSlots(slots)
+			if err != nil {
+				return created, err
+			}
+			created += n
+			continue
 		}
 		slotsToCreate = append(slotsToCreate, slots...)
 	}
+	if skipExisting {
+		return created, nil
+	}
 	s.log.Debugf("CreateSlots:: Adding %v to Repository", slotsToCreate)
-	_, er := s.rep.Create(slotsToCreate)
-	if er != nil {
-		return er
+	return s.rep.Create(slotsToCreate)
+}
+
+// newSlots checks the request to create slots and builds its open slots, the
+// positions in preceding are taken as existing when checking that the
+// positions follow each other
+func (s *service) newSlots(req *api.CreateSlotRequestBody, preceding map[string]bool) ([]*mysql.Slot, error) {
+	startDate := time.Time(req.StartDate)
+	endDate := time.Time(req.EndDate)
+	if startDate.After(endDate) {
+		return nil, models.NewError(
+			fmt.Sprintf("BadParameterValue: start_date[%s] should be less than or equal to end_date[%s]", startDate.Format(time.DateOnly), endDate.Format(time.DateOnly)),
+			models.DecodeFailureError,
+		)
 	}
-	return nil
+	placement, err := s.placement(req.Placement)
+	if err != nil {
+		return nil, err
+	}
+	if placement.MaxPositions > 0 && req.Position[1] > placement.MaxPositions {
+		return nil, models.NewError(
+			fmt.Sprintf("BadParameterValue: position %d exceeds the %d positions of placement %s", req.Position[1], placement.MaxPositions, placement.ID),
+			models.DecodeFailureError,
+		)
+	}
+	req.Placement = placement.ID
+	return s.slotsOfRequest(req, placement, models.PtrString(models.SlotStatusOpen), preceding)
 }
 
 func (s *service) PatchSlots(patchReqBody []*api.CreateSlotRequestBody) (int, error) {
@@ -169,7 +485,12 @@ func (s *service) PatchSlots(patchReqBody []*api.CreateSlotRequestBody) (int, er
 				models.DecodeFailureError,
 			)
 		}
-		slots, err := s.fetchSlotsFromReqBody(req, nil)
+		placement, err := s.placement(req.Placement)
+		if err != nil {
+			return 0, err
+		}
+		req.Placement = placement.ID
+		slots, err := s.fetchSlotsFromReqBody(req, placement, nil)
 		if err != nil {
 			return 0, err
 		}
@@ -180,48 +501,66 @@ func (s *service) PatchSlots(patchReqBody []*api.CreateSlotRequestBody) (int, er
 }
 
 func (s *service) GetSlots(filters map[string]string) ([]*api.GetSlotsResponse, error) {
-	startDate, err := time.Parse(time.DateOnly, filters["start_date"])
+	startDate, err := models.ParseTime(filters["start_date"])
 	if err != nil {
-		return nil, models.NewError(fmt.Sprintf("start_date: %s decode failed", startDate), models.DecodeFailureError)
+		return nil, models.NewError(fmt.Sprintf("start_date: %s decode failed", filters["start_date"]), models.DecodeFailureError)
 	}
-	endDate, err := time.Parse(time.DateOnly, filters["end_date"])
+	endDate, err := models.ParseTime(filters["end_date"])
 	if err != nil {
-		return nil, models.NewError(fmt.Sprintf("end_date: %s decode failed", startDate), models.DecodeFailureError)
+		return nil, models.NewError(fmt.Sprintf("end_date: %s decode failed", filters["end_date"]), models.DecodeFailureError)
 	}
 	if startDate.After(endDate) {
-		return nil, models.NewError(fmt.Sprintf("start_date[%s] cannot be greater than end_date[%s]", startDate.Format(time.DateOnly), endDate.Format(time.DateOnly)), models.DecodeFailureError)
+		return nil, models.NewError(fmt.Sprintf("start_date[%s] cannot be greater than end_date[%s]", models.TimeToString(startDate), models.TimeToString(endDate)), models.DecodeFailureError)
 	}
 
 	position, _ := filters["position"]
 	status, _ := filters["status"]
 	uid, _ := filters["uid"]
 	getOptions := &mysql.GetOptions{
+		Placement:     filters["placement"],
 		StartDate:     startDate,
 		EndDate:       endDate,
 		PositionStart: position,
 		PositionEnd:   position,
 		Status:        status,
 		Uid:           uid,
+		AdvertiserID:  filters["advertiser_id"],
+		CampaignID:    filters["campaign_id"],
 	}
 	slots, err := s.rep.SearchSlotsInRange(getOptions)
 	if err != nil {
 		return nil, err
 	}
-	return ConvertSlotsToJSON(slots)
+	res, err := ConvertSlotsToJSON(slots)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.describeCreatives(res); err != nil {
+		return nil, err
+	}
+	return res, s.describeDelivery(res, getOptions.Placement, startDate, models.EndOfRange(endDate))
 }
 
+// ConvertSlotsToJSON groups the slots by placement and day, the slots within
+// a day carry the times of their windows
 func ConvertSlotsToJSON(slots []*mysql.Slot) ([]*api.GetSlotsResponse, error) {
 	groups := make(map[string]*api.GetSlotsResponse)
 	for _, s := range slots {
-		date := s.Date.Format(time.DateOnly)
-		if _, ok := groups[date]; !ok {
-			groups[date] = &api.GetSlotsResponse{
-				Date:  date,
-				Slots: make([]*api.SlotResponse, 0),
+		date := models.DateToString(*s.Date)
+		key := s.Placement + ":" + date
+		if _, ok := groups[key]; !ok {
+			groups[key] = &api.GetSlotsResponse{
+				Placement: s.Placement,
+				Date:      date,
+				Timezone:  models.Location().String(),
+				Slots:     make([]*api.SlotResponse, 0),
 			}
 		}
 
+		end := slotEnd(s)
 		slot := &api.SlotResponse{
+			Start:    s.Date.In(models.Location()).Format(time.RFC3339),
+			End:      end.In(models.Location()).Format(time.RFC3339),
 			Position: *s.Position,
 			Cost:     *s.Cost,
 			Status:   *s.Status,
@@ -230,7 +569,10 @@ func ConvertSlotsToJSON(slots []*mysql.Slot) ([]*api.GetSlotsResponse, error) {
 			slot.BookedDate = models.JsonDatePtr(models.JsonDate(*s.BookedDate))
 			slot.BookedBy = s.BookedBy
 		}
-		groups[date].Slots = append(groups[date].Slots, slot)
+		if s.CreativeID != nil {
+			slot.Creative = &api.SlotCreative{Id: *s.CreativeID, Url: creativeURL(*s.CreativeID)}
+		}
+		groups[key].Slots = append(groups[key].Slots, slot)
 	}
 	result := make([]*api.GetSlotsResponse, 0, len(groups))
 	for _, g := range groups {
@@ -252,13 +594,29 @@ func (s *service) ReserveSlots(reserveRequest []*api.ReserveSlotRequestBody, uid
 		)
 	}
 
-	// prepare slots and transactions
+	providerName, err := s.pay.ProviderFor(uid)
+	if err != nil {
+		return err
+	}
+	provider, err := s.pay.Get(providerName)
+	if err != nil {
+		return err
+	}
+	if err = s.checkBookable(uid, requestDates(reserveRequest)...); err != nil {
+		return err
+	}
+	if err = s.checkCampaigns(reserveRequest, uid); err != nil {
+		return err
+	}
+
+	// prepare slots and transactions, the cost of the slots is charged to their campaigns
+	amounts := make(map[string]float64)
 	for _, r := range reserveRequest {
 		date := time.Time(r.Date)
 		pos := models.Int32ToString(*r.Position)
 		getOptions := &mysql.GetOptions{
-			StartDate:     date,
-			EndDate:       date,
+			Placement:     placementID(r.Placement),
+			Start:         &date,
 			PositionStart: pos,
 			PositionEnd:   pos,
 			Status:        models.SlotStatusOpen,
@@ -267,14 +625,20 @@ func (s *service) ReserveSlots(reserveRequest []*api.ReserveSlotRequestBody, uid
 		slot, err := s.rep.SearchSlotsInRange(getOptions)
 		if err != nil || len(slot) == 0 {
 			return models.NewError(
-				fmt.Sprintf("Slot with [date: %s, position: %d] not open", models.DateToString(date), *r.Position),
+				fmt.Sprintf("Slot with [placement: %s, date: %s, position: %d] not open", getOptions.Placement, models.TimeToString(date), *r.Position),
 				models.ActionForbidden,
 			)
 		}
 		txn := &mysql.Transaction{
-			Txnid:    txnid.String(),
-			Date:     models.PtrDate(date),
-			Position: r.Position,
+			Txnid:     txnid.String(),
+			Placement: getOptions.Placement,
+			Date:      models.PtrDate(date),
+			Position:  r.Position,
+			Provider:  models.PtrString(providerName),
+		}
+		if r.CampaignID != "" {
+			txn.CampaignID = models.PtrString(r.CampaignID)
+			amounts[r.CampaignID] += *slot[0].Cost
 		}
 		slot[0].BookedBy = models.PtrString(uid)
 		slot[0].BookedDate = models.PtrDate(time.Now())
@@ -284,7 +648,7 @@ func (s *service) ReserveSlots(reserveRequest []*api.ReserveSlotRequestBody, uid
 	}
 
 	// create transactions
-	if _, err = s.rep.Create(transactions); err != nil {
+	if err = s.rep.CreateTransactions(transactions, amounts); err != nil {
 		if mErr, ok := err.(*models.Error); ok {
 			if mErr.Type == models.DuplicateResourceCreationError {
 				err = models.NewError(
@@ -305,8 +669,24 @@ func (s *service) ReserveSlots(reserveRequest []*api.ReserveSlotRequestBody, uid
 		}
 	}()
 
+	return s.chargeAndBook(provider, slots, uid, txnid.String())
+}
+
+// chargeAndBook debits the held slots through the provider and books them,
+// the slots must carry their booking details
+func (s *service) chargeAndBook(provider payment.Provider, slots []*mysql.Slot, uid, txnid string) error {
+	// providers keeping their ledger in our database book within the debit's transaction
+	if booker, ok := provider.(payment.Booker); ok {
+		if err := booker.DebitAndBook(slots, uid, txnid); err != nil {
+			s.log.Debugf("DebitTransactionFailed:: reverting changes to db with [Status: %s, Slots: %+v]", models.SlotStatusOpen, slots)
+			return err
+		}
+		s.log.Infof("Total %d slots reserved successfully", len(slots))
+		return nil
+	}
+
 	// debit transaction
-	if err = s.acc.Debit(slots, uid, txnid.String()); err != nil {
+	if err := provider.Debit(slots, uid, txnid); err != nil {
 		s.log.Debugf("DebitTransactionFailed:: reverting changes to db with [Status: %s, Slots: %+v]", models.SlotStatusOpen, slots)
 		return err
 	}
@@ -323,6 +703,133 @@ func (s *service) ReserveSlots(reserveRequest []*api.ReserveSlotRequestBody, uid
 	return nil
 }
 
+// CancelReservation opens slots booked by the advertiser again and refunds
+// them, only providers which can refund support cancellation
+func (s *service) CancelReservation(cancelRequest []*api.ReserveSlotRequestBody, uid string) error {
+	groups := make(map[string][]*mysql.Slot)
+	providers := make(map[string]string)
+	for _, r := range cancelRequest {
+		date := time.Time(r.Date)
+		pos := models.Int32ToString(*r.Position)
+		getOptions := &mysql.GetOptions{
+			Placement:          placementID(r.Placement),
+			Start:              &date,
+			PositionStart:      pos,
+			PositionEnd:        pos,
+			Status:             models.SlotStatusBooked,
+			Uid:                uid,
+			PreloadTransaction: true,
+		}
+		slots, err := s.rep.SearchSlotsInRange(getOptions)
+		if err != nil {
+			return err
+		}
+		if len(slots) == 0 || slots[0].Transaction == nil {
+			return models.NewError(
+				fmt.Sprintf("Slot with [placement: %s, date: %s, position: %d] not booked by %s", getOptions.Placement, models.TimeToString(date), *r.Position, uid),
+				models.ActionForbidden,
+			)
+		}
+		txn := slots[0].Transaction
+		groups[txn.Txnid] = append(groups[txn.Txnid], slots[0])
+		providers[txn.Txnid] = transactionProvider(txn)
+	}
+
+	for txnid, slots := range groups {
+		p, err := s.pay.Get(providers[txnid])
+		if err != nil {
+			return err
+		}
+		refunder, ok := p.(payment.Refunder)
+		if !ok {
+			return models.NewError(
+				fmt.Sprintf("Reservations paid through '%s' cannot be cancelled", providers[txnid]),
+				models.ActionForbidden,
+			)
+		}
+		if err = refunder.RefundAndRelease(slots, uid, txnid); err != nil {
+			return err
+		}
+		s.log.Infof("Total %d slots of transaction %s cancelled and refunded", len(slots), txnid)
+	}
+	s.offerOpenedSlots()
+	return nil
+}
+
+func (s *service) TopUpWallet(uid string, reqBody *api.WalletTopUpRequestBody) (*api.WalletResponse, error) {
+	if *reqBody.Amount <= 0 {
+		return nil, models.NewError("BadParameterValue: amount must be greater than 0", models.DecodeFailureError)
+	}
+	wallet, err := s.rep.TopUpWallet(uid, *reqBody.Amount)
+	if err != nil {
+		return nil, err
+	}
+	return &api.WalletResponse{Uid: uid, Balance: wallet.Balance}, nil
+}
+
+func (s *service) GetWallet(uid string) (*api.WalletResponse, error) {
+	wallet, err := s.rep.GetWallet(uid)
+	if err != nil {
+		return nil, err
+	}
+	return &api.WalletResponse{Uid: uid, Balance: wallet.Balance}, nil
+}
+
+func (s *service) GetWalletStatement(uid string, filters map[string]string) (*api.WalletStatementResponse, error) {
+	startDate, err := time.ParseInLocation(time.DateOnly, filters["start_date"], models.Location())
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("start_date: %s decode failed", filters["start_date"]), models.DecodeFailureError)
+	}
+	endDate, err := time.ParseInLocation(time.DateOnly, filters["end_date"], models.Location())
+	if err != nil {
+		return nil, models.NewError(fmt.Sprintf("end_date: %s decode failed", filters["end_date"]), models.DecodeFailureError)
+	}
+	if startDate.After(endDate) {
+		return nil, models.NewError(fmt.Sprintf("start_date[%s] cannot be greater than end_date[%s]", models.DateToString(startDate), models.DateToString(endDate)), models.DecodeFailureError)
+	}
+	wallet, err := s.rep.GetWallet(uid)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.rep.WalletStatement(uid, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	res := &api.WalletStatementResponse{
+		Uid:     uid,
+		Balance: wallet.Balance,
+		Entries: make([]*api.WalletEntryResponse, 0, len(entries)),
+	}
+	for _, e := range entries {
+		res.Entries = append(res.Entries, &api.WalletEntryResponse{
+			Reference:    e.Reference,
+			Kind:         e.Kind,
+			Amount:       e.Amount,
+			BalanceAfter: e.BalanceAfter,
+			Created:      e.Created,
+		})
+	}
+	return res, nil
+}
+
+func (s *service) GetPaymentProfile(uid string) (*api.PaymentProfileResponse, error) {
+	provider, err := s.pay.ProviderFor(uid)
+	if err != nil {
+		return nil, err
+	}
+	return &api.PaymentProfileResponse{Uid: uid, Provider: provider}, nil
+}
+
+func (s *service) SetPaymentProfile(uid string, reqBody *api.PaymentProfileRequestBody) error {
+	if !s.pay.Has(reqBody.Provider) {
+		return models.NewError(
+			fmt.Sprintf("BadParameterValue: provider must be one of %v", s.pay.Names()),
+			models.DecodeFailureError,
+		)
+	}
+	return s.rep.SavePaymentProfile(&mysql.PaymentProfile{Uid: uid, Provider: reqBody.Provider})
+}
+
 func (s *service) DeleteSlots(deleteReqBody []*api.DeleteSlotRequestBody) error {
 	for _, reqBody := range deleteReqBody {
 		startDate := time.Time(reqBody.StartDate)
@@ -334,20 +841,21 @@ func (s *service) DeleteSlots(deleteReqBody []*api.DeleteSlotRequestBody) error
 			)
 		}
 		getOptions := &mysql.GetOptions{
+			Placement:          placementID(reqBody.Placement),
 			StartDate:          startDate,
 			EndDate:            endDate,
 			PositionStart:      models.Int32ToString(reqBody.Position[0]),
 			PositionEnd:        models.Int32ToString(reqBody.Position[1]),
 			PreloadTransaction: true,
 		}
-		getOptions.Query = fmt.Sprintf("status = '%s' OR status = '%s'", models.SlotStatusBooked, models.SlotStatusHold)
+		getOptions.Query = fmt.Sprintf("status IN ('%s', '%s', '%s')", models.SlotStatusBooked, models.SlotStatusHold, models.SlotStatusAuction)
 		bookedSlots, err := s.rep.SearchSlotsInRange(getOptions)
 		if err != nil {
 			return err
 		}
 		if len(bookedSlots) > 0 {
 			return models.NewError(
-				fmt.Sprintf("Attempting to delete booked or on-hold slots [start_date: %s, end_date: %s]", models.DateToString(startDate), models.DateToString(endDate)),
+				fmt.Sprintf("Attempting to delete booked, on-hold or auctioned slots [start_date: %s, end_date: %s]", models.DateToString(startDate), models.DateToString(endDate)),
 				models.ActionForbidden,
 			)
 		}
@@ -385,14 +893,35 @@ func (s *service) DeleteSlots(deleteReqBody []*api.DeleteSlotRequestBody) error
 	return nil
 }
 
-func (s *service) fetchSlotsFromReqBody(req *api.CreateSlotRequestBody, status *string) ([]*mysql.Slot, error) {
+// fetchSlotsFromReqBody builds the slots of the request in the windows of
+// the placement (days, hours or day parts) following the calendar, new slots
+// (with a status) are not created on blackout days and the cost of holidays
+// carries their uplift
+func (s *service) fetchSlotsFromReqBody(req *api.CreateSlotRequestBody, placement *mysql.Placement, status *string) ([]*mysql.Slot, error) {
+	return s.slotsOfRequest(req, placement, status, nil)
+}
+
+func (s *service) slotsOfRequest(req *api.CreateSlotRequestBody, placement *mysql.Placement, status *string, preceding map[string]bool) ([]*mysql.Slot, error) {
 	var slots []*mysql.Slot
-	for date := time.Time(req.StartDate); date.Before(time.Time(req.EndDate)) || date.Equal(time.Time(req.EndDate)); date = date.AddDate(0, 0, 1) {
-		if req.Position[0] > 1 {
+	calendar, err := s.calendar(time.Time(req.StartDate), time.Time(req.EndDate))
+	if err != nil {
+		return nil, err
+	}
+	windows, err := slotWindows(placement, time.Time(req.StartDate), time.Time(req.EndDate))
+	if err != nil {
+		return nil, err
+	}
+	for _, window := range windows {
+		date, endsAt := window[0], window[1]
+		day := calendar[models.DateToString(date)]
+		if status != nil && day != nil && day.Kind == models.CalendarBlackout {
+			continue
+		}
+		if req.Position[0] > 1 && !preceding[slotKey(req.Placement, date, req.Position[0]-1)] {
 			pos := models.Int32ToString(req.Position[0] - 1)
 			getOptions := &mysql.GetOptions{
-				StartDate:     date,
-				EndDate:       date,
+				Placement:     req.Placement,
+				Start:         &date,
 				PositionStart: pos,
 				PositionEnd:   pos,
 				Status:        "",
@@ -401,17 +930,19 @@ func (s *service) fetchSlotsFromReqBody(req *api.CreateSlotRequestBody, status *
 			preSlots, err := s.rep.SearchSlotsInRange(getOptions)
 			if err != nil || len(preSlots) == 0 {
 				return nil, models.NewError(
-					fmt.Sprintf("Invalid date[%s] or record with position '%d' doesn't exits", models.DateToString(date), req.Position[0]-1),
+					fmt.Sprintf("Invalid date[%s] or record with position '%d' doesn't exits", models.TimeToString(date), req.Position[0]-1),
 					models.DecodeFailureError,
 				)
 			}
 		}
 		for pos := req.Position[0]; pos <= req.Position[1]; pos++ {
-			slotDate, slotPos := date, pos
+			slotDate, slotEnd, slotPos := date, endsAt, pos
 			slot := &mysql.Slot{
-				Date:     &slotDate,
-				Position: &slotPos,
-				Cost:     req.Cost,
+				Placement: req.Placement,
+				Date:      &slotDate,
+				EndsAt:    &slotEnd,
+				Position:  &slotPos,
+				Cost:      dayCost(req.Cost, day),
 			}
 			if status != nil {
 				slot.Status = models.PtrString(models.SlotStatusOpen)
@@ -419,5 +950,11 @@ func (s *service) fetchSlotsFromReqBody(req *api.CreateSlotRequestBody, status *
 			slots = append(slots, slot)
 		}
 	}
+	if status != nil && len(slots) == 0 {
+		return nil, models.NewError(
+			fmt.Sprintf("No slots can be created between %s and %s, they are blackout days", models.DateToString(time.Time(req.StartDate)), models.DateToString(time.Time(req.EndDate))),
+			models.ActionForbidden,
+		)
+	}
 	return slots, nil
 }
@@ -0,0 +1,215 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// maxServingDays caps the days kept by the serving cache, requests can be
+// made for any date
+const maxServingDays = 1000
+
+// servingCache keeps what is served at the placements by day in memory, so
+// that serving doesn't query the database per request. It's cleared whenever
+// the storage changes slots, creatives or placements of the tenant, and its
+// days expire after the ttl to pick up the changes of other instances
+type servingCache struct {
+	mu  sync.RWMutex
+	ttl time.Duration
+	// generation counts the invalidations, days loaded before the last one are dropped
+	generation uint64
+	days       map[string]*servingDay
+}
+
+// servingDay holds the slots of a placement starting on a day, with their
+// creatives and the approved house ad of the placement
+type servingDay struct {
+	loaded    time.Time
+	slots     []*mysql.Slot
+	creatives map[string]*mysql.Creative
+	house     *mysql.Creative
+}
+
+func newServingCache(ttl time.Duration) *servingCache {
+	return &servingCache{ttl: ttl, days: make(map[string]*servingDay)}
+}
+
+func (c *servingCache) get(key string) (*servingDay, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if day, ok := c.days[key]; ok && time.Since(day.loaded) < c.ttl {
+		return day, c.generation
+	}
+	return nil, c.generation
+}
+
+// put keeps the day unless the cache was cleared while it was loaded. The
+// expired days are dropped, and the oldest one when the cache is full
+func (c *servingCache) put(key string, day *servingDay, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	var oldest string
+	for k, d := range c.days {
+		if time.Since(d.loaded) >= c.ttl {
+			delete(c.days, k)
+		} else if oldest == "" || d.loaded.Before(c.days[oldest].loaded) {
+			oldest = k
+		}
+	}
+	if _, ok := c.days[key]; !ok && len(c.days) >= maxServingDays {
+		delete(c.days, oldest)
+	}
+	c.days[key] = day
+}
+
+func (c *servingCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.days = make(map[string]*servingDay)
+}
+
+// Serve resolves the creative to show for every request, the booked slot
+// with its approved creative or else the house ad of the placement. A request
+// without date is served for the current time
+func (s *service) Serve(request []*api.ServeRequestBody) ([]*api.ServeResponse, error) {
+	res := make([]*api.ServeResponse, 0, len(request))
+	for _, r := range request {
+		at := time.Time(r.Date)
+		if at.IsZero() {
+			at = time.Now()
+		}
+		served, err := s.serve(placementID(r.Placement), at, *r.Position)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, served)
+	}
+	return res, nil
+}
+
+func (s *service) serve(placement string, at time.Time, position int32) (*api.ServeResponse, error) {
+	res := &api.ServeResponse{Placement: placement, Position: position, Source: models.ServeSourceNone}
+	today, err := s.servingDay(placement, models.StartOfDay(at))
+	if err != nil {
+		return nil, err
+	}
+	slot, creative := today.slotAt(at, position)
+	if slot == nil {
+		// windows ending after midnight started on the day before
+		yesterday, err := s.servingDay(placement, models.StartOfDay(at).AddDate(0, 0, -1))
+		if err != nil {
+			return nil, err
+		}
+		slot, creative = yesterday.slotAt(at, position)
+	}
+	if slot != nil {
+		res.Start = slot.Date.In(models.Location()).Format(time.RFC3339)
+		res.End = slotEnd(slot).In(models.Location()).Format(time.RFC3339)
+		res.Status = *slot.Status
+		if *slot.Status == models.SlotStatusBooked {
+			if creative != nil && creative.Status == models.CreativeStatusApproved {
+				res.Source = models.ServeSourceBooked
+				res.Creative = slotCreative(creative)
+				res.ImpressionUrl, res.ClickUrl = s.trackingURLs(slot, creative)
+				return res, nil
+			}
+			if !s.conf.HouseAdFallback {
+				return res, nil
+			}
+		}
+	}
+	if today.house != nil {
+		res.Source = models.ServeSourceHouse
+		res.Creative = slotCreative(today.house)
+		// house ads are only tracked in slots
+		if slot != nil {
+			res.ImpressionUrl, res.ClickUrl = s.trackingURLs(slot, today.house)
+		}
+	}
+	return res, nil
+}
+
+// servingDay returns the day of the placement from the cache, loading it from
+// the storage on a miss
+func (s *service) servingDay(placementID string, day time.Time) (*servingDay, error) {
+	key := placementID + ":" + models.DateToString(day)
+	cached, generation := s.serving.get(key)
+	if cached != nil {
+		return cached, nil
+	}
+	placement, err := s.rep.GetPlacement(placementID)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := s.rep.SearchSlotsInRange(&mysql.GetOptions{Placement: placementID, StartDate: day, EndDate: day})
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, slot := range slots {
+		if slot.CreativeID != nil {
+			ids = append(ids, *slot.CreativeID)
+		}
+	}
+	if placement.HouseCreativeID != nil {
+		ids = append(ids, *placement.HouseCreativeID)
+	}
+	creatives, err := s.rep.CreativesByIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+	loaded := &servingDay{loaded: time.Now(), slots: slots, creatives: creatives}
+	if placement.HouseCreativeID != nil {
+		if house, ok := creatives[*placement.HouseCreativeID]; ok && house.Status == models.CreativeStatusApproved {
+			loaded.house = house
+		}
+	}
+	s.serving.put(key, loaded, generation)
+	return loaded, nil
+}
+
+// warmServing loads the current day of every placement into the cache
+func (s *service) warmServing() {
+	placements, err := s.rep.Placements()
+	if err != nil {
+		s.log.Errorf("WarmServingCacheFailed:: [Error: %s]", err)
+		return
+	}
+	today := models.Today()
+	for _, placement := range placements {
+		if _, err = s.servingDay(placement.ID, today); err != nil {
+			s.log.Errorf("WarmServingCacheFailed:: [Placement: %s, Error: %s]", placement.ID, err)
+		}
+	}
+}
+
+// slotAt returns the slot at the position whose window contains the time,
+// with its creative
+func (d *servingDay) slotAt(at time.Time, position int32) (*mysql.Slot, *mysql.Creative) {
+	for _, slot := range d.slots {
+		if *slot.Position != position || at.Before(*slot.Date) || !at.Before(slotEnd(slot)) {
+			continue
+		}
+		if slot.CreativeID == nil {
+			return slot, nil
+		}
+		return slot, d.creatives[*slot.CreativeID]
+	}
+	return nil, nil
+}
+
+// slotEnd returns the end of the window of the slot, slots without one last the whole day
+func slotEnd(slot *mysql.Slot) time.Time {
+	if slot.EndsAt != nil {
+		return *slot.EndsAt
+	}
+	return slot.Date.AddDate(0, 0, 1)
+}
@@ -0,0 +1,340 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+func (s *service) CreateTemplate(reqBody *api.TemplateRequestBody) (*api.TemplateResponse, error) {
+	template, err := s.templateFromRequest(uuid.New().String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.rep.CreateTemplate(template); err != nil {
+		return nil, err
+	}
+	return templateResponse(template), nil
+}
+
+func (s *service) GetTemplates() ([]*api.TemplateResponse, error) {
+	templates, err := s.rep.Templates(false)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.TemplateResponse, 0, len(templates))
+	for _, template := range templates {
+		res = append(res, templateResponse(template))
+	}
+	return res, nil
+}
+
+func (s *service) GetTemplate(id string) (*api.TemplateResponse, error) {
+	template, err := s.rep.GetTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	return templateResponse(template), nil
+}
+
+// UpdateTemplate replaces the template, slots it generated before are kept
+func (s *service) UpdateTemplate(id string, reqBody *api.TemplateRequestBody) (*api.TemplateResponse, error) {
+	if _, err := s.rep.GetTemplate(id); err != nil {
+		return nil, err
+	}
+	template, err := s.templateFromRequest(id, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.rep.UpdateTemplate(template); err != nil {
+		return nil, err
+	}
+	return templateResponse(template), nil
+}
+
+func (s *service) DeleteTemplate(id string) error {
+	deleted, err := s.rep.DeleteTemplate(id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return models.NewError(fmt.Sprintf("Template %s not found", id), models.ResourceNotFoundError)
+	}
+	return nil
+}
+
+// PreviewTemplate shows the slots the template would generate between
+// start_date and end_date, by default over the days the scheduler covers
+func (s *service) PreviewTemplate(id string, filters map[string]string) ([]*api.GetSlotsResponse, error) {
+	template, err := s.rep.GetTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	startDate, endDate := s.templateWindow()
+	if filters["start_date"] != "" {
+		if startDate, err = time.ParseInLocation(time.DateOnly, filters["start_date"], models.Location()); err != nil {
+			return nil, models.NewError(fmt.Sprintf("start_date: %s decode failed", filters["start_date"]), models.DecodeFailureError)
+		}
+	}
+	if filters["end_date"] != "" {
+		if endDate, err = time.ParseInLocation(time.DateOnly, filters["end_date"], models.Location()); err != nil {
+			return nil, models.NewError(fmt.Sprintf("end_date: %s decode failed", filters["end_date"]), models.DecodeFailureError)
+		}
+	}
+	if startDate.After(endDate) {
+		return nil, models.NewError(fmt.Sprintf("start_date[%s] cannot be greater than end_date[%s]", models.DateToString(startDate), models.DateToString(endDate)), models.DecodeFailureError)
+	}
+	requests, err := s.templateRequests([]*mysql.InventoryTemplate{template}, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	calendar, err := s.calendar(startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	var slots []*mysql.Slot
+	for _, req := range requests {
+		placement, err := s.placement(req.Placement)
+		if err != nil {
+			return nil, err
+		}
+		windows, err := slotWindows(placement, time.Time(req.StartDate), time.Time(req.EndDate))
+		if err != nil {
+			return nil, err
+		}
+		for _, window := range windows {
+			for pos := req.Position[0]; pos <= req.Position[1]; pos++ {
+				slots = append(slots, &mysql.Slot{
+					Placement: req.Placement,
+					Date:      models.PtrDate(window[0]),
+					EndsAt:    models.PtrDate(window[1]),
+					Position:  models.PtrInt(pos),
+					Cost:      dayCost(req.Cost, calendar[models.DateToString(window[0])]),
+					Status:    models.PtrString(models.SlotStatusOpen),
+				})
+			}
+		}
+	}
+	res, err := ConvertSlotsToJSON(slots)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Date != res[j].Date {
+			return res[i].Date < res[j].Date
+		}
+		return res[i].Placement < res[j].Placement
+	})
+	return res, nil
+}
+
+// GenerateSlots materialises the slots of the active templates for the
+// configured days ahead, it returns the number of slots created
+func (s *service) GenerateSlots() (int, error) {
+	templates, err := s.rep.Templates(true)
+	if err != nil {
+		return 0, err
+	}
+	if len(templates) == 0 {
+		return 0, nil
+	}
+	startDate, endDate := s.templateWindow()
+	requests, err := s.templateRequests(templates, startDate, endDate)
+	if err != nil {
+		return 0, err
+	}
+	created, err := s.createSlots(requests, true)
+	if created > 0 {
+		s.log.Infof("Total %d slots generated from templates until %s", created, models.DateToString(endDate))
+	}
+	return created, err
+}
+
+func (s *service) templateWindow() (time.Time, time.Time) {
+	today := models.Today()
+	return today, today.AddDate(0, 0, s.conf.TemplateDaysAhead)
+}
+
+// templateRequests builds the create requests for the slots the templates
+// generate between start and end, leaving out blackout dates and the slots
+// which already exist. When templates of a placement overlap the earlier one
+// wins. The requests of a day are ordered by position and cover the missing
+// runs of positions, so that each of them follows a slot which exists or is
+// created before it
+func (s *service) templateRequests(templates []*mysql.InventoryTemplate, start, end time.Time) ([]*api.CreateSlotRequestBody, error) {
+	blackouts, err := s.rep.CalendarDays(start, end, models.CalendarBlackout)
+	if err != nil {
+		return nil, err
+	}
+	blackedOut := make(map[string]bool)
+	for _, b := range blackouts {
+		blackedOut[models.DateToString(*b.Date)] = true
+	}
+	existing, err := s.rep.SearchSlotsInRange(&mysql.GetOptions{StartDate: start, EndDate: end})
+	if err != nil {
+		return nil, err
+	}
+	planned := make(map[string]bool)
+	for _, slot := range existing {
+		planned[slotKey(slot.Placement, *slot.Date, *slot.Position)] = true
+	}
+	var placements []string
+	byPlacement := make(map[string][]*mysql.InventoryTemplate)
+	for _, template := range templates {
+		if _, ok := byPlacement[template.Placement]; !ok {
+			placements = append(placements, template.Placement)
+		}
+		byPlacement[template.Placement] = append(byPlacement[template.Placement], template)
+	}
+
+	var requests []*api.CreateSlotRequestBody
+	for date := start; !date.After(end); date = date.AddDate(0, 0, 1) {
+		if blackedOut[models.DateToString(date)] {
+			continue
+		}
+		for _, placement := range placements {
+			costs := make(map[int32]float64)
+			var maxPos int32
+			for _, template := range byPlacement[placement] {
+				for _, rule := range template.Rules {
+					if !ruleAppliesOn(rule, date.Weekday()) {
+						continue
+					}
+					for pos := rule.PositionStart; pos <= rule.PositionEnd; pos++ {
+						if _, ok := costs[pos]; !ok {
+							costs[pos] = rule.Cost
+						}
+					}
+					if rule.PositionEnd > maxPos {
+						maxPos = rule.PositionEnd
+					}
+				}
+			}
+			// runs of missing positions with the same cost
+			var run *api.CreateSlotRequestBody
+			for pos := int32(1); pos <= maxPos; pos++ {
+				cost, ok := costs[pos]
+				key := slotKey(placement, date, pos)
+				if !ok || planned[key] {
+					run = nil
+					continue
+				}
+				planned[key] = true
+				if run != nil && *run.Cost == cost {
+					run.Position[1] = pos
+					continue
+				}
+				run = &api.CreateSlotRequestBody{
+					Placement: placement,
+					StartDate: models.JSONDate(date),
+					EndDate:   models.JSONDate(date),
+					Position:  []int32{pos, pos},
+					Cost:      models.PtrFloat(cost),
+				}
+				requests = append(requests, run)
+			}
+		}
+	}
+	return requests, nil
+}
+
+func ruleAppliesOn(rule *mysql.TemplateRule, day time.Weekday) bool {
+	for _, name := range strings.Split(rule.Weekdays, ",") {
+		if weekdays[name] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// templateFromRequest validates the template, the rules of every weekday
+// must cover positions from 1 onwards without gaps or overlaps and stay
+// within the positions of the placement
+func (s *service) templateFromRequest(id string, reqBody *api.TemplateRequestBody) (*mysql.InventoryTemplate, error) {
+	if strings.TrimSpace(reqBody.Name) == "" {
+		return nil, models.NewError("BadParameterValue: name cannot be empty", models.DecodeFailureError)
+	}
+	if len(reqBody.Rules) == 0 {
+		return nil, models.NewError("BadParameterValue: rules cannot be empty", models.DecodeFailureError)
+	}
+	placement, err := s.placement(reqBody.Placement)
+	if err != nil {
+		return nil, err
+	}
+	template := &mysql.InventoryTemplate{ID: id, Name: reqBody.Name, Placement: placement.ID, Active: true}
+	if reqBody.Active != nil {
+		template.Active = *reqBody.Active
+	}
+	ranges := make(map[string][][2]int32)
+	for i, r := range reqBody.Rules {
+		if len(r.Weekdays) == 0 {
+			return nil, models.NewError(fmt.Sprintf("BadParameterValue: rules[%d].weekdays cannot be empty", i), models.DecodeFailureError)
+		}
+		if *r.Cost < 0 {
+			return nil, models.NewError(fmt.Sprintf("BadParameterValue: rules[%d].cost cannot be negative", i), models.DecodeFailureError)
+		}
+		if r.Position[0] < 1 {
+			return nil, models.NewError(fmt.Sprintf("BadParameterValue: rules[%d].position must start from 1", i), models.DecodeFailureError)
+		}
+		if placement.MaxPositions > 0 && r.Position[1] > placement.MaxPositions {
+			return nil, models.NewError(
+				fmt.Sprintf("BadParameterValue: rules[%d].position exceeds the %d positions of placement %s", i, placement.MaxPositions, placement.ID),
+				models.DecodeFailureError,
+			)
+		}
+		var names []string
+		for _, day := range r.Weekdays {
+			name := strings.ToLower(day)
+			if _, ok := weekdays[name]; !ok {
+				return nil, models.NewError(fmt.Sprintf("BadParameterValue: rules[%d].weekdays has invalid day '%s', use mon to sun", i, day), models.DecodeFailureError)
+			}
+			names = append(names, name)
+			ranges[name] = append(ranges[name], [2]int32{r.Position[0], r.Position[1]})
+		}
+		template.Rules = append(template.Rules, &mysql.TemplateRule{
+			TemplateID:    id,
+			Weekdays:      strings.Join(names, ","),
+			PositionStart: r.Position[0],
+			PositionEnd:   r.Position[1],
+			Cost:          *r.Cost,
+		})
+	}
+	for day, dayRanges := range ranges {
+		sort.Slice(dayRanges, func(i, j int) bool { return dayRanges[i][0] < dayRanges[j][0] })
+		next := int32(1)
+		for _, r := range dayRanges {
+			if r[0] != next {
+				return nil, models.NewError(
+					fmt.Sprintf("BadParameterValue: positions of '%s' must continue from %d without gaps or overlaps", day, next),
+					models.DecodeFailureError,
+				)
+			}
+			next = r[1] + 1
+		}
+	}
+	return template, nil
+}
+
+func templateResponse(template *mysql.InventoryTemplate) *api.TemplateResponse {
+	res := &api.TemplateResponse{
+		Id:        template.ID,
+		Name:      template.Name,
+		Placement: template.Placement,
+		Active:    template.Active,
+		Rules:     make([]*api.TemplateRuleResponse, 0, len(template.Rules)),
+	}
+	for _, rule := range template.Rules {
+		res.Rules = append(res.Rules, &api.TemplateRuleResponse{
+			Weekdays: strings.Split(rule.Weekdays, ","),
+			Position: []int32{rule.PositionStart, rule.PositionEnd},
+			Cost:     rule.Cost,
+		})
+	}
+	return res
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/auth"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// maxPendingDeliveryStats bounds the counts kept between two flushes, events
+// of further slots are dropped until the next flush
+const maxPendingDeliveryStats = 100000
+
+// maxSeenTrackingURLs bounds the counted urls kept until they expire, further
+// urls are not counted until the next flush drops the expired ones
+const maxSeenTrackingURLs = 1000000
+
+// trackingParams are the signed query params of the tracking urls
+var trackingParams = []string{"tenant", "placement", "date", "position", "creative", "url", "exp", "nonce", "sig"}
+
+// botAgents are parts of the user agents of crawlers, link previews, monitors
+// and scripts, their requests are not counted
+var botAgents = []string{
+	"bot", "crawl", "spider", "slurp", "facebookexternalhit", "preview", "headless", "lighthouse",
+	"pingdom", "monitor", "curl", "wget", "python-", "go-http-client", "java/", "okhttp", "libwww", "httpclient",
+}
+
+type deliveryKey struct {
+	placement string
+	date      int64
+	position  int32
+	creative  string
+}
+
+// deliveryBuffer adds up the tracked events until they are flushed to the storage
+type deliveryBuffer struct {
+	mu    sync.Mutex
+	stats map[deliveryKey]*mysql.DeliveryStat
+	// seen holds the expiry of the counted urls by signature, so that a
+	// replayed url is counted once by the instance
+	seen map[string]int64
+}
+
+func newDeliveryBuffer() *deliveryBuffer {
+	return &deliveryBuffer{stats: make(map[deliveryKey]*mysql.DeliveryStat), seen: make(map[string]int64)}
+}
+
+// markSeen records the url of the signature until it expires, it returns
+// false when the url was counted before or too many urls are kept
+func (b *deliveryBuffer) markSeen(sig string, exp int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.seen[sig]; ok || len(b.seen) >= maxSeenTrackingURLs {
+		return false
+	}
+	b.seen[sig] = exp
+	return true
+}
+
+func (b *deliveryBuffer) add(stat *mysql.DeliveryStat) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := deliveryKey{placement: stat.Placement, date: stat.Date.UnixNano(), position: *stat.Position, creative: stat.CreativeID}
+	pending, ok := b.stats[key]
+	if !ok {
+		if len(b.stats) >= maxPendingDeliveryStats {
+			return false
+		}
+		b.stats[key] = stat
+		return true
+	}
+	pending.Impressions += stat.Impressions
+	pending.Clicks += stat.Clicks
+	return true
+}
+
+func (b *deliveryBuffer) take() []*mysql.DeliveryStat {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := make([]*mysql.DeliveryStat, 0, len(b.stats))
+	for _, stat := range b.stats {
+		stats = append(stats, stat)
+	}
+	b.stats = make(map[deliveryKey]*mysql.DeliveryStat)
+	now := time.Now().Unix()
+	for sig, exp := range b.seen {
+		if now > exp {
+			delete(b.seen, sig)
+		}
+	}
+	return stats
+}
+
+// Track counts an impression or click of a creative in a slot from the
+// signed params of a tracking url until it expires, requests of bots and
+// prefetches and replays of a counted url are not counted. It returns the url
+// clicks are redirected to
+func (s *service) Track(kind string, params map[string]string) (string, error) {
+	values := url.Values{}
+	for _, k := range trackingParams {
+		if v, ok := params[k]; ok {
+			values.Set(k, v)
+		}
+	}
+	if !auth.VerifyValues(s.conf.TrackingSecret, values) || values.Get("tenant") != s.conf.Tenant {
+		return "", models.NewError("Invalid tracking signature", models.ActionForbidden)
+	}
+	exp, err := strconv.ParseInt(values.Get("exp"), 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return "", models.NewError("Tracking url expired", models.ActionForbidden)
+	}
+	date, err := models.ParseTime(values.Get("date"))
+	if err != nil {
+		return "", models.NewError(fmt.Sprintf("date: %s decode failed", values.Get("date")), models.DecodeFailureError)
+	}
+	position, err := strconv.ParseInt(values.Get("position"), 10, 32)
+	if err != nil {
+		return "", models.NewError(fmt.Sprintf("position: %s decode failed", values.Get("position")), models.DecodeFailureError)
+	}
+	if isBot(params["user_agent"]) || strings.Contains(strings.ToLower(params["purpose"]), "prefetch") {
+		return values.Get("url"), nil
+	}
+	if !s.delivery.markSeen(kind+"|"+values.Get("sig"), exp) {
+		s.log.Debugf("TrackingDropped:: Tracking url counted before [Kind: %s, Slot: %s]", kind, values.Encode())
+		return values.Get("url"), nil
+	}
+	stat := &mysql.DeliveryStat{
+		Placement:  values.Get("placement"),
+		Date:       &date,
+		Position:   models.PtrInt(int32(position)),
+		CreativeID: values.Get("creative"),
+	}
+	if kind == models.TrackClick {
+		stat.Clicks = 1
+	} else {
+		stat.Impressions = 1
+	}
+	if !s.delivery.add(stat) {
+		s.log.Warnf("TrackingDropped:: Too many pending delivery stats [Kind: %s, Slot: %s]", kind, values.Encode())
+	}
+	return values.Get("url"), nil
+}
+
+// FlushTracking writes the tracked events to the storage, they are kept for
+// the next flush when it fails
+func (s *service) FlushTracking() (int, error) {
+	stats := s.delivery.take()
+	if len(stats) == 0 {
+		return 0, nil
+	}
+	if err := s.rep.AddDeliveryStats(stats); err != nil {
+		for _, stat := range stats {
+			s.delivery.add(stat)
+		}
+		return 0, err
+	}
+	return len(stats), nil
+}
+
+// trackingURLs returns the signed impression and click urls of the creative
+// served in the slot, there is no click url without click_url of the creative.
+// The urls expire after TrackingURLTTL, the nonce tells the serves apart so that
+// each of them is counted once
+func (s *service) trackingURLs(slot *mysql.Slot, creative *mysql.Creative) (string, string) {
+	values := url.Values{
+		"tenant":    {s.conf.Tenant},
+		"placement": {slot.Placement},
+		"date":      {models.TimeToString(*slot.Date)},
+		"position":  {models.Int32ToString(*slot.Position)},
+		"creative":  {creative.ID},
+		"exp":       {strconv.FormatInt(time.Now().Add(s.conf.TrackingURLTTL).Unix(), 10)},
+		"nonce":     {uuid.New().String()},
+	}
+	values.Set("sig", auth.SignValues(s.conf.TrackingSecret, values))
+	impression := "/track/impression?" + values.Encode()
+	if creative.ClickURL == "" {
+		return impression, ""
+	}
+	values.Set("url", creative.ClickURL)
+	values.Set("sig", auth.SignValues(s.conf.TrackingSecret, values))
+	return impression, "/track/click?" + values.Encode()
+}
+
+// describeDelivery adds the tracked impressions and clicks to the slots
+func (s *service) describeDelivery(res []*api.GetSlotsResponse, placement string, start, end time.Time) error {
+	if len(res) == 0 {
+		return nil
+	}
+	stats, err := s.rep.DeliveryStats(placement, start, end)
+	if err != nil {
+		return err
+	}
+	delivery := make(map[string]*api.DeliveryStats)
+	for _, stat := range stats {
+		key := deliverySlotKey(stat.Placement, stat.Date.In(models.Location()).Format(time.RFC3339), *stat.Position)
+		if _, ok := delivery[key]; !ok {
+			delivery[key] = &api.DeliveryStats{}
+		}
+		delivery[key].Impressions += stat.Impressions
+		delivery[key].Clicks += stat.Clicks
+	}
+	for _, group := range res {
+		for _, slot := range group.Slots {
+			slot.Delivery = delivery[deliverySlotKey(group.Placement, slot.Start, slot.Position)]
+		}
+	}
+	return nil
+}
+
+func deliverySlotKey(placement, start string, position int32) string {
+	return fmt.Sprintf("%s|%s|%d", placement, start, position)
+}
+
+func isBot(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+	userAgent = strings.ToLower(userAgent)
+	for _, bot := range botAgents {
+		if strings.Contains(userAgent, bot) {
+			return true
+		}
+	}
+	return false
+}
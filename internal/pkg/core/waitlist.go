@@ -0,0 +1,216 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// JoinWaitlist queues the advertiser for slots which are booked, held or
+// closed, open slots should be reserved instead
+func (s *service) JoinWaitlist(request []*api.ReserveSlotRequestBody, uid string) ([]*api.WaitlistEntryResponse, error) {
+	if err := s.checkBookable(uid, requestDates(request)...); err != nil {
+		return nil, err
+	}
+	var entries []*mysql.WaitlistEntry
+	for _, r := range request {
+		date := time.Time(r.Date)
+		pos := models.Int32ToString(*r.Position)
+		placement := placementID(r.Placement)
+		slots, err := s.rep.SearchSlotsInRange(&mysql.GetOptions{
+			Placement:     placement,
+			Start:         &date,
+			PositionStart: pos,
+			PositionEnd:   pos,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(slots) == 0 {
+			return nil, models.NewError(
+				fmt.Sprintf("Slot with [placement: %s, date: %s, position: %d] not found", placement, models.TimeToString(date), *r.Position),
+				models.ResourceNotFoundError,
+			)
+		}
+		if *slots[0].Status == models.SlotStatusOpen {
+			return nil, models.NewError(
+				fmt.Sprintf("Slot with [placement: %s, date: %s, position: %d] is open and can be reserved", placement, models.TimeToString(date), *r.Position),
+				models.ActionForbidden,
+			)
+		}
+		entries = append(entries, &mysql.WaitlistEntry{
+			ID:        uuid.New().String(),
+			Placement: placement,
+			Date:      models.PtrDate(date),
+			Position:  r.Position,
+			Uid:       uid,
+			Status:    models.WaitlistStatusWaiting,
+		})
+	}
+	if err := s.rep.CreateWaitlistEntries(entries); err != nil {
+		return nil, err
+	}
+	res := make([]*api.WaitlistEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		res = append(res, waitlistEntryResponse(entry))
+	}
+	return res, nil
+}
+
+func (s *service) GetWaitlist(uid string) ([]*api.WaitlistEntryResponse, error) {
+	entries, err := s.rep.WaitlistEntries(uid, "")
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*api.WaitlistEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		res = append(res, waitlistEntryResponse(entry))
+	}
+	return res, nil
+}
+
+// LeaveWaitlist removes the advertiser from the waitlist, a pending offer is
+// released and passed to the next advertiser
+func (s *service) LeaveWaitlist(id, uid string) error {
+	entry, err := s.rep.GetWaitlistEntry(id)
+	if err != nil {
+		return err
+	}
+	if entry.Uid != uid {
+		return models.NewError(fmt.Sprintf("Waitlist entry %s does not belong to %s", id, uid), models.ActionForbidden)
+	}
+	switch entry.Status {
+	case models.WaitlistStatusWaiting:
+		ok, err := s.rep.UpdateWaitlistEntry(id, models.WaitlistStatusWaiting, models.WaitlistStatusLeft, nil)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	case models.WaitlistStatusOffered:
+		hold, err := s.rep.GetHold(*entry.HoldID)
+		if err != nil {
+			return err
+		}
+		if hold.Status != models.HoldStatusActive {
+			break
+		}
+		ok, err := s.rep.UpdateWaitlistEntry(id, models.WaitlistStatusOffered, models.WaitlistStatusLeft, nil)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if _, err = s.rep.ReleaseHold(hold.ID, models.HoldStatusReleased); err != nil {
+			return err
+		}
+		s.offerOpenedSlots()
+		return nil
+	}
+	return models.NewError(fmt.Sprintf("Waitlist entry %s is %s and cannot be left", id, entry.Status), models.ActionForbidden)
+}
+
+// ProcessWaitlist settles the offers whose holds were confirmed, released or
+// expired and offers the opened slots to the first advertiser waiting for them,
+// it returns the number of offers made
+func (s *service) ProcessWaitlist() (int, error) {
+	s.waitlistMu.Lock()
+	defer s.waitlistMu.Unlock()
+
+	offered, err := s.rep.WaitlistEntries("", models.WaitlistStatusOffered)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range offered {
+		hold, err := s.rep.GetHold(*entry.HoldID)
+		if err != nil {
+			return 0, err
+		}
+		switch hold.Status {
+		case models.HoldStatusConfirmed:
+			if _, err = s.rep.UpdateWaitlistEntry(entry.ID, models.WaitlistStatusOffered, models.WaitlistStatusAccepted, nil); err != nil {
+				return 0, err
+			}
+		case models.HoldStatusReleased, models.HoldStatusExpired:
+			ok, err := s.rep.UpdateWaitlistEntry(entry.ID, models.WaitlistStatusOffered, models.WaitlistStatusExpired, nil)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				s.publish(models.EventWaitlistOfferExpired, waitlistOfferEvent(entry, hold))
+			}
+		}
+	}
+
+	next, err := s.rep.NextWaitlistOffers()
+	if err != nil {
+		return 0, err
+	}
+	offers := 0
+	for _, entry := range next {
+		request := []*api.ReserveSlotRequestBody{{Placement: entry.Placement, Date: models.JSONDate(*entry.Date), Position: entry.Position}}
+		hold, err := s.createHold(request, entry.Uid, s.conf.WaitlistOfferTTL)
+		if err != nil {
+			// the slot was taken since it opened, the entry keeps waiting
+			if mErr, ok := err.(*models.Error); ok && mErr.Type == models.ActionForbidden {
+				continue
+			}
+			return offers, err
+		}
+		ok, err := s.rep.UpdateWaitlistEntry(entry.ID, models.WaitlistStatusWaiting, models.WaitlistStatusOffered, models.PtrString(hold.ID))
+		if err == nil && !ok {
+			err = models.NewError(fmt.Sprintf("Waitlist entry %s is no longer waiting", entry.ID), models.ActionForbidden)
+		}
+		if err != nil {
+			if _, rErr := s.rep.ReleaseHold(hold.ID, models.HoldStatusReleased); rErr != nil {
+				s.log.Errorf("ProcessWaitlist:: failed to release hold %s [Error: %s]", hold.ID, rErr)
+			}
+			s.log.Errorf("ProcessWaitlist:: failed to offer slot to entry %s [Error: %s]", entry.ID, err)
+			continue
+		}
+		s.publish(models.EventWaitlistOffered, waitlistOfferEvent(entry, hold))
+		offers++
+	}
+	if offers > 0 {
+		s.log.Infof("Total %d waitlisted slots offered", offers)
+	}
+	return offers, nil
+}
+
+// offerOpenedSlots offers the slots which just opened to the waitlist, the
+// scheduled job retries on failures
+func (s *service) offerOpenedSlots() {
+	if _, err := s.ProcessWaitlist(); err != nil {
+		s.log.Errorf("ProcessWaitlistFailed:: %s", err)
+	}
+}
+
+func waitlistEntryResponse(entry *mysql.WaitlistEntry) *api.WaitlistEntryResponse {
+	return &api.WaitlistEntryResponse{
+		Id:        entry.ID,
+		Placement: entry.Placement,
+		Date:      models.TimeToString(*entry.Date),
+		Position:  *entry.Position,
+		Uid:       entry.Uid,
+		Status:    entry.Status,
+		HoldId:    entry.HoldID,
+	}
+}
+
+func waitlistOfferEvent(entry *mysql.WaitlistEntry, hold *mysql.Hold) *api.WaitlistOfferEvent {
+	return &api.WaitlistOfferEvent{
+		EntryId:   entry.ID,
+		Uid:       entry.Uid,
+		Placement: entry.Placement,
+		Date:      models.TimeToString(*entry.Date),
+		Position:  *entry.Position,
+		HoldId:    hold.ID,
+		ExpiresAt: hold.ExpiresAt,
+	}
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Event notifies other systems about something which happened in admgr
+type Event struct {
+	Type    string      `json:"type"`
+	Tenant  string      `json:"tenant,omitempty"`
+	Created time.Time   `json:"created"`
+	Data    interface{} `json:"data"`
+}
+
+func New(eventType string, data interface{}) *Event {
+	return &Event{Type: eventType, Created: time.Now().UTC(), Data: data}
+}
+
+// Publisher delivers events, publishing never blocks the caller and
+// delivery failures are only logged
+type Publisher interface {
+	Publish(event *Event)
+}
+
+type logPublisher struct {
+	log *logrus.Logger
+}
+
+// NewLogPublisher writes the events to the log, it is used when no webhook
+// is configured
+func NewLogPublisher(log *logrus.Logger) Publisher {
+	return &logPublisher{log: log}
+}
+
+func (p *logPublisher) Publish(event *Event) {
+	data, _ := json.Marshal(event)
+	p.log.Infof("Event:: %s", data)
+}
+
+type webhookPublisher struct {
+	log    *logrus.Logger
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPublisher posts the events as JSON to the url
+func NewWebhookPublisher(log *logrus.Logger, url string, timeout time.Duration) Publisher {
+	return &webhookPublisher{log: log, url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (p *webhookPublisher) Publish(event *Event) {
+	go func() {
+		data, err := json.Marshal(event)
+		if err != nil {
+			p.log.Errorf("EventEncodingFailed:: [Type: %s, Error: %s]", event.Type, err)
+			return
+		}
+		res, err := p.client.Post(p.url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			p.log.Errorf("EventDeliveryFailed:: [Type: %s, Error: %s]", event.Type, err)
+			return
+		}
+		defer res.Body.Close()
+		if res.StatusCode >= http.StatusMultipleChoices {
+			p.log.Errorf("EventDeliveryFailed:: [Type: %s, StatusCode: %d]", event.Type, res.StatusCode)
+		}
+	}()
+}
@@ -1,3 +1,29 @@
 package rest
 
 // Any constants which are needed by rest package can be defined here.
+
+// tenantServiceKey holds the service of the request's tenant in the gin context
+const tenantServiceKey = "admgr.tenant_service"
+
+// callerUidKey holds the uid of the advertiser or operator making the request
+const callerUidKey = "admgr.caller_uid"
+
+// requestIDHeader carries the id of a request, it's generated when the
+// client doesn't send one and recorded with the changes of the request
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request id kept from the client
+const maxRequestIDLength = 64
+
+// anonymousActor is the actor of the changes of requests without token or uid
+const anonymousActor = "anonymous"
+
+// timezoneHeader names the business time zone the dates of a response are in
+const timezoneHeader = "X-Timezone"
+
+// trackingPixel is a transparent 1x1 gif
+var trackingPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/kiran-anand14/admgr/internal/pkg/models"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,23 +18,104 @@ import (
 )
 
 var (
-	logger  *logrus.Logger
-	service core.Service
+	logger     *logrus.Logger
+	services   map[string]core.Service
+	authSecret string
 )
 
-func Handler(log *logrus.Logger, s core.Service, writer io.Writer) (*gin.Engine, error) {
+// Handler serves the services of the tenants. When secret is set every request
+// must carry a bearer token signed with it, whose tenant claim selects the
+// service, else all requests belong to the default tenant
+func Handler(log *logrus.Logger, s map[string]core.Service, secret string, writer io.Writer) (*gin.Engine, error) {
 	logger = log
-	service = s
+	services = s
+	authSecret = secret
 
 	r := gin.Default()
 	gin.DefaultWriter = writer
-	// Add all HTTP routes here.
-	r.POST("/adslots", createSlotHandler)
-	r.GET("/adslots", getSlotHandler)
-	r.PATCH("/adslots", updateSlotHandler)
-	r.DELETE("/adslots", deleteSlotHandler)
-	r.PATCH("/adslots/reserve", reserveSlotHandler)
+	r.Use(func(c *gin.Context) {
+		c.Header(timezoneHeader, models.Location().String())
+	})
 	r.GET("/health-check", healthCheck)
+	r.GET("/readiness", readinessHandler)
+	// The tracking urls are loaded by browsers without a token, they are signed instead
+	tr := r.Group("/track", trackingMiddleware)
+	tr.GET("/impression", trackImpressionHandler)
+	tr.GET("/click", trackClickHandler)
+
+	// Add all HTTP routes of the tenants here.
+	t := r.Group("/", tenantMiddleware)
+	t.POST("/adslots", createSlotHandler)
+	t.POST("/adslots/import", importSlotsHandler)
+	t.GET("/adslots/export", exportSlotsHandler)
+	t.GET("/adslots/audit", getSlotAuditsHandler)
+	t.GET("/adslots", getSlotHandler)
+	t.PATCH("/adslots", updateSlotHandler)
+	t.DELETE("/adslots", deleteSlotHandler)
+	t.POST("/adslots/restore", restoreSlotHandler)
+	t.PATCH("/adslots/reserve", reserveSlotHandler)
+	t.PATCH("/adslots/cancel", cancelReservationHandler)
+	t.PATCH("/adslots/creative", attachCreativeHandler)
+	t.GET("/serve", serveHandler)
+	t.POST("/serve/batch", serveBatchHandler)
+	t.POST("/adslots/holds", createHoldHandler)
+	t.GET("/adslots/holds/:id", getHoldHandler)
+	t.POST("/adslots/holds/:id/confirm", confirmHoldHandler)
+	t.DELETE("/adslots/holds/:id", releaseHoldHandler)
+	t.POST("/adslots/waitlist", joinWaitlistHandler)
+	t.GET("/adslots/waitlist", getWaitlistHandler)
+	t.DELETE("/adslots/waitlist/:id", leaveWaitlistHandler)
+	t.POST("/auctions", createAuctionsHandler)
+	t.GET("/auctions", getAuctionsHandler)
+	t.GET("/auctions/:id", getAuctionHandler)
+	t.POST("/auctions/:id/bids", placeBidHandler)
+	t.POST("/placements", createPlacementHandler)
+	t.GET("/placements", getPlacementsHandler)
+	t.GET("/placements/:id", getPlacementHandler)
+	t.PUT("/placements/:id", updatePlacementHandler)
+	t.DELETE("/placements/:id", deletePlacementHandler)
+	t.POST("/advertisers", createAdvertiserHandler)
+	t.GET("/advertisers", getAdvertisersHandler)
+	t.GET("/advertisers/:id", getAdvertiserHandler)
+	t.PUT("/advertisers/:id", updateAdvertiserHandler)
+	t.DELETE("/advertisers/:id", deleteAdvertiserHandler)
+	t.POST("/campaigns", createCampaignHandler)
+	t.GET("/campaigns", getCampaignsHandler)
+	t.GET("/campaigns/:id", getCampaignHandler)
+	t.PUT("/campaigns/:id", updateCampaignHandler)
+	t.DELETE("/campaigns/:id", deleteCampaignHandler)
+	t.POST("/creatives", createCreativeHandler)
+	t.GET("/creatives", getCreativesHandler)
+	t.GET("/creatives/review", getCreativeReviewsHandler)
+	t.GET("/creatives/:id", getCreativeHandler)
+	t.GET("/creatives/:id/content", getCreativeContentHandler)
+	t.DELETE("/creatives/:id", deleteCreativeHandler)
+	t.POST("/creatives/:id/review", reviewCreativeHandler)
+	t.POST("/templates", createTemplateHandler)
+	t.GET("/templates", getTemplatesHandler)
+	t.GET("/templates/:id", getTemplateHandler)
+	t.PUT("/templates/:id", updateTemplateHandler)
+	t.DELETE("/templates/:id", deleteTemplateHandler)
+	t.GET("/templates/:id/preview", previewTemplateHandler)
+	t.GET("/calendar", getCalendarHandler)
+	t.POST("/calendar/import", importCalendarHandler)
+	t.PUT("/calendar/:date", setCalendarDayHandler)
+	t.DELETE("/calendar/:date", deleteCalendarDayHandler)
+	t.POST("/carts", createCartHandler)
+	t.GET("/carts/:id", getCartHandler)
+	t.POST("/carts/:id/items", addCartItemsHandler)
+	t.DELETE("/carts/:id/items", removeCartItemsHandler)
+	t.GET("/carts/:id/validate", validateCartHandler)
+	t.POST("/carts/:id/checkout", checkoutCartHandler)
+	t.POST("/wallets/:uid/topup", topUpWalletHandler)
+	t.GET("/wallets/:uid", getWalletHandler)
+	t.GET("/wallets/:uid/statement", getWalletStatementHandler)
+	t.GET("/payment-profiles/:uid", getPaymentProfileHandler)
+	t.PUT("/payment-profiles/:uid", setPaymentProfileHandler)
+	t.GET("/reports/occupancy", occupancyReportHandler)
+	t.GET("/reports/revenue", revenueReportHandler)
+	t.GET("/reports/advertisers", topAdvertisersReportHandler)
+	t.GET("/reports/lead-time", leadTimeReportHandler)
 
 	return r, nil
 }
@@ -42,6 +124,15 @@ func healthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, nil)
 }
 
+func readinessHandler(c *gin.Context) {
+	res := readinessService().Readiness()
+	if !res.Ready {
+		c.JSON(http.StatusServiceUnavailable, res)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
 func createSlotHandler(c *gin.Context) {
 	var requestBody []*api.CreateSlotRequestBody
 	err := json.NewDecoder(c.Request.Body).Decode(&requestBody)
@@ -55,7 +146,7 @@ func createSlotHandler(c *gin.Context) {
 			return
 		}
 	}
-	er := service.CreateSlots(requestBody)
+	er := tenantService(c).CreateSlots(requestBody)
 	if er != nil {
 		httpCode, msg := getHttpCodeAndMessage(er)
 		if msg == "" {
@@ -69,6 +160,44 @@ func createSlotHandler(c *gin.Context) {
 	return
 }
 
+// importSlotsHandler takes the CSV or XLSX file as the request body, it
+// answers with the report of the rows, with 400 when a row is invalid and
+// nothing was created
+func importSlotsHandler(c *gin.Context) {
+	params, _ := requiredQueryParams(c)
+	params["content_type"] = c.ContentType()
+	res, err := tenantService(c).ImportSlots(c.Request.Body, params)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	switch {
+	case len(res.Errors) > 0 && !res.DryRun && res.Created == 0:
+		c.JSON(http.StatusBadRequest, res)
+	case res.Created > 0:
+		c.JSON(http.StatusCreated, res)
+	default:
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// getSlotAuditsHandler answers with the audit log of the slots, filtered by
+// slot, actor and time range
+func getSlotAuditsHandler(c *gin.Context) {
+	params, ok := requiredQueryParams(c, "uid")
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).GetSlotAudits(params)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
 func getSlotHandler(c *gin.Context) {
 	reqParams, requiredParams := c.Request.URL.Query(), map[string]bool{"start_date": true, "end_date": true}
 	params := make(map[string]string)
@@ -81,7 +210,7 @@ func getSlotHandler(c *gin.Context) {
 			return
 		}
 	}
-	res, er := service.GetSlots(params)
+	res, er := tenantService(c).GetSlots(params)
 	if er != nil {
 		httpCode, msg := getHttpCodeAndMessage(er)
 		if msg == "" {
@@ -107,7 +236,7 @@ func updateSlotHandler(c *gin.Context) {
 			return
 		}
 	}
-	affected, err := service.PatchSlots(requestBody)
+	affected, err := tenantService(c).PatchSlots(requestBody)
 	if err != nil {
 		httpCode, erMsg := getHttpCodeAndMessage(err)
 		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
@@ -129,7 +258,7 @@ func deleteSlotHandler(c *gin.Context) {
 			return
 		}
 	}
-	err = service.DeleteSlots(requestBody)
+	err = tenantService(c).DeleteSlots(requestBody)
 	if err != nil {
 		httpCode, erMsg := getHttpCodeAndMessage(err)
 		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
@@ -138,6 +267,33 @@ func deleteSlotHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+// restoreSlotHandler brings back the deleted slots of the ranges of the body,
+// the uid param must name an operator
+func restoreSlotHandler(c *gin.Context) {
+	var requestBody []*api.DeleteSlotRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	for i, req := range requestBody {
+		if err := api.ValidateWithTags(req, fmt.Sprintf(".[%d].", i)); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+			return
+		}
+	}
+	params, ok := requiredQueryParams(c, "uid")
+	if !ok {
+		return
+	}
+	restored, err := tenantService(c).RestoreSlots(requestBody, params["uid"])
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Total %d records restored", restored)})
+}
+
 func reserveSlotHandler(c *gin.Context) {
 	var requestBody []*api.ReserveSlotRequestBody
 	err := json.NewDecoder(c.Request.Body).Decode(&requestBody)
@@ -151,12 +307,988 @@ func reserveSlotHandler(c *gin.Context) {
 			return
 		}
 	}
-	uid := c.Query("uid")
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	err = tenantService(c).ReserveSlots(requestBody, uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func cancelReservationHandler(c *gin.Context) {
+	var requestBody []*api.ReserveSlotRequestBody
+	err := json.NewDecoder(c.Request.Body).Decode(&requestBody)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	for i, slotRequest := range requestBody {
+		if err := api.ValidateWithTags(slotRequest, fmt.Sprintf(".[%d].", i)); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+			return
+		}
+	}
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	err = tenantService(c).CancelReservation(requestBody, uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func createHoldHandler(c *gin.Context) {
+	var requestBody []*api.ReserveSlotRequestBody
+	err := json.NewDecoder(c.Request.Body).Decode(&requestBody)
+	if err != nil || len(requestBody) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	for i, slotRequest := range requestBody {
+		if err := api.ValidateWithTags(slotRequest, fmt.Sprintf(".[%d].", i)); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+			return
+		}
+	}
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).CreateHold(requestBody, uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func getHoldHandler(c *gin.Context) {
+	res, err := tenantService(c).GetHold(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func confirmHoldHandler(c *gin.Context) {
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).ConfirmHold(c.Param("id"), uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func releaseHoldHandler(c *gin.Context) {
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	err := tenantService(c).ReleaseHold(c.Param("id"), uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// decodeSlotRequests decodes and validates a list of slots from the request
+// body, an empty body is accepted when optional is set
+func decodeSlotRequests(c *gin.Context, optional bool) ([]*api.ReserveSlotRequestBody, bool) {
+	var requestBody []*api.ReserveSlotRequestBody
+	err := json.NewDecoder(c.Request.Body).Decode(&requestBody)
+	if optional && err == io.EOF {
+		return requestBody, true
+	}
+	if err != nil || len(requestBody) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return nil, false
+	}
+	for i, slotRequest := range requestBody {
+		if err := api.ValidateWithTags(slotRequest, fmt.Sprintf(".[%d].", i)); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+			return nil, false
+		}
+	}
+	return requestBody, true
+}
+
+func joinWaitlistHandler(c *gin.Context) {
+	requestBody, ok := decodeSlotRequests(c, false)
+	if !ok {
+		return
+	}
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).JoinWaitlist(requestBody, uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func getWaitlistHandler(c *gin.Context) {
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).GetWaitlist(uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func leaveWaitlistHandler(c *gin.Context) {
+	uid := callerUid(c)
 	if uid == "" {
 		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
 		return
 	}
-	err = service.ReserveSlots(requestBody, uid)
+	err := tenantService(c).LeaveWaitlist(c.Param("id"), uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func createPlacementHandler(c *gin.Context) {
+	var requestBody api.PlacementRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	res, err := tenantService(c).CreatePlacement(&requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func getPlacementsHandler(c *gin.Context) {
+	res, err := tenantService(c).GetPlacements()
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func getPlacementHandler(c *gin.Context) {
+	res, err := tenantService(c).GetPlacement(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func updatePlacementHandler(c *gin.Context) {
+	var requestBody api.PlacementRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	res, err := tenantService(c).UpdatePlacement(c.Param("id"), &requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func deletePlacementHandler(c *gin.Context) {
+	err := tenantService(c).DeletePlacement(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func createAdvertiserHandler(c *gin.Context) {
+	var requestBody api.AdvertiserRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	res, err := tenantService(c).CreateAdvertiser(&requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func getAdvertisersHandler(c *gin.Context) {
+	res, err := tenantService(c).GetAdvertisers()
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func getAdvertiserHandler(c *gin.Context) {
+	res, err := tenantService(c).GetAdvertiser(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func updateAdvertiserHandler(c *gin.Context) {
+	var requestBody api.AdvertiserRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	res, err := tenantService(c).UpdateAdvertiser(c.Param("id"), &requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func deleteAdvertiserHandler(c *gin.Context) {
+	err := tenantService(c).DeleteAdvertiser(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func createCampaignHandler(c *gin.Context) {
+	var requestBody api.CampaignRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	res, err := tenantService(c).CreateCampaign(&requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func getCampaignsHandler(c *gin.Context) {
+	res, err := tenantService(c).GetCampaigns(map[string]string{"advertiser_id": c.Query("advertiser_id")})
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func getCampaignHandler(c *gin.Context) {
+	res, err := tenantService(c).GetCampaign(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func updateCampaignHandler(c *gin.Context) {
+	var requestBody api.CampaignRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	res, err := tenantService(c).UpdateCampaign(c.Param("id"), &requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func deleteCampaignHandler(c *gin.Context) {
+	err := tenantService(c).DeleteCampaign(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// serveHandler returns the creative to show at a position, at the time or
+// date of the date param or now when it's missing
+func serveHandler(c *gin.Context) {
+	params, ok := requiredQueryParams(c, "position")
+	if !ok {
+		return
+	}
+	position, err := strconv.ParseInt(params["position"], 10, 32)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("position: %s decode failed", params["position"])})
+		return
+	}
+	request := &api.ServeRequestBody{Placement: params["placement"], Position: models.PtrInt(int32(position))}
+	if params["date"] != "" {
+		date, err := models.ParseTime(params["date"])
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("date: %s decode failed", params["date"])})
+			return
+		}
+		request.Date = models.JSONDate(date)
+	}
+	res, err := tenantService(c).Serve([]*api.ServeRequestBody{request})
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res[0])
+}
+
+func serveBatchHandler(c *gin.Context) {
+	var requestBody []*api.ServeRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil || len(requestBody) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	for i, serveRequest := range requestBody {
+		if err := api.ValidateWithTags(serveRequest, fmt.Sprintf(".[%d].", i)); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+			return
+		}
+	}
+	res, err := tenantService(c).Serve(requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// trackImpressionHandler counts an impression and answers with a transparent pixel
+func trackImpressionHandler(c *gin.Context) {
+	if _, ok := track(c, models.TrackImpression); !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/gif", trackingPixel)
+}
+
+// trackClickHandler counts a click and redirects to the click url of the creative
+func trackClickHandler(c *gin.Context) {
+	target, ok := track(c, models.TrackClick)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	if target == "" {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+func track(c *gin.Context, kind string) (string, bool) {
+	params, _ := requiredQueryParams(c)
+	params["user_agent"] = c.Request.UserAgent()
+	params["purpose"] = c.GetHeader("Purpose") + c.GetHeader("Sec-Purpose") + c.GetHeader("X-Moz")
+	target, err := tenantService(c).Track(kind, params)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return "", false
+	}
+	return target, true
+}
+
+// createCreativeHandler stores the request body as a creative, its format is
+// taken from the Content-Type header
+func createCreativeHandler(c *gin.Context) {
+	params, ok := requiredQueryParams(c, "uid", "name")
+	if !ok {
+		return
+	}
+	params["content_type"] = c.ContentType()
+	res, err := tenantService(c).CreateCreative(c.Request.Body, params)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func getCreativesHandler(c *gin.Context) {
+	res, err := tenantService(c).GetCreatives(map[string]string{"uid": callerUid(c), "status": c.Query("status")})
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func getCreativeHandler(c *gin.Context) {
+	res, err := tenantService(c).GetCreative(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func getCreativeContentHandler(c *gin.Context) {
+	content, creative, err := tenantService(c).CreativeContent(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	defer content.Close()
+	// the uploaded content is served from the api's origin, it must not run
+	// scripts there or be sniffed as another type
+	headers := map[string]string{
+		"Content-Security-Policy": "sandbox",
+		"X-Content-Type-Options":  "nosniff",
+	}
+	if creative.Format == models.CreativeFormatHTML {
+		headers["Content-Disposition"] = "attachment"
+	}
+	c.DataFromReader(http.StatusOK, creative.Size, creative.Format, content, headers)
+}
+
+func deleteCreativeHandler(c *gin.Context) {
+	err := tenantService(c).DeleteCreative(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func getCreativeReviewsHandler(c *gin.Context) {
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).GetCreativeReviews(uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func reviewCreativeHandler(c *gin.Context) {
+	var requestBody api.CreativeReviewRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).ReviewCreative(c.Param("id"), uid, &requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func attachCreativeHandler(c *gin.Context) {
+	var requestBody []*api.AttachCreativeRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil || len(requestBody) == 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	for i, attachRequest := range requestBody {
+		if err := api.ValidateWithTags(attachRequest, fmt.Sprintf(".[%d].", i)); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+			return
+		}
+	}
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	err := tenantService(c).AttachCreatives(requestBody, uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// decodeTemplateRequest decodes and validates the template from the request
+// body, it responds with bad request and returns false when it's invalid
+func decodeTemplateRequest(c *gin.Context) (*api.TemplateRequestBody, bool) {
+	var requestBody api.TemplateRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return nil, false
+	}
+	for i, rule := range requestBody.Rules {
+		if err := api.ValidateWithTags(rule, fmt.Sprintf(".rules[%d].", i)); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+			return nil, false
+		}
+	}
+	return &requestBody, true
+}
+
+func createTemplateHandler(c *gin.Context) {
+	requestBody, ok := decodeTemplateRequest(c)
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).CreateTemplate(requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func getTemplatesHandler(c *gin.Context) {
+	res, err := tenantService(c).GetTemplates()
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func getTemplateHandler(c *gin.Context) {
+	res, err := tenantService(c).GetTemplate(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func updateTemplateHandler(c *gin.Context) {
+	requestBody, ok := decodeTemplateRequest(c)
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).UpdateTemplate(c.Param("id"), requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func deleteTemplateHandler(c *gin.Context) {
+	err := tenantService(c).DeleteTemplate(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func previewTemplateHandler(c *gin.Context) {
+	params, _ := requiredQueryParams(c)
+	res, err := tenantService(c).PreviewTemplate(c.Param("id"), params)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func getCalendarHandler(c *gin.Context) {
+	params, ok := requiredQueryParams(c, "start_date", "end_date")
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).GetCalendar(params)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func setCalendarDayHandler(c *gin.Context) {
+	var requestBody api.CalendarDayRequestBody
+	if err := json.NewDecoder(c.Request.Body).Decode(&requestBody); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	if err := api.ValidateWithTags(&requestBody, "."); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+		return
+	}
+	res, err := tenantService(c).SetCalendarDay(c.Param("date"), &requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func deleteCalendarDayHandler(c *gin.Context) {
+	err := tenantService(c).DeleteCalendarDay(c.Param("date"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// importCalendarHandler takes the iCalendar file as the request body
+func importCalendarHandler(c *gin.Context) {
+	params, ok := requiredQueryParams(c, "kind")
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).ImportCalendar(c.Request.Body, params)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func createCartHandler(c *gin.Context) {
+	requestBody, ok := decodeSlotRequests(c, true)
+	if !ok {
+		return
+	}
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).CreateCart(requestBody, uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func getCartHandler(c *gin.Context) {
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).GetCart(c.Param("id"), uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func addCartItemsHandler(c *gin.Context) {
+	requestBody, ok := decodeSlotRequests(c, false)
+	if !ok {
+		return
+	}
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).AddCartItems(c.Param("id"), uid, requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func removeCartItemsHandler(c *gin.Context) {
+	requestBody, ok := decodeSlotRequests(c, false)
+	if !ok {
+		return
+	}
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).RemoveCartItems(c.Param("id"), uid, requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func validateCartHandler(c *gin.Context) {
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).ValidateCart(c.Param("id"), uid)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func checkoutCartHandler(c *gin.Context) {
+	allowPartial := false
+	if value := c.Query("allow_partial"); value != "" {
+		var err error
+		if allowPartial, err = strconv.ParseBool(value); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'allow_partial' must be a boolean"})
+			return
+		}
+	}
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).CheckoutCart(c.Param("id"), uid, allowPartial)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func createAuctionsHandler(c *gin.Context) {
+	var requestBody api.AuctionRequestBody
+	err := json.NewDecoder(c.Request.Body).Decode(&requestBody)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	if err := api.ValidateWithTags(&requestBody, "."); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+		return
+	}
+	res, err := tenantService(c).CreateAuctions(&requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusCreated, res)
+}
+
+func getAuctionsHandler(c *gin.Context) {
+	params, ok := requiredQueryParams(c, "start_date", "end_date")
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).GetAuctions(params)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func getAuctionHandler(c *gin.Context) {
+	res, err := tenantService(c).GetAuction(c.Param("id"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func placeBidHandler(c *gin.Context) {
+	var requestBody api.BidRequestBody
+	err := json.NewDecoder(c.Request.Body).Decode(&requestBody)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	if err := api.ValidateWithTags(&requestBody, "."); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+		return
+	}
+	uid := callerUid(c)
+	if uid == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Query param 'uid' cannot be empty"})
+		return
+	}
+	res, err := tenantService(c).PlaceBid(c.Param("id"), uid, &requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func topUpWalletHandler(c *gin.Context) {
+	var requestBody api.WalletTopUpRequestBody
+	err := json.NewDecoder(c.Request.Body).Decode(&requestBody)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	if err := api.ValidateWithTags(&requestBody, "."); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("BadRequest:: [Error: %s]", err.Error())})
+		return
+	}
+	res, err := tenantService(c).TopUpWallet(c.Param("uid"), &requestBody)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func getWalletHandler(c *gin.Context) {
+	res, err := tenantService(c).GetWallet(c.Param("uid"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func getWalletStatementHandler(c *gin.Context) {
+	params, ok := requiredQueryParams(c, "start_date", "end_date")
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).GetWalletStatement(c.Param("uid"), params)
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// requiredQueryParams flattens the query params of the request, it responds
+// with bad request and returns false when any of the required ones is missing
+func requiredQueryParams(c *gin.Context, required ...string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for k, v := range c.Request.URL.Query() {
+		params[k] = strings.Join(v, "")
+	}
+	// the uid is the caller's, the subject of the token when authenticated
+	if uid := callerUid(c); uid != "" {
+		params["uid"] = uid
+	}
+	for _, k := range required {
+		if v, e := params[k]; !e || v == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is required", k)})
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func getPaymentProfileHandler(c *gin.Context) {
+	res, err := tenantService(c).GetPaymentProfile(c.Param("uid"))
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+func setPaymentProfileHandler(c *gin.Context) {
+	var requestBody api.PaymentProfileRequestBody
+	err := json.NewDecoder(c.Request.Body).Decode(&requestBody)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "ParsingError: Invalid request body provided"})
+		return
+	}
+	if requestBody.Provider == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "BadRequest:: [Error: provider field is required]"})
+		return
+	}
+	err = tenantService(c).SetPaymentProfile(c.Param("uid"), &requestBody)
 	if err != nil {
 		httpCode, erMsg := getHttpCodeAndMessage(err)
 		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
@@ -0,0 +1,165 @@
+package rest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+func occupancyReportHandler(c *gin.Context) {
+	params, ok := reportParams(c)
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).OccupancyReport(params)
+	respondReport(c, params["format"], "occupancy", res, err, []string{"key", "total", "sellable", "booked", "rate"},
+		func(r *api.OccupancyReportRow) []string {
+			return []string{r.Key, formatInt(r.Total), formatInt(r.Sellable), formatInt(r.Booked), formatFloat(r.Rate)}
+		})
+}
+
+func revenueReportHandler(c *gin.Context) {
+	params, ok := reportParams(c)
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).RevenueReport(params)
+	respondReport(c, params["format"], "revenue", res, err, []string{"period", "bookings", "revenue"},
+		func(r *api.RevenueReportRow) []string {
+			return []string{r.Period, formatInt(r.Bookings), formatFloat(r.Revenue)}
+		})
+}
+
+func topAdvertisersReportHandler(c *gin.Context) {
+	params, ok := reportParams(c)
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).TopAdvertisersReport(params)
+	respondReport(c, params["format"], "advertisers", res, err, []string{"advertiser_id", "name", "bookings", "spend"},
+		func(r *api.AdvertiserSpendRow) []string {
+			return []string{r.AdvertiserId, r.Name, formatInt(r.Bookings), formatFloat(r.Spend)}
+		})
+}
+
+func leadTimeReportHandler(c *gin.Context) {
+	params, ok := reportParams(c)
+	if !ok {
+		return
+	}
+	res, err := tenantService(c).LeadTimeReport(params)
+	respondReport(c, params["format"], "lead-time", res, err, []string{"period", "bookings", "avg_days", "min_days", "max_days"},
+		func(r *api.LeadTimeReportRow) []string {
+			return []string{r.Period, formatInt(r.Bookings), formatFloat(r.AvgDays), formatInt(r.MinDays), formatInt(r.MaxDays)}
+		})
+}
+
+// exportContentTypes are the content types of the formats of the exports
+var exportContentTypes = map[string]string{
+	models.ExportFormatCSV:     "text/csv; charset=utf-8",
+	models.ExportFormatNDJSON:  "application/x-ndjson",
+	models.ExportFormatParquet: "application/vnd.apache.parquet",
+}
+
+// exportSlotsHandler streams the slots and their bookings, csv unless the
+// format param says else
+func exportSlotsHandler(c *gin.Context) {
+	params, ok := requiredQueryParams(c, "uid", "start_date", "end_date")
+	if !ok {
+		return
+	}
+	if params["format"] == "" {
+		params["format"] = models.ExportFormatCSV
+	}
+	w := &exportResponse{c: c, format: params["format"]}
+	_, err := tenantService(c).ExportSlots(w, params)
+	if err != nil && !w.started {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	if err != nil {
+		// the status is sent, the client sees the export break off
+		logger.Errorf("ExportSlotsFailed:: [Error: %s]", err)
+		c.Abort()
+		return
+	}
+	if !w.started {
+		c.Status(http.StatusOK)
+	}
+}
+
+// exportResponse sends the headers of the export with its first bytes
+type exportResponse struct {
+	c       *gin.Context
+	format  string
+	started bool
+}
+
+func (w *exportResponse) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.c.Header("Content-Type", exportContentTypes[w.format])
+		w.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "slots."+w.format))
+		w.c.Status(http.StatusOK)
+	}
+	return w.c.Writer.Write(p)
+}
+
+// reportParams reads the query params of a report, the range is required
+// and the format is json unless it's csv
+func reportParams(c *gin.Context) (map[string]string, bool) {
+	params, ok := requiredQueryParams(c, "uid", "start_date", "end_date")
+	if !ok {
+		return nil, false
+	}
+	switch params["format"] {
+	case "":
+		params["format"] = models.ReportFormatJSON
+	case models.ReportFormatJSON, models.ReportFormatCSV:
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("format: %s must be %s or %s", params["format"], models.ReportFormatJSON, models.ReportFormatCSV)})
+		return nil, false
+	}
+	return params, true
+}
+
+// respondReport answers with the rows of the report in the format, the
+// header names the columns of the records of the csv
+func respondReport[T any](c *gin.Context, format, name string, rows []T, err error, header []string, record func(T) []string) {
+	if err != nil {
+		httpCode, erMsg := getHttpCodeAndMessage(err)
+		c.AbortWithStatusJSON(httpCode, gin.H{"error": erMsg})
+		return
+	}
+	if format != models.ReportFormatCSV {
+		c.JSON(http.StatusOK, rows)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+	c.Status(http.StatusOK)
+	cw := csv.NewWriter(c.Writer)
+	cw.Write(header)
+	for _, row := range rows {
+		cw.Write(record(row))
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		logger.Errorf("WriteReportFailed:: [Report: %s, Error: %s]", name, err)
+	}
+}
+
+func formatInt(v int64) string {
+	return strconv.FormatInt(v, 10)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
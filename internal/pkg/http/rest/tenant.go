@@ -0,0 +1,100 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/auth"
+	"github.com/kiran-anand14/admgr/internal/pkg/core"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// tenantMiddleware resolves the tenant of the request from its bearer token
+// and hands the service of the tenant to the handlers. The caller is the
+// subject of the token, a uid param naming anyone else is refused, or the uid
+// param when authentication is disabled. The changes of slots made by the
+// request are audited as made by the caller
+func tenantMiddleware(c *gin.Context) {
+	tenant, uid := models.DefaultTenant, c.Query("uid")
+	if authSecret != "" {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized:: bearer token required"})
+			return
+		}
+		claims, err := auth.ParseToken(authSecret, token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Unauthorized:: [Error: %s]", err)})
+			return
+		}
+		tenant = claims.Tenant
+		for _, param := range append(c.QueryArray("uid"), c.Param("uid")) {
+			if param != "" && param != claims.Subject {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Uid %s does not match the subject of the token", param)})
+				return
+			}
+		}
+		uid = claims.Subject
+	}
+	s, ok := services[tenant]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Tenant %s is not hosted here", tenant)})
+		return
+	}
+	actor := uid
+	if actor == "" {
+		actor = anonymousActor
+	}
+	requestID := c.GetHeader(requestIDHeader)
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		requestID = uuid.NewString()
+	}
+	c.Header(requestIDHeader, requestID)
+	c.Set(tenantServiceKey, s.WithAudit(actor, requestID))
+	c.Set(callerUidKey, uid)
+	c.Next()
+}
+
+// trackingMiddleware hands the service of the tenant param to the tracking
+// handlers, whose urls are signed by the service
+func trackingMiddleware(c *gin.Context) {
+	tenant := c.Query("tenant")
+	if tenant == "" {
+		tenant = models.DefaultTenant
+	}
+	s, ok := services[tenant]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Tenant %s is not hosted here", tenant)})
+		return
+	}
+	c.Set(tenantServiceKey, s)
+	c.Next()
+}
+
+func tenantService(c *gin.Context) core.Service {
+	return c.MustGet(tenantServiceKey).(core.Service)
+}
+
+// callerUid is the advertiser or operator making the request
+func callerUid(c *gin.Context) string {
+	return c.GetString(callerUidKey)
+}
+
+// readinessService is the service whose dependencies the readiness reports,
+// the tenants share the database server and the payment providers
+func readinessService() core.Service {
+	if s, ok := services[models.DefaultTenant]; ok {
+		return s
+	}
+	tenants := make([]string, 0, len(services))
+	for tenant := range services {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return services[tenants[0]]
+}
@@ -0,0 +1,224 @@
+// Package ical reads the all-day events of iCalendar (RFC 5545) files, it
+// understands the subset used by holiday and closure calendars
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+	FreqYearly  = "YEARLY"
+)
+
+// Event is a VEVENT, Start is its first day and End the day after its last one
+type Event struct {
+	UID        string
+	Summary    string
+	Categories []string
+	Start      time.Time
+	End        time.Time
+	Rule       *Rule
+}
+
+// Rule is the recurrence of an event, a zero Count and Until repeat forever
+type Rule struct {
+	Freq     string
+	Interval int
+	Count    int
+	Until    time.Time
+}
+
+// Parse reads the events of the calendar
+func Parse(r io.Reader) ([]*Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		events []*Event
+		event  *Event
+	)
+	for i, line := range lines {
+		name, params, value, ok := splitLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event = &Event{}
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if event == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN:VEVENT", i+1)
+			}
+			if event.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event '%s' has no DTSTART", i+1, event.Summary)
+			}
+			if event.End.IsZero() || !event.End.After(event.Start) {
+				event.End = event.Start.AddDate(0, 0, 1)
+			}
+			events = append(events, event)
+			event = nil
+		case event == nil:
+		case name == "UID":
+			event.UID = value
+		case name == "SUMMARY":
+			event.Summary = unescape(value)
+		case name == "CATEGORIES":
+			for _, c := range strings.Split(value, ",") {
+				event.Categories = append(event.Categories, strings.TrimSpace(unescape(c)))
+			}
+		case name == "DTSTART":
+			if event.Start, err = parseDate(params, value); err != nil {
+				return nil, fmt.Errorf("line %d: %s", i+1, err)
+			}
+		case name == "DTEND":
+			if event.End, err = parseDate(params, value); err != nil {
+				return nil, fmt.Errorf("line %d: %s", i+1, err)
+			}
+		case name == "RRULE":
+			if event.Rule, err = parseRule(value); err != nil {
+				return nil, fmt.Errorf("line %d: %s", i+1, err)
+			}
+		}
+	}
+	if event != nil {
+		return nil, fmt.Errorf("event '%s' is not terminated by END:VEVENT", event.Summary)
+	}
+	return events, nil
+}
+
+// Dates returns the days the event covers until the given day included,
+// recurrences are expanded
+func (e *Event) Dates(until time.Time) []time.Time {
+	var dates []time.Time
+	days := int(e.End.Sub(e.Start).Hours()/24 + 0.5)
+	for n, start := 0, e.Start; !start.After(until); n++ {
+		if e.Rule != nil && (e.Rule.Count > 0 && n >= e.Rule.Count || !e.Rule.Until.IsZero() && start.After(e.Rule.Until)) {
+			break
+		}
+		for d := 0; d < days; d++ {
+			if day := start.AddDate(0, 0, d); !day.After(until) {
+				dates = append(dates, day)
+			}
+		}
+		if e.Rule == nil {
+			break
+		}
+		start = e.Rule.next(e.Start, n+1)
+	}
+	return dates
+}
+
+// next returns the start of the n-th occurrence, computed from the first one
+// so that monthly and yearly events keep their day of month
+func (r *Rule) next(first time.Time, n int) time.Time {
+	step := n * r.Interval
+	switch r.Freq {
+	case FreqDaily:
+		return first.AddDate(0, 0, step)
+	case FreqWeekly:
+		return first.AddDate(0, 0, 7*step)
+	case FreqMonthly:
+		return first.AddDate(0, step, 0)
+	}
+	return first.AddDate(step, 0, 0)
+}
+
+// unfold joins the continuation lines, which start with a space or a tab
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitLine splits a content line into its upper cased name, its parameters and its value
+func splitLine(line string) (string, map[string]string, string, bool) {
+	sep := strings.Index(line, ":")
+	if sep < 0 {
+		return "", nil, "", false
+	}
+	parts := strings.Split(line[:sep], ";")
+	params := make(map[string]string)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[sep+1:], true
+}
+
+// parseDate reads a DATE or DATE-TIME value, only the day of a DATE-TIME is kept
+func parseDate(params map[string]string, value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid date '%s'", value)
+	}
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date '%s'", value)
+		}
+		return t, nil
+	}
+	t, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date-time '%s'", value)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// parseRule reads a RRULE, rules selecting days other than the ones of
+// the first occurrence (BYDAY, BYSETPOS ...) are not supported
+func parseRule(value string) (*Rule, error) {
+	rule := &Rule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(v)
+		case "INTERVAL":
+			if rule.Interval, err = strconv.Atoi(v); err != nil || rule.Interval < 1 {
+				return nil, fmt.Errorf("invalid RRULE interval '%s'", v)
+			}
+		case "COUNT":
+			if rule.Count, err = strconv.Atoi(v); err != nil || rule.Count < 1 {
+				return nil, fmt.Errorf("invalid RRULE count '%s'", v)
+			}
+		case "UNTIL":
+			if rule.Until, err = parseDate(nil, v); err != nil {
+				return nil, err
+			}
+		case "WKST", "BYMONTH", "BYMONTHDAY":
+			// redundant with DTSTART in the rules we support
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part '%s'", k)
+		}
+	}
+	switch rule.Freq {
+	case FreqDaily, FreqWeekly, FreqMonthly, FreqYearly:
+	default:
+		return nil, fmt.Errorf("unsupported RRULE frequency '%s'", rule.Freq)
+	}
+	return rule, nil
+}
+
+func unescape(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
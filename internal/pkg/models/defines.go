@@ -11,13 +11,182 @@ const (
 	SlotStatusClosed = "closed"
 	SlotStatusBooked = "booked"
 	SlotStatusHold   = "hold"
+	// SlotStatusAuction marks slots which are sold through an auction instead of at their cost
+	SlotStatusAuction = "auction"
 )
 
-// JSONDate Custom time object with layout formatting
+const (
+	HoldStatusActive     = "active"
+	HoldStatusConfirming = "confirming"
+	HoldStatusConfirmed  = "confirmed"
+	HoldStatusReleased   = "released"
+	HoldStatusExpired    = "expired"
+)
+
+const (
+	WaitlistStatusWaiting  = "waiting"
+	WaitlistStatusOffered  = "offered"
+	WaitlistStatusAccepted = "accepted"
+	WaitlistStatusExpired  = "expired"
+	WaitlistStatusLeft     = "left"
+
+	EventWaitlistOffered      = "waitlist.offered"
+	EventWaitlistOfferExpired = "waitlist.offer_expired"
+	EventAuctionAwarded       = "auction.awarded"
+	EventCreativeSubmitted    = "creative.submitted"
+	EventCreativeApproved     = "creative.approved"
+	EventCreativeRejected     = "creative.rejected"
+)
+
+const (
+	AuctionStatusOpen    = "open"
+	AuctionStatusAwarded = "awarded"
+	AuctionStatusUnsold  = "unsold"
+
+	AuctionPricingFirst  = "first"
+	AuctionPricingSecond = "second"
+
+	CampaignStatusActive = "active"
+	CampaignStatusPaused = "paused"
+
+	BidStatusActive = "active"
+	BidStatusWon    = "won"
+	BidStatusLost   = "lost"
+	// BidStatusFailed marks winning bids whose debit failed, the slot moves to the next bidder
+	BidStatusFailed = "failed"
+)
+
+// DefaultPlacement holds the slots created without a placement, and the ones
+// which existed before placements were introduced
+const DefaultPlacement = "default"
+
+// DefaultTenant owns the records which existed before tenants were introduced,
+// every request belongs to it when authentication is disabled
+const DefaultTenant = "default"
+
+// Formats of the creatives, as media types
+const (
+	CreativeFormatPNG  = "image/png"
+	CreativeFormatJPEG = "image/jpeg"
+	CreativeFormatGIF  = "image/gif"
+	CreativeFormatHTML = "text/html"
+	CreativeFormatText = "text/plain"
+
+	// Review states of the creatives, only approved creatives go live
+	CreativeStatusPending  = "pending"
+	CreativeStatusApproved = "approved"
+	CreativeStatusRejected = "rejected"
+
+	// CreativeIssueMissing flags a booked slot without creative past the review
+	// cut-off, slots with an unapproved creative are flagged with its status
+	CreativeIssueMissing = "missing"
+
+	// Sources of the creatives served at a position
+	ServeSourceBooked = "booked"
+	ServeSourceHouse  = "house"
+	ServeSourceNone   = "none"
+
+	// Kinds of the tracked delivery events
+	TrackImpression = "impression"
+	TrackClick      = "click"
+)
+
+// Groups of the rows of the reports, date, position and weekday group the
+// occupancy while day, week and month are the periods of the bookings
+const (
+	ReportGroupDate     = "date"
+	ReportGroupPosition = "position"
+	ReportGroupWeekday  = "weekday"
+	ReportGroupDay      = "day"
+	ReportGroupWeek     = "week"
+	ReportGroupMonth    = "month"
+
+	ReportFormatJSON = "json"
+	ReportFormatCSV  = "csv"
+)
+
+// Formats of the exports of slots and bookings
+const (
+	ExportFormatCSV     = "csv"
+	ExportFormatNDJSON  = "ndjson"
+	ExportFormatParquet = "parquet"
+)
+
+// Actions of the slot audit log, AuditActorSystem is the actor of the changes
+// made outside of a request, e.g. by the schedulers
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionStatus  = "status"
+	AuditActionRelease = "release"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+
+	AuditActorSystem = "system"
+)
+
+// Granularity of the slots of a placement
+const (
+	GranularityDay     = "day"
+	GranularityHour    = "hour"
+	GranularityDayPart = "daypart"
+)
+
+// Isolation of the tenants in the database
+const (
+	// TenancyColumn shares the tables, every query is scoped by the tenant column
+	TenancyColumn = "column"
+	// TenancySchema gives every tenant a database of its own
+	TenancySchema = "schema"
+)
+
+const (
+	// CalendarBlackout days have no inventory
+	CalendarBlackout = "blackout"
+	// CalendarHoliday days raise the cost of the slots created on them by their uplift
+	CalendarHoliday = "holiday"
+	// CalendarRestricted days can only be booked by operators
+	CalendarRestricted = "restricted"
+)
+
+const (
+	CartStatusOpen       = "open"
+	CartStatusCheckedOut = "checked_out"
+
+	// availability of a cart item, besides the booked and closed slot statuses
+	ItemAvailable = "available"
+	ItemHeld      = "held"
+	ItemNotFound  = "not_found"
+)
+
+const (
+	LedgerAccountWallet  = "wallet"
+	LedgerAccountFunding = "funding"
+	LedgerAccountRevenue = "revenue"
+
+	LedgerEntryTopUp  = "topup"
+	LedgerEntryDebit  = "debit"
+	LedgerEntryRefund = "refund"
+)
+
+const (
+	MismatchMissingDebit     = "missing_debit"
+	MismatchOrphanDebit      = "orphan_debit"
+	MismatchAmount           = "amount_mismatch"
+	MismatchBookedByMismatch = "booked_by_mismatch"
+)
+
+// JSONDate Custom time object with layout formatting, it accepts a date or
+// an RFC3339 time for the slots within a day
 type JSONDate time.Time
 
 func (jt *JSONDate) UnmarshalJSON(b []byte) error {
-	t, err := time.ParseInLocation(`"`+time.DateOnly+`"`, string(b), time.Local)
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	t, err := ParseTime(value)
 	if err != nil {
 		return err
 	}
@@ -27,13 +196,21 @@ func (jt *JSONDate) UnmarshalJSON(b []byte) error {
 
 func (jt *JSONDate) MarshalJSON() ([]byte, error) {
 	t := time.Time(*jt)
-	return json.Marshal(t.Format(time.DateOnly))
+	return json.Marshal(DateToString(t))
 }
 
 func PtrString(s string) *string {
 	return &s
 }
 
+// StringValue returns the string s points to, empty for nil
+func StringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
 func PtrDate(d time.Time) *time.Time {
 	return &d
 }
@@ -42,8 +219,76 @@ func PtrInt(p int32) *int32 {
 	return &p
 }
 
+func PtrFloat(f float64) *float64 {
+	return &f
+}
+
+// location is the business time zone of the deployment, the dates of the
+// slots, the calendar and the current date are days of this zone
+var location = time.Local
+
+// SetLocation sets the business time zone, it is meant to be called once at
+// startup before any request is served
+func SetLocation(loc *time.Location) {
+	location = loc
+}
+
+// Location returns the business time zone
+func Location() *time.Location {
+	return location
+}
+
+// StartOfDay returns the midnight starting the day of t in the business time zone
+func StartOfDay(t time.Time) time.Time {
+	t = t.In(location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+}
+
+// Today returns the start of the current day in the business time zone
+func Today() time.Time {
+	return StartOfDay(time.Now())
+}
+
+// DateToString formats the day of d in the business time zone
 func DateToString(d time.Time) string {
-	return d.Format(time.DateOnly)
+	return d.In(location).Format(time.DateOnly)
+}
+
+// ParseTime parses a date, which is midnight in the business time zone, or an
+// RFC3339 time in any zone
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, location); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(location), nil
+}
+
+// IsDate reports whether t is midnight in the business time zone, the start of a whole day
+func IsDate(t time.Time) bool {
+	hour, min, sec := t.In(location).Clock()
+	return hour == 0 && min == 0 && sec == 0 && t.Nanosecond() == 0
+}
+
+// TimeToString formats the start of a slot, as a date for the slots of whole
+// days and in RFC3339 for the slots within a day
+func TimeToString(t time.Time) string {
+	if IsDate(t) {
+		return DateToString(t)
+	}
+	return t.In(location).Format(time.RFC3339)
+}
+
+// EndOfRange returns the last instant of a range which ends at t, a date
+// includes the whole day
+func EndOfRange(t time.Time) time.Time {
+	if IsDate(t) {
+		return t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t
 }
 
 func JsonDate(d time.Time) JSONDate {
@@ -1,11 +1,15 @@
 package models
 
+import "time"
+
 type DBConf struct {
 	Host     string
 	Port     string
 	Name     string
 	Username string
 	Password string
+	// Tenancy is how the tenants are isolated, TenancyColumn or TenancySchema
+	Tenancy string
 }
 
 type AccountingServiceConf struct {
@@ -13,4 +17,16 @@ type AccountingServiceConf struct {
 	Host            string `json:"host" yaml:"host"`
 	Port            string `json:"port" yaml:"port"`
 	HealthCheckPath string `json:"health_check_path" yaml:"health_check_path"`
+	// HealthCheckInterval is how often the service is checked, a negative interval disables the checks
+	HealthCheckInterval     time.Duration `json:"health_check_interval" yaml:"health_check_interval"`
+	Timeout                 time.Duration `json:"timeout" yaml:"timeout"`
+	MaxRetries              int           `json:"max_retries" yaml:"max_retries"`
+	MinRetryBackoff         time.Duration `json:"min_retry_backoff" yaml:"min_retry_backoff"`
+	MaxRetryBackoff         time.Duration `json:"max_retry_backoff" yaml:"max_retry_backoff"`
+	BreakerFailureThreshold int           `json:"breaker_failure_threshold" yaml:"breaker_failure_threshold"`
+	BreakerResetTimeout     time.Duration `json:"breaker_reset_timeout" yaml:"breaker_reset_timeout"`
+	SigningSecret           string        `json:"signing_secret" yaml:"signing_secret"`
+	TLSCertPath             string        `json:"tls_cert_path" yaml:"tls_cert_path"`
+	TLSKeyPath              string        `json:"tls_key_path" yaml:"tls_key_path"`
+	TLSCAPath               string        `json:"tls_ca_path" yaml:"tls_ca_path"`
 }
@@ -0,0 +1,48 @@
+package payment
+
+import (
+	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// InvoiceStore keeps the reservations which are billed later
+type InvoiceStore interface {
+	CreateInvoiceItem(item *mysql.InvoiceItem) error
+	InvoiceItems(txnids []string) ([]*mysql.InvoiceItem, error)
+}
+
+type invoiceProvider struct {
+	store InvoiceStore
+}
+
+// NewInvoiceProvider books reservations without charging and records them
+// for invoicing, it is meant for trusted advertisers only so it should be
+// set on their payment profile rather than as the default provider
+func NewInvoiceProvider(store InvoiceStore) Provider {
+	return &invoiceProvider{store: store}
+}
+
+func (i *invoiceProvider) Debit(slots []*mysql.Slot, uid, txnid string) error {
+	return i.store.CreateInvoiceItem(&mysql.InvoiceItem{
+		Txnid:  txnid,
+		Uid:    uid,
+		Amount: totalCost(slots),
+	})
+}
+
+func (i *invoiceProvider) Status(txnids []string) ([]*accounting.AccountingStatusResponse, error) {
+	items, err := i.store.InvoiceItems(txnids)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*accounting.AccountingStatusResponse, 0, len(items))
+	for _, item := range items {
+		res = append(res, &accounting.AccountingStatusResponse{
+			Txnid:   item.Txnid,
+			UID:     item.Uid,
+			Created: item.Created,
+			Amount:  item.Amount,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,136 @@
+package payment
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ProviderAccounting = "accounting"
+	ProviderWallet     = "wallet"
+	ProviderInvoice    = "invoice"
+)
+
+// Provider charges an advertiser for reserved slots and reports which
+// transactions it has charged, the accounting service is one of them
+type Provider interface {
+	Debit(slots []*mysql.Slot, uid, txnid string) error
+	Status(txnids []string) ([]*accounting.AccountingStatusResponse, error)
+}
+
+// Booker is implemented by providers which charge in the same database
+// transaction that moves the held slots to booked
+type Booker interface {
+	DebitAndBook(slots []*mysql.Slot, uid, txnid string) error
+}
+
+// Refunder is implemented by providers which can refund a cancelled booking,
+// the refund is made in the same database transaction that opens the slots
+type Refunder interface {
+	RefundAndRelease(slots []*mysql.Slot, uid, txnid string) error
+}
+
+// ProfileStore provides the payment profile of an advertiser
+type ProfileStore interface {
+	GetPaymentProfile(uid string) (*mysql.PaymentProfile, error)
+}
+
+// Registry holds the available providers and resolves the one to use
+// for an advertiser, advertisers without a profile use the default one
+type Registry struct {
+	log             *logrus.Logger
+	store           ProfileStore
+	providers       map[string]Provider
+	defaultProvider string
+}
+
+func NewRegistry(log *logrus.Logger, store ProfileStore, defaultProvider string) *Registry {
+	return &Registry{
+		log:             log,
+		store:           store,
+		providers:       make(map[string]Provider),
+		defaultProvider: defaultProvider,
+	}
+}
+
+func (r *Registry) Register(name string, p Provider) {
+	r.providers[name] = p
+}
+
+func (r *Registry) Has(name string) bool {
+	_, ok := r.providers[name]
+	return ok
+}
+
+// Names returns the registered provider names in sorted order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, models.NewError(
+			fmt.Sprintf("Payment provider '%s' not configured", name),
+			models.InternalProcessingError,
+		)
+	}
+	return p, nil
+}
+
+// ProviderFor returns the name of the provider configured for the advertiser
+func (r *Registry) ProviderFor(uid string) (string, error) {
+	profile, err := r.store.GetPaymentProfile(uid)
+	if err != nil {
+		if mErr, ok := err.(*models.Error); ok && mErr.Type == models.ResourceNotFoundError {
+			return r.defaultProvider, nil
+		}
+		return "", err
+	}
+	if !r.Has(profile.Provider) {
+		r.log.Errorf("PaymentProviderNotConfigured:: [Uid: %s, Provider: %s]", uid, profile.Provider)
+		return "", models.NewError(
+			fmt.Sprintf("Payment provider '%s' not configured", profile.Provider),
+			models.InternalProcessingError,
+		)
+	}
+	return profile.Provider, nil
+}
+
+// Default returns the name of the provider of advertisers without a profile
+func (r *Registry) Default() string {
+	return r.defaultProvider
+}
+
+// Available reports whether the provider can be called, which isn't the case
+// while its circuit is open
+func (r *Registry) Available(name string) bool {
+	p, ok := r.providers[name]
+	if !ok {
+		return false
+	}
+	s, ok := p.(interface{ State() string })
+	return !ok || s.State() != accounting.BreakerStateOpen
+}
+
+// States reports the state of every provider which keeps one, such as the
+// circuit breaker of the accounting client
+func (r *Registry) States() map[string]string {
+	states := make(map[string]string)
+	for name, p := range r.providers {
+		if s, ok := p.(interface{ State() string }); ok {
+			states[name] = s.State()
+		}
+	}
+	return states
+}
@@ -0,0 +1,64 @@
+package payment
+
+import (
+	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+)
+
+// WalletStore keeps the prepaid balances of advertisers in a double-entry ledger
+type WalletStore interface {
+	DebitWallet(uid, txnid string, amount float64) error
+	DebitWalletAndBook(slots []*mysql.Slot, uid, txnid string) error
+	RefundWalletAndRelease(slots []*mysql.Slot, uid, txnid string) error
+	WalletDebits(txnids []string) ([]*mysql.LedgerEntry, error)
+}
+
+type walletProvider struct {
+	store WalletStore
+}
+
+// NewWalletProvider charges reservations against the prepaid balance
+// stored in admgr's own database
+func NewWalletProvider(store WalletStore) Provider {
+	return &walletProvider{store: store}
+}
+
+func (w *walletProvider) Debit(slots []*mysql.Slot, uid, txnid string) error {
+	return w.store.DebitWallet(uid, txnid, totalCost(slots))
+}
+
+func (w *walletProvider) DebitAndBook(slots []*mysql.Slot, uid, txnid string) error {
+	return w.store.DebitWalletAndBook(slots, uid, txnid)
+}
+
+func (w *walletProvider) RefundAndRelease(slots []*mysql.Slot, uid, txnid string) error {
+	return w.store.RefundWalletAndRelease(slots, uid, txnid)
+}
+
+func (w *walletProvider) Status(txnids []string) ([]*accounting.AccountingStatusResponse, error) {
+	entries, err := w.store.WalletDebits(txnids)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*accounting.AccountingStatusResponse, 0, len(entries))
+	for _, entry := range entries {
+		status := &accounting.AccountingStatusResponse{
+			Txnid:   entry.Reference,
+			Created: entry.Created,
+			Amount:  -entry.Amount,
+		}
+		if entry.Account != nil && entry.Account.Uid != nil {
+			status.UID = *entry.Account.Uid
+		}
+		res = append(res, status)
+	}
+	return res, nil
+}
+
+func totalCost(slots []*mysql.Slot) float64 {
+	var total float64
+	for _, s := range slots {
+		total += *s.Cost
+	}
+	return total
+}
@@ -0,0 +1,246 @@
+// Package sheet reads the rows of CSV files and of the first worksheet of
+// XLSX workbooks, as the text of their cells
+package sheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// maxPartSize bounds the unpacked size of a part of a workbook
+const maxPartSize = 64 << 20
+
+// Read returns the rows of the spreadsheet in the format, the cells of the
+// rows are trimmed and row i of the result is row i+1 of the sheet
+func Read(r io.Reader, format string) ([][]string, error) {
+	switch format {
+	case FormatCSV:
+		return ReadCSV(r)
+	case FormatXLSX:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return ReadXLSX(data)
+	default:
+		return nil, fmt.Errorf("unsupported format %s", format)
+	}
+}
+
+// ReadCSV returns the records of the CSV file by the line they start on,
+// blank lines are empty rows and the lengths of the records may differ
+func ReadCSV(r io.Reader) ([][]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	var rows [][]string
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		for len(rows) < line-1 {
+			rows = append(rows, nil)
+		}
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		rows = append(rows, record)
+	}
+}
+
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t *xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Index int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string    `xml:"r,attr"`
+			Type   string    `xml:"t,attr"`
+			Value  string    `xml:"v"`
+			Inline *xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadXLSX returns the rows of the first worksheet of the workbook, numbers
+// and dates are returned as their stored value
+func ReadXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a workbook: %w", err)
+	}
+	parts := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		parts[f.Name] = f
+	}
+	sheetPath, err := firstSheet(parts)
+	if err != nil {
+		return nil, err
+	}
+	var shared xlsxSharedStrings
+	if f, ok := parts["xl/sharedStrings.xml"]; ok {
+		if err = decodePart(f, &shared); err != nil {
+			return nil, err
+		}
+	}
+	f, ok := parts[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("worksheet %s not found", sheetPath)
+	}
+	var ws xlsxWorksheet
+	if err = decodePart(f, &ws); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, xr := range ws.Rows {
+		index := xr.Index
+		if index == 0 {
+			index = len(rows) + 1
+		}
+		for len(rows) < index {
+			rows = append(rows, nil)
+		}
+		var row []string
+		for _, c := range xr.Cells {
+			col := len(row)
+			if c.Ref != "" {
+				if col, err = column(c.Ref); err != nil {
+					return nil, err
+				}
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			switch c.Type {
+			case "s":
+				i, err := strconv.Atoi(c.Value)
+				if err != nil || i < 0 || i >= len(shared.Items) {
+					return nil, fmt.Errorf("cell %s refers to an unknown string", c.Ref)
+				}
+				row[col] = shared.Items[i].String()
+			case "inlineStr":
+				if c.Inline != nil {
+					row[col] = c.Inline.String()
+				}
+			default:
+				row[col] = c.Value
+			}
+			row[col] = strings.TrimSpace(row[col])
+		}
+		rows[index-1] = row
+	}
+	return rows, nil
+}
+
+// firstSheet returns the path of the first worksheet of the workbook
+func firstSheet(parts map[string]*zip.File) (string, error) {
+	f, ok := parts["xl/workbook.xml"]
+	if !ok {
+		return "", errors.New("not a workbook: xl/workbook.xml not found")
+	}
+	var wb xlsxWorkbook
+	if err := decodePart(f, &wb); err != nil {
+		return "", err
+	}
+	if len(wb.Sheets) == 0 {
+		return "", errors.New("workbook has no worksheets")
+	}
+	var rels xlsxRelationships
+	if f, ok = parts["xl/_rels/workbook.xml.rels"]; ok {
+		if err := decodePart(f, &rels); err != nil {
+			return "", err
+		}
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID == wb.Sheets[0].RelID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "xl/worksheets/sheet1.xml", nil
+}
+
+func decodePart(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	if err = xml.NewDecoder(io.LimitReader(rc, maxPartSize)).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// column returns the index of the column of a cell reference, 0 for A1
+func column(ref string) (int, error) {
+	col := 0
+	for i, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			col = col*26 + int(r-'A'+1)
+			continue
+		}
+		if i == 0 || r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid cell reference %s", ref)
+		}
+		break
+	}
+	if col == 0 || col > 16384 {
+		return 0, fmt.Errorf("invalid cell reference %s", ref)
+	}
+	return col - 1, nil
+}
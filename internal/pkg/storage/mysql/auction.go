@@ -0,0 +1,196 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// CreateAuctions moves the open slots of the auctions to auction, it fails
+// without changes if any slot isn't open
+func (s *Storage) CreateAuctions(auctions []*Auction) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, auction := range auctions {
+			var slot Slot
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("placement = ? AND date = ? AND position = ? AND status = ?", auction.Placement, auction.Date, auction.Position, models.SlotStatusOpen).
+				First(&slot).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return models.NewError(
+					fmt.Sprintf("Slot with [placement: %s, date: %s, position: %d] not open", auction.Placement, models.DateToString(*auction.Date), *auction.Position),
+					models.ActionForbidden,
+				)
+			}
+			if err == nil {
+				auction.SlotCost = *slot.Cost
+				err = tx.Model(&slot).Update("status", models.SlotStatusAuction).Error
+			}
+			if err != nil {
+				s.logger.Errorf("CreateAuctionsFailed:: [Error: %s, Auction: %+v]", err, auction)
+				return models.NewError("CreateAuctionsFailed:: Internal server error", models.InternalProcessingError)
+			}
+		}
+		if err := tx.Create(auctions).Error; err != nil {
+			s.logger.Errorf("CreateAuctionsFailed:: [Error: %s]", err)
+			return models.NewError("CreateAuctionsFailed:: Internal server error", models.InternalProcessingError)
+		}
+		return nil
+	})
+}
+
+func (s *Storage) GetAuction(id string) (*Auction, error) {
+	var auction Auction
+	err := s.db.Where("id = ?", id).First(&auction).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(fmt.Sprintf("Auction %s not found", id), models.ResourceNotFoundError)
+	}
+	if err != nil {
+		s.logger.Errorf("GetAuctionFailed:: [Id: %s, Error: %s]", id, err)
+		return nil, models.NewError("GetAuctionFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &auction, nil
+}
+
+// Auctions returns the auctions of the slots between start and end, filtered
+// by placement and status when they're given
+func (s *Storage) Auctions(placement string, start, end time.Time, status string) ([]*Auction, error) {
+	var auctions []*Auction
+	q := s.db.Where("date BETWEEN ? AND ?", start, models.EndOfRange(end))
+	if placement != "" {
+		q = q.Where("placement = ?", placement)
+	}
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if err := q.Order("placement, date, position, created").Find(&auctions).Error; err != nil {
+		s.logger.Errorf("AuctionsFailed:: [Error: %s]", err)
+		return nil, models.NewError("AuctionsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return auctions, nil
+}
+
+// ClosedAuctions returns the open auctions whose closing time passed
+func (s *Storage) ClosedAuctions(now time.Time) ([]*Auction, error) {
+	var auctions []*Auction
+	if err := s.db.Where("status = ? AND closes_at <= ?", models.AuctionStatusOpen, now).Order("closes_at").Find(&auctions).Error; err != nil {
+		s.logger.Errorf("ClosedAuctionsFailed:: [Error: %s]", err)
+		return nil, models.NewError("ClosedAuctionsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return auctions, nil
+}
+
+// SaveBid records the bid, replacing the amount of an earlier bid of the
+// same advertiser, and returns the stored bid
+func (s *Storage) SaveBid(bid *Bid) (*Bid, error) {
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "auction_id"}, {Name: "uid"}},
+		DoUpdates: clause.AssignmentColumns([]string{"amount", "modified"}),
+	}).Create(bid).Error
+	if err != nil {
+		s.logger.Errorf("SaveBidFailed:: [Error: %s, Bid: %+v]", err, bid)
+		return nil, models.NewError("SaveBidFailed:: Internal server error", models.InternalProcessingError)
+	}
+	var saved Bid
+	if err = s.db.Where("auction_id = ? AND uid = ?", bid.AuctionID, bid.Uid).First(&saved).Error; err != nil {
+		s.logger.Errorf("SaveBidFailed:: [Error: %s, Bid: %+v]", err, bid)
+		return nil, models.NewError("SaveBidFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &saved, nil
+}
+
+// AuctionBids returns the bids of the auction, highest first and the
+// earliest of equal bids first
+func (s *Storage) AuctionBids(auctionID string) ([]*Bid, error) {
+	var bids []*Bid
+	if err := s.db.Where("auction_id = ?", auctionID).Order("amount DESC, modified, id").Find(&bids).Error; err != nil {
+		s.logger.Errorf("AuctionBidsFailed:: [Id: %s, Error: %s]", auctionID, err)
+		return nil, models.NewError("AuctionBidsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return bids, nil
+}
+
+func (s *Storage) UpdateBidStatus(id, status string) error {
+	if err := s.db.Model(&Bid{}).Where("id = ?", id).Update("status", status).Error; err != nil {
+		s.logger.Errorf("UpdateBidStatusFailed:: [Id: %s, Error: %s]", id, err)
+		return models.NewError("UpdateBidStatusFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+// HoldAuctionSlot puts the auctioned slot on hold for a bidder at the given
+// price, so that the hold can be confirmed like any other
+func (s *Storage) HoldAuctionSlot(auction *Auction, hold *Hold, txn *Transaction, price float64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Slot{}).
+			Where("placement = ? AND date = ? AND position = ? AND status = ?", auction.Placement, auction.Date, auction.Position, models.SlotStatusAuction).
+			Updates(map[string]interface{}{"status": models.SlotStatusHold, "cost": price})
+		if res.Error != nil {
+			s.logger.Errorf("HoldAuctionSlotFailed:: [Id: %s, Error: %s]", auction.ID, res.Error)
+			return models.NewError("HoldAuctionSlotFailed:: Internal server error", models.InternalProcessingError)
+		}
+		if res.RowsAffected == 0 {
+			return models.NewError(fmt.Sprintf("Slot of auction %s is no longer auctioned", auction.ID), models.ActionForbidden)
+		}
+		if err := tx.Create(hold).Error; err != nil {
+			s.logger.Errorf("HoldAuctionSlotFailed:: [Id: %s, Error: %s]", auction.ID, err)
+			return models.NewError("HoldAuctionSlotFailed:: Internal server error", models.InternalProcessingError)
+		}
+		if err := tx.Create(txn).Error; err != nil {
+			s.logger.Errorf("HoldAuctionSlotFailed:: [Id: %s, Error: %s]", auction.ID, err)
+			return models.NewError("HoldAuctionSlotFailed:: Internal server error", models.InternalProcessingError)
+		}
+		return nil
+	})
+}
+
+// ReturnAuctionSlot releases the hold of a bidder whose debit failed and
+// puts the slot back to auction at its original cost
+func (s *Storage) ReturnAuctionSlot(auction *Auction, holdID string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Hold{}).Where("id = ?", holdID).Update("status", models.HoldStatusReleased).Error; err != nil {
+			return err
+		}
+		// deleting the transaction opens the slot, which is moved back right away
+		if err := tx.Where("txnid = ?", holdID).Delete(&Transaction{Placement: auction.Placement, Date: auction.Date, Position: auction.Position}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Slot{}).
+			Where("placement = ? AND date = ? AND position = ?", auction.Placement, auction.Date, auction.Position).
+			Updates(map[string]interface{}{"status": models.SlotStatusAuction, "cost": auction.SlotCost}).Error
+	})
+	if err != nil {
+		s.logger.Errorf("ReturnAuctionSlotFailed:: [Id: %s, Hold: %s, Error: %s]", auction.ID, holdID, err)
+		return models.NewError("ReturnAuctionSlotFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+// FinishAuction records the result of the auction and marks the remaining
+// active bids as lost, the slot of an unsold auction is opened again
+func (s *Storage) FinishAuction(auction *Auction) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(auction).Select("status", "winner_uid", "price").Updates(auction).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Bid{}).Where("auction_id = ? AND status = ?", auction.ID, models.BidStatusActive).
+			Update("status", models.BidStatusLost).Error; err != nil {
+			return err
+		}
+		if auction.Status != models.AuctionStatusUnsold {
+			return nil
+		}
+		return tx.Model(&Slot{}).
+			Where("placement = ? AND date = ? AND position = ? AND status = ?", auction.Placement, auction.Date, auction.Position, models.SlotStatusAuction).
+			Updates(map[string]interface{}{"status": models.SlotStatusOpen, "cost": auction.SlotCost}).Error
+	})
+	if err != nil {
+		s.logger.Errorf("FinishAuctionFailed:: [Id: %s, Error: %s]", auction.ID, err)
+		return models.NewError("FinishAuctionFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
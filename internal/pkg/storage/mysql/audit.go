@@ -0,0 +1,407 @@
+package mysql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+type auditKey struct{}
+
+// Audit identifies who changes the slots of a storage, see WithAudit
+type Audit struct {
+	Actor     string
+	RequestID string
+}
+
+// SlotAuditOptions filter the audit log, the zero values match every entry
+type SlotAuditOptions struct {
+	Placement string
+	// Date and Position select the entries of a single slot
+	Date     *time.Time
+	Position *int32
+	Actor    string
+	// From and To bound the time of the changes
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// slotChange is a slot before and after a change, before is nil for created
+// slots and after for purged ones
+type slotChange struct {
+	before *Slot
+	after  *Slot
+}
+
+// auditIgnored are the fields of the slots left out of the audit log
+var auditIgnored = []string{"tenant", "created", "modified", "Transaction"}
+
+// WithAudit returns a copy of the storage whose changes of slots are recorded
+// in the audit log as made by the actor, within the request
+func (s *Storage) WithAudit(actor, requestID string) *Storage {
+	as := *s
+	as.db = s.db.WithContext(context.WithValue(s.db.Statement.Context, auditKey{}, &Audit{Actor: actor, RequestID: requestID}))
+	return &as
+}
+
+// SlotAudits returns the entries of the audit log matching the options, the
+// latest first
+func (s *Storage) SlotAudits(opts *SlotAuditOptions) ([]*SlotAudit, error) {
+	var audits []*SlotAudit
+	q := s.db.Model(&SlotAudit{})
+	if opts.Placement != "" {
+		q = q.Where("placement = ?", opts.Placement)
+	}
+	if opts.Date != nil {
+		q = q.Where("date = ?", opts.Date)
+	}
+	if opts.Position != nil {
+		q = q.Where("position = ?", opts.Position)
+	}
+	if opts.Actor != "" {
+		q = q.Where("actor = ?", opts.Actor)
+	}
+	if !opts.From.IsZero() {
+		q = q.Where("created >= ?", opts.From)
+	}
+	if !opts.To.IsZero() {
+		q = q.Where("created <= ?", opts.To)
+	}
+	if opts.Limit > 0 {
+		q = q.Limit(opts.Limit)
+	}
+	if err := q.Order("created DESC, id DESC").Find(&audits).Error; err != nil {
+		s.logger.Errorf("GetSlotAuditsFailed:: [Options: %+v, Error: %s]", opts, err)
+		return nil, models.NewError("GetSlotAuditsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return audits, nil
+}
+
+// auditActionKey holds the action the writes of a session are recorded as
+type auditActionKey struct{}
+
+// auditStateKey holds the slots captured before a write, see registerSlotAudit
+const auditStateKey = "admgr:audit_state"
+
+// auditKeyBatch is the number of slot keys looked up per query
+const auditKeyBatch = 1000
+
+// auditState is the slots a write touches, by key, as they were before it
+type auditState struct {
+	keys   [][]interface{}
+	before map[string]*Slot
+}
+
+// withAuditAction returns the session whose writes to the slots are recorded
+// as the action, rather than as the create, update, delete or purge they are
+func withAuditAction(db *gorm.DB, action string) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true, Context: context.WithValue(db.Statement.Context, auditActionKey{}, action)})
+}
+
+// registerSlotAudit records every write to the slots in the audit log within
+// the transaction of the write. The slots are read before and after the
+// write, changes which leave every audited field as it was are skipped
+func registerSlotAudit(db *gorm.DB, logger *logrus.Logger) error {
+	capture := func(created bool) func(*gorm.DB) {
+		return func(db *gorm.DB) {
+			if db.Error != nil || db.DryRun || db.Statement.Table != "slots" {
+				return
+			}
+			state, err := captureSlots(db, created)
+			if err != nil {
+				logger.Errorf("WriteSlotAuditFailed:: [Table: %s, Error: %s]", db.Statement.Table, err)
+				_ = db.AddError(models.NewError("WriteSlotAuditFailed:: Internal server error", models.InternalProcessingError))
+				return
+			}
+			db.InstanceSet(auditStateKey, state)
+		}
+	}
+	record := func(action string) func(*gorm.DB) {
+		return func(db *gorm.DB) {
+			v, ok := db.InstanceGet(auditStateKey)
+			if db.Error != nil || !ok {
+				return
+			}
+			if a, ok := db.Statement.Context.Value(auditActionKey{}).(string); ok {
+				action = a
+			} else if action == models.AuditActionDelete && db.Statement.Unscoped {
+				action = models.AuditActionPurge
+			}
+			if err := recordSlots(db, action, v.(*auditState)); err != nil {
+				logger.Errorf("WriteSlotAuditFailed:: [Action: %s, Error: %s]", action, err)
+				_ = db.AddError(models.NewError("WriteSlotAuditFailed:: Internal server error", models.InternalProcessingError))
+			}
+		}
+	}
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("admgr:audit_capture", capture(true)),
+		cb.Create().After("gorm:create").Register("admgr:audit_record", record(models.AuditActionCreate)),
+		cb.Update().Before("gorm:update").Register("admgr:audit_capture", capture(false)),
+		cb.Update().After("gorm:update").Register("admgr:audit_record", record(models.AuditActionUpdate)),
+		cb.Delete().Before("gorm:delete").Register("admgr:audit_capture", capture(false)),
+		cb.Delete().After("gorm:delete").Register("admgr:audit_record", record(models.AuditActionDelete)),
+	)
+}
+
+// captureSlots locks and reads the slots the write touches: the slots at the
+// positions of the created records, or those matching the conditions of an
+// update or delete
+func captureSlots(db *gorm.DB, created bool) (*auditState, error) {
+	keys := slotKeys(slotsOfValue(db.Statement.ReflectValue))
+	var before []*Slot
+	var err error
+	if created {
+		before, err = findSlots(db, keys, true)
+	} else {
+		q := db.Session(&gorm.Session{NewDB: true}).Model(&Slot{}).Clauses(clause.Locking{Strength: "UPDATE"})
+		if db.Statement.Unscoped {
+			q = q.Unscoped()
+		}
+		if c, ok := db.Statement.Clauses["WHERE"]; ok {
+			if where, ok := c.Expression.(clause.Where); ok {
+				q = q.Clauses(where)
+			}
+		}
+		// the keys of the model are only added to the conditions by the write
+		if len(keys) > 0 {
+			q = q.Where("(placement, date, position) IN ?", keys)
+		}
+		err = q.Find(&before).Error
+		keys = slotKeys(before)
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &auditState{keys: keys, before: make(map[string]*Slot, len(before))}
+	for _, slot := range before {
+		state.before[slotKey(slot)] = slot
+	}
+	return state, nil
+}
+
+// recordSlots reads the slots captured before the write again and records
+// their changes in the audit log
+func recordSlots(db *gorm.DB, action string, state *auditState) error {
+	after, err := findSlots(db, state.keys, false)
+	if err != nil {
+		return err
+	}
+	changes := make([]slotChange, 0, len(state.keys))
+	for _, slot := range after {
+		changes = append(changes, slotChange{before: state.before[slotKey(slot)], after: slot})
+		delete(state.before, slotKey(slot))
+	}
+	for _, slot := range state.before {
+		changes = append(changes, slotChange{before: slot})
+	}
+	return writeAudit(db, action, changes)
+}
+
+// findSlots reads the slots with the keys, deleted ones included
+func findSlots(db *gorm.DB, keys [][]interface{}, lock bool) ([]*Slot, error) {
+	var slots []*Slot
+	for start := 0; start < len(keys); start += auditKeyBatch {
+		end := start + auditKeyBatch
+		if end > len(keys) {
+			end = len(keys)
+		}
+		q := db.Session(&gorm.Session{NewDB: true}).Unscoped().Where("(placement, date, position) IN ?", keys[start:end])
+		if lock {
+			q = q.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var found []*Slot
+		if err := q.Find(&found).Error; err != nil {
+			return nil, err
+		}
+		slots = append(slots, found...)
+	}
+	return slots, nil
+}
+
+// writeAudit records the changes of the slots in the audit log, changes which
+// leave every audited field as it was are skipped
+func writeAudit(db *gorm.DB, action string, changes []slotChange) error {
+	audit := auditOf(db)
+	now := time.Now()
+	entries := make([]*SlotAudit, 0, len(changes))
+	for _, change := range changes {
+		before, after, err := slotDiff(change.before, change.after)
+		if err != nil {
+			return err
+		}
+		if before == nil && after == nil {
+			continue
+		}
+		slot := change.after
+		if slot == nil {
+			slot = change.before
+		}
+		entries = append(entries, &SlotAudit{
+			Placement: slot.Placement,
+			Date:      *slot.Date,
+			Position:  *slot.Position,
+			Action:    action,
+			Actor:     audit.Actor,
+			RequestID: audit.RequestID,
+			Before:    before,
+			After:     after,
+			Created:   now,
+		})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return db.Session(&gorm.Session{NewDB: true}).CreateInBatches(entries, auditKeyBatch).Error
+}
+
+// auditOf returns who makes the changes of the session, the system when the
+// storage wasn't given an actor
+func auditOf(db *gorm.DB) *Audit {
+	if audit, ok := db.Statement.Context.Value(auditKey{}).(*Audit); ok {
+		return audit
+	}
+	return &Audit{Actor: models.AuditActorSystem}
+}
+
+// slotsOf returns the slots of the records given to Create and Delete
+func slotsOf(records interface{}) ([]*Slot, bool) {
+	switch r := records.(type) {
+	case []*Slot:
+		return r, true
+	case *Slot:
+		return []*Slot{r}, true
+	}
+	return nil, false
+}
+
+// slotsOfValue returns the slots of the records of a statement
+func slotsOfValue(rv reflect.Value) []*Slot {
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if !rv.IsNil() {
+			return slotsOfValue(rv.Elem())
+		}
+	case reflect.Struct:
+		if rv.CanAddr() {
+			if slot, ok := rv.Addr().Interface().(*Slot); ok {
+				return []*Slot{slot}
+			}
+		} else if slot, ok := rv.Interface().(Slot); ok {
+			return []*Slot{&slot}
+		}
+	case reflect.Slice, reflect.Array:
+		var slots []*Slot
+		for i := 0; i < rv.Len(); i++ {
+			slots = append(slots, slotsOfValue(rv.Index(i))...)
+		}
+		return slots
+	}
+	return nil
+}
+
+// slotKeys returns the keys of the slots, slots missing a part of it are skipped
+func slotKeys(slots []*Slot) [][]interface{} {
+	keys := make([][]interface{}, 0, len(slots))
+	for _, slot := range slots {
+		if slot.Placement != "" && slot.Date != nil && slot.Position != nil {
+			keys = append(keys, []interface{}{slot.Placement, *slot.Date, *slot.Position})
+		}
+	}
+	return keys
+}
+
+func slotKey(slot *Slot) string {
+	return fmt.Sprintf("%s/%d/%d", slot.Placement, slot.Date.Unix(), *slot.Position)
+}
+
+// slotDiff returns the fields of the slot before and after a change, for
+// updates only the fields which changed. Both are nil when nothing changed
+func slotDiff(before, after *Slot) (json.RawMessage, json.RawMessage, error) {
+	b, err := slotFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := slotFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b != nil && a != nil {
+		for k, v := range b {
+			if reflect.DeepEqual(v, a[k]) {
+				delete(b, k)
+				delete(a, k)
+			}
+		}
+		// fields cleared by the change are omitted from their side
+		for k := range b {
+			if _, ok := a[k]; !ok {
+				a[k] = nil
+			}
+		}
+		for k := range a {
+			if _, ok := b[k]; !ok {
+				b[k] = nil
+			}
+		}
+		if len(b) == 0 {
+			return nil, nil, nil
+		}
+	}
+	rb, err := marshalFields(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	ra, err := marshalFields(a)
+	return rb, ra, err
+}
+
+func slotFields(slot *Slot) (map[string]interface{}, error) {
+	if slot == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(slot)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for _, k := range auditIgnored {
+		delete(fields, k)
+	}
+	return fields, nil
+}
+
+func marshalFields(fields map[string]interface{}) (json.RawMessage, error) {
+	if fields == nil {
+		return nil, nil
+	}
+	return json.Marshal(fields)
+}
+
+// registerAuditGuard keeps the audit log append only, updates and deletes of
+// its entries fail
+func registerAuditGuard(db *gorm.DB) error {
+	guard := func(db *gorm.DB) {
+		if db.Statement.Table == (&SlotAudit{}).TableName() {
+			_ = db.AddError(errors.New("the slot audit log is append only"))
+		}
+	}
+	cb := db.Callback()
+	return errors.Join(
+		cb.Update().Before("gorm:update").Register("admgr:audit", guard),
+		cb.Delete().Before("gorm:delete").Register("admgr:audit", guard),
+	)
+}
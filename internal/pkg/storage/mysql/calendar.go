@@ -0,0 +1,62 @@
+package mysql
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// SaveCalendarDays adds the days or replaces the marking of the existing ones
+func (s *Storage) SaveCalendarDays(days []*CalendarDay) error {
+	err := s.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"kind", "uplift", "reason", "modified"}),
+	}).Create(days).Error
+	if err != nil {
+		s.logger.Errorf("SaveCalendarDaysFailed:: [Error: %s, Days: %d]", err, len(days))
+		return models.NewError("SaveCalendarDaysFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteCalendarDay(date time.Time) (int, error) {
+	res := s.db.Where("date = ?", date.Format(time.DateOnly)).Delete(&CalendarDay{})
+	if res.Error != nil {
+		s.logger.Errorf("DeleteCalendarDayFailed:: [Date: %s, Error: %s]", models.DateToString(date), res.Error)
+		return 0, models.NewError("DeleteCalendarDayFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return int(res.RowsAffected), nil
+}
+
+// CalendarDays returns the marked days between start and end, of the given
+// kind unless it is empty
+func (s *Storage) CalendarDays(start, end time.Time, kind string) ([]*CalendarDay, error) {
+	var days []*CalendarDay
+	q := s.db.Where("date BETWEEN ? AND ?", start.Format(time.DateOnly), end.Format(time.DateOnly))
+	if kind != "" {
+		q = q.Where("kind = ?", kind)
+	}
+	if err := q.Order("date").Find(&days).Error; err != nil {
+		s.logger.Errorf("CalendarDaysFailed:: [Error: %s]", err)
+		return nil, models.NewError("CalendarDaysFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return days, nil
+}
+
+// migrateBlackoutDates moves the days of the former blackout_dates table
+// into the calendar
+func migrateBlackoutDates(db *gorm.DB) error {
+	if !db.Migrator().HasTable("blackout_dates") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("INSERT IGNORE INTO calendar_days (date, kind, uplift, reason, created, modified) "+
+			"SELECT date, ?, 0, reason, created, created FROM blackout_dates", models.CalendarBlackout).Error
+		if err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable("blackout_dates")
+	})
+}
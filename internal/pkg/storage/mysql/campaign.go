@@ -0,0 +1,167 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+func (s *Storage) GetAdvertiser(id string) (*Advertiser, error) {
+	var advertiser Advertiser
+	err := s.db.Where("id = ?", id).First(&advertiser).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(fmt.Sprintf("Advertiser %s not found", id), models.ResourceNotFoundError)
+	}
+	if err != nil {
+		s.logger.Errorf("GetAdvertiserFailed:: [Id: %s, Error: %s]", id, err)
+		return nil, models.NewError("GetAdvertiserFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &advertiser, nil
+}
+
+func (s *Storage) Advertisers() ([]*Advertiser, error) {
+	var advertisers []*Advertiser
+	if err := s.db.Order("id").Find(&advertisers).Error; err != nil {
+		s.logger.Errorf("AdvertisersFailed:: [Error: %s]", err)
+		return nil, models.NewError("AdvertisersFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return advertisers, nil
+}
+
+func (s *Storage) UpdateAdvertiser(advertiser *Advertiser) error {
+	if err := s.db.Model(advertiser).Select("name", "email").Updates(advertiser).Error; err != nil {
+		s.logger.Errorf("UpdateAdvertiserFailed:: [Id: %s, Error: %s]", advertiser.ID, err)
+		return models.NewError("UpdateAdvertiserFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteAdvertiser(id string) (int, error) {
+	res := s.db.Where("id = ?", id).Delete(&Advertiser{})
+	if res.Error != nil {
+		s.logger.Errorf("DeleteAdvertiserFailed:: [Id: %s, Error: %s]", id, res.Error)
+		return 0, models.NewError("DeleteAdvertiserFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return int(res.RowsAffected), nil
+}
+
+func (s *Storage) GetCampaign(id string) (*Campaign, error) {
+	var campaign Campaign
+	err := s.db.Where("id = ?", id).First(&campaign).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(fmt.Sprintf("Campaign %s not found", id), models.ResourceNotFoundError)
+	}
+	if err != nil {
+		s.logger.Errorf("GetCampaignFailed:: [Id: %s, Error: %s]", id, err)
+		return nil, models.NewError("GetCampaignFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &campaign, nil
+}
+
+// Campaigns returns the campaigns of the advertiser, all campaigns when
+// advertiserID is empty
+func (s *Storage) Campaigns(advertiserID string) ([]*Campaign, error) {
+	var campaigns []*Campaign
+	q := s.db.Order("created, id")
+	if advertiserID != "" {
+		q = q.Where("advertiser_id = ?", advertiserID)
+	}
+	if err := q.Find(&campaigns).Error; err != nil {
+		s.logger.Errorf("CampaignsFailed:: [AdvertiserId: %s, Error: %s]", advertiserID, err)
+		return nil, models.NewError("CampaignsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return campaigns, nil
+}
+
+func (s *Storage) UpdateCampaign(campaign *Campaign) error {
+	if err := s.db.Model(campaign).Select("name", "budget", "status").Updates(campaign).Error; err != nil {
+		s.logger.Errorf("UpdateCampaignFailed:: [Id: %s, Error: %s]", campaign.ID, err)
+		return models.NewError("UpdateCampaignFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteCampaign(id string) (int, error) {
+	res := s.db.Where("id = ?", id).Delete(&Campaign{})
+	if res.Error != nil {
+		s.logger.Errorf("DeleteCampaignFailed:: [Id: %s, Error: %s]", id, res.Error)
+		return 0, models.NewError("DeleteCampaignFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return int(res.RowsAffected), nil
+}
+
+// CampaignSpend returns the cost of the slots reserved for the campaigns,
+// booked or still on hold, by campaign id
+func (s *Storage) CampaignSpend(ids ...string) (map[string]float64, error) {
+	spend, err := campaignSpend(s.db, ids)
+	if err != nil {
+		s.logger.Errorf("CampaignSpendFailed:: [Ids: %v, Error: %s]", ids, err)
+		return nil, models.NewError("CampaignSpendFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return spend, nil
+}
+
+// CreateTransactions creates the transactions of a reservation, which puts
+// their slots on hold. The campaigns the transactions are charged to are
+// locked until the transactions are created, and they are refused when the
+// spend of a campaign together with its amount would exceed its budget
+func (s *Storage) CreateTransactions(transactions []*Transaction, amounts map[string]float64) error {
+	if len(amounts) == 0 {
+		_, err := s.Create(transactions)
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		ids := make([]string, 0, len(amounts))
+		for id := range amounts {
+			ids = append(ids, id)
+		}
+		var campaigns []*Campaign
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", ids).Order("id").Find(&campaigns).Error; err != nil {
+			s.logger.Errorf("LockCampaignsFailed:: [Ids: %v, Error: %s]", ids, err)
+			return models.NewError("ReserveSlotsFailed:: Internal server error", models.InternalProcessingError)
+		}
+		spend, err := campaignSpend(tx, ids)
+		if err != nil {
+			s.logger.Errorf("CampaignSpendFailed:: [Ids: %v, Error: %s]", ids, err)
+			return models.NewError("ReserveSlotsFailed:: Internal server error", models.InternalProcessingError)
+		}
+		for _, campaign := range campaigns {
+			if campaign.Budget > 0 && roundAmount(spend[campaign.ID]+amounts[campaign.ID]) > roundAmount(campaign.Budget) {
+				return models.NewError(
+					fmt.Sprintf("Reservation of %.2f exceeds the remaining budget %.2f of campaign %s", amounts[campaign.ID], campaign.Budget-spend[campaign.ID], campaign.ID),
+					models.ActionForbidden,
+				)
+			}
+		}
+		if err := tx.Create(transactions).Error; err != nil {
+			return s.createError(err, transactions)
+		}
+		return nil
+	})
+}
+
+func campaignSpend(db *gorm.DB, ids []string) (map[string]float64, error) {
+	var rows []struct {
+		CampaignID string
+		Spend      float64
+	}
+	err := db.Model(&Transaction{}).
+		Select("transactions.campaign_id, COALESCE(SUM(slots.cost), 0) AS spend").
+		Joins("JOIN slots ON slots.tenant = transactions.tenant AND slots.placement = transactions.placement AND "+
+			"slots.date = transactions.date AND slots.position = transactions.position").
+		Where("transactions.campaign_id IN ?", ids).
+		Group("transactions.campaign_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	spend := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		spend[row.CampaignID] = row.Spend
+	}
+	return spend, nil
+}
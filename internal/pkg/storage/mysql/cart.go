@@ -0,0 +1,73 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// CreateCart creates the cart with its first items, duplicate items are ignored
+func (s *Storage) CreateCart(cart *Cart, items []*CartItem) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(cart).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(items).Error
+	})
+	if err != nil {
+		s.logger.Errorf("CreateCartFailed:: [Error: %s, Cart: %+v]", err, cart)
+		return models.NewError("CreateCartFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+func (s *Storage) GetCart(id string) (*Cart, error) {
+	var cart Cart
+	err := s.db.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("placement, date, position")
+	}).Where("id = ?", id).First(&cart).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(fmt.Sprintf("Cart %s not found", id), models.ResourceNotFoundError)
+	}
+	if err != nil {
+		s.logger.Errorf("GetCartFailed:: [Id: %s, Error: %s]", id, err)
+		return nil, models.NewError("GetCartFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &cart, nil
+}
+
+// AddCartItems adds the items to the cart, items already in the cart are ignored
+func (s *Storage) AddCartItems(items []*CartItem) error {
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(items).Error; err != nil {
+		s.logger.Errorf("AddCartItemsFailed:: [Error: %s]", err)
+		return models.NewError("AddCartItemsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+func (s *Storage) RemoveCartItems(items []*CartItem) (int, error) {
+	res := s.db.Delete(items)
+	if res.Error != nil {
+		s.logger.Errorf("RemoveCartItemsFailed:: [Error: %s]", res.Error)
+		return 0, models.NewError("RemoveCartItemsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return int(res.RowsAffected), nil
+}
+
+// UpdateCartStatus moves the cart from one status to another, it returns
+// false if the cart wasn't in the expected status
+func (s *Storage) UpdateCartStatus(id, lastStatus, newStatus string) (bool, error) {
+	res := s.db.Model(&Cart{}).Where("id = ? AND status = ?", id, lastStatus).Update("status", newStatus)
+	if res.Error != nil {
+		s.logger.Errorf("UpdateCartStatusFailed:: [Id: %s, Error: %s]", id, res.Error)
+		return false, models.NewError("UpdateCartStatusFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return res.RowsAffected == 1, nil
+}
@@ -0,0 +1,122 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// servingTables are the tables whose changes alter which creative is served
+var servingTables = map[string]bool{
+	"slots":      true,
+	"creatives":  true,
+	"placements": true,
+	"day_parts":  true,
+}
+
+// changeListeners are told about the changes of the serving tables, they are
+// shared by the storages of all tenants of a database
+type changeListeners struct {
+	mu        sync.RWMutex
+	listeners []func(tenant string)
+}
+
+func (c *changeListeners) notify(tenant string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, listener := range c.listeners {
+		listener(tenant)
+	}
+}
+
+// OnChange registers the listener to be called with the tenant whenever
+// slots, creatives or placements are created, updated or deleted. It runs
+// once the surrounding transaction committed, changes which are rolled back
+// aren't told, and must not block
+func (s *Storage) OnChange(listener func(tenant string)) {
+	s.changes.mu.Lock()
+	defer s.changes.mu.Unlock()
+	s.changes.listeners = append(s.changes.listeners, listener)
+}
+
+// changePool begins the transactions of the database as changeTx
+type changePool struct {
+	gorm.ConnPool
+	db      *sql.DB
+	changes *changeListeners
+}
+
+func (p *changePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	tx, err := p.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &changeTx{Tx: tx, changes: p.changes}, nil
+}
+
+func (p *changePool) GetDBConn() (*sql.DB, error) {
+	return p.db, nil
+}
+
+// changeTx keeps the tenants whose serving tables the transaction changed
+// and tells the listeners once it committed
+type changeTx struct {
+	*sql.Tx
+	changes *changeListeners
+	mu      sync.Mutex
+	tenants map[string]bool
+}
+
+func (t *changeTx) changed(tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tenants == nil {
+		t.tenants = make(map[string]bool)
+	}
+	t.tenants[tenant] = true
+}
+
+func (t *changeTx) Commit() error {
+	if err := t.Tx.Commit(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	tenants := t.tenants
+	t.tenants = nil
+	t.mu.Unlock()
+	for tenant := range tenants {
+		t.changes.notify(tenant)
+	}
+	return nil
+}
+
+// registerChangeNotifier calls the listeners after every write to the serving
+// tables, the writes of a transaction once it commits
+func registerChangeNotifier(db *gorm.DB, changes *changeListeners) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	db.ConnPool = &changePool{ConnPool: db.ConnPool, db: sqlDB, changes: changes}
+	db.Statement.ConnPool = db.ConnPool
+	notify := func(db *gorm.DB) {
+		if db.Error != nil || !servingTables[db.Statement.Table] {
+			return
+		}
+		tenant, _ := db.Statement.Context.Value(tenantKey{}).(string)
+		if tx, ok := db.Statement.ConnPool.(*changeTx); ok {
+			tx.changed(tenant)
+			return
+		}
+		changes.notify(tenant)
+	}
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().After("gorm:create").Register("admgr:changes", notify),
+		cb.Update().After("gorm:update").Register("admgr:changes", notify),
+		cb.Delete().After("gorm:delete").Register("admgr:changes", notify),
+	)
+}
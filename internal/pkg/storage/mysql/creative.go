@@ -0,0 +1,156 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+func (s *Storage) GetCreative(id string) (*Creative, error) {
+	var creative Creative
+	err := s.db.Where("id = ?", id).First(&creative).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(fmt.Sprintf("Creative %s not found", id), models.ResourceNotFoundError)
+	}
+	if err != nil {
+		s.logger.Errorf("GetCreativeFailed:: [Id: %s, Error: %s]", id, err)
+		return nil, models.NewError("GetCreativeFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &creative, nil
+}
+
+// Creatives returns the creatives of the advertiser in the review status,
+// empty values match all creatives
+func (s *Storage) Creatives(advertiserID, status string) ([]*Creative, error) {
+	var creatives []*Creative
+	q := s.db.Order("created, id")
+	if advertiserID != "" {
+		q = q.Where("advertiser_id = ?", advertiserID)
+	}
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if err := q.Find(&creatives).Error; err != nil {
+		s.logger.Errorf("CreativesFailed:: [AdvertiserId: %s, Error: %s]", advertiserID, err)
+		return nil, models.NewError("CreativesFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return creatives, nil
+}
+
+// CreativesByIDs returns the creatives with the ids by id
+func (s *Storage) CreativesByIDs(ids []string) (map[string]*Creative, error) {
+	res := make(map[string]*Creative, len(ids))
+	if len(ids) == 0 {
+		return res, nil
+	}
+	var creatives []*Creative
+	if err := s.db.Where("id IN ?", ids).Find(&creatives).Error; err != nil {
+		s.logger.Errorf("CreativesByIDsFailed:: [Ids: %v, Error: %s]", ids, err)
+		return nil, models.NewError("CreativesFailed:: Internal server error", models.InternalProcessingError)
+	}
+	for _, creative := range creatives {
+		res[creative.ID] = creative
+	}
+	return res, nil
+}
+
+// DeleteCreative deletes the creative unless it is attached to slots, the
+// creative is locked so that it cannot be attached meanwhile
+func (s *Storage) DeleteCreative(id string) (int, error) {
+	deleted := 0
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var creative Creative
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&creative).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var used int64
+		if err = tx.Model(&Slot{}).Where("creative_id = ?", id).Count(&used).Error; err != nil {
+			return err
+		}
+		if used > 0 {
+			return models.NewError(fmt.Sprintf("Creative %s is attached to %d slots", id, used), models.ActionForbidden)
+		}
+		res := tx.Where("id = ?", id).Delete(&Creative{})
+		deleted = int(res.RowsAffected)
+		return res.Error
+	})
+	if mErr, ok := err.(*models.Error); ok {
+		return 0, mErr
+	}
+	if err != nil {
+		s.logger.Errorf("DeleteCreativeFailed:: [Id: %s, Error: %s]", id, err)
+		return 0, models.NewError("DeleteCreativeFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return deleted, nil
+}
+
+// ReviewCreative saves the review of the creative if it's still in
+// lastStatus, it returns false when it was reviewed meanwhile
+func (s *Storage) ReviewCreative(creative *Creative, lastStatus string) (bool, error) {
+	res := s.db.Model(&Creative{}).Where("id = ? AND status = ?", creative.ID, lastStatus).Updates(map[string]interface{}{
+		"status":        creative.Status,
+		"review_reason": creative.ReviewReason,
+		"reviewed_by":   creative.ReviewedBy,
+		"reviewed_at":   creative.ReviewedAt,
+	})
+	if res.Error != nil {
+		s.logger.Errorf("ReviewCreativeFailed:: [Id: %s, Error: %s]", creative.ID, res.Error)
+		return false, models.NewError("ReviewCreativeFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// CreativeUsage returns the number of slots the creative is attached to
+func (s *Storage) CreativeUsage(id string) (int64, error) {
+	var count int64
+	if err := s.db.Model(&Slot{}).Where("creative_id = ?", id).Count(&count).Error; err != nil {
+		s.logger.Errorf("CreativeUsageFailed:: [Id: %s, Error: %s]", id, err)
+		return 0, models.NewError("CreativeUsageFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return count, nil
+}
+
+// AttachCreatives attaches the creatives to the slots booked by uid in one
+// database transaction, a nil creative id detaches it. The creatives are
+// locked so that they cannot be deleted meanwhile, and nothing is attached
+// when a slot is no longer booked by uid
+func (s *Storage) AttachCreatives(slots []*Slot, uid string, creativeIDs []*string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for i, slot := range slots {
+			if id := creativeIDs[i]; id != nil {
+				var creative Creative
+				err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", *id).First(&creative).Error
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return models.NewError(fmt.Sprintf("Creative %s not found", *id), models.ResourceNotFoundError)
+				}
+				if err != nil {
+					s.logger.Errorf("AttachCreativeFailed:: [Error: %s, Creative: %s]", err, *id)
+					return models.NewError("AttachCreativeFailed:: Internal server error", models.InternalProcessingError)
+				}
+			}
+			res := tx.Model(&Slot{}).
+				Where("placement = ? AND date = ? AND position = ? AND status = ? AND booked_by = ?",
+					slot.Placement, slot.Date, slot.Position, models.SlotStatusBooked, uid).
+				Update("creative_id", creativeIDs[i])
+			if res.Error != nil {
+				s.logger.Errorf("AttachCreativeFailed:: [Error: %s, Slot: %s]", res.Error, slot.ToString())
+				return models.NewError("AttachCreativeFailed:: Internal server error", models.InternalProcessingError)
+			}
+			if res.RowsAffected == 0 {
+				return models.NewError(
+					fmt.Sprintf("Slot with [placement: %s, date: %s, position: %d] is not booked by %s", slot.Placement, models.TimeToString(*slot.Date), *slot.Position, uid),
+					models.ActionForbidden,
+				)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,123 @@
+package mysql
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// purgeBatchSize is the number of deleted slots purged per transaction
+const purgeBatchSize = 500
+
+// RestoreSlots brings the deleted slots back, all of them must be deleted
+func (s *Storage) RestoreSlots(slots []*Slot) (int, error) {
+	restored := 0
+	err := withAuditAction(s.db, models.AuditActionRestore).Transaction(func(tx *gorm.DB) error {
+		for _, slot := range slots {
+			var found []*Slot
+			err := tx.Unscoped().
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("placement = ? AND date = ? AND position = ? AND deleted_at IS NOT NULL", slot.Placement, slot.Date, slot.Position).
+				Limit(1).
+				Find(&found).
+				Error
+			if err != nil {
+				s.logger.Errorf("RestoreSlotsFailed:: [Error: %s, Slot: %s]", err, slot.ToString())
+				return models.NewError("RestoreSlotsFailed:: Internal server error", models.InternalProcessingError)
+			}
+			if len(found) == 0 {
+				return models.NewError(fmt.Sprintf("Slot is not deleted %s", slot.ToString()), models.ActionForbidden)
+			}
+			res := tx.Unscoped().Model(&Slot{}).
+				Where("placement = ? AND date = ? AND position = ?", slot.Placement, slot.Date, slot.Position).
+				Updates(map[string]interface{}{"deleted_at": nil, "deleted_by": nil})
+			if res.Error != nil {
+				s.logger.Errorf("RestoreSlotsFailed:: [Error: %s, Slot: %s]", res.Error, slot.ToString())
+				return models.NewError("RestoreSlotsFailed:: Internal server error", models.InternalProcessingError)
+			}
+			restored += int(res.RowsAffected)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Infof("RestoreSlots:: Total %d slots restored", restored)
+	return restored, nil
+}
+
+// PurgeDeletedSlots removes the slots deleted before the time for good, with
+// their transactions
+func (s *Storage) PurgeDeletedSlots(before time.Time) (int, error) {
+	purged := 0
+	for {
+		var slots []*Slot
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Unscoped().
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("deleted_at < ?", before).
+				Order("deleted_at").
+				Limit(purgeBatchSize).
+				Find(&slots).
+				Error
+			if err != nil {
+				s.logger.Errorf("PurgeSlotsFailed:: [Before: %s, Error: %s]", before, err)
+				return models.NewError("PurgeSlotsFailed:: Internal server error", models.InternalProcessingError)
+			}
+			return s.purgeSlots(tx, slots)
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += len(slots)
+		if len(slots) < purgeBatchSize {
+			break
+		}
+	}
+	if purged > 0 {
+		s.logger.Infof("PurgeSlots:: Total %d deleted slots purged", purged)
+	}
+	return purged, nil
+}
+
+// deletedSlotsAt returns the deleted slots at the positions of the slots
+func (s *Storage) deletedSlotsAt(tx *gorm.DB, slots []*Slot) ([]*Slot, error) {
+	var deleted []*Slot
+	for start := 0; start < len(slots); start += purgeBatchSize {
+		end := start + purgeBatchSize
+		if end > len(slots) {
+			end = len(slots)
+		}
+		keys := make([][]interface{}, 0, end-start)
+		for _, slot := range slots[start:end] {
+			keys = append(keys, []interface{}{slot.Placement, slot.Date, slot.Position})
+		}
+		var found []*Slot
+		err := tx.Unscoped().
+			Where("(placement, date, position) IN ? AND deleted_at IS NOT NULL", keys).
+			Find(&found).
+			Error
+		if err != nil {
+			s.logger.Errorf("DeletedSlotsFailed:: [Error: %s]", err)
+			return nil, models.NewError("FailedToCreate:: Internal server error", models.InternalProcessingError)
+		}
+		deleted = append(deleted, found...)
+	}
+	return deleted, nil
+}
+
+// purgeSlots hard deletes the slots
+func (s *Storage) purgeSlots(tx *gorm.DB, slots []*Slot) error {
+	if len(slots) == 0 {
+		return nil
+	}
+	if err := tx.Unscoped().Delete(slots).Error; err != nil {
+		s.logger.Errorf("PurgeSlotsFailed:: [Error: %s, Slots: %d]", err, len(slots))
+		return models.NewError("PurgeSlotsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package mysql
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// deliveryStatsBatchSize keeps the inserts of the stats below the placeholder
+// limit of the prepared statements
+const deliveryStatsBatchSize = 1000
+
+// AddDeliveryStats adds the counts of the stats to the stored ones
+func (s *Storage) AddDeliveryStats(stats []*DeliveryStat) error {
+	err := s.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"impressions": gorm.Expr("impressions + VALUES(impressions)"),
+			"clicks":      gorm.Expr("clicks + VALUES(clicks)"),
+			"modified":    gorm.Expr("VALUES(modified)"),
+		}),
+	}).CreateInBatches(stats, deliveryStatsBatchSize).Error
+	if err != nil {
+		s.logger.Errorf("AddDeliveryStatsFailed:: [Error: %s, Stats: %d]", err, len(stats))
+		return models.NewError("AddDeliveryStatsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+// DeliveryStats returns the stats of the slots starting between start and
+// end, of one placement unless it's empty
+func (s *Storage) DeliveryStats(placement string, start, end time.Time) ([]*DeliveryStat, error) {
+	var stats []*DeliveryStat
+	q := s.db.Where("date BETWEEN ? AND ?", start, end)
+	if placement != "" {
+		q = q.Where("placement = ?", placement)
+	}
+	if err := q.Find(&stats).Error; err != nil {
+		s.logger.Errorf("DeliveryStatsFailed:: [Placement: %s, Error: %s]", placement, err)
+		return nil, models.NewError("DeliveryStatsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return stats, nil
+}
@@ -0,0 +1,72 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// ExportOptions select the slots of an export by their start
+type ExportOptions struct {
+	// Placement limits the export to a placement, all placements when empty
+	Placement string
+	Start     time.Time
+	End       time.Time
+	// Statuses limits the export to slots in one of the statuses, all when empty
+	Statuses []string
+}
+
+// BookingRow is a slot with the transaction of its booking, if any
+type BookingRow struct {
+	Placement  string
+	Date       time.Time
+	EndsAt     *time.Time
+	Position   int32
+	Status     string
+	Cost       float64
+	Txnid      *string
+	Provider   *string
+	CampaignID *string
+	BookedBy   *string
+	BookedDate *time.Time
+	CreativeID *string
+}
+
+// EachBooking hands the slots of the options with their transactions to fn
+// in the order of their start, one row after the other as they are read
+func (s *Storage) EachBooking(opts *ExportOptions, fn func(*BookingRow) error) error {
+	q := s.db.Model(&Slot{}).
+		Select("slots.placement, slots.date, slots.ends_at, slots.position, slots.status, slots.cost, transactions.txnid, "+
+			"transactions.provider, transactions.campaign_id, slots.booked_by, slots.booked_date, slots.creative_id").
+		Joins("LEFT JOIN transactions ON transactions.tenant = slots.tenant AND transactions.placement = slots.placement AND "+
+			"transactions.date = slots.date AND transactions.position = slots.position").
+		Where("slots.date BETWEEN ? AND ?", opts.Start, opts.End)
+	if opts.Placement != "" {
+		q = q.Where("slots.placement = ?", opts.Placement)
+	}
+	if len(opts.Statuses) > 0 {
+		q = q.Where("slots.status IN ?", opts.Statuses)
+	}
+	rows, err := q.Order("slots.date, slots.placement, slots.position").Rows()
+	if err != nil {
+		s.logger.Errorf("ExportBookingsFailed:: [Options: %+v, Error: %s]", opts, err)
+		return models.NewError("ExportBookingsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row BookingRow
+		if err = rows.Scan(&row.Placement, &row.Date, &row.EndsAt, &row.Position, &row.Status, &row.Cost, &row.Txnid,
+			&row.Provider, &row.CampaignID, &row.BookedBy, &row.BookedDate, &row.CreativeID); err != nil {
+			s.logger.Errorf("ExportBookingsFailed:: [Options: %+v, Error: %s]", opts, err)
+			return models.NewError("ExportBookingsFailed:: Internal server error", models.InternalProcessingError)
+		}
+		if err = fn(&row); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		s.logger.Errorf("ExportBookingsFailed:: [Options: %+v, Error: %s]", opts, err)
+		return models.NewError("ExportBookingsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// CreateHold puts the open slots on hold and records the hold along with
+// its transactions, it fails without changes if any slot isn't open
+func (s *Storage) CreateHold(hold *Hold, transactions []*Transaction) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, txn := range transactions {
+			res := tx.Model(&Slot{}).
+				Where("placement = ? AND date = ? AND position = ? AND status = ?", txn.Placement, txn.Date, txn.Position, models.SlotStatusOpen).
+				Update("status", models.SlotStatusHold)
+			if res.Error != nil {
+				s.logger.Errorf("CreateHoldFailed:: [Error: %s, Hold: %+v]", res.Error, hold)
+				return models.NewError("CreateHoldFailed:: Internal server error", models.InternalProcessingError)
+			}
+			if res.RowsAffected == 0 {
+				return models.NewError(
+					fmt.Sprintf("Slot with [placement: %s, date: %s, position: %d] not open", txn.Placement, models.DateToString(*txn.Date), *txn.Position),
+					models.ActionForbidden,
+				)
+			}
+		}
+		if err := tx.Create(hold).Error; err != nil {
+			s.logger.Errorf("CreateHoldFailed:: [Error: %s, Hold: %+v]", err, hold)
+			return models.NewError("CreateHoldFailed:: Internal server error", models.InternalProcessingError)
+		}
+		if err := tx.Create(transactions).Error; err != nil {
+			s.logger.Errorf("CreateHoldFailed:: [Error: %s, Hold: %+v]", err, hold)
+			return models.NewError("CreateHoldFailed:: Internal server error", models.InternalProcessingError)
+		}
+		return nil
+	})
+}
+
+func (s *Storage) GetHold(id string) (*Hold, error) {
+	var hold Hold
+	err := s.db.Where("id = ?", id).First(&hold).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(fmt.Sprintf("Hold %s not found", id), models.ResourceNotFoundError)
+	}
+	if err != nil {
+		s.logger.Errorf("GetHoldFailed:: [Id: %s, Error: %s]", id, err)
+		return nil, models.NewError("GetHoldFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &hold, nil
+}
+
+// UpdateHoldStatus moves the hold from one status to another, it returns
+// false if the hold wasn't in the expected status
+func (s *Storage) UpdateHoldStatus(id, lastStatus, newStatus string) (bool, error) {
+	res := s.db.Model(&Hold{}).Where("id = ? AND status = ?", id, lastStatus).Update("status", newStatus)
+	if res.Error != nil {
+		s.logger.Errorf("UpdateHoldStatusFailed:: [Id: %s, Error: %s]", id, res.Error)
+		return false, models.NewError("UpdateHoldStatusFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// ReleaseHold opens the held slots again and closes the hold with the given
+// status, it returns false if the hold wasn't active
+func (s *Storage) ReleaseHold(id, newStatus string) (bool, error) {
+	released := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Hold{}).Where("id = ? AND status = ?", id, models.HoldStatusActive).Update("status", newStatus)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		var transactions []*Transaction
+		if err := tx.Where("txnid = ?", id).Find(&transactions).Error; err != nil {
+			return err
+		}
+		// deleting a transaction opens its slot if it's still on hold
+		for _, txn := range transactions {
+			if err := tx.Delete(txn).Error; err != nil {
+				return err
+			}
+		}
+		released = true
+		return nil
+	})
+	if err != nil {
+		s.logger.Errorf("ReleaseHoldFailed:: [Id: %s, Error: %s]", id, err)
+		return false, models.NewError("ReleaseHoldFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return released, nil
+}
+
+// SlotsByTxnid returns the slots of a reservation or hold
+func (s *Storage) SlotsByTxnid(txnid string) ([]*Slot, error) {
+	var slots []*Slot
+	err := s.db.Model(&Slot{}).
+		Joins("JOIN transactions ON transactions.tenant = slots.tenant AND transactions.placement = slots.placement AND transactions.date = slots.date AND transactions.position = slots.position").
+		Where("transactions.txnid = ?", txnid).
+		Preload("Transaction").
+		Order("slots.placement, slots.date, slots.position").
+		Find(&slots).Error
+	if err != nil {
+		s.logger.Errorf("SlotsByTxnidFailed:: [Txnid: %s, Error: %s]", txnid, err)
+		return nil, models.NewError("SlotsByTxnidFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return slots, nil
+}
+
+// ExpiredHolds returns the active holds which expired before now and the
+// holds confirming since before staleConfirming, whose confirmation was
+// abandoned
+func (s *Storage) ExpiredHolds(now, staleConfirming time.Time) ([]*Hold, error) {
+	var holds []*Hold
+	err := s.db.Where("(status = ? AND expires_at < ?) OR (status = ? AND modified < ?)",
+		models.HoldStatusActive, now, models.HoldStatusConfirming, staleConfirming).
+		Find(&holds).Error
+	if err != nil {
+		s.logger.Errorf("ExpiredHoldsFailed:: [Error: %s]", err)
+		return nil, models.NewError("ExpiredHoldsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return holds, nil
+}
+
+// ActiveHoldIDs returns the ids of the holds which are waiting for confirmation
+func (s *Storage) ActiveHoldIDs() ([]string, error) {
+	var ids []string
+	if err := s.db.Model(&Hold{}).Where("status = ?", models.HoldStatusActive).Pluck("id", &ids).Error; err != nil {
+		s.logger.Errorf("ActiveHoldIDsFailed:: [Error: %s]", err)
+		return nil, models.NewError("ActiveHoldIDsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return ids, nil
+}
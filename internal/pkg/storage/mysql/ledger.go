@@ -0,0 +1,299 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+const (
+	fundingAccountID = "system:funding"
+	revenueAccountID = "system:revenue"
+)
+
+func walletAccountID(uid string) string {
+	return "wallet:" + uid
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func slotsCost(slots []*Slot) float64 {
+	var total float64
+	for _, s := range slots {
+		total += *s.Cost
+	}
+	return roundAmount(total)
+}
+
+// postEntries writes a balanced movement to the ledger and updates the account
+// balances, accounts are locked in id order so concurrent postings can't
+// deadlock, a wallet balance is never allowed to go below zero
+func (s *Storage) postEntries(tx *gorm.DB, reference, kind string, movements map[string]float64) error {
+	ids := make([]string, 0, len(movements))
+	var sum float64
+	for id, amount := range movements {
+		ids = append(ids, id)
+		sum += amount
+	}
+	if roundAmount(sum) != 0 {
+		return models.NewError(fmt.Sprintf("Unbalanced ledger movement %s: %v", reference, movements), models.InternalProcessingError)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		var account LedgerAccount
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&account).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.NewError(fmt.Sprintf("Ledger account %s not found", id), models.ActionForbidden)
+		}
+		if err != nil {
+			s.logger.Errorf("PostLedgerEntriesFailed:: [Account: %s, Error: %s]", id, err)
+			return models.NewError("PostLedgerEntriesFailed:: Internal server error", models.InternalProcessingError)
+		}
+		balance := roundAmount(account.Balance + movements[id])
+		if account.Type == models.LedgerAccountWallet && balance < 0 {
+			return models.NewError(
+				fmt.Sprintf("Insufficient wallet balance [Balance: %.2f, Amount: %.2f]", account.Balance, -movements[id]),
+				models.ActionForbidden,
+			)
+		}
+		if err = tx.Model(&account).Update("balance", balance).Error; err != nil {
+			s.logger.Errorf("PostLedgerEntriesFailed:: [Account: %s, Error: %s]", id, err)
+			return models.NewError("PostLedgerEntriesFailed:: Internal server error", models.InternalProcessingError)
+		}
+		entry := &LedgerEntry{
+			Reference:    reference,
+			AccountID:    id,
+			Kind:         kind,
+			Amount:       roundAmount(movements[id]),
+			BalanceAfter: balance,
+		}
+		if err = tx.Create(entry).Error; err != nil {
+			s.logger.Errorf("PostLedgerEntriesFailed:: [Entry: %+v, Error: %s]", entry, err)
+			return models.NewError("PostLedgerEntriesFailed:: Internal server error", models.InternalProcessingError)
+		}
+	}
+	return nil
+}
+
+// ensureAccounts creates the given ledger accounts if they don't exist yet
+func (s *Storage) ensureAccounts(tx *gorm.DB, accounts ...*LedgerAccount) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(accounts).Error; err != nil {
+		s.logger.Errorf("EnsureLedgerAccountsFailed:: [Error: %s]", err)
+		return models.NewError("EnsureLedgerAccountsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+// TopUpWallet credits the advertiser's wallet from the funding account,
+// the wallet is opened on its first top up
+func (s *Storage) TopUpWallet(uid string, amount float64) (*LedgerAccount, error) {
+	var wallet LedgerAccount
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := s.ensureAccounts(tx,
+			&LedgerAccount{ID: walletAccountID(uid), Type: models.LedgerAccountWallet, Uid: models.PtrString(uid)},
+			&LedgerAccount{ID: fundingAccountID, Type: models.LedgerAccountFunding},
+		)
+		if err != nil {
+			return err
+		}
+		err = s.postEntries(tx, uuid.New().String(), models.LedgerEntryTopUp, map[string]float64{
+			walletAccountID(uid): amount,
+			fundingAccountID:     -amount,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", walletAccountID(uid)).First(&wallet).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Infof("TopUpWallet:: [Uid: %s, Amount: %.2f, Balance: %.2f]", uid, amount, wallet.Balance)
+	return &wallet, nil
+}
+
+func (s *Storage) GetWallet(uid string) (*LedgerAccount, error) {
+	var wallet LedgerAccount
+	err := s.db.Where("id = ?", walletAccountID(uid)).First(&wallet).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(fmt.Sprintf("Wallet not found for uid %s", uid), models.ResourceNotFoundError)
+	}
+	if err != nil {
+		s.logger.Errorf("GetWalletFailed:: [Uid: %s, Error: %s]", uid, err)
+		return nil, models.NewError("GetWalletFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &wallet, nil
+}
+
+// WalletStatement returns the entries of the advertiser's wallet created
+// between start and end, both inclusive
+func (s *Storage) WalletStatement(uid string, start, end time.Time) ([]*LedgerEntry, error) {
+	var entries []*LedgerEntry
+	err := s.db.Where("account_id = ? AND created >= ? AND created < ?", walletAccountID(uid),
+		start.Format(time.DateOnly), end.AddDate(0, 0, 1).Format(time.DateOnly)).
+		Order("id").
+		Find(&entries).Error
+	if err != nil {
+		s.logger.Errorf("WalletStatementFailed:: [Uid: %s, Error: %s]", uid, err)
+		return nil, models.NewError("WalletStatementFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return entries, nil
+}
+
+// WalletDebits returns the wallet debits posted for the given transactions,
+// net of their refunds. Debits refunded in full are left out
+func (s *Storage) WalletDebits(txnids []string) ([]*LedgerEntry, error) {
+	var entries []*LedgerEntry
+	err := s.db.Preload("Account").
+		Joins("JOIN ledger_accounts ON ledger_accounts.tenant = ledger_entries.tenant AND ledger_accounts.id = ledger_entries.account_id").
+		Where("ledger_entries.reference IN ? AND ledger_entries.kind = ? AND ledger_accounts.type = ?",
+			txnids, models.LedgerEntryDebit, models.LedgerAccountWallet).
+		Find(&entries).Error
+	if err != nil {
+		s.logger.Errorf("WalletDebitsFailed:: [Error: %s]", err)
+		return nil, models.NewError("WalletDebitsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	var refunds []struct {
+		Reference string
+		AccountID string
+		Amount    float64
+	}
+	err = s.db.Model(&LedgerEntry{}).
+		Select("reference, account_id, SUM(amount) AS amount").
+		Where("reference IN ? AND kind = ? AND account_id LIKE ?", txnids, models.LedgerEntryRefund, walletAccountID("%")).
+		Group("reference, account_id").
+		Scan(&refunds).Error
+	if err != nil {
+		s.logger.Errorf("WalletDebitsFailed:: [Error: %s]", err)
+		return nil, models.NewError("WalletDebitsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	refunded := make(map[string]float64, len(refunds))
+	for _, refund := range refunds {
+		refunded[refund.Reference+"/"+refund.AccountID] = refund.Amount
+	}
+	debits := make([]*LedgerEntry, 0, len(entries))
+	for _, entry := range entries {
+		key := entry.Reference + "/" + entry.AccountID
+		entry.Amount = roundAmount(entry.Amount + refunded[key])
+		delete(refunded, key)
+		if entry.Amount < 0 {
+			debits = append(debits, entry)
+		}
+	}
+	return debits, nil
+}
+
+func (s *Storage) debitWallet(tx *gorm.DB, uid, txnid string, amount float64) error {
+	if err := s.ensureAccounts(tx, &LedgerAccount{ID: revenueAccountID, Type: models.LedgerAccountRevenue}); err != nil {
+		return err
+	}
+	return s.postEntries(tx, txnid, models.LedgerEntryDebit, map[string]float64{
+		walletAccountID(uid): -amount,
+		revenueAccountID:     amount,
+	})
+}
+
+// DebitWallet moves amount from the advertiser's wallet to revenue
+func (s *Storage) DebitWallet(uid, txnid string, amount float64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return s.debitWallet(tx, uid, txnid, amount)
+	})
+}
+
+// DebitWalletAndBook debits the cost of the slots from the advertiser's wallet
+// and moves the slots from hold to booked in the same database transaction
+func (s *Storage) DebitWalletAndBook(slots []*Slot, uid, txnid string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.debitWallet(tx, uid, txnid, slotsCost(slots)); err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, slot := range slots {
+			res := tx.Model(&Slot{}).
+				Where("placement = ? AND date = ? AND position = ? AND status = ?", slot.Placement, slot.Date, slot.Position, models.SlotStatusHold).
+				Updates(map[string]interface{}{
+					"status":      models.SlotStatusBooked,
+					"booked_by":   uid,
+					"booked_date": now,
+				})
+			if res.Error != nil {
+				s.logger.Errorf("DebitWalletAndBookFailed:: [Slot: %s, Error: %s]", slot.ToString(), res.Error)
+				return models.NewError("BookSlotsFailed:: Internal server error", models.InternalProcessingError)
+			}
+			if res.RowsAffected == 0 {
+				return models.NewError(
+					fmt.Sprintf("Slot with [placement: %s, date: %s, position: %d] is not on hold", slot.Placement, models.DateToString(*slot.Date), *slot.Position),
+					models.ActionForbidden,
+				)
+			}
+		}
+		return nil
+	})
+}
+
+// RefundWalletAndRelease opens the slots booked by the advertiser under txnid
+// again and refunds their cost to the wallet in the same database transaction,
+// the total refunded for a transaction never exceeds what was debited
+func (s *Storage) RefundWalletAndRelease(slots []*Slot, uid, txnid string) error {
+	amount := slotsCost(slots)
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var debited, refunded float64
+		if err := tx.Model(&LedgerEntry{}).
+			Where("reference = ? AND account_id = ? AND kind = ?", txnid, walletAccountID(uid), models.LedgerEntryDebit).
+			Select("COALESCE(-SUM(amount), 0)").Scan(&debited).Error; err != nil {
+			s.logger.Errorf("RefundWalletFailed:: [Txnid: %s, Error: %s]", txnid, err)
+			return models.NewError("RefundWalletFailed:: Internal server error", models.InternalProcessingError)
+		}
+		if err := tx.Model(&LedgerEntry{}).
+			Where("reference = ? AND account_id = ? AND kind = ?", txnid, walletAccountID(uid), models.LedgerEntryRefund).
+			Select("COALESCE(SUM(amount), 0)").Scan(&refunded).Error; err != nil {
+			s.logger.Errorf("RefundWalletFailed:: [Txnid: %s, Error: %s]", txnid, err)
+			return models.NewError("RefundWalletFailed:: Internal server error", models.InternalProcessingError)
+		}
+		if roundAmount(refunded+amount) > roundAmount(debited) {
+			return models.NewError(
+				fmt.Sprintf("Refund of %.2f exceeds the remaining debit %.2f of transaction %s", amount, debited-refunded, txnid),
+				models.ActionForbidden,
+			)
+		}
+		for _, slot := range slots {
+			res := tx.Model(&Slot{}).
+				Where("placement = ? AND date = ? AND position = ? AND status = ? AND booked_by = ?",
+					slot.Placement, slot.Date, slot.Position, models.SlotStatusBooked, uid).
+				Updates(map[string]interface{}{
+					"status":      models.SlotStatusOpen,
+					"booked_by":   nil,
+					"booked_date": nil,
+					"creative_id": nil,
+				})
+			if res.Error != nil {
+				s.logger.Errorf("RefundWalletAndReleaseFailed:: [Slot: %s, Error: %s]", slot.ToString(), res.Error)
+				return models.NewError("ReleaseSlotsFailed:: Internal server error", models.InternalProcessingError)
+			}
+			if res.RowsAffected == 0 {
+				return models.NewError(
+					fmt.Sprintf("Slot with [placement: %s, date: %s, position: %d] is not booked by %s", slot.Placement, models.DateToString(*slot.Date), *slot.Position, uid),
+					models.ActionForbidden,
+				)
+			}
+			if err := tx.Delete(&Transaction{Placement: slot.Placement, Date: slot.Date, Position: slot.Position}).Error; err != nil {
+				s.logger.Errorf("RefundWalletAndReleaseFailed:: [Slot: %s, Error: %s]", slot.ToString(), err)
+				return models.NewError("ReleaseSlotsFailed:: Internal server error", models.InternalProcessingError)
+			}
+		}
+		return s.postEntries(tx, txnid, models.LedgerEntryRefund, map[string]float64{
+			revenueAccountID:     -amount,
+			walletAccountID(uid): amount,
+		})
+	})
+}
@@ -11,17 +11,28 @@ import (
 	"time"
 )
 
-// Slot represents a slot in the ad manager system.
+// Slot represents a slot of a placement in the ad manager system. Date is
+// the start of the slot's time window, which is midnight for the slots of
+// whole days, and EndsAt its end.
 type Slot struct {
-	Date        *time.Time   `gorm:"primaryKey;type:date;not null" json:"date"`
-	Position    *int32       `gorm:"primaryKey;type:int;not null" json:"position"`
-	Cost        *float64     `gorm:"type:decimal(10,2);not null" json:"cost"`
-	Status      *string      `gorm:"type:varchar(45);not null" json:"status"`
-	Created     time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
-	Modified    time.Time    `gorm:"autoUpdateTime" json:"modified"`
-	BookedDate  *time.Time   `gorm:"type:datetime" json:"booked_date,omitempty"`
-	BookedBy    *string      `gorm:"type:varchar(36)" json:"booked_by,omitempty"`
-	Transaction *Transaction `gorm:"ForeignKey:Date,Position;References:Date,Position;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Tenant     string     `gorm:"primaryKey;type:varchar(64);not null" json:"tenant"`
+	Placement  string     `gorm:"primaryKey;type:varchar(64);not null" json:"placement"`
+	Date       *time.Time `gorm:"primaryKey;type:datetime;not null" json:"date"`
+	Position   *int32     `gorm:"primaryKey;type:int;not null" json:"position"`
+	EndsAt     *time.Time `gorm:"type:datetime" json:"ends_at"`
+	Cost       *float64   `gorm:"type:decimal(10,2);not null" json:"cost"`
+	Status     *string    `gorm:"type:varchar(45);not null" json:"status"`
+	Created    time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified   time.Time  `gorm:"autoUpdateTime" json:"modified"`
+	BookedDate *time.Time `gorm:"type:datetime" json:"booked_date,omitempty"`
+	BookedBy   *string    `gorm:"type:varchar(36)" json:"booked_by,omitempty"`
+	// CreativeID is the creative the advertiser who booked the slot attached to it
+	CreativeID *string `gorm:"type:varchar(36);index" json:"creative_id,omitempty"`
+	// DeletedAt marks the slot as deleted, deleted slots are left out of the
+	// queries until they are restored or purged
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	DeletedBy   *string        `gorm:"type:varchar(64)" json:"deleted_by,omitempty"`
+	Transaction *Transaction   `gorm:"ForeignKey:Tenant,Placement,Date,Position;References:Tenant,Placement,Date,Position;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 }
 
 func (s *Slot) Value() (driver.Value, error) {
@@ -48,10 +59,15 @@ func (s *Slot) ToString() string {
 
 // Transaction represents a transaction in the ad manager system.
 type Transaction struct {
-	Txnid    string     `gorm:"type:varchar(36);unique" json:"txnid"`
-	Created  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
-	Date     *time.Time `gorm:"primaryKey;type:date;not null" json:"date"`
-	Position *int32     `gorm:"primaryKey;type:int;not null" json:"position"`
+	Txnid     string     `gorm:"type:varchar(36);index" json:"txnid"`
+	Created   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Tenant    string     `gorm:"primaryKey;type:varchar(64);not null" json:"tenant"`
+	Placement string     `gorm:"primaryKey;type:varchar(64);not null" json:"placement"`
+	Date      *time.Time `gorm:"primaryKey;type:datetime;not null" json:"date"`
+	Position  *int32     `gorm:"primaryKey;type:int;not null" json:"position"`
+	Provider  *string    `gorm:"type:varchar(20)" json:"provider,omitempty"`
+	// CampaignID is the campaign the reservation is charged to, if any
+	CampaignID *string `gorm:"type:varchar(36);index" json:"campaign_id,omitempty"`
 }
 
 // TableName Define foreign key relationship
@@ -60,7 +76,9 @@ func (t *Transaction) TableName() string {
 }
 
 func (t *Transaction) BeforeCreate(tx *gorm.DB) error {
-	t.Txnid = uuid.New().String()
+	if t.Txnid == "" {
+		t.Txnid = uuid.New().String()
+	}
 	return nil
 }
 
@@ -68,14 +86,15 @@ func (t *Transaction) AfterCreate(tx *gorm.DB) (err error) {
 	if t.Date == nil {
 		return models.NewError("column 'date' cannot be empty", models.ActionForbidden)
 	}
-	if err = tx.Model(&Slot{}).Where(
-		"date = ? AND position = ? AND status = ?",
-		t.Date.Format(time.DateOnly),
+	if err = withAuditAction(tx, models.AuditActionStatus).Model(&Slot{}).Where(
+		"placement = ? AND date = ? AND position = ? AND status = ?",
+		t.Placement,
+		t.Date,
 		t.Position,
 		models.SlotStatusOpen).
 		Update("status", models.SlotStatusHold).Error; err != nil {
 		return models.NewError(
-			fmt.Sprintf("Slot not found [Date: %s, Position: %d]", t.Date.Format(time.DateOnly), *t.Position),
+			fmt.Sprintf("Slot not found [Placement: %s, Date: %s, Position: %d]", t.Placement, models.TimeToString(*t.Date), *t.Position),
 			models.ActionForbidden)
 	}
 	return nil
@@ -85,9 +104,10 @@ func (t *Transaction) AfterDelete(tx *gorm.DB) (err error) {
 	if t.Date == nil {
 		return models.NewError("column 'date' cannot be empty", models.ActionForbidden)
 	}
-	if err = tx.Model(&Slot{}).Where(
-		"date = ? AND position = ? AND status = ?",
-		t.Date.Format(time.DateOnly),
+	if err = withAuditAction(tx, models.AuditActionStatus).Model(&Slot{}).Where(
+		"placement = ? AND date = ? AND position = ? AND status = ?",
+		t.Placement,
+		t.Date,
 		t.Position,
 		models.SlotStatusHold).
 		Update("status", models.SlotStatusOpen).Error; err != nil {
@@ -96,13 +116,320 @@ func (t *Transaction) AfterDelete(tx *gorm.DB) (err error) {
 	return nil
 }
 
+// ReleasedTransaction is a transaction deleted when its slot was opened
+// again, it is kept for the reconciliation of the debits the providers
+// may still hold for it
+type ReleasedTransaction struct {
+	Tenant    string     `gorm:"type:varchar(64);not null;default:default;index:idx_released_transactions_date,priority:1" json:"tenant"`
+	ID        uint64     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Txnid     string     `gorm:"type:varchar(36);not null;index" json:"txnid"`
+	Placement string     `gorm:"type:varchar(64);not null" json:"placement"`
+	Date      *time.Time `gorm:"type:datetime;not null;index:idx_released_transactions_date,priority:2" json:"date"`
+	Position  *int32     `gorm:"type:int;not null" json:"position"`
+	Provider  *string    `gorm:"type:varchar(20)" json:"provider,omitempty"`
+	// Created is when the transaction was created
+	Created  time.Time `gorm:"type:datetime;not null" json:"created"`
+	Released time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"released"`
+}
+
 type GetOptions struct {
-	StartDate          time.Time
-	EndDate            time.Time
+	// Placement limits the query to the slots of the placement, all placements when empty
+	Placement string
+	StartDate time.Time
+	EndDate   time.Time
+	// Start looks up the slots starting exactly at the time instead of the
+	// range, a midnight is the first hour of a day rather than the whole day
+	Start *time.Time
+	// AdvertiserID limits the query to the slots booked by the advertiser
+	AdvertiserID string
+	// CampaignID limits the query to the slots reserved for the campaign
+	CampaignID         string
 	PositionStart      string
 	PositionEnd        string
 	Status             string
 	Uid                string
 	Query              string
 	PreloadTransaction bool
+	// WithDeleted includes the deleted slots
+	WithDeleted bool
+}
+
+// PaymentProfile selects the payment provider used for an advertiser's reservations
+type PaymentProfile struct {
+	Tenant   string    `gorm:"primaryKey;type:varchar(64);not null" json:"tenant"`
+	Uid      string    `gorm:"primaryKey;type:varchar(36)" json:"uid"`
+	Provider string    `gorm:"type:varchar(20);not null" json:"provider"`
+	Created  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified time.Time `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// InvoiceItem records a reservation which is billed to the advertiser later
+type InvoiceItem struct {
+	Tenant  string    `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	Txnid   string    `gorm:"primaryKey;type:varchar(36)" json:"txnid"`
+	Uid     string    `gorm:"type:varchar(36);not null;index" json:"uid"`
+	Amount  float64   `gorm:"type:decimal(12,2);not null" json:"amount"`
+	Settled bool      `gorm:"not null;default:false" json:"settled"`
+	Created time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+}
+
+// LedgerAccount is an account of the wallet ledger, advertisers own a wallet
+// account and the system owns the funding and revenue accounts, balance is
+// the running sum of the account's entries
+type LedgerAccount struct {
+	Tenant   string    `gorm:"primaryKey;type:varchar(64);not null;uniqueIndex:idx_ledger_account_tenant_uid" json:"tenant"`
+	ID       string    `gorm:"primaryKey;type:varchar(64)" json:"id"`
+	Type     string    `gorm:"type:varchar(20);not null" json:"type"`
+	Uid      *string   `gorm:"type:varchar(36);uniqueIndex:idx_ledger_account_tenant_uid" json:"uid,omitempty"`
+	Balance  float64   `gorm:"type:decimal(12,2);not null;default:0" json:"balance"`
+	Created  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified time.Time `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// LedgerEntry is one side of a ledger movement, every movement writes
+// entries of the same reference which sum up to zero
+type LedgerEntry struct {
+	Tenant       string         `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	ID           uint64         `gorm:"primaryKey;autoIncrement" json:"id"`
+	Reference    string         `gorm:"type:varchar(36);not null;index" json:"reference"`
+	AccountID    string         `gorm:"type:varchar(64);not null;index" json:"account_id"`
+	Kind         string         `gorm:"type:varchar(20);not null" json:"kind"`
+	Amount       float64        `gorm:"type:decimal(12,2);not null" json:"amount"`
+	BalanceAfter float64        `gorm:"type:decimal(12,2);not null" json:"balance_after"`
+	Created      time.Time      `gorm:"default:CURRENT_TIMESTAMP;index" json:"created"`
+	Account      *LedgerAccount `gorm:"foreignKey:Tenant,AccountID;references:Tenant,ID" json:"-"`
+}
+
+// Hold is a reservation which holds its slots until it is confirmed, released
+// or expires, its id is the txnid of the transactions holding the slots
+type Hold struct {
+	Tenant    string    `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Uid       string    `gorm:"type:varchar(36);not null;index" json:"uid"`
+	Status    string    `gorm:"type:varchar(20);not null;index:idx_holds_status_expires" json:"status"`
+	ExpiresAt time.Time `gorm:"type:datetime;not null;index:idx_holds_status_expires" json:"expires_at"`
+	Created   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified  time.Time `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// Cart collects the slots an advertiser wants to book before checking out
+type Cart struct {
+	Tenant   string      `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	ID       string      `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Uid      string      `gorm:"type:varchar(36);not null;index" json:"uid"`
+	Status   string      `gorm:"type:varchar(20);not null" json:"status"`
+	Items    []*CartItem `gorm:"foreignKey:CartID;constraint:OnDelete:CASCADE" json:"items"`
+	Created  time.Time   `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified time.Time   `gorm:"autoUpdateTime" json:"modified"`
+}
+
+type CartItem struct {
+	Tenant    string     `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	CartID    string     `gorm:"primaryKey;type:varchar(36)" json:"cart_id"`
+	Placement string     `gorm:"primaryKey;type:varchar(64);not null" json:"placement"`
+	Date      *time.Time `gorm:"primaryKey;type:datetime;not null" json:"date"`
+	Position  *int32     `gorm:"primaryKey;type:int;not null" json:"position"`
+	Created   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+}
+
+// WaitlistEntry queues an advertiser for a slot, when the slot opens the
+// first waiting entry is offered the slot through a hold
+type WaitlistEntry struct {
+	Tenant    string     `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	ID        string     `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Placement string     `gorm:"type:varchar(64);not null;default:default;index:idx_waitlist_placement_slot" json:"placement"`
+	Date      *time.Time `gorm:"type:datetime;not null;index:idx_waitlist_placement_slot" json:"date"`
+	Position  *int32     `gorm:"type:int;not null;index:idx_waitlist_placement_slot" json:"position"`
+	Uid       string     `gorm:"type:varchar(36);not null;index" json:"uid"`
+	Status    string     `gorm:"type:varchar(20);not null;index" json:"status"`
+	HoldID    *string    `gorm:"type:varchar(36)" json:"hold_id"`
+	Created   time.Time  `gorm:"type:datetime(3);autoCreateTime" json:"created"`
+	Modified  time.Time  `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// Auction sells a slot to the highest sealed bid at or above the reserve
+// price when it closes
+type Auction struct {
+	Tenant       string     `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	ID           string     `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Placement    string     `gorm:"type:varchar(64);not null;default:default;index:idx_auction_placement_slot" json:"placement"`
+	Date         *time.Time `gorm:"type:datetime;not null;index:idx_auction_placement_slot" json:"date"`
+	Position     *int32     `gorm:"type:int;not null;index:idx_auction_placement_slot" json:"position"`
+	ReservePrice float64    `gorm:"type:decimal(10,2);not null" json:"reserve_price"`
+	// SlotCost is the cost of the slot before the auction, restored when it's unsold
+	SlotCost  float64   `gorm:"type:decimal(10,2);not null" json:"slot_cost"`
+	Pricing   string    `gorm:"type:varchar(10);not null" json:"pricing"`
+	Status    string    `gorm:"type:varchar(20);not null;index:idx_auctions_status_closes" json:"status"`
+	ClosesAt  time.Time `gorm:"type:datetime;not null;index:idx_auctions_status_closes" json:"closes_at"`
+	WinnerUid *string   `gorm:"type:varchar(36)" json:"winner_uid"`
+	Price     *float64  `gorm:"type:decimal(10,2)" json:"price"`
+	Created   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified  time.Time `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// Bid is the sealed bid of an advertiser on an auction, bidding again
+// replaces the previous amount
+type Bid struct {
+	Tenant    string    `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	AuctionID string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_bid_auction_uid" json:"auction_id"`
+	Uid       string    `gorm:"type:varchar(36);not null;uniqueIndex:idx_bid_auction_uid" json:"uid"`
+	Amount    float64   `gorm:"type:decimal(10,2);not null" json:"amount"`
+	Status    string    `gorm:"type:varchar(20);not null" json:"status"`
+	Created   time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified  time.Time `gorm:"type:datetime(3);autoUpdateTime" json:"modified"`
+}
+
+// InventoryTemplate describes the slots to generate for every day of the
+// week, active templates are materialised ahead of time by a scheduler
+type InventoryTemplate struct {
+	Tenant    string          `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	ID        string          `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Name      string          `gorm:"type:varchar(100);not null" json:"name"`
+	Placement string          `gorm:"type:varchar(64);not null;default:default" json:"placement"`
+	Active    bool            `gorm:"not null" json:"active"`
+	Rules     []*TemplateRule `gorm:"foreignKey:TemplateID;constraint:OnDelete:CASCADE" json:"rules"`
+	Created   time.Time       `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified  time.Time       `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// TemplateRule generates the positions at cost on the given weekdays, which
+// are stored as comma separated short names e.g. "mon,tue"
+type TemplateRule struct {
+	Tenant        string  `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	ID            uint    `gorm:"primaryKey;autoIncrement" json:"id"`
+	TemplateID    string  `gorm:"type:varchar(36);not null;index" json:"template_id"`
+	Weekdays      string  `gorm:"type:varchar(30);not null" json:"weekdays"`
+	PositionStart int32   `gorm:"type:int;not null" json:"position_start"`
+	PositionEnd   int32   `gorm:"type:int;not null" json:"position_end"`
+	Cost          float64 `gorm:"type:decimal(10,2);not null" json:"cost"`
+}
+
+// CalendarDay marks a date as blackout, holiday or restricted
+type CalendarDay struct {
+	Tenant string     `gorm:"primaryKey;type:varchar(64);not null" json:"tenant"`
+	Date   *time.Time `gorm:"primaryKey;type:date" json:"date"`
+	Kind   string     `gorm:"type:varchar(20);not null;index" json:"kind"`
+	// Uplift is the percentage added to the cost of slots created on holidays
+	Uplift   float64   `gorm:"type:decimal(6,2);not null;default:0" json:"uplift"`
+	Reason   string    `gorm:"type:varchar(255)" json:"reason"`
+	Created  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified time.Time `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// Placement is an inventory channel such as a banner or a newsletter, each
+// placement has its own slots. MaxPositions limits the positions of a time
+// window, zero means no limit. Granularity is the time window of its slots,
+// a whole day, an hour or one of its day parts. The creatives attached to its
+// slots must have one of the comma separated CreativeFormats, fit into
+// CreativeMaxSize bytes and images must have the CreativeWidth and
+// CreativeHeight, empty or zero values leave them unrestricted.
+// HouseCreativeID is the house ad served instead of creatives which weren't
+// approved in time
+type Placement struct {
+	Tenant          string     `gorm:"primaryKey;type:varchar(64);not null" json:"tenant"`
+	ID              string     `gorm:"primaryKey;type:varchar(64)" json:"id"`
+	Name            string     `gorm:"type:varchar(100);not null" json:"name"`
+	MaxPositions    int32      `gorm:"type:int;not null;default:0" json:"max_positions"`
+	Granularity     string     `gorm:"type:varchar(10);not null;default:day" json:"granularity"`
+	CreativeFormats string     `gorm:"type:varchar(255);not null;default:''" json:"creative_formats"`
+	CreativeMaxSize int64      `gorm:"not null;default:0" json:"creative_max_size"`
+	CreativeWidth   int32      `gorm:"type:int;not null;default:0" json:"creative_width"`
+	CreativeHeight  int32      `gorm:"type:int;not null;default:0" json:"creative_height"`
+	HouseCreativeID *string    `gorm:"type:varchar(36)" json:"house_creative_id,omitempty"`
+	DayParts        []*DayPart `gorm:"foreignKey:Tenant,PlacementID;references:Tenant,ID;constraint:OnDelete:CASCADE" json:"day_parts"`
+	Created         time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified        time.Time  `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// DayPart is a named time window of the days of a placement, e.g. morning
+// from "06:00" to "12:00". An end at or before the start is on the next day
+type DayPart struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Tenant      string `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	PlacementID string `gorm:"type:varchar(64);not null;index" json:"placement_id"`
+	Name        string `gorm:"type:varchar(50);not null" json:"name"`
+	Start       string `gorm:"type:varchar(5);not null" json:"start"`
+	End         string `gorm:"type:varchar(5);not null" json:"end"`
+}
+
+// Advertiser is the profile of the advertiser who books under the uid ID
+type Advertiser struct {
+	Tenant   string    `gorm:"primaryKey;type:varchar(64);not null" json:"tenant"`
+	ID       string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	Name     string    `gorm:"type:varchar(100);not null" json:"name"`
+	Email    string    `gorm:"type:varchar(255)" json:"email"`
+	Created  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified time.Time `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// Campaign groups the reservations of an advertiser, which are charged to it
+// through their transactions, under a budget. A zero budget is unlimited
+type Campaign struct {
+	Tenant       string    `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	ID           string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	AdvertiserID string    `gorm:"type:varchar(36);not null;index" json:"advertiser_id"`
+	Name         string    `gorm:"type:varchar(100);not null" json:"name"`
+	Budget       float64   `gorm:"type:decimal(10,2);not null;default:0" json:"budget"`
+	Status       string    `gorm:"type:varchar(20);not null;default:active" json:"status"`
+	Created      time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified     time.Time `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// Creative is an ad an advertiser uploaded, its content is kept in the blob
+// store under BlobKey. Width and Height are the dimensions of images. Status
+// is the review state, creatives uploaded before reviews were introduced
+// default to approved
+type Creative struct {
+	Tenant       string `gorm:"type:varchar(64);not null;default:default;index" json:"tenant"`
+	ID           string `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	AdvertiserID string `gorm:"type:varchar(36);not null;index" json:"advertiser_id"`
+	Name         string `gorm:"type:varchar(100);not null" json:"name"`
+	Format       string `gorm:"type:varchar(50);not null" json:"format"`
+	Size         int64  `gorm:"not null" json:"size"`
+	Width        int32  `gorm:"type:int;not null;default:0" json:"width"`
+	Height       int32  `gorm:"type:int;not null;default:0" json:"height"`
+	BlobKey      string `gorm:"type:varchar(255);not null" json:"blob_key"`
+	// ClickURL is where the clicks on the creative are redirected to
+	ClickURL     string     `gorm:"type:varchar(2048);not null;default:''" json:"click_url"`
+	Status       string     `gorm:"type:varchar(20);not null;default:approved;index" json:"status"`
+	ReviewReason string     `gorm:"type:varchar(500);not null;default:''" json:"review_reason"`
+	ReviewedBy   *string    `gorm:"type:varchar(36)" json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	Created      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created"`
+	Modified     time.Time  `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// DeliveryStat counts the impressions and clicks of a creative served in a slot
+type DeliveryStat struct {
+	Tenant      string     `gorm:"primaryKey;type:varchar(64);not null" json:"tenant"`
+	Placement   string     `gorm:"primaryKey;type:varchar(64);not null" json:"placement"`
+	Date        *time.Time `gorm:"primaryKey;type:datetime;not null" json:"date"`
+	Position    *int32     `gorm:"primaryKey;type:int;not null" json:"position"`
+	CreativeID  string     `gorm:"primaryKey;type:varchar(36)" json:"creative_id"`
+	Impressions int64      `gorm:"not null;default:0" json:"impressions"`
+	Clicks      int64      `gorm:"not null;default:0" json:"clicks"`
+	Modified    time.Time  `gorm:"autoUpdateTime" json:"modified"`
+}
+
+// SlotAudit records a change of a slot, Before and After hold the changed
+// fields of the slot, either is null when the slot was created or deleted.
+// The table is append only
+type SlotAudit struct {
+	Tenant    string          `gorm:"type:varchar(64);not null;default:default;index:idx_slot_audit_slot,priority:1" json:"tenant"`
+	ID        uint64          `gorm:"primaryKey;autoIncrement" json:"id"`
+	Placement string          `gorm:"type:varchar(64);not null;index:idx_slot_audit_slot,priority:2" json:"placement"`
+	Date      time.Time       `gorm:"type:datetime;not null;index:idx_slot_audit_slot,priority:3" json:"date"`
+	Position  int32           `gorm:"type:int;not null;index:idx_slot_audit_slot,priority:4" json:"position"`
+	Action    string          `gorm:"type:varchar(20);not null" json:"action"`
+	Actor     string          `gorm:"type:varchar(64);not null;index" json:"actor"`
+	RequestID string          `gorm:"type:varchar(64);not null;default:''" json:"request_id"`
+	Before    json.RawMessage `gorm:"type:json" json:"before"`
+	After     json.RawMessage `gorm:"type:json" json:"after"`
+	Created   time.Time       `gorm:"type:datetime(3);not null;index" json:"created"`
+}
+
+// TableName keeps the table singular, as it is referred to by operators
+func (a *SlotAudit) TableName() string {
+	return "slot_audit"
 }
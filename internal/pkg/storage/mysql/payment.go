@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+func (s *Storage) GetPaymentProfile(uid string) (*PaymentProfile, error) {
+	var profile PaymentProfile
+	err := s.db.Where("uid = ?", uid).First(&profile).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(
+			fmt.Sprintf("Payment profile not found for uid %s", uid),
+			models.ResourceNotFoundError,
+		)
+	}
+	if err != nil {
+		s.logger.Errorf("GetPaymentProfileFailed:: [Uid: %s, Error: %s]", uid, err)
+		return nil, models.NewError("GetPaymentProfileFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &profile, nil
+}
+
+func (s *Storage) SavePaymentProfile(profile *PaymentProfile) error {
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "uid"}},
+		DoUpdates: clause.AssignmentColumns([]string{"provider", "modified"}),
+	}).Create(profile).Error
+	if err != nil {
+		s.logger.Errorf("SavePaymentProfileFailed:: [Profile: %+v, Error: %s]", profile, err)
+		return models.NewError("SavePaymentProfileFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+func (s *Storage) CreateInvoiceItem(item *InvoiceItem) error {
+	if err := s.db.Create(item).Error; err != nil {
+		s.logger.Errorf("CreateInvoiceItemFailed:: [Item: %+v, Error: %s]", item, err)
+		return models.NewError("CreateInvoiceItemFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+func (s *Storage) InvoiceItems(txnids []string) ([]*InvoiceItem, error) {
+	var items []*InvoiceItem
+	if err := s.db.Where("txnid IN ?", txnids).Find(&items).Error; err != nil {
+		s.logger.Errorf("InvoiceItemsFailed:: [Error: %s]", err)
+		return nil, models.NewError("InvoiceItemsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return items, nil
+}
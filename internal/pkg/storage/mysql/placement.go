@@ -0,0 +1,146 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+func (s *Storage) GetPlacement(id string) (*Placement, error) {
+	var placement Placement
+	err := s.db.Preload("DayParts", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Where("id = ?", id).First(&placement).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(fmt.Sprintf("Placement %s not found", id), models.ResourceNotFoundError)
+	}
+	if err != nil {
+		s.logger.Errorf("GetPlacementFailed:: [Id: %s, Error: %s]", id, err)
+		return nil, models.NewError("GetPlacementFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &placement, nil
+}
+
+func (s *Storage) Placements() ([]*Placement, error) {
+	var placements []*Placement
+	err := s.db.Preload("DayParts", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Order("id").Find(&placements).Error
+	if err != nil {
+		s.logger.Errorf("PlacementsFailed:: [Error: %s]", err)
+		return nil, models.NewError("PlacementsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return placements, nil
+}
+
+// UpdatePlacement updates the placement and replaces its day parts
+func (s *Storage) UpdatePlacement(placement *Placement) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(placement).Select("name", "max_positions", "granularity", "creative_formats", "creative_max_size", "creative_width", "creative_height", "house_creative_id").Updates(placement).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("placement_id = ?", placement.ID).Delete(&DayPart{}).Error; err != nil {
+			return err
+		}
+		if len(placement.DayParts) == 0 {
+			return nil
+		}
+		for _, part := range placement.DayParts {
+			part.ID = 0
+			part.PlacementID = placement.ID
+		}
+		return tx.Create(placement.DayParts).Error
+	})
+	if err != nil {
+		s.logger.Errorf("UpdatePlacementFailed:: [Id: %s, Error: %s]", placement.ID, err)
+		return models.NewError("UpdatePlacementFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+func (s *Storage) DeletePlacement(id string) (int, error) {
+	res := s.db.Delete(&Placement{ID: id})
+	if res.Error != nil {
+		s.logger.Errorf("DeletePlacementFailed:: [Id: %s, Error: %s]", id, res.Error)
+		return 0, models.NewError("DeletePlacementFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return int(res.RowsAffected), nil
+}
+
+// MaxPosition returns the highest position of the slots of the placement,
+// zero when it has no slots
+func (s *Storage) MaxPosition(placement string) (int32, error) {
+	var position int32
+	err := s.db.Model(&Slot{}).Where("placement = ?", placement).Select("COALESCE(MAX(position), 0)").Scan(&position).Error
+	if err != nil {
+		s.logger.Errorf("MaxPositionFailed:: [Placement: %s, Error: %s]", placement, err)
+		return 0, models.NewError("MaxPositionFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return position, nil
+}
+
+// migratePlacements moves the slots, their transactions and the cart items,
+// which used to be keyed by date and position only, into the default placement
+func migratePlacements(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&Slot{}) || m.HasColumn(&Slot{}, "placement") {
+		return nil
+	}
+	// the foreign key of the transactions references the former primary key of the slots
+	if m.HasConstraint(&Slot{}, "Transaction") {
+		if err := m.DropConstraint(&Slot{}, "Transaction"); err != nil {
+			return err
+		}
+	}
+	keys := map[string]string{
+		"slots":        "placement, date, position",
+		"transactions": "placement, date, position",
+		"cart_items":   "cart_id, placement, date, position",
+	}
+	for table, key := range keys {
+		if !m.HasTable(table) {
+			continue
+		}
+		err := db.Exec(fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN placement varchar(64) NOT NULL DEFAULT '%s' FIRST, DROP PRIMARY KEY, ADD PRIMARY KEY (%s)",
+			table, models.DefaultPlacement, key,
+		)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateSlotTimes turns the dates keying the slots and the records which
+// refer to them into the start times of the slots, the existing slots cover
+// their whole day
+func migrateSlotTimes(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&Slot{}) || m.HasColumn(&Slot{}, "ends_at") {
+		return nil
+	}
+	// the type of a column in a foreign key cannot be changed
+	if m.HasConstraint(&Slot{}, "Transaction") {
+		if err := m.DropConstraint(&Slot{}, "Transaction"); err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{"slots", "transactions", "cart_items", "waitlist_entries", "auctions"} {
+		if !m.HasTable(table) {
+			continue
+		}
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY date datetime NOT NULL", table)).Error; err != nil {
+			return err
+		}
+	}
+	if err := db.Exec("ALTER TABLE slots ADD COLUMN ends_at datetime").Error; err != nil {
+		return err
+	}
+	return db.Exec("UPDATE slots SET ends_at = date + INTERVAL 1 DAY").Error
+}
+
+func createDefaultPlacement(db *gorm.DB) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Placement{ID: models.DefaultPlacement, Name: "Default"}).Error
+}
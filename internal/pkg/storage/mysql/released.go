@@ -0,0 +1,112 @@
+package mysql
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// releasedStateKey holds the transactions captured before a delete
+const releasedStateKey = "admgr:released_state"
+
+// registerReleasedTransactions keeps the transactions deleted from the
+// transactions table, within the transaction of the delete
+func registerReleasedTransactions(db *gorm.DB, logger *logrus.Logger) error {
+	capture := func(db *gorm.DB) {
+		if db.Error != nil || db.DryRun || db.Statement.Table != (&Transaction{}).TableName() {
+			return
+		}
+		txns, err := captureTransactions(db)
+		if err != nil {
+			logger.Errorf("WriteReleasedTransactionsFailed:: [Error: %s]", err)
+			_ = db.AddError(models.NewError("WriteReleasedTransactionsFailed:: Internal server error", models.InternalProcessingError))
+			return
+		}
+		db.InstanceSet(releasedStateKey, txns)
+	}
+	record := func(db *gorm.DB) {
+		v, ok := db.InstanceGet(releasedStateKey)
+		if db.Error != nil || !ok || db.Statement.RowsAffected == 0 {
+			return
+		}
+		txns := v.([]*Transaction)
+		if len(txns) == 0 {
+			return
+		}
+		released := make([]*ReleasedTransaction, 0, len(txns))
+		for _, txn := range txns {
+			released = append(released, &ReleasedTransaction{
+				Txnid:     txn.Txnid,
+				Placement: txn.Placement,
+				Date:      txn.Date,
+				Position:  txn.Position,
+				Provider:  txn.Provider,
+				Created:   txn.Created,
+			})
+		}
+		if err := db.Session(&gorm.Session{NewDB: true}).CreateInBatches(released, auditKeyBatch).Error; err != nil {
+			logger.Errorf("WriteReleasedTransactionsFailed:: [Error: %s]", err)
+			_ = db.AddError(models.NewError("WriteReleasedTransactionsFailed:: Internal server error", models.InternalProcessingError))
+		}
+	}
+	cb := db.Callback()
+	return errors.Join(
+		cb.Delete().Before("gorm:delete").Register("admgr:released_capture", capture),
+		cb.Delete().After("gorm:delete").Register("admgr:released_record", record),
+	)
+}
+
+// captureTransactions locks and reads the transactions matching the
+// conditions and the keys of the records of a delete
+func captureTransactions(db *gorm.DB) ([]*Transaction, error) {
+	q := db.Session(&gorm.Session{NewDB: true}).Model(&Transaction{}).Clauses(clause.Locking{Strength: "UPDATE"})
+	if c, ok := db.Statement.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			q = q.Clauses(where)
+		}
+	}
+	// the keys of the model are only added to the conditions by the delete
+	keys := make([][]interface{}, 0)
+	for _, txn := range transactionsOfValue(db) {
+		if txn.Placement != "" && txn.Date != nil && txn.Position != nil {
+			keys = append(keys, []interface{}{txn.Placement, *txn.Date, *txn.Position})
+		}
+	}
+	if len(keys) > 0 {
+		q = q.Where("(placement, date, position) IN ?", keys)
+	}
+	var txns []*Transaction
+	err := q.Find(&txns).Error
+	return txns, err
+}
+
+// transactionsOfValue returns the transactions given to a delete
+func transactionsOfValue(db *gorm.DB) []*Transaction {
+	switch r := db.Statement.Model.(type) {
+	case *Transaction:
+		return []*Transaction{r}
+	case []*Transaction:
+		return r
+	}
+	return nil
+}
+
+// ReleasedTransactions returns the transactions released from the slots
+// dated between start and end
+func (s *Storage) ReleasedTransactions(start, end time.Time) ([]*ReleasedTransaction, error) {
+	var released []*ReleasedTransaction
+	err := s.db.Where("date BETWEEN ? AND ?", start, models.EndOfRange(end)).
+		Order("id").
+		Find(&released).Error
+	if err != nil {
+		s.logger.Errorf("GetReleasedTransactionsFailed:: [StartDate: %s, EndDate: %s, Error: %s]",
+			models.DateToString(start), models.DateToString(end), err)
+		return nil, models.NewError("GetReleasedTransactionsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return released, nil
+}
@@ -0,0 +1,147 @@
+package mysql
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// ReportOptions select the slots a report aggregates, by their start for the
+// occupancy and by their booking for the other reports
+type ReportOptions struct {
+	// Placement limits the report to a placement, all placements when empty
+	Placement string
+	Start     time.Time
+	End       time.Time
+	GroupBy   string
+	// Limit bounds the rows of the top advertisers
+	Limit int
+}
+
+type OccupancyRow struct {
+	Key      string
+	Total    int64
+	Sellable int64
+	Booked   int64
+	Rate     float64
+}
+
+type RevenueRow struct {
+	Period   string
+	Bookings int64
+	Revenue  float64
+}
+
+type AdvertiserSpendRow struct {
+	AdvertiserID string
+	Name         string
+	Bookings     int64
+	Spend        float64
+}
+
+type LeadTimeRow struct {
+	Period   string
+	Bookings int64
+	AvgDays  float64
+	MinDays  int64
+	MaxDays  int64
+}
+
+// reportGroup returns the expression of the group of a report over the
+// datetime column and the expression ordering its groups
+func reportGroup(groupBy, column string) (string, string) {
+	switch groupBy {
+	case models.ReportGroupPosition:
+		return "slots.position", "MIN(slots.position)"
+	case models.ReportGroupWeekday:
+		return fmt.Sprintf("DAYNAME(%s)", column), fmt.Sprintf("MIN(WEEKDAY(%s))", column)
+	case models.ReportGroupWeek:
+		return fmt.Sprintf("DATE_FORMAT(%[1]s - INTERVAL WEEKDAY(%[1]s) DAY, '%%Y-%%m-%%d')", column), fmt.Sprintf("MIN(%s)", column)
+	case models.ReportGroupMonth:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m')", column), fmt.Sprintf("MIN(%s)", column)
+	default:
+		return fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d')", column), fmt.Sprintf("MIN(%s)", column)
+	}
+}
+
+// bookings returns the query of the booked slots with their transactions,
+// booked within the range of the options
+func (s *Storage) bookings(opts *ReportOptions) *gorm.DB {
+	q := s.db.Model(&Slot{}).
+		Joins("JOIN transactions ON transactions.tenant = slots.tenant AND transactions.placement = slots.placement AND "+
+			"transactions.date = slots.date AND transactions.position = slots.position").
+		Where("slots.status = ? AND slots.booked_date BETWEEN ? AND ?", models.SlotStatusBooked, opts.Start, opts.End)
+	if opts.Placement != "" {
+		q = q.Where("slots.placement = ?", opts.Placement)
+	}
+	return q
+}
+
+// OccupancyReport counts the slots starting within the range and how many of
+// the slots which are not closed are booked
+func (s *Storage) OccupancyReport(opts *ReportOptions) ([]*OccupancyRow, error) {
+	group, order := reportGroup(opts.GroupBy, "slots.date")
+	q := s.db.Model(&Slot{}).
+		Select(fmt.Sprintf("%s AS `key`, COUNT(*) AS total, SUM(slots.status <> ?) AS sellable, SUM(slots.status = ?) AS booked, "+
+			"COALESCE(SUM(slots.status = ?) / NULLIF(SUM(slots.status <> ?), 0), 0) AS rate", group),
+			models.SlotStatusClosed, models.SlotStatusBooked, models.SlotStatusBooked, models.SlotStatusClosed).
+		Where("slots.date BETWEEN ? AND ?", opts.Start, opts.End)
+	if opts.Placement != "" {
+		q = q.Where("slots.placement = ?", opts.Placement)
+	}
+	var rows []*OccupancyRow
+	if err := q.Group("`key`").Order(order).Scan(&rows).Error; err != nil {
+		s.logger.Errorf("OccupancyReportFailed:: [Options: %+v, Error: %s]", opts, err)
+		return nil, models.NewError("OccupancyReportFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return rows, nil
+}
+
+// RevenueReport sums the cost of the slots booked within the range per period
+func (s *Storage) RevenueReport(opts *ReportOptions) ([]*RevenueRow, error) {
+	group, order := reportGroup(opts.GroupBy, "slots.booked_date")
+	var rows []*RevenueRow
+	err := s.bookings(opts).
+		Select(fmt.Sprintf("%s AS period, COUNT(*) AS bookings, COALESCE(SUM(slots.cost), 0) AS revenue", group)).
+		Group("period").Order(order).Scan(&rows).Error
+	if err != nil {
+		s.logger.Errorf("RevenueReportFailed:: [Options: %+v, Error: %s]", opts, err)
+		return nil, models.NewError("RevenueReportFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return rows, nil
+}
+
+// TopAdvertisers returns the advertisers who spent the most on the slots
+// booked within the range
+func (s *Storage) TopAdvertisers(opts *ReportOptions) ([]*AdvertiserSpendRow, error) {
+	var rows []*AdvertiserSpendRow
+	err := s.bookings(opts).
+		Joins("LEFT JOIN advertisers ON advertisers.tenant = slots.tenant AND advertisers.id = slots.booked_by").
+		Select("slots.booked_by AS advertiser_id, COALESCE(MAX(advertisers.name), '') AS name, COUNT(*) AS bookings, " +
+			"COALESCE(SUM(slots.cost), 0) AS spend").
+		Group("slots.booked_by").Order("spend DESC, advertiser_id").Limit(opts.Limit).Scan(&rows).Error
+	if err != nil {
+		s.logger.Errorf("TopAdvertisersFailed:: [Options: %+v, Error: %s]", opts, err)
+		return nil, models.NewError("TopAdvertisersFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return rows, nil
+}
+
+// LeadTimeReport returns the days between the booking and the start of the
+// slots booked within the range per period of their booking
+func (s *Storage) LeadTimeReport(opts *ReportOptions) ([]*LeadTimeRow, error) {
+	group, order := reportGroup(opts.GroupBy, "slots.booked_date")
+	lead := "TIMESTAMPDIFF(DAY, slots.booked_date, slots.date)"
+	var rows []*LeadTimeRow
+	err := s.bookings(opts).
+		Select(fmt.Sprintf("%[1]s AS period, COUNT(*) AS bookings, AVG(%[2]s) AS avg_days, MIN(%[2]s) AS min_days, MAX(%[2]s) AS max_days", group, lead)).
+		Group("period").Order(order).Scan(&rows).Error
+	if err != nil {
+		s.logger.Errorf("LeadTimeReportFailed:: [Options: %+v, Error: %s]", opts, err)
+		return nil, models.NewError("LeadTimeReportFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return rows, nil
+}
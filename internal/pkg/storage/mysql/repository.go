@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"gorm.io/gorm/clause"
@@ -8,6 +9,7 @@ import (
 	"io"
 	"log"
 	"net"
+	"net/url"
 	"strings"
 	"time"
 
@@ -25,15 +27,29 @@ type Storage struct {
 	seedFile string
 	db       *gorm.DB
 	loglevel string
+	writer   io.Writer
+	conf     models.DBConf
+	// tenant scopes every query of the storage, see ForTenant
+	tenant  string
+	tenants *tenantStorages
+	changes *changeListeners
 }
 
+// NewStorage connects to the database and migrates it, the returned storage
+// is scoped to the default tenant
 func NewStorage(_log *logrus.Logger, writer io.Writer, logLevel string, dbConf *models.DBConf) (*Storage, error) {
 	s := new(Storage)
 
 	s.logger = _log
+	s.writer = writer
+	s.loglevel = logLevel
+	s.conf = *dbConf
+	s.tenants = &tenantStorages{storages: make(map[string]*Storage)}
+	s.changes = &changeListeners{}
 
 	dsn := dbConf.Username + ":" + dbConf.Password + "@tcp" + "(" + dbConf.Host +
-		":" + dbConf.Port + ")/" + dbConf.Name + "?" + "charset=utf8mb4&parseTime=True&loc=Local&clientFoundRows=true&timeout=60s"
+		":" + dbConf.Port + ")/" + dbConf.Name + "?" + "charset=utf8mb4&parseTime=True&clientFoundRows=true&timeout=60s" +
+		"&loc=" + url.QueryEscape(models.Location().String())
 
 	s.logger.Debugf("Database Connection String: %s", dsn)
 
@@ -78,14 +94,47 @@ func NewStorage(_log *logrus.Logger, writer io.Writer, logLevel string, dbConf *
 		db = db.Debug()
 	}
 	s.logger.Infof("Connection to MariaDB Successfull, initiating db seeding")
-	err = db.AutoMigrate(&Slot{}, &Transaction{})
+	if err = registerTenantScope(db); err != nil {
+		return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
+	}
+	if err = registerChangeNotifier(db, s.changes); err != nil {
+		return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
+	}
+	if err = registerAuditGuard(db); err != nil {
+		return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
+	}
+	if err = registerSlotAudit(db, s.logger); err != nil {
+		return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
+	}
+	if err = registerReleasedTransactions(db, s.logger); err != nil {
+		return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
+	}
+	if err = migratePlacements(db); err != nil {
+		return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
+	}
+	if err = migrateTenants(db); err != nil {
+		return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
+	}
+	if err = migrateSlotTimes(db); err != nil {
+		return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
+	}
+	err = db.AutoMigrate(&Slot{}, &Transaction{}, &PaymentProfile{}, &LedgerAccount{}, &LedgerEntry{}, &InvoiceItem{}, &Hold{}, &Cart{}, &CartItem{}, &WaitlistEntry{}, &Auction{}, &Bid{}, &InventoryTemplate{}, &TemplateRule{}, &CalendarDay{}, &Placement{}, &DayPart{}, &Advertiser{}, &Campaign{}, &Creative{}, &DeliveryStat{}, &SlotAudit{}, &ReleasedTransaction{})
 	// Add foreign key constraint
 	if err != nil {
 		return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
 	}
+	// all slots of a reservation share its txnid, which used to be unique per slot
+	if db.Migrator().HasIndex(&Transaction{}, "txnid") {
+		if err = db.Migrator().DropIndex(&Transaction{}, "txnid"); err != nil {
+			return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
+		}
+	}
+	if err = migrateBlackoutDates(db); err != nil {
+		return nil, errors.New(fmt.Sprintf("DBSeeding failed with error: %s", err))
+	}
 	s.logger.Infof("DB Seeding succeded")
 	s.db = db
-	return s, nil
+	return s.bind(models.DefaultTenant)
 }
 
 func getLogLevel(lvl string) logger.LogLevel {
@@ -100,32 +149,61 @@ func getLogLevel(lvl string) logger.LogLevel {
 	return logger.Info
 }
 
-func (s *Storage) Create(records interface{}) (int, error) {
-	var dbErr error
-	var mysqlErr *sqlDrvMySql.MySQLError
+// createBatchSize keeps the inserts of the slots below the placeholder limit
+// of the prepared statements
+const createBatchSize = 1000
 
-	res := s.db.Create(records)
-	if res.Error != nil {
-		err := res.Error
-		switch err.(type) {
-		case *sqlDrvMySql.MySQLError:
-			errors.As(err, &mysqlErr)
-			if mysqlErr.Number == 1062 {
-				s.logger.Errorf("DbInsertFailed:: key duplication Error: %s while "+
-					"adding new record: %+v", mysqlErr.Error(), records)
-				dbErr = models.NewError("FailedToCreate:: Duplicate records provided", models.DuplicateResourceCreationError)
-				break
-			}
-			s.logger.Errorf("DbInsertFailed:: [Code: %d, Error: %s]", mysqlErr.Number, mysqlErr.Message)
-			dbErr = models.NewError("FailedToCreate:: Internal server error", models.InternalProcessingError)
-		default:
-			s.logger.Errorf("DbInsertFailed:: [Code: %d, Error: %s]", -1, err)
-			dbErr = models.NewError("FailedToCreate:: Internal server error", models.InternalProcessingError)
+// Create inserts the records, created slots supersede the deleted slots at
+// their positions. The slots are inserted in batches within one transaction
+func (s *Storage) Create(records interface{}) (int, error) {
+	slots, ok := slotsOf(records)
+	if !ok {
+		res := s.db.Create(records)
+		if res.Error != nil {
+			return 0, s.createError(res.Error, records)
 		}
-		return 0, dbErr
+		s.logger.Infof("Create:: Total %d records created successfully", res.RowsAffected)
+		return int(res.RowsAffected), nil
+	}
+	var created int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// the deleted slots at the same positions are superseded by the new ones
+		superseded, err := s.deletedSlotsAt(tx, slots)
+		if err == nil {
+			err = s.purgeSlots(tx, superseded)
+		}
+		if err != nil {
+			return err
+		}
+		res := tx.CreateInBatches(records, createBatchSize)
+		if res.Error != nil {
+			return s.createError(res.Error, records)
+		}
+		created = res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
-	s.logger.Infof("Create:: Total %d records created successfully", res.RowsAffected)
-	return int(res.RowsAffected), nil
+	s.logger.Infof("Create:: Total %d records created successfully", created)
+	return int(created), nil
+}
+
+// createError maps a failed insert to a duplicate error for key conflicts
+// and an internal error otherwise
+func (s *Storage) createError(err error, records interface{}) error {
+	var mysqlErr *sqlDrvMySql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		s.logger.Errorf("DbInsertFailed:: [Code: %d, Error: %s]", -1, err)
+		return models.NewError("FailedToCreate:: Internal server error", models.InternalProcessingError)
+	}
+	if mysqlErr.Number == 1062 {
+		s.logger.Errorf("DbInsertFailed:: key duplication Error: %s while "+
+			"adding new record: %+v", mysqlErr.Error(), records)
+		return models.NewError("FailedToCreate:: Duplicate records provided", models.DuplicateResourceCreationError)
+	}
+	s.logger.Errorf("DbInsertFailed:: [Code: %d, Error: %s]", mysqlErr.Number, mysqlErr.Message)
+	return models.NewError("FailedToCreate:: Internal server error", models.InternalProcessingError)
 }
 
 func (s *Storage) UpdateSlots(slots []*Slot) (int, error) {
@@ -133,7 +211,7 @@ func (s *Storage) UpdateSlots(slots []*Slot) (int, error) {
 	tx, affectedRows := s.db.Begin(), 0
 	for _, slot := range slots {
 		if slot.Status != nil && *slot.Status == models.SlotStatusOpen {
-			if err := tx.Delete(&Transaction{Date: slot.Date, Position: slot.Position}).Error; err != nil {
+			if err := tx.Delete(&Transaction{Placement: slot.Placement, Date: slot.Date, Position: slot.Position}).Error; err != nil {
 				s.logger.Errorf("RevertingTransationFailed:: [Error: %s, Slot: %+v]", err.Error(), slot.Transaction)
 				dbError = models.NewError(
 					fmt.Sprint("PatchFailed:: Internal server error"),
@@ -144,8 +222,8 @@ func (s *Storage) UpdateSlots(slots []*Slot) (int, error) {
 		}
 		res := tx.Model(&Slot{}).
 			Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("date = ? and position = ?", slot.Date.Format(time.DateOnly), slot.Position).
-			Omit("date", "position").
+			Where("placement = ? AND date = ? AND position = ?", slot.Placement, slot.Date, slot.Position).
+			Omit("placement", "date", "position").
 			Updates(slot)
 		if res.Error != nil {
 			s.logger.Errorf("UpdateRecordsFailed:: %s :: %+v", res.Error, slot)
@@ -167,10 +245,53 @@ func (s *Storage) UpdateSlots(slots []*Slot) (int, error) {
 	return affectedRows, tx.Commit().Error
 }
 
+// ReleaseSlots opens the slots again, clearing their booking details and
+// removing their transactions in a single database transaction
+func (s *Storage) ReleaseSlots(slots []*Slot) (int, error) {
+	affectedRows := 0
+	err := withAuditAction(s.db, models.AuditActionRelease).Transaction(func(tx *gorm.DB) error {
+		for _, slot := range slots {
+			res := tx.Model(&Slot{}).
+				Where("placement = ? AND date = ? AND position = ?", slot.Placement, slot.Date, slot.Position).
+				Updates(map[string]interface{}{
+					"status":      models.SlotStatusOpen,
+					"booked_by":   nil,
+					"booked_date": nil,
+					"creative_id": nil,
+				})
+			if res.Error != nil {
+				s.logger.Errorf("ReleaseSlotsFailed:: [Error: %s, Slot: %s]", res.Error, slot.ToString())
+				return models.NewError("ReleaseSlotsFailed:: Internal server error", models.InternalProcessingError)
+			}
+			if err := tx.Delete(&Transaction{Placement: slot.Placement, Date: slot.Date, Position: slot.Position}).Error; err != nil {
+				s.logger.Errorf("ReleaseSlotsFailed:: [Error: %s, Slot: %s]", err, slot.ToString())
+				return models.NewError("ReleaseSlotsFailed:: Internal server error", models.InternalProcessingError)
+			}
+			affectedRows += int(res.RowsAffected)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Infof("ReleaseSlots:: Total %d slots opened", affectedRows)
+	return affectedRows, nil
+}
+
 func (s *Storage) SearchSlotsInRange(options *GetOptions) ([]*Slot, error) {
 	var slots []*Slot
-	query := s.db.Model(&Slot{}).
-		Where("date BETWEEN ? AND ?", options.StartDate.Format(time.DateOnly), options.EndDate.Format(time.DateOnly))
+	query := s.db.Model(&Slot{})
+	if options.WithDeleted {
+		query = query.Unscoped()
+	}
+	if options.Start != nil {
+		query = query.Where("date = ?", options.Start)
+	} else {
+		query = query.Where("date BETWEEN ? AND ?", options.StartDate, models.EndOfRange(options.EndDate))
+	}
+	if options.Placement != "" {
+		query = query.Where("placement = ?", options.Placement)
+	}
 	if options.PositionStart != "" && options.PositionEnd != "" {
 		query = query.Where("position BETWEEN ? AND ?", options.PositionStart, options.PositionEnd)
 	}
@@ -180,9 +301,22 @@ func (s *Storage) SearchSlotsInRange(options *GetOptions) ([]*Slot, error) {
 	if options.Uid != "" {
 		query = query.Where("booked_by = ?", options.Uid)
 	}
+	if options.AdvertiserID != "" {
+		query = query.Where("booked_by = ?", options.AdvertiserID)
+	}
+	if options.CampaignID != "" {
+		query = query.Where("EXISTS (?)", s.db.Model(&Transaction{}).Select("1").Where(
+			"transactions.tenant = slots.tenant AND transactions.placement = slots.placement AND "+
+				"transactions.date = slots.date AND transactions.position = slots.position AND transactions.campaign_id = ?",
+			options.CampaignID,
+		))
+	}
 	if options.Query != "" {
 		query = query.Where(options.Query)
 	}
+	if options.PreloadTransaction {
+		query = query.Preload("Transaction")
+	}
 	res := query.Find(&slots)
 	if res.Error != nil {
 		s.logger.Errorf("SearchSlotsInRange::[%+v]", options)
@@ -198,6 +332,12 @@ func (s *Storage) SearchSlotsInRange(options *GetOptions) ([]*Slot, error) {
 func (s *Storage) SearchSlotsByStatus(options *GetOptions) ([]*Slot, error) {
 	var slots []*Slot
 	db := s.db.Model(&Slot{}).Where("status = ?", options.Status)
+	if options.WithDeleted {
+		db = db.Unscoped()
+	}
+	if options.Placement != "" {
+		db = db.Where("placement = ?", options.Placement)
+	}
 	if options.PreloadTransaction {
 		db = db.Preload("Transaction")
 	}
@@ -211,20 +351,20 @@ func (s *Storage) SearchSlotsByStatus(options *GetOptions) ([]*Slot, error) {
 }
 
 func (s *Storage) UpdateSlotsStatus(slots []*Slot, lastStatus, newStatus string) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	return withAuditAction(s.db, models.AuditActionStatus).Transaction(func(tx *gorm.DB) error {
 		for i, slot := range slots {
 			var resSlot Slot
 			if err := tx.Model(&Slot{}).
-				Where("date = ? AND position = ? AND status = ?", slot.Date.Format(time.DateOnly), slot.Position, lastStatus).
+				Where("placement = ? AND date = ? AND position = ? AND status = ?", slot.Placement, slot.Date, slot.Position, lastStatus).
 				First(&resSlot).
 				Error; err != nil {
 				return models.NewError(
-					fmt.Sprintf("SlotNotFound:: Slot cannot be booked [date: %s, position: %v]", models.DateToString(*slot.Date), *slot.Position),
+					fmt.Sprintf("SlotNotFound:: Slot cannot be booked [placement: %s, date: %s, position: %v]", slot.Placement, models.DateToString(*slot.Date), *slot.Position),
 					models.ActionForbidden,
 				)
 			}
 			resSlot.Status = models.PtrString(newStatus)
-			if err := s.db.Save(&resSlot).Error; err != nil {
+			if err := tx.Save(&resSlot).Error; err != nil {
 				s.logger.Errorf("SlotUpdateFailed:: [Error: %s, Slot: %+v]", err.Error(), resSlot)
 				return models.NewError(
 					fmt.Sprintf("SlotUpdateFailed:: Internal server error"),
@@ -237,20 +377,49 @@ func (s *Storage) UpdateSlotsStatus(slots []*Slot, lastStatus, newStatus string)
 	})
 }
 
+// Delete removes the records. Slots are only marked as deleted by the actor
+// of the storage, see RestoreSlots and PurgeDeletedSlots
 func (s *Storage) Delete(records interface{}) (int, error) {
-	res := s.db.Delete(records)
-	if res.Error != nil {
-		s.logger.Errorf("DeleteRecordsFailed:: [Error: %s, Records: %+v]", res.Error, records)
-		return 0, models.NewError("DeleteFailed:: Internal server error", models.InternalProcessingError)
+	slots, ok := slotsOf(records)
+	if !ok {
+		res := s.db.Delete(records)
+		if res.Error != nil {
+			s.logger.Errorf("DeleteRecordsFailed:: [Error: %s, Records: %+v]", res.Error, records)
+			return 0, models.NewError("DeleteFailed:: Internal server error", models.InternalProcessingError)
+		}
+		s.logger.Infof("Delete:: Total %d matching records deleted", res.RowsAffected)
+		return int(res.RowsAffected), nil
 	}
-	s.logger.Infof("Delete:: Total %d matching records deleted", res.RowsAffected)
-	return int(res.RowsAffected), nil
+	var deleted int64
+	err := withAuditAction(s.db, models.AuditActionDelete).Transaction(func(tx *gorm.DB) error {
+		deletedAt, deletedBy := time.Now(), auditOf(tx).Actor
+		for _, slot := range slots {
+			res := tx.Model(&Slot{}).
+				Where("placement = ? AND date = ? AND position = ?", slot.Placement, slot.Date, slot.Position).
+				Updates(map[string]interface{}{"deleted_at": deletedAt, "deleted_by": deletedBy})
+			if res.Error != nil {
+				s.logger.Errorf("DeleteRecordsFailed:: [Error: %s, Slot: %s]", res.Error, slot.ToString())
+				return models.NewError("DeleteFailed:: Internal server error", models.InternalProcessingError)
+			}
+			deleted += res.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Infof("Delete:: Total %d matching records deleted", deleted)
+	return int(deleted), nil
 }
 
 func (s *Storage) DropAll() error {
-	return s.db.Migrator().DropTable(&Transaction{}, &Slot{})
+	return s.db.WithContext(context.Background()).Migrator().DropTable(&DayPart{}, &Transaction{}, &Slot{}, &PaymentProfile{}, &LedgerAccount{}, &LedgerEntry{}, &InvoiceItem{}, &Hold{}, &CartItem{}, &Cart{}, &WaitlistEntry{}, &Bid{}, &Auction{}, &TemplateRule{}, &InventoryTemplate{}, &CalendarDay{}, &Placement{}, &DeliveryStat{}, &SlotAudit{}, &ReleasedTransaction{}, &Creative{}, &Campaign{}, &Advertiser{})
 }
 
 func (s *Storage) Initialize() error {
-	return s.db.AutoMigrate(&Transaction{}, &Slot{})
+	err := s.db.WithContext(context.Background()).AutoMigrate(&Transaction{}, &Slot{}, &PaymentProfile{}, &LedgerAccount{}, &LedgerEntry{}, &InvoiceItem{}, &Hold{}, &Cart{}, &CartItem{}, &WaitlistEntry{}, &Auction{}, &Bid{}, &InventoryTemplate{}, &TemplateRule{}, &CalendarDay{}, &Placement{}, &DayPart{}, &Advertiser{}, &Campaign{}, &Creative{}, &DeliveryStat{}, &SlotAudit{}, &ReleasedTransaction{})
+	if err != nil {
+		return err
+	}
+	return createDefaultPlacement(s.db)
 }
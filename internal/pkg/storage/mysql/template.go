@@ -0,0 +1,95 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+func (s *Storage) CreateTemplate(template *InventoryTemplate) error {
+	if err := s.db.Create(template).Error; err != nil {
+		s.logger.Errorf("CreateTemplateFailed:: [Error: %s, Template: %+v]", err, template)
+		return models.NewError("CreateTemplateFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+func (s *Storage) GetTemplate(id string) (*InventoryTemplate, error) {
+	var template InventoryTemplate
+	err := s.db.Preload("Rules", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position_start")
+	}).Where("id = ?", id).First(&template).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(fmt.Sprintf("Template %s not found", id), models.ResourceNotFoundError)
+	}
+	if err != nil {
+		s.logger.Errorf("GetTemplateFailed:: [Id: %s, Error: %s]", id, err)
+		return nil, models.NewError("GetTemplateFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &template, nil
+}
+
+// Templates returns the templates with their rules, only the active ones
+// when activeOnly is set
+func (s *Storage) Templates(activeOnly bool) ([]*InventoryTemplate, error) {
+	var templates []*InventoryTemplate
+	q := s.db.Preload("Rules", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position_start")
+	}).Order("created, id")
+	if activeOnly {
+		q = q.Where("active = ?", true)
+	}
+	if err := q.Find(&templates).Error; err != nil {
+		s.logger.Errorf("TemplatesFailed:: [Error: %s]", err)
+		return nil, models.NewError("TemplatesFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return templates, nil
+}
+
+// UpdateTemplate saves the existing template and replaces its rules
+func (s *Storage) UpdateTemplate(template *InventoryTemplate) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(template).Select("name", "placement", "active").Updates(template).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("template_id = ?", template.ID).Delete(&TemplateRule{}).Error; err != nil {
+			return err
+		}
+		for _, rule := range template.Rules {
+			rule.ID = 0
+			rule.TemplateID = template.ID
+		}
+		return tx.Create(template.Rules).Error
+	})
+	if err != nil {
+		s.logger.Errorf("UpdateTemplateFailed:: [Id: %s, Error: %s]", template.ID, err)
+		return models.NewError("UpdateTemplateFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteTemplate(id string) (int, error) {
+	res := s.db.Delete(&InventoryTemplate{ID: id})
+	if res.Error != nil {
+		s.logger.Errorf("DeleteTemplateFailed:: [Id: %s, Error: %s]", id, res.Error)
+		return 0, models.NewError("DeleteTemplateFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return int(res.RowsAffected), nil
+}
+
+// CreateMissingSlots creates the slots which don't exist yet and leaves the
+// existing ones untouched, it returns the number of slots created. The
+// slots are inserted with IGNORE rather than on conflict do nothing, which
+// becomes an update of the existing rows and counts them as affected
+func (s *Storage) CreateMissingSlots(slots []*Slot) (int, error) {
+	res := s.db.Clauses(clause.Insert{Modifier: "IGNORE"}).Create(slots)
+	if res.Error != nil {
+		s.logger.Errorf("CreateMissingSlotsFailed:: [Error: %s]", res.Error)
+		return 0, models.NewError("CreateMissingSlotsFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return int(res.RowsAffected), nil
+}
@@ -0,0 +1,231 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// tenantPattern limits tenants to names which are safe as part of a database name
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_]{0,31}$`)
+
+type tenantKey struct{}
+
+// tenantStorages caches the storages of the tenants with schema isolation
+type tenantStorages struct {
+	mu       sync.Mutex
+	storages map[string]*Storage
+}
+
+// Tenant returns the tenant the queries of the storage are scoped to
+func (s *Storage) Tenant() string {
+	return s.tenant
+}
+
+// ForTenant returns the storage of the tenant. With column isolation the
+// tenants share the tables and every query is scoped by their tenant column,
+// with schema isolation each tenant has a database of its own, named after
+// the configured database and the tenant, which is created on first use. The
+// default tenant keeps the configured database in both cases
+func (s *Storage) ForTenant(tenant string) (*Storage, error) {
+	if !tenantPattern.MatchString(tenant) {
+		return nil, models.NewError(fmt.Sprintf("Invalid tenant %q", tenant), models.DecodeFailureError)
+	}
+	if s.conf.Tenancy != models.TenancySchema || tenant == models.DefaultTenant {
+		return s.bind(tenant)
+	}
+	s.tenants.mu.Lock()
+	defer s.tenants.mu.Unlock()
+	if ts, ok := s.tenants.storages[tenant]; ok {
+		return ts, nil
+	}
+	conf := s.conf
+	conf.Name = fmt.Sprintf("%s_%s", s.conf.Name, tenant)
+	if err := s.db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", conf.Name)).Error; err != nil {
+		s.logger.Errorf("CreateTenantSchemaFailed:: [Tenant: %s, Error: %s]", tenant, err)
+		return nil, models.NewError("CreateTenantSchemaFailed:: Internal server error", models.InternalProcessingError)
+	}
+	root, err := NewStorage(s.logger, s.writer, s.loglevel, &conf)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := root.bind(tenant)
+	if err != nil {
+		return nil, err
+	}
+	s.tenants.storages[tenant] = ts
+	return ts, nil
+}
+
+// bind returns a copy of the storage whose queries are scoped to the tenant,
+// the default placement of the tenant is created when it is missing
+func (s *Storage) bind(tenant string) (*Storage, error) {
+	ts := &Storage{
+		logger:   s.logger,
+		seedFile: s.seedFile,
+		db:       s.db.WithContext(context.WithValue(context.Background(), tenantKey{}, tenant)),
+		loglevel: s.loglevel,
+		writer:   s.writer,
+		conf:     s.conf,
+		tenant:   tenant,
+		tenants:  s.tenants,
+		changes:  s.changes,
+	}
+	if err := createDefaultPlacement(ts.db); err != nil {
+		s.logger.Errorf("CreateDefaultPlacementFailed:: [Tenant: %s, Error: %s]", tenant, err)
+		return nil, models.NewError("CreateDefaultPlacementFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return ts, nil
+}
+
+// registerTenantScope makes every query of a model with a tenant column
+// filter on the tenant of the session, and every created record belong to it
+func registerTenantScope(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("admgr:tenant", assignTenant),
+		cb.Query().Before("gorm:query").Register("admgr:tenant", scopeTenant),
+		cb.Update().Before("gorm:update").Register("admgr:tenant", scopeWrite),
+		cb.Delete().Before("gorm:delete").Register("admgr:tenant", scopeWrite),
+		cb.Row().Before("gorm:row").Register("admgr:tenant", scopeTenant),
+	)
+}
+
+func sessionTenant(db *gorm.DB) (string, bool) {
+	if db.Statement.Schema == nil || db.Statement.Schema.LookUpField("Tenant") == nil {
+		return "", false
+	}
+	tenant, ok := db.Statement.Context.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+func scopeTenant(db *gorm.DB) {
+	tenant, ok := sessionTenant(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "tenant"}, Value: tenant},
+	}})
+}
+
+// scopeWrite scopes an update or delete to the tenant of the session. The
+// records it's given by their keys get the tenant too when they have none,
+// the keys include it and would match no rows otherwise
+func scopeWrite(db *gorm.DB) {
+	scopeTenant(db)
+	if _, ok := sessionTenant(db); ok {
+		setTenant(db, true)
+	}
+}
+
+// keyedWithoutTenant tells whether the record has no tenant but other parts
+// of its primary key
+func keyedWithoutTenant(db *gorm.DB, tenant *schema.Field, rv reflect.Value) bool {
+	if !tenant.PrimaryKey {
+		return false
+	}
+	if _, zero := tenant.ValueOf(db.Statement.Context, rv); !zero {
+		return false
+	}
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		if field == tenant {
+			continue
+		}
+		if _, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+			return true
+		}
+	}
+	return false
+}
+
+func assignTenant(db *gorm.DB) {
+	if _, ok := sessionTenant(db); ok {
+		setTenant(db, false)
+	}
+}
+
+// setTenant sets the tenant of the session on the records of the statement.
+// With keysOnly only the records without a tenant but with other parts of
+// their key get it, records without a key are conditions of their own
+func setTenant(db *gorm.DB, keysOnly bool) {
+	tenant, _ := sessionTenant(db)
+	field := db.Statement.Schema.LookUpField("Tenant")
+	set := func(rv reflect.Value) error {
+		if keysOnly && !keyedWithoutTenant(db, field, rv) {
+			return nil
+		}
+		return field.Set(db.Statement.Context, rv, tenant)
+	}
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := set(reflect.Indirect(rv.Index(i))); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	case reflect.Struct:
+		if rv.CanAddr() {
+			if err := set(rv); err != nil {
+				db.AddError(err)
+			}
+		}
+	}
+}
+
+// migrateTenants moves the existing records into the default tenant, the
+// tenant becomes part of the primary key of the tables with natural keys
+func migrateTenants(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&Slot{}) || m.HasColumn(&Slot{}, "tenant") {
+		return nil
+	}
+	// the foreign keys reference the former primary keys
+	for _, fk := range []struct {
+		model interface{}
+		name  string
+	}{{&Slot{}, "Transaction"}, {&LedgerEntry{}, "Account"}} {
+		if m.HasConstraint(fk.model, fk.name) {
+			if err := m.DropConstraint(fk.model, fk.name); err != nil {
+				return err
+			}
+		}
+	}
+	if m.HasIndex("ledger_accounts", "idx_ledger_accounts_uid") {
+		if err := m.DropIndex("ledger_accounts", "idx_ledger_accounts_uid"); err != nil {
+			return err
+		}
+	}
+	keys := map[string]string{
+		"slots":            "tenant, placement, date, position",
+		"transactions":     "tenant, placement, date, position",
+		"payment_profiles": "tenant, uid",
+		"ledger_accounts":  "tenant, id",
+		"calendar_days":    "tenant, date",
+		"placements":       "tenant, id",
+	}
+	for table, key := range keys {
+		if !m.HasTable(table) {
+			continue
+		}
+		err := db.Exec(fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN tenant varchar(64) NOT NULL DEFAULT '%s' FIRST, DROP PRIMARY KEY, ADD PRIMARY KEY (%s)",
+			table, models.DefaultTenant, key,
+		)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
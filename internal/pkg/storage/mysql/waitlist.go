@@ -0,0 +1,111 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+)
+
+// CreateWaitlistEntries queues the entries, it fails without changes if the
+// advertiser is already waiting for any of the slots
+func (s *Storage) CreateWaitlistEntries(entries []*WaitlistEntry) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, entry := range entries {
+			var count int64
+			err := tx.Model(&WaitlistEntry{}).
+				Where("placement = ? AND date = ? AND position = ? AND uid = ? AND status IN ?", entry.Placement, entry.Date, entry.Position, entry.Uid,
+					[]string{models.WaitlistStatusWaiting, models.WaitlistStatusOffered}).
+				Count(&count).Error
+			if err != nil {
+				s.logger.Errorf("CreateWaitlistEntriesFailed:: [Error: %s, Entry: %+v]", err, entry)
+				return models.NewError("CreateWaitlistEntriesFailed:: Internal server error", models.InternalProcessingError)
+			}
+			if count > 0 {
+				return models.NewError(
+					fmt.Sprintf("Already on the waitlist of slot with [placement: %s, date: %s, position: %d]", entry.Placement, models.DateToString(*entry.Date), *entry.Position),
+					models.DuplicateResourceCreationError,
+				)
+			}
+		}
+		if err := tx.Create(entries).Error; err != nil {
+			s.logger.Errorf("CreateWaitlistEntriesFailed:: [Error: %s]", err)
+			return models.NewError("CreateWaitlistEntriesFailed:: Internal server error", models.InternalProcessingError)
+		}
+		return nil
+	})
+}
+
+func (s *Storage) GetWaitlistEntry(id string) (*WaitlistEntry, error) {
+	var entry WaitlistEntry
+	err := s.db.Where("id = ?", id).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, models.NewError(fmt.Sprintf("Waitlist entry %s not found", id), models.ResourceNotFoundError)
+	}
+	if err != nil {
+		s.logger.Errorf("GetWaitlistEntryFailed:: [Id: %s, Error: %s]", id, err)
+		return nil, models.NewError("GetWaitlistEntryFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return &entry, nil
+}
+
+// WaitlistEntries returns the entries of the advertiser, or the entries in
+// the given status when uid is empty, oldest first
+func (s *Storage) WaitlistEntries(uid, status string) ([]*WaitlistEntry, error) {
+	var entries []*WaitlistEntry
+	q := s.db.Order("created, id")
+	if uid != "" {
+		q = q.Where("uid = ?", uid)
+	}
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if err := q.Find(&entries).Error; err != nil {
+		s.logger.Errorf("WaitlistEntriesFailed:: [Uid: %s, Status: %s, Error: %s]", uid, status, err)
+		return nil, models.NewError("WaitlistEntriesFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return entries, nil
+}
+
+// NextWaitlistOffers returns the first waiting entry of every open slot
+func (s *Storage) NextWaitlistOffers() ([]*WaitlistEntry, error) {
+	var entries []*WaitlistEntry
+	err := s.db.Model(&WaitlistEntry{}).
+		Joins("JOIN slots ON slots.tenant = waitlist_entries.tenant AND slots.placement = waitlist_entries.placement AND slots.date = waitlist_entries.date AND slots.position = waitlist_entries.position").
+		Where("waitlist_entries.status = ? AND slots.status = ?", models.WaitlistStatusWaiting, models.SlotStatusOpen).
+		Order("waitlist_entries.created, waitlist_entries.id").
+		Find(&entries).Error
+	if err != nil {
+		s.logger.Errorf("NextWaitlistOffersFailed:: [Error: %s]", err)
+		return nil, models.NewError("NextWaitlistOffersFailed:: Internal server error", models.InternalProcessingError)
+	}
+	seen := make(map[string]bool)
+	var next []*WaitlistEntry
+	for _, entry := range entries {
+		key := fmt.Sprintf("%s:%s:%d", entry.Placement, entry.Date.Format(time.RFC3339), *entry.Position)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		next = append(next, entry)
+	}
+	return next, nil
+}
+
+// UpdateWaitlistEntry moves the entry from one status to another and sets
+// its hold when given, it returns false if the entry wasn't in the expected status
+func (s *Storage) UpdateWaitlistEntry(id, lastStatus, newStatus string, holdID *string) (bool, error) {
+	values := map[string]interface{}{"status": newStatus}
+	if holdID != nil {
+		values["hold_id"] = *holdID
+	}
+	res := s.db.Model(&WaitlistEntry{}).Where("id = ? AND status = ?", id, lastStatus).Updates(values)
+	if res.Error != nil {
+		s.logger.Errorf("UpdateWaitlistEntryFailed:: [Id: %s, Error: %s]", id, res.Error)
+		return false, models.NewError("UpdateWaitlistEntryFailed:: Internal server error", models.InternalProcessingError)
+	}
+	return res.RowsAffected == 1, nil
+}
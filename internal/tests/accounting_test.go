@@ -0,0 +1,273 @@
+package tests_test
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAccountingService starts a stub accounting server and a client of it
+// without health checks, so that they don't race with the test calls
+func newTestAccountingService(t *testing.T, signingSecret string, handler http.HandlerFunc) accounting.AccountingService {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	acc, err := accounting.NewAccountingService(logrus.New(), testAccountingConf(server.URL, signingSecret, -1), "admgr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(acc.Close)
+	return acc
+}
+
+func testAccountingConf(serverURL, signingSecret string, healthCheckInterval time.Duration) models.AccountingServiceConf {
+	u, _ := url.Parse(serverURL)
+	return models.AccountingServiceConf{
+		Scheme:                  u.Scheme,
+		Host:                    u.Hostname(),
+		Port:                    u.Port(),
+		HealthCheckPath:         "health-check",
+		HealthCheckInterval:     healthCheckInterval,
+		MaxRetries:              2,
+		MinRetryBackoff:         time.Millisecond,
+		MaxRetryBackoff:         2 * time.Millisecond,
+		BreakerFailureThreshold: 3,
+		BreakerResetTimeout:     time.Hour,
+		SigningSecret:           signingSecret,
+	}
+}
+
+func TestAccountingHealthCheck(t *testing.T) {
+	checks := make(chan struct{}, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health-check" {
+			checks <- struct{}{}
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+	acc, err := accounting.NewAccountingService(logrus.New(), testAccountingConf(server.URL, "", 10*time.Millisecond), "admgr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-checks:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected accounting client to run periodic health checks")
+		}
+	}
+	acc.Close()
+	acc.Close()
+	// drain a check which was in flight while closing
+	time.Sleep(50 * time.Millisecond)
+	for len(checks) > 0 {
+		<-checks
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, len(checks), "Expected health checks to stop once the client is closed")
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := accounting.NewCircuitBreaker(3, time.Minute, func() time.Time { return now })
+
+	for i := 0; i < 2; i++ {
+		assert.True(t, b.Allow())
+		b.Failure()
+	}
+	assert.Equal(t, accounting.BreakerStateClosed, b.State())
+	b.Failure()
+	assert.Equal(t, accounting.BreakerStateOpen, b.State())
+	assert.False(t, b.Allow(), "Expected open circuit to refuse calls")
+
+	b.Success()
+	assert.Equal(t, accounting.BreakerStateOpen, b.State(), "Expected success to not close an open circuit")
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.Allow(), "Expected a trial call once the reset timeout elapsed")
+	assert.Equal(t, accounting.BreakerStateHalfOpen, b.State())
+	assert.False(t, b.Allow(), "Expected a single trial call while half open")
+	b.Failure()
+	assert.Equal(t, accounting.BreakerStateOpen, b.State(), "Expected failed trial to reopen the circuit")
+	assert.False(t, b.Allow())
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.Allow())
+	b.Success()
+	assert.Equal(t, accounting.BreakerStateClosed, b.State(), "Expected successful trial to close the circuit")
+	assert.True(t, b.Allow())
+}
+
+func TestCircuitBreakerHealthChecks(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := accounting.NewCircuitBreaker(3, time.Minute, func() time.Time { return now })
+
+	for i := 0; i < 3; i++ {
+		b.Failure()
+		b.CheckSuccess()
+	}
+	assert.Equal(t, accounting.BreakerStateOpen, b.State(), "Expected passing health checks to not reset the failures of calls")
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.Allow())
+	b.CheckSuccess()
+	assert.Equal(t, accounting.BreakerStateClosed, b.State(), "Expected a passing health check to close a half open circuit")
+
+	for i := 0; i < 2; i++ {
+		b.CheckFailure()
+		b.Failure()
+		b.Success()
+	}
+	assert.Equal(t, accounting.BreakerStateClosed, b.State())
+	b.CheckFailure()
+	assert.Equal(t, accounting.BreakerStateOpen, b.State(), "Expected failed health checks to open the circuit")
+}
+
+func TestAccountingStatusRetries(t *testing.T) {
+	var calls int32
+	acc := newTestAccountingService(t, "", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`[]`))
+	})
+	_, err := acc.Status([]string{"txn"})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "Expected status to be retried until it succeeds")
+	assert.Equal(t, accounting.BreakerStateClosed, acc.State())
+}
+
+func TestAccountingCircuitBreaker(t *testing.T) {
+	var debits int32
+	acc := newTestAccountingService(t, "", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/debit" {
+			atomic.AddInt32(&debits, 1)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	for i := 0; i < 3; i++ {
+		err := acc.Debit(nil, "uid", "txn")
+		assert.Error(t, err)
+		assert.NotEqual(t, accounting.ErrCircuitOpen, err, "Expected a debit which was sent to fail with another error")
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&debits), "Expected debit to be attempted once per call")
+	assert.Equal(t, accounting.BreakerStateOpen, acc.State())
+
+	err := acc.Debit(nil, "uid", "txn")
+	if assert.IsType(t, &models.Error{}, err) {
+		assert.Equal(t, models.DependentServiceRequestFailed, err.(*models.Error).Type)
+	}
+	assert.Equal(t, accounting.ErrCircuitOpen, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&debits), "Expected open circuit to fail fast")
+}
+
+func TestAccountingSignedRequests(t *testing.T) {
+	secret := "admgr-test-secret"
+	var verifyErr error
+	acc := newTestAccountingService(t, secret, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = accounting.VerifySignature(secret, r.Method, r.URL.Path,
+			r.Header.Get(accounting.HeaderTimestamp), r.Header.Get(accounting.HeaderSignature), body)
+		if verifyErr != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	assert.Nil(t, acc.Debit(nil, "uid", "txn"))
+	assert.Nil(t, verifyErr, "Expected debit request to carry a valid signature")
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := accounting.Sign(secret, http.MethodPost, "/debit", timestamp, []byte(`{"amount":1}`))
+	assert.Error(t, accounting.VerifySignature(secret, http.MethodPost, "/debit", timestamp, signature, []byte(`{"amount":2}`)),
+		"Expected tampered body to fail verification")
+	assert.Error(t, accounting.VerifySignature("other", http.MethodPost, "/debit", timestamp, signature, []byte(`{"amount":1}`)),
+		"Expected wrong secret to fail verification")
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	assert.Error(t, accounting.VerifySignature(secret, http.MethodPost, "/debit", stale,
+		accounting.Sign(secret, http.MethodPost, "/debit", stale, nil), nil), "Expected stale timestamp to fail verification")
+}
+
+func TestAccountingTenantSource(t *testing.T) {
+	var source string
+	acc := newTestAccountingService(t, "", func(w http.ResponseWriter, r *http.Request) {
+		var body accounting.AccountingRequestBody
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		source = body.Source
+	})
+	assert.Nil(t, acc.ForTenant("acme").Debit(nil, "uid", "txn"))
+	assert.Equal(t, "acme", source, "Expected the tenant to be sent as source")
+	assert.Nil(t, acc.Debit(nil, "uid", "txn"))
+	assert.Equal(t, "admgr", source, "Expected the tenant client to leave the source of the shared one alone")
+}
+
+func TestAccountingTenantClose(t *testing.T) {
+	checks := make(chan struct{}, 16)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health-check" {
+			select {
+			case checks <- struct{}{}:
+			default:
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	acc, err := accounting.NewAccountingService(logrus.New(), testAccountingConf(server.URL, "", 10*time.Millisecond), "admgr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(acc.Close)
+	acme, globex := acc.ForTenant("acme"), acc.ForTenant("globex")
+	acme.Close()
+	acme.Close()
+	globex.Close()
+	for len(checks) > 0 {
+		<-checks
+	}
+	select {
+	case <-checks:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected closing the clients of tenants to leave the health checks of the shared one running")
+	}
+}
+
+func TestAccountingTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+	dir := t.TempDir()
+	caPath := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caPath, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := testAccountingConf(server.URL, "", -1)
+	conf.TLSCAPath = caPath
+	acc, err := accounting.NewAccountingService(logrus.New(), conf, "admgr")
+	if !assert.Nil(t, err) {
+		return
+	}
+	t.Cleanup(acc.Close)
+	_, err = acc.Status([]string{"txn"})
+	assert.Nil(t, err, "Expected the server to be verified with the configured CA")
+
+	conf.TLSCertPath = filepath.Join(dir, "missing.pem")
+	conf.TLSKeyPath = filepath.Join(dir, "missing.key")
+	_, err = accounting.NewAccountingService(logrus.New(), conf, "admgr")
+	assert.Error(t, err, "Expected a missing client certificate to fail the client")
+}
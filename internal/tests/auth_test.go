@@ -0,0 +1,98 @@
+package tests_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/auth"
+	"github.com/kiran-anand14/admgr/internal/pkg/core"
+	"github.com/kiran-anand14/admgr/internal/pkg/http/rest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	secret := "admgr-test-secret"
+	token, err := auth.NewToken(secret, &auth.Claims{Subject: "uid", Tenant: "acme"})
+	assert.Nil(t, err)
+	claims, err := auth.ParseToken(secret, token)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "acme", claims.Tenant)
+		assert.Equal(t, "uid", claims.Subject)
+	}
+
+	_, err = auth.ParseToken("other", token)
+	assert.Error(t, err, "Expected wrong secret to fail verification")
+	parts := strings.Split(token, ".")
+	forged, _ := auth.NewToken(secret, &auth.Claims{Tenant: "other"})
+	_, err = auth.ParseToken(secret, parts[0]+"."+strings.Split(forged, ".")[1]+"."+parts[2])
+	assert.Error(t, err, "Expected tampered claims to fail verification")
+
+	expired, _ := auth.NewToken(secret, &auth.Claims{Tenant: "acme", ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+	_, err = auth.ParseToken(secret, expired)
+	assert.Error(t, err, "Expected expired token to be rejected")
+	anonymous, _ := auth.NewToken(secret, &auth.Claims{Subject: "uid"})
+	_, err = auth.ParseToken(secret, anonymous)
+	assert.Error(t, err, "Expected token without tenant to be rejected")
+}
+
+func TestSignValues(t *testing.T) {
+	secret := "admgr-test-secret"
+	values := url.Values{"placement": {"default"}, "position": {"1"}}
+	values.Set("sig", auth.SignValues(secret, values))
+	assert.True(t, auth.VerifyValues(secret, values))
+	assert.False(t, auth.VerifyValues("other", values), "Expected wrong secret to fail verification")
+
+	values.Set("position", "2")
+	assert.False(t, auth.VerifyValues(secret, values), "Expected tampered values to fail verification")
+	values.Del("sig")
+	assert.False(t, auth.VerifyValues(secret, values), "Expected unsigned values to fail verification")
+}
+
+// callerService records the uid whose waitlist is read
+type callerService struct {
+	core.Service
+	uid string
+}
+
+func (s *callerService) WithAudit(actor, requestID string) core.Service {
+	return s
+}
+
+func (s *callerService) GetWaitlist(uid string) ([]*api.WaitlistEntryResponse, error) {
+	s.uid = uid
+	return nil, nil
+}
+
+func TestCallerUid(t *testing.T) {
+	secret := "admgr-test-secret"
+	svc := &callerService{}
+	router, err := rest.Handler(logrus.New(), map[string]core.Service{"acme": svc}, secret, io.Discard)
+	if !assert.Nil(t, err) {
+		return
+	}
+	token, _ := auth.NewToken(secret, &auth.Claims{Subject: "advertiser", Tenant: "acme"})
+	get := func(path string) int {
+		svc.uid = ""
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("/adslots/waitlist"))
+	assert.Equal(t, "advertiser", svc.uid, "Expected the uid to be the subject of the token")
+	assert.Equal(t, http.StatusOK, get("/adslots/waitlist?uid=advertiser"))
+	assert.Equal(t, "advertiser", svc.uid)
+	assert.Equal(t, http.StatusForbidden, get("/adslots/waitlist?uid=operator"), "Expected the uid of someone else to be refused")
+	assert.Equal(t, http.StatusForbidden, get("/adslots/waitlist?uid=advertiser&uid=operator"))
+	assert.Empty(t, svc.uid)
+	assert.Equal(t, http.StatusForbidden, get("/wallets/operator"), "Expected the wallet of someone else to be refused")
+}
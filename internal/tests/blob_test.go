@@ -0,0 +1,34 @@
+package tests_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/blob"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := blob.NewFileStore(t.TempDir())
+	if !assert.Nil(t, err) {
+		return
+	}
+	err = store.Put("creatives/default/banner", strings.NewReader("<p>Sale</p>"))
+	assert.Nil(t, err)
+
+	content, err := store.Open("creatives/default/banner")
+	if assert.Nil(t, err) {
+		data, _ := io.ReadAll(content)
+		content.Close()
+		assert.Equal(t, "<p>Sale</p>", string(data))
+	}
+
+	assert.Nil(t, store.Delete("creatives/default/banner"))
+	assert.Nil(t, store.Delete("creatives/default/banner"), "Expected deleting a missing blob to succeed")
+	_, err = store.Open("creatives/default/banner")
+	assert.ErrorIs(t, err, blob.ErrNotFound)
+
+	assert.Error(t, store.Put("../outside", strings.NewReader("x")), "Expected keys escaping the store to be refused")
+	assert.Error(t, store.Put("", strings.NewReader("x")))
+}
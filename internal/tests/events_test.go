@@ -0,0 +1,34 @@
+package tests_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/events"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookPublisher(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		received <- body
+	}))
+	defer server.Close()
+
+	publisher := events.NewWebhookPublisher(logrus.New(), server.URL, time.Second)
+	publisher.Publish(events.New(models.EventWaitlistOffered, map[string]string{"hold_id": "1"}))
+	select {
+	case body := <-received:
+		assert.Equal(t, models.EventWaitlistOffered, body["type"])
+		assert.Equal(t, map[string]interface{}{"hold_id": "1"}, body["data"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the event to be posted to the webhook")
+	}
+}
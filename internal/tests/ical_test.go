@@ -0,0 +1,50 @@
+package tests_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/ical"
+	"github.com/stretchr/testify/assert"
+)
+
+const holidays = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:christmas
+DTSTART;VALUE=DATE:20301225
+DTEND;VALUE=DATE:20301227
+RRULE:FREQ=YEARLY;COUNT=2
+SUMMARY:Christmas\, Boxing
+  Day
+CATEGORIES:holiday
+END:VEVENT
+BEGIN:VEVENT
+DTSTART:20300101T090000Z
+SUMMARY:Maintenance
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestParseCalendar(t *testing.T) {
+	events, err := ical.Parse(strings.NewReader(holidays))
+	if !assert.Nil(t, err) || !assert.Len(t, events, 2) {
+		return
+	}
+	assert.Equal(t, "Christmas, Boxing Day", events[0].Summary)
+	assert.Equal(t, []string{"holiday"}, events[0].Categories)
+
+	var dates []string
+	until, _ := time.Parse(time.DateOnly, "2040-01-01")
+	for _, d := range events[0].Dates(until) {
+		dates = append(dates, d.Format(time.DateOnly))
+	}
+	assert.Equal(t, []string{"2030-12-25", "2030-12-26", "2031-12-25", "2031-12-26"}, dates)
+	if assert.Len(t, events[1].Dates(until), 1) {
+		assert.Equal(t, "2030-01-01", events[1].Dates(until)[0].Format(time.DateOnly))
+	}
+
+	_, err = ical.Parse(strings.NewReader("BEGIN:VEVENT\nDTSTART:20300101\nRRULE:FREQ=YEARLY;BYDAY=4TH\nEND:VEVENT\n"))
+	assert.NotNil(t, err, "Expected unsupported rules to be refused")
+}
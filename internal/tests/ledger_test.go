@@ -0,0 +1,144 @@
+package tests_test
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+// buildCostedSlots builds slots of the status which cost 10 each
+func buildCostedSlots(status string, n int) []*mysql.Slot {
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{status}).WithInstances(n).Build()
+	for _, slot := range slots {
+		slot.Cost = models.PtrFloat(10)
+		slot.BookedBy, slot.BookedDate = nil, nil
+	}
+	return slots
+}
+
+func (r *RepositoryTestSuite) Test_LedgerTopUp() {
+	uid := uuid.New().String()
+	wallet, err := r.repository.TopUpWallet(uid, 100)
+	assert.Nil(r.T(), err, "Failed to top up wallet")
+	assert.Equal(r.T(), 100.0, wallet.Balance)
+	wallet, err = r.repository.TopUpWallet(uid, 50.5)
+	assert.Nil(r.T(), err, "Failed to top up wallet")
+	assert.Equal(r.T(), 150.5, wallet.Balance)
+
+	wallet, err = r.repository.GetWallet(uid)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 150.5, wallet.Balance)
+	today := time.Now()
+	entries, err := r.repository.WalletStatement(uid, today, today)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), entries, 2) {
+		assert.Equal(r.T(), models.LedgerEntryTopUp, entries[1].Kind)
+		assert.Equal(r.T(), 50.5, entries[1].Amount)
+		assert.Equal(r.T(), 150.5, entries[1].BalanceAfter)
+	}
+
+	_, err = r.repository.GetWallet(uuid.New().String())
+	if assert.IsType(r.T(), &models.Error{}, err) {
+		assert.Equal(r.T(), models.ResourceNotFoundError, err.(*models.Error).Type)
+	}
+}
+
+func (r *RepositoryTestSuite) Test_LedgerOverdraft() {
+	uid := uuid.New().String()
+	_, err := r.repository.TopUpWallet(uid, 10)
+	assert.Nil(r.T(), err, "Failed to top up wallet")
+
+	err = r.repository.DebitWallet(uid, uuid.New().String(), 25)
+	if assert.IsType(r.T(), &models.Error{}, err, "Expected the wallet to refuse an overdraft") {
+		assert.Equal(r.T(), models.ActionForbidden, err.(*models.Error).Type)
+	}
+	wallet, err := r.repository.GetWallet(uid)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 10.0, wallet.Balance, "Expected a refused debit to leave the balance")
+
+	assert.Nil(r.T(), r.repository.DebitWallet(uid, uuid.New().String(), 10), "Expected the whole balance to be spendable")
+	wallet, err = r.repository.GetWallet(uid)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 0.0, wallet.Balance)
+
+	err = r.repository.DebitWallet(uuid.New().String(), uuid.New().String(), 1)
+	assert.NotNil(r.T(), err, "Expected a debit of a missing wallet to fail")
+}
+
+func (r *RepositoryTestSuite) Test_LedgerDebitAndBook() {
+	uid, txnid := uuid.New().String(), uuid.New().String()
+	slots := buildCostedSlots(models.SlotStatusHold, 2)
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+	_, err = r.repository.TopUpWallet(uid, 100)
+	assert.Nil(r.T(), err, "Failed to top up wallet")
+
+	err = r.repository.DebitWalletAndBook(slots, uid, txnid)
+	assert.Nil(r.T(), err, "Failed to debit and book")
+	wallet, err := r.repository.GetWallet(uid)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 80.0, wallet.Balance)
+	debits, err := r.repository.WalletDebits([]string{txnid})
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), debits, 1) {
+		assert.Equal(r.T(), -20.0, debits[0].Amount)
+	}
+	booked, err := r.repository.SearchSlotsByStatus(&mysql.GetOptions{Status: models.SlotStatusBooked})
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), booked, 2) {
+		assert.Equal(r.T(), uid, models.StringValue(booked[0].BookedBy))
+	}
+
+	// the debit is rolled back with the booking of slots which aren't on hold
+	err = r.repository.DebitWalletAndBook(slots, uid, uuid.New().String())
+	if assert.IsType(r.T(), &models.Error{}, err) {
+		assert.Equal(r.T(), models.ActionForbidden, err.(*models.Error).Type)
+	}
+	wallet, err = r.repository.GetWallet(uid)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 80.0, wallet.Balance, "Expected the debit to be rolled back")
+}
+
+func (r *RepositoryTestSuite) Test_LedgerRefundCap() {
+	uid, txnid := uuid.New().String(), uuid.New().String()
+	slots := buildCostedSlots(models.SlotStatusHold, 2)
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+	_, err = r.repository.TopUpWallet(uid, 20)
+	assert.Nil(r.T(), err, "Failed to top up wallet")
+	assert.Nil(r.T(), r.repository.DebitWalletAndBook(slots, uid, txnid), "Failed to debit and book")
+
+	err = r.repository.RefundWalletAndRelease(slots[:1], uid, txnid)
+	assert.Nil(r.T(), err, "Failed to refund a slot")
+	wallet, err := r.repository.GetWallet(uid)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 10.0, wallet.Balance)
+
+	// the slot of another transaction doesn't raise the refundable amount
+	other := buildCostedSlots(models.SlotStatusHold, 1)
+	otherDate := slots[0].Date.AddDate(0, 1, 0)
+	other[0].Date = &otherDate
+	other[0].Cost = models.PtrFloat(15)
+	_, err = r.repository.Create(other)
+	assert.Nil(r.T(), err, "Failed to create slot")
+	_, err = r.repository.TopUpWallet(uid, 15)
+	assert.Nil(r.T(), err, "Failed to top up wallet")
+	assert.Nil(r.T(), r.repository.DebitWalletAndBook(other, uid, uuid.New().String()), "Failed to book the other slot")
+	err = r.repository.RefundWalletAndRelease([]*mysql.Slot{slots[1], other[0]}, uid, txnid)
+	if assert.IsType(r.T(), &models.Error{}, err, "Expected a refund above the debit to be refused") {
+		assert.Equal(r.T(), models.ActionForbidden, err.(*models.Error).Type)
+		assert.Contains(r.T(), err.Error(), "exceeds the remaining debit")
+	}
+
+	err = r.repository.RefundWalletAndRelease(slots[1:], uid, txnid)
+	assert.Nil(r.T(), err, "Failed to refund the remaining slot")
+	err = r.repository.RefundWalletAndRelease(slots[1:], uid, txnid)
+	assert.NotNil(r.T(), err, "Expected the refunded debit to be spent")
+	wallet, err = r.repository.GetWallet(uid)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 20.0, wallet.Balance, "Expected the whole debit to be refunded once")
+}
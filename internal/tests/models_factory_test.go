@@ -58,7 +58,7 @@ func (s *SlotFactory) Build() []*mysql.Slot {
 
 	s.fill_default()
 
-	slotFactory := factory.NewFactory(&mysql.Slot{}).
+	slotFactory := factory.NewFactory(&mysql.Slot{Placement: models.DefaultPlacement}).
 		Attr("Date", func(args factory.Args) (interface{}, error) {
 			date := time.Now().AddDate(0, 0, randomdata.Number(1, 7))
 			return &date, nil
@@ -126,7 +126,7 @@ func (t *TransactionFactory) WithInstances(n int) *TransactionFactory {
 }
 
 func (t *TransactionFactory) Build() []*mysql.Transaction {
-	txnFactory := factory.NewFactory(&mysql.Transaction{}).
+	txnFactory := factory.NewFactory(&mysql.Transaction{Placement: models.DefaultPlacement}).
 		Attr("Date", func(args factory.Args) (interface{}, error) {
 			if t.Date != nil {
 				return t.Date, nil
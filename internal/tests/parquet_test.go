@@ -0,0 +1,194 @@
+package tests_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	pq "github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/schema"
+	"github.com/kiran-anand14/admgr/internal/pkg/core"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// bookingRows hands its rows to the export
+type bookingRows struct {
+	core.Repository
+	rows []*mysql.BookingRow
+}
+
+func (b *bookingRows) EachBooking(opts *mysql.ExportOptions, fn func(*mysql.BookingRow) error) error {
+	for _, row := range b.rows {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestParquetExport(t *testing.T) {
+	// enough rows for two full row groups and a partial one
+	const rows = 20001
+	date := time.Date(2030, 5, 4, 0, 0, 0, 0, time.UTC)
+	rep := &bookingRows{}
+	var placements, dates, endsAt, positions, statuses, costs, txnids, creatives []interface{}
+	for i := 0; i < rows; i++ {
+		row := &mysql.BookingRow{
+			Placement: "homepage",
+			Date:      date.Add(time.Duration(i) * time.Hour),
+			Position:  int32(i%10 + 1),
+			Status:    models.SlotStatusOpen,
+			Cost:      10.5 * float64(i%4+1),
+		}
+		placements = append(placements, row.Placement)
+		dates = append(dates, row.Date.UnixMilli())
+		positions = append(positions, row.Position)
+		costs = append(costs, row.Cost)
+		endsAt = append(endsAt, nil)
+		txnids = append(txnids, nil)
+		if i%2 == 0 {
+			row.Status = models.SlotStatusBooked
+			row.Txnid = models.PtrString("txn-" + models.Int32ToString(int32(i)))
+			row.EndsAt = models.PtrDate(row.Date.Add(time.Hour))
+			txnids[i] = *row.Txnid
+			endsAt[i] = row.EndsAt.UnixMilli()
+		}
+		statuses = append(statuses, row.Status)
+		creatives = append(creatives, nil)
+		rep.rows = append(rep.rows, row)
+	}
+
+	var buf bytes.Buffer
+	n, err := core.NewExporter(rep, logrus.New()).Export(&buf, models.ExportFormatParquet, &mysql.ExportOptions{Start: date, End: date})
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, rows, n)
+
+	r, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	if !assert.Nil(t, err, "Expected the export to be opened by a Parquet reader") {
+		return
+	}
+	defer r.Close()
+	assert.Equal(t, int64(rows), r.NumRows())
+	assert.Equal(t, 3, r.NumRowGroups(), "Expected a row group every 10000 rows")
+
+	columns := []struct {
+		name       string
+		typ        pq.Type
+		repetition pq.Repetition
+		converted  schema.ConvertedType
+	}{
+		{"placement", pq.Types.ByteArray, pq.Repetitions.Required, schema.ConvertedTypes.UTF8},
+		{"date", pq.Types.Int64, pq.Repetitions.Required, schema.ConvertedTypes.TimestampMillis},
+		{"ends_at", pq.Types.Int64, pq.Repetitions.Optional, schema.ConvertedTypes.TimestampMillis},
+		{"position", pq.Types.Int32, pq.Repetitions.Required, schema.ConvertedTypes.Int32},
+		{"status", pq.Types.ByteArray, pq.Repetitions.Required, schema.ConvertedTypes.UTF8},
+		{"cost", pq.Types.Double, pq.Repetitions.Required, schema.ConvertedTypes.None},
+		{"txnid", pq.Types.ByteArray, pq.Repetitions.Optional, schema.ConvertedTypes.UTF8},
+		{"provider", pq.Types.ByteArray, pq.Repetitions.Optional, schema.ConvertedTypes.UTF8},
+		{"campaign_id", pq.Types.ByteArray, pq.Repetitions.Optional, schema.ConvertedTypes.UTF8},
+		{"booked_by", pq.Types.ByteArray, pq.Repetitions.Optional, schema.ConvertedTypes.UTF8},
+		{"booked_date", pq.Types.Int64, pq.Repetitions.Optional, schema.ConvertedTypes.TimestampMillis},
+		{"creative_id", pq.Types.ByteArray, pq.Repetitions.Optional, schema.ConvertedTypes.UTF8},
+	}
+	fileSchema := r.MetaData().Schema
+	if !assert.Equal(t, len(columns), fileSchema.NumColumns()) {
+		return
+	}
+	for i, c := range columns {
+		col := fileSchema.Column(i)
+		assert.Equal(t, c.name, col.Name())
+		assert.Equal(t, c.typ, col.PhysicalType(), c.name)
+		assert.Equal(t, c.repetition, col.SchemaNode().RepetitionType(), c.name)
+		assert.Equal(t, c.converted, col.ConvertedType(), c.name)
+	}
+
+	assert.Equal(t, placements, readParquetColumn(t, r, 0))
+	assert.Equal(t, dates, readParquetColumn(t, r, 1))
+	assert.Equal(t, endsAt, readParquetColumn(t, r, 2), "Expected the missing values of the optional column to be null")
+	assert.Equal(t, positions, readParquetColumn(t, r, 3))
+	assert.Equal(t, statuses, readParquetColumn(t, r, 4))
+	assert.Equal(t, costs, readParquetColumn(t, r, 5))
+	assert.Equal(t, txnids, readParquetColumn(t, r, 6))
+	assert.Equal(t, creatives, readParquetColumn(t, r, 11), "Expected a column of nulls")
+
+	// an export without rows is a valid file
+	buf.Reset()
+	_, err = core.NewExporter(&bookingRows{}, logrus.New()).Export(&buf, models.ExportFormatParquet, &mysql.ExportOptions{Start: date, End: date})
+	assert.Nil(t, err)
+	empty, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(0), empty.NumRows())
+		assert.Equal(t, len(columns), empty.MetaData().Schema.NumColumns())
+	}
+}
+
+// readParquetColumn reads the values of the column from every row group, nil
+// for the nulls of optional columns and strings for byte arrays
+func readParquetColumn(t *testing.T, r *file.Reader, col int) []interface{} {
+	var values []interface{}
+	for i := 0; i < r.NumRowGroups(); i++ {
+		rg := r.RowGroup(i)
+		rows := rg.NumRows()
+		chunk, err := rg.Column(col)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defLvls := make([]int16, rows)
+		var read []interface{}
+		switch c := chunk.(type) {
+		case *file.Int32ColumnChunkReader:
+			batch := make([]int32, rows)
+			_, n, err := c.ReadBatch(rows, batch, defLvls, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range batch[:n] {
+				read = append(read, v)
+			}
+		case *file.Int64ColumnChunkReader:
+			batch := make([]int64, rows)
+			_, n, err := c.ReadBatch(rows, batch, defLvls, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range batch[:n] {
+				read = append(read, v)
+			}
+		case *file.Float64ColumnChunkReader:
+			batch := make([]float64, rows)
+			_, n, err := c.ReadBatch(rows, batch, defLvls, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range batch[:n] {
+				read = append(read, v)
+			}
+		case *file.ByteArrayColumnChunkReader:
+			batch := make([]pq.ByteArray, rows)
+			_, n, err := c.ReadBatch(rows, batch, defLvls, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range batch[:n] {
+				read = append(read, string(v))
+			}
+		default:
+			t.Fatalf("unexpected column reader %T", chunk)
+		}
+		maxDef := chunk.Descriptor().MaxDefinitionLevel()
+		for row := int64(0); row < rows; row++ {
+			if maxDef > 0 && defLvls[row] < maxDef {
+				values = append(values, nil)
+				continue
+			}
+			values, read = append(values, read[0]), read[1:]
+		}
+	}
+	return values
+}
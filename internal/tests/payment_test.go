@@ -0,0 +1,125 @@
+package tests_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/payment"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// profileStore keeps the payment profiles by uid, the failing uid fails
+type profileStore map[string]string
+
+const failingUid = "failing"
+
+func (p profileStore) GetPaymentProfile(uid string) (*mysql.PaymentProfile, error) {
+	if uid == failingUid {
+		return nil, errors.New("connection refused")
+	}
+	provider, ok := p[uid]
+	if !ok {
+		return nil, models.NewError("Payment profile not found for uid "+uid, models.ResourceNotFoundError)
+	}
+	return &mysql.PaymentProfile{Uid: uid, Provider: provider}, nil
+}
+
+type stubProvider struct{}
+
+func (stubProvider) Debit(slots []*mysql.Slot, uid, txnid string) error {
+	return nil
+}
+
+func (stubProvider) Status(txnids []string) ([]*accounting.AccountingStatusResponse, error) {
+	return nil, nil
+}
+
+// breakerProvider is a provider behind a circuit breaker in the state
+type breakerProvider struct {
+	stubProvider
+	state string
+}
+
+func (b *breakerProvider) State() string {
+	return b.state
+}
+
+func TestPaymentRegistry(t *testing.T) {
+	accountingProvider := &breakerProvider{state: accounting.BreakerStateClosed}
+	store := profileStore{"invoiced": payment.ProviderInvoice, "removed": "paypal"}
+	registry := payment.NewRegistry(logrus.New(), store, payment.ProviderWallet)
+	registry.Register(payment.ProviderAccounting, accountingProvider)
+	registry.Register(payment.ProviderWallet, stubProvider{})
+	registry.Register(payment.ProviderInvoice, stubProvider{})
+
+	assert.Equal(t, []string{payment.ProviderAccounting, payment.ProviderInvoice, payment.ProviderWallet}, registry.Names())
+	assert.True(t, registry.Has(payment.ProviderInvoice))
+	assert.False(t, registry.Has("paypal"))
+	_, err := registry.Get("paypal")
+	if assert.IsType(t, &models.Error{}, err) {
+		assert.Equal(t, models.InternalProcessingError, err.(*models.Error).Type)
+	}
+
+	provider, err := registry.ProviderFor(uuid.New().String())
+	assert.Nil(t, err)
+	assert.Equal(t, payment.ProviderWallet, provider, "Expected advertisers without a profile to use the default provider")
+	provider, err = registry.ProviderFor("invoiced")
+	assert.Nil(t, err)
+	assert.Equal(t, payment.ProviderInvoice, provider)
+	_, err = registry.ProviderFor("removed")
+	assert.NotNil(t, err, "Expected a profile of a provider which isn't configured to fail")
+	_, err = registry.ProviderFor(failingUid)
+	assert.NotNil(t, err, "Expected a failing lookup not to fall back to the default provider")
+
+	assert.Equal(t, map[string]string{payment.ProviderAccounting: accounting.BreakerStateClosed}, registry.States())
+	assert.True(t, registry.Available(payment.ProviderAccounting))
+	accountingProvider.state = accounting.BreakerStateOpen
+	assert.False(t, registry.Available(payment.ProviderAccounting))
+	assert.True(t, registry.Available(registry.Default()), "Expected the default wallet to stay available while the accounting circuit is open")
+	accountingProvider.state = accounting.BreakerStateHalfOpen
+	assert.True(t, registry.Available(payment.ProviderAccounting), "Expected a half open circuit to let calls through")
+	assert.False(t, registry.Available("paypal"))
+}
+
+func (r *RepositoryTestSuite) Test_PaymentProfile() {
+	uid := uuid.New().String()
+	_, err := r.repository.GetPaymentProfile(uid)
+	if assert.IsType(r.T(), &models.Error{}, err) {
+		assert.Equal(r.T(), models.ResourceNotFoundError, err.(*models.Error).Type)
+	}
+
+	assert.Nil(r.T(), r.repository.SavePaymentProfile(&mysql.PaymentProfile{Uid: uid, Provider: payment.ProviderWallet}))
+	profile, err := r.repository.GetPaymentProfile(uid)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), payment.ProviderWallet, profile.Provider)
+
+	// saving again replaces the provider
+	assert.Nil(r.T(), r.repository.SavePaymentProfile(&mysql.PaymentProfile{Uid: uid, Provider: payment.ProviderInvoice}))
+	registry := payment.NewRegistry(logrus.New(), r.repository, payment.ProviderAccounting)
+	registry.Register(payment.ProviderInvoice, payment.NewInvoiceProvider(r.repository))
+	provider, err := registry.ProviderFor(uid)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), payment.ProviderInvoice, provider)
+	provider, err = registry.ProviderFor(uuid.New().String())
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), payment.ProviderAccounting, provider)
+}
+
+func (r *RepositoryTestSuite) Test_InvoiceProvider() {
+	uid, txnid := uuid.New().String(), uuid.New().String()
+	invoice := payment.NewInvoiceProvider(r.repository)
+	assert.Nil(r.T(), invoice.Debit(buildCostedSlots(models.SlotStatusHold, 2), uid, txnid))
+
+	statuses, err := invoice.Status([]string{txnid, uuid.New().String()})
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), statuses, 1) {
+		assert.Equal(r.T(), txnid, statuses[0].Txnid)
+		assert.Equal(r.T(), uid, statuses[0].UID)
+		assert.Equal(r.T(), 20.0, statuses[0].DebitedAmount())
+	}
+}
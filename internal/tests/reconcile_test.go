@@ -0,0 +1,165 @@
+package tests_test
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/core"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/payment"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func (r *RepositoryTestSuite) newReconciler() *core.Reconciler {
+	logger := logrus.New()
+	registry := payment.NewRegistry(logger, r.repository, payment.ProviderWallet)
+	registry.Register(payment.ProviderWallet, payment.NewWalletProvider(r.repository))
+	return core.NewReconciler(core.NewRepository(r.repository), registry, logger)
+}
+
+// reconcile runs the reconciliation over the days the factories date slots on
+func (r *RepositoryTestSuite) reconcile(repair bool) *api.ReconciliationReport {
+	now := time.Now()
+	report, err := r.newReconciler().Run(now, now.AddDate(0, 0, 8), repair)
+	assert.Nil(r.T(), err, "Failed to reconcile")
+	return report
+}
+
+// bookWithWallet creates the open slots and books them for the advertiser
+// under txnid, paid from the wallet
+func (r *RepositoryTestSuite) bookWithWallet(slots []*mysql.Slot, uid, txnid string) {
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+	txns := make([]*mysql.Transaction, 0, len(slots))
+	for _, slot := range slots {
+		txns = append(txns, &mysql.Transaction{
+			Txnid:     txnid,
+			Placement: slot.Placement,
+			Date:      slot.Date,
+			Position:  slot.Position,
+			Provider:  models.PtrString(payment.ProviderWallet),
+		})
+	}
+	_, err = r.repository.Create(txns)
+	assert.Nil(r.T(), err, "Failed to hold slots")
+	_, err = r.repository.TopUpWallet(uid, 100)
+	assert.Nil(r.T(), err, "Failed to top up wallet")
+	assert.Nil(r.T(), r.repository.DebitWalletAndBook(slots, uid, txnid), "Failed to debit and book")
+}
+
+func (r *RepositoryTestSuite) findSlot(slot *mysql.Slot) *mysql.Slot {
+	found, err := r.repository.SearchSlotsInRange(&mysql.GetOptions{Start: slot.Date, PositionStart: models.Int32ToString(*slot.Position), PositionEnd: models.Int32ToString(*slot.Position)})
+	assert.Nil(r.T(), err)
+	if !assert.Len(r.T(), found, 1) {
+		r.T().FailNow()
+	}
+	return found[0]
+}
+
+func (r *RepositoryTestSuite) Test_ReconcileBalanced() {
+	r.bookWithWallet(buildCostedSlots(models.SlotStatusOpen, 2), uuid.New().String(), uuid.New().String())
+
+	report := r.reconcile(false)
+	assert.Equal(r.T(), 2, report.SlotsChecked)
+	assert.Equal(r.T(), 1, report.Transactions)
+	assert.Empty(r.T(), report.Mismatches)
+}
+
+func (r *RepositoryTestSuite) Test_ReconcileMissingDebit() {
+	slot := buildCostedSlots(models.SlotStatusBooked, 1)[0]
+	slot.BookedBy = models.PtrString(uuid.New().String())
+	_, err := r.repository.Create(slot)
+	assert.Nil(r.T(), err, "Failed to create slot")
+
+	report := r.reconcile(true)
+	if assert.Len(r.T(), report.Mismatches, 1) {
+		assert.Equal(r.T(), models.MismatchMissingDebit, report.Mismatches[0].Type)
+		assert.True(r.T(), report.Mismatches[0].Repaired)
+	}
+	assert.Equal(r.T(), models.SlotStatusOpen, *r.findSlot(slot).Status, "Expected the unpaid slot to be opened")
+}
+
+func (r *RepositoryTestSuite) Test_ReconcileOrphanDebit() {
+	uid, txnid := uuid.New().String(), uuid.New().String()
+	slot := buildCostedSlots(models.SlotStatusOpen, 1)[0]
+	_, err := r.repository.Create(slot)
+	assert.Nil(r.T(), err, "Failed to create slot")
+	_, err = r.repository.Create(&mysql.Transaction{Txnid: txnid, Placement: slot.Placement, Date: slot.Date, Position: slot.Position, Provider: models.PtrString(payment.ProviderWallet)})
+	assert.Nil(r.T(), err, "Failed to hold slot")
+	_, err = r.repository.TopUpWallet(uid, 100)
+	assert.Nil(r.T(), err, "Failed to top up wallet")
+	// the debit went through but the slot wasn't booked
+	assert.Nil(r.T(), r.repository.DebitWallet(uid, txnid, 10))
+	assert.Nil(r.T(), r.repository.UpdateSlotsStatus([]*mysql.Slot{slot}, models.SlotStatusHold, models.SlotStatusOpen))
+
+	report := r.reconcile(true)
+	if assert.Len(r.T(), report.Mismatches, 1) {
+		m := report.Mismatches[0]
+		assert.Equal(r.T(), models.MismatchOrphanDebit, m.Type)
+		assert.Equal(r.T(), txnid, m.Txnid)
+		assert.Equal(r.T(), uid, m.DebitedBy)
+		assert.True(r.T(), m.Repaired)
+	}
+	found := r.findSlot(slot)
+	assert.Equal(r.T(), models.SlotStatusBooked, *found.Status, "Expected the paid slot to be booked")
+	assert.Equal(r.T(), uid, models.StringValue(found.BookedBy))
+}
+
+func (r *RepositoryTestSuite) Test_ReconcileReleasedOrphanDebit() {
+	uid, txnid := uuid.New().String(), uuid.New().String()
+	slots := buildCostedSlots(models.SlotStatusOpen, 2)
+	r.bookWithWallet(slots[:1], uid, txnid)
+	// a refunded release leaves no debit behind
+	refunded := uuid.New().String()
+	r.bookWithWallet(slots[1:], uid, refunded)
+	assert.Nil(r.T(), r.repository.RefundWalletAndRelease(slots[1:], uid, refunded), "Failed to refund")
+
+	_, err := r.repository.ReleaseSlots(slots[:1])
+	assert.Nil(r.T(), err, "Failed to release slot")
+
+	report := r.reconcile(true)
+	assert.Equal(r.T(), 2, report.Transactions)
+	if assert.Len(r.T(), report.Mismatches, 1) {
+		m := report.Mismatches[0]
+		assert.Equal(r.T(), models.MismatchOrphanDebit, m.Type)
+		assert.Equal(r.T(), txnid, m.Txnid)
+		assert.Equal(r.T(), uid, m.DebitedBy)
+		assert.Equal(r.T(), 10.0, m.DebitAmount)
+		assert.False(r.T(), m.Repaired, "Expected a released slot not to be booked again")
+	}
+	assert.Equal(r.T(), models.SlotStatusOpen, *r.findSlot(slots[0]).Status)
+}
+
+func (r *RepositoryTestSuite) Test_ReconcileBookedByMismatch() {
+	uid := uuid.New().String()
+	slot := buildCostedSlots(models.SlotStatusOpen, 1)[0]
+	r.bookWithWallet([]*mysql.Slot{slot}, uid, uuid.New().String())
+	_, err := r.repository.UpdateSlots([]*mysql.Slot{{Placement: slot.Placement, Date: slot.Date, Position: slot.Position, BookedBy: models.PtrString(uuid.New().String())}})
+	assert.Nil(r.T(), err, "Failed to update slot")
+
+	report := r.reconcile(true)
+	if assert.Len(r.T(), report.Mismatches, 1) {
+		assert.Equal(r.T(), models.MismatchBookedByMismatch, report.Mismatches[0].Type)
+		assert.True(r.T(), report.Mismatches[0].Repaired)
+	}
+	assert.Equal(r.T(), uid, models.StringValue(r.findSlot(slot).BookedBy), "Expected the slot to be booked for the payer")
+}
+
+func (r *RepositoryTestSuite) Test_ReconcileAmountMismatch() {
+	slots := buildCostedSlots(models.SlotStatusOpen, 2)
+	r.bookWithWallet(slots, uuid.New().String(), uuid.New().String())
+	_, err := r.repository.UpdateSlots([]*mysql.Slot{{Placement: slots[0].Placement, Date: slots[0].Date, Position: slots[0].Position, Cost: models.PtrFloat(15)}})
+	assert.Nil(r.T(), err, "Failed to update slot")
+
+	report := r.reconcile(true)
+	if assert.Len(r.T(), report.Mismatches, 1) {
+		m := report.Mismatches[0]
+		assert.Equal(r.T(), models.MismatchAmount, m.Type)
+		assert.Equal(r.T(), 25.0, m.SlotAmount)
+		assert.Equal(r.T(), 20.0, m.DebitAmount)
+		assert.False(r.T(), m.Repaired, "Expected amount mismatches only to be reported")
+	}
+}
@@ -2,7 +2,12 @@ package tests_test
 
 import (
 	"fmt"
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/core"
 	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/payment"
 	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -140,6 +145,858 @@ func (r *RepositoryTestSuite) Test_Search() {
 	assert.Empty(r.T(), slotRes)
 }
 
+func (r *RepositoryTestSuite) Test_Hold() {
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(2).Build()
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+
+	hold := &mysql.Hold{
+		ID:        uuid.New().String(),
+		Uid:       uuid.New().String(),
+		Status:    models.HoldStatusActive,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	var transactions []*mysql.Transaction
+	for _, slot := range slots {
+		transactions = append(transactions, &mysql.Transaction{Txnid: hold.ID, Placement: slot.Placement, Date: slot.Date, Position: slot.Position})
+	}
+	err = r.repository.CreateHold(hold, transactions)
+	assert.Nil(r.T(), err, "Expected to hold open slots")
+	held, err := r.repository.SlotsByTxnid(hold.ID)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), held, len(slots))
+	for _, slot := range held {
+		assert.Equal(r.T(), models.SlotStatusHold, *slot.Status)
+	}
+
+	// Test holding slots which are already on hold
+	other := &mysql.Hold{ID: uuid.New().String(), Uid: hold.Uid, Status: models.HoldStatusActive, ExpiresAt: time.Now()}
+	err = r.repository.CreateHold(other, []*mysql.Transaction{{Txnid: other.ID, Placement: slots[0].Placement, Date: slots[0].Date, Position: slots[0].Position}})
+	assert.Error(r.T(), err, "Expected held slot not to be held again")
+
+	expired, err := r.repository.ExpiredHolds(time.Now(), time.Now())
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), expired, 1)
+	released, err := r.repository.ReleaseHold(hold.ID, models.HoldStatusExpired)
+	assert.Nil(r.T(), err)
+	assert.True(r.T(), released, "Expected active hold to be released")
+	released, err = r.repository.ReleaseHold(hold.ID, models.HoldStatusReleased)
+	assert.Nil(r.T(), err)
+	assert.False(r.T(), released, "Expected expired hold not to be released again")
+
+	opened, err := r.repository.SearchSlotsInRange(&mysql.GetOptions{
+		StartDate: *slots[0].Date,
+		EndDate:   *slots[0].Date,
+		Status:    models.SlotStatusOpen,
+	})
+	assert.Nil(r.T(), err)
+	assert.NotEmpty(r.T(), opened, "Expected released slots to be open")
+}
+
+func (r *RepositoryTestSuite) Test_HoldConfirming() {
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(1).Build()
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+	hold := &mysql.Hold{ID: uuid.New().String(), Uid: uuid.New().String(), Status: models.HoldStatusActive, ExpiresAt: time.Now().Add(time.Hour)}
+	err = r.repository.CreateHold(hold, []*mysql.Transaction{{Txnid: hold.ID, Placement: slots[0].Placement, Date: slots[0].Date, Position: slots[0].Position}})
+	assert.Nil(r.T(), err, "Expected to hold open slots")
+	ok, err := r.repository.UpdateHoldStatus(hold.ID, models.HoldStatusActive, models.HoldStatusConfirming)
+	assert.Nil(r.T(), err)
+	assert.True(r.T(), ok)
+
+	// a confirming hold expires only once its confirmation is stale
+	expired, err := r.repository.ExpiredHolds(time.Now(), time.Now().Add(-time.Minute))
+	assert.Nil(r.T(), err)
+	assert.Empty(r.T(), expired, "Expected a hold being confirmed not to expire")
+	expired, err = r.repository.ExpiredHolds(time.Now(), time.Now().Add(time.Minute))
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), expired, 1) {
+		assert.Equal(r.T(), hold.ID, expired[0].ID)
+		assert.Equal(r.T(), models.HoldStatusConfirming, expired[0].Status)
+	}
+}
+
+func (r *RepositoryTestSuite) Test_HoldOwner() {
+	uid := uuid.New().String()
+	slot := waitlistSlot()
+	_, err := r.repository.Create(slot)
+	assert.Nil(r.T(), err, "Failed to create slot")
+	svc := r.newService(&recordingPublisher{})
+	request := []*api.ReserveSlotRequestBody{{Placement: slot.Placement, Date: models.JSONDate(*slot.Date), Position: slot.Position}}
+	hold, err := svc.CreateHold(request, uid)
+	if !assert.Nil(r.T(), err, "Failed to create hold") {
+		return
+	}
+
+	_, err = svc.ConfirmHold(hold.HoldId, uuid.New().String())
+	if assert.IsType(r.T(), &models.Error{}, err, "Expected a hold not to be confirmed by another user") {
+		assert.Equal(r.T(), models.ActionForbidden, err.(*models.Error).Type)
+	}
+	err = svc.ReleaseHold(hold.HoldId, uuid.New().String())
+	if assert.IsType(r.T(), &models.Error{}, err, "Expected a hold not to be released by another user") {
+		assert.Equal(r.T(), models.ActionForbidden, err.(*models.Error).Type)
+	}
+	assert.Nil(r.T(), svc.ReleaseHold(hold.HoldId, uid), "Failed to release the hold")
+}
+
+// failingProvider fails every debit with its error
+type failingProvider struct {
+	stubProvider
+	err error
+}
+
+func (f failingProvider) Debit(slots []*mysql.Slot, uid, txnid string) error {
+	return f.err
+}
+
+func (r *RepositoryTestSuite) Test_HoldConfirmFailedDebit() {
+	uid := uuid.New().String()
+	logger := logrus.New()
+	registry := payment.NewRegistry(logger, r.repository, payment.ProviderAccounting)
+	svc := core.NewService(core.NewRepository(r.repository), registry, core.Config{Events: &recordingPublisher{}}, logger)
+	confirm := func(err error) *mysql.Hold {
+		registry.Register(payment.ProviderAccounting, failingProvider{err: err})
+		slot := waitlistSlot()
+		_, cErr := r.repository.Create(slot)
+		assert.Nil(r.T(), cErr, "Failed to create slot")
+		hold, cErr := svc.CreateHold([]*api.ReserveSlotRequestBody{{Placement: slot.Placement, Date: models.JSONDate(*slot.Date), Position: slot.Position}}, uid)
+		if !assert.Nil(r.T(), cErr, "Failed to create hold") {
+			r.T().FailNow()
+		}
+		_, cErr = svc.ConfirmHold(hold.HoldId, uid)
+		assert.Equal(r.T(), err, cErr)
+		stored, cErr := r.repository.GetHold(hold.HoldId)
+		assert.Nil(r.T(), cErr)
+		return stored
+	}
+
+	timeout := models.NewError("Accounting request /debit failed", models.DependentServiceRequestFailed)
+	assert.Equal(r.T(), models.HoldStatusConfirming, confirm(timeout).Status, "Expected a debit which may have been taken to leave the hold to be settled")
+	assert.Equal(r.T(), models.HoldStatusActive, confirm(accounting.ErrCircuitOpen).Status, "Expected a debit which was not sent to reactivate the hold")
+	rejected := models.NewError("Debit transaction failed", models.InternalProcessingError)
+	assert.Equal(r.T(), models.HoldStatusActive, confirm(rejected).Status, "Expected a rejected debit to reactivate the hold")
+}
+
+func (r *RepositoryTestSuite) Test_CartOwner() {
+	uid, other := uuid.New().String(), uuid.New().String()
+	slot := waitlistSlot()
+	_, err := r.repository.Create(slot)
+	assert.Nil(r.T(), err, "Failed to create slot")
+	svc := r.newService(&recordingPublisher{})
+	request := []*api.ReserveSlotRequestBody{{Placement: slot.Placement, Date: models.JSONDate(*slot.Date), Position: slot.Position}}
+	cart, err := svc.CreateCart(request, uid)
+	if !assert.Nil(r.T(), err, "Failed to create cart") {
+		return
+	}
+
+	forbidden := func(err error, msg string) {
+		if assert.IsType(r.T(), &models.Error{}, err, msg) {
+			assert.Equal(r.T(), models.ActionForbidden, err.(*models.Error).Type)
+		}
+	}
+	_, err = svc.GetCart(cart.CartId, other)
+	forbidden(err, "Expected the cart not to be read by another user")
+	_, err = svc.ValidateCart(cart.CartId, other)
+	forbidden(err, "Expected the cart not to be validated by another user")
+	_, err = svc.AddCartItems(cart.CartId, other, request)
+	forbidden(err, "Expected the cart not to be changed by another user")
+	_, err = svc.RemoveCartItems(cart.CartId, other, request)
+	forbidden(err, "Expected the cart not to be changed by another user")
+	_, err = svc.CheckoutCart(cart.CartId, other, false)
+	forbidden(err, "Expected the cart not to be checked out by another user")
+
+	owned, err := svc.GetCart(cart.CartId, uid)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), owned.Items, 1)
+}
+
+func (r *RepositoryTestSuite) Test_CartValidateWindows() {
+	uid := uuid.New().String()
+	// only the second hour of the day is a slot
+	slot := waitlistSlot()
+	day := *slot.Date
+	slot.Date = models.PtrDate(day.Add(time.Hour))
+	slot.EndsAt = models.PtrDate(day.Add(2 * time.Hour))
+	_, err := r.repository.Create(slot)
+	assert.Nil(r.T(), err, "Failed to create slot")
+	svc := r.newService(&recordingPublisher{})
+	cart, err := svc.CreateCart([]*api.ReserveSlotRequestBody{
+		{Placement: slot.Placement, Date: models.JSONDate(day), Position: slot.Position},
+		{Placement: slot.Placement, Date: models.JSONDate(*slot.Date), Position: slot.Position},
+	}, uid)
+	if !assert.Nil(r.T(), err, "Failed to create cart") {
+		return
+	}
+
+	validation, err := svc.ValidateCart(cart.CartId, uid)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), validation.Items, 2) {
+		assert.Equal(r.T(), models.ItemNotFound, validation.Items[0].Availability, "Expected the whole day not to match the window of an hour")
+		assert.Equal(r.T(), models.ItemAvailable, validation.Items[1].Availability)
+	}
+}
+
+func (r *RepositoryTestSuite) Test_Cart() {
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(2).Build()
+	cart := &mysql.Cart{ID: uuid.New().String(), Uid: uuid.New().String(), Status: models.CartStatusOpen}
+	err := r.repository.CreateCart(cart, nil)
+	assert.Nil(r.T(), err, "Failed to create cart")
+
+	var items []*mysql.CartItem
+	for _, slot := range slots {
+		items = append(items, &mysql.CartItem{CartID: cart.ID, Placement: slot.Placement, Date: slot.Date, Position: slot.Position})
+	}
+	err = r.repository.AddCartItems(items)
+	assert.Nil(r.T(), err, "Failed to add cart items")
+	// Test adding items which are already in the cart
+	err = r.repository.AddCartItems(items[:1])
+	assert.Nil(r.T(), err, "Expected duplicate cart items to be ignored")
+	saved, err := r.repository.GetCart(cart.ID)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), saved.Items, len(items))
+
+	removed, err := r.repository.RemoveCartItems(items[:1])
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 1, removed)
+
+	ok, err := r.repository.UpdateCartStatus(cart.ID, models.CartStatusOpen, models.CartStatusCheckedOut)
+	assert.Nil(r.T(), err)
+	assert.True(r.T(), ok, "Expected open cart to be checked out")
+	ok, err = r.repository.UpdateCartStatus(cart.ID, models.CartStatusOpen, models.CartStatusCheckedOut)
+	assert.Nil(r.T(), err)
+	assert.False(r.T(), ok, "Expected cart not to be checked out twice")
+
+	// the cart is created with its items or not at all
+	withItems := &mysql.Cart{ID: uuid.New().String(), Uid: cart.Uid, Status: models.CartStatusOpen}
+	first := &mysql.CartItem{CartID: withItems.ID, Placement: slots[0].Placement, Date: slots[0].Date, Position: slots[0].Position}
+	assert.Nil(r.T(), r.repository.CreateCart(withItems, []*mysql.CartItem{first}), "Failed to create cart with items")
+	saved, err = r.repository.GetCart(withItems.ID)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), saved.Items, 1)
+	failed := &mysql.Cart{ID: uuid.New().String(), Uid: cart.Uid, Status: models.CartStatusOpen}
+	err = r.repository.CreateCart(failed, []*mysql.CartItem{{CartID: failed.ID, Placement: slots[0].Placement, Date: slots[0].Date}})
+	assert.Error(r.T(), err, "Expected an item without position to fail the cart")
+	_, err = r.repository.GetCart(failed.ID)
+	if assert.IsType(r.T(), &models.Error{}, err, "Expected no cart left behind by failed items") {
+		assert.Equal(r.T(), models.ResourceNotFoundError, err.(*models.Error).Type)
+	}
+}
+
+func (r *RepositoryTestSuite) Test_Auction() {
+	slotF := SlotFactory{}
+	slot := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(1).Build()[0]
+	_, err := r.repository.Create(slot)
+	assert.Nil(r.T(), err, "Failed to create slots")
+
+	auction := &mysql.Auction{
+		ID:           uuid.New().String(),
+		Date:         slot.Date,
+		Position:     slot.Position,
+		ReservePrice: 10,
+		Pricing:      models.AuctionPricingSecond,
+		Status:       models.AuctionStatusOpen,
+		ClosesAt:     time.Now().Add(-time.Minute),
+	}
+	err = r.repository.CreateAuctions([]*mysql.Auction{auction})
+	assert.Nil(r.T(), err, "Expected to auction open slot")
+	assert.Equal(r.T(), *slot.Cost, auction.SlotCost)
+
+	// Test bidding again replaces the earlier bid
+	uid := uuid.New().String()
+	for _, amount := range []float64{20, 30} {
+		_, err = r.repository.SaveBid(&mysql.Bid{ID: uuid.New().String(), AuctionID: auction.ID, Uid: uid, Amount: amount, Status: models.BidStatusActive})
+		assert.Nil(r.T(), err)
+	}
+	_, err = r.repository.SaveBid(&mysql.Bid{ID: uuid.New().String(), AuctionID: auction.ID, Uid: uuid.New().String(), Amount: 25, Status: models.BidStatusActive})
+	assert.Nil(r.T(), err)
+	bids, err := r.repository.AuctionBids(auction.ID)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), bids, 2) {
+		assert.Equal(r.T(), uid, bids[0].Uid, "Expected highest bid first")
+		assert.Equal(r.T(), 30.0, bids[0].Amount)
+	}
+
+	closed, err := r.repository.ClosedAuctions(time.Now())
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), closed, 1)
+	auction.Status = models.AuctionStatusUnsold
+	err = r.repository.FinishAuction(auction)
+	assert.Nil(r.T(), err)
+	opened, err := r.repository.SearchSlotsInRange(&mysql.GetOptions{
+		StartDate: *slot.Date,
+		EndDate:   *slot.Date,
+		Status:    models.SlotStatusOpen,
+	})
+	assert.Nil(r.T(), err)
+	assert.NotEmpty(r.T(), opened, "Expected slot of unsold auction to be open")
+}
+
+func (r *RepositoryTestSuite) Test_CloseAuctions() {
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(2).Build()
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+	var auctions []*mysql.Auction
+	for _, slot := range slots {
+		auctions = append(auctions, &mysql.Auction{
+			ID:           uuid.New().String(),
+			Date:         slot.Date,
+			Position:     slot.Position,
+			ReservePrice: 10,
+			Pricing:      models.AuctionPricingFirst,
+			Status:       models.AuctionStatusOpen,
+			ClosesAt:     time.Now().Add(-time.Minute),
+		})
+	}
+	assert.Nil(r.T(), r.repository.CreateAuctions(auctions), "Expected to auction open slots")
+
+	// the bidder of the first auction pays through a provider which isn't configured
+	broken, uid := uuid.New().String(), uuid.New().String()
+	assert.Nil(r.T(), r.repository.SavePaymentProfile(&mysql.PaymentProfile{Uid: broken, Provider: "paypal"}))
+	_, err = r.repository.SaveBid(&mysql.Bid{ID: uuid.New().String(), AuctionID: auctions[0].ID, Uid: broken, Amount: 20, Status: models.BidStatusActive})
+	assert.Nil(r.T(), err)
+	_, err = r.repository.TopUpWallet(uid, 100)
+	assert.Nil(r.T(), err, "Failed to top up wallet")
+	_, err = r.repository.SaveBid(&mysql.Bid{ID: uuid.New().String(), AuctionID: auctions[1].ID, Uid: uid, Amount: 20, Status: models.BidStatusActive})
+	assert.Nil(r.T(), err)
+
+	closed, err := r.newService(&recordingPublisher{}).CloseAuctions()
+	assert.Equal(r.T(), 1, closed, "Expected a failing auction not to keep the others open")
+	if assert.Error(r.T(), err) {
+		assert.Contains(r.T(), err.Error(), auctions[0].ID)
+	}
+	open, err := r.repository.ClosedAuctions(time.Now())
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), open, 1) {
+		assert.Equal(r.T(), auctions[0].ID, open[0].ID, "Expected the failed auction to be retried on the next run")
+	}
+}
+
+func (r *RepositoryTestSuite) Test_Template() {
+	template := &mysql.InventoryTemplate{
+		ID:     uuid.New().String(),
+		Name:   "weekdays",
+		Active: true,
+		Rules:  []*mysql.TemplateRule{{Weekdays: "mon,tue", PositionStart: 1, PositionEnd: 3, Cost: 10}},
+	}
+	err := r.repository.CreateTemplate(template)
+	assert.Nil(r.T(), err, "Failed to create template")
+	template.Active = false
+	template.Rules = []*mysql.TemplateRule{{Weekdays: "sat", PositionStart: 1, PositionEnd: 2, Cost: 20}}
+	err = r.repository.UpdateTemplate(template)
+	assert.Nil(r.T(), err, "Failed to update template")
+	active, err := r.repository.Templates(true)
+	assert.Nil(r.T(), err)
+	assert.Empty(r.T(), active, "Expected inactive template to be left out")
+	saved, err := r.repository.GetTemplate(template.ID)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), saved.Rules, 1) {
+		assert.Equal(r.T(), "sat", saved.Rules[0].Weekdays)
+	}
+
+	// Test creating slots which partly exist already
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(2).Build()
+	_, err = r.repository.Create(slots[:1])
+	assert.Nil(r.T(), err, "Failed to create slots")
+	created, err := r.repository.CreateMissingSlots(slots)
+	assert.Nil(r.T(), err, "Expected existing slots to be skipped")
+	assert.Equal(r.T(), 1, created)
+}
+
+func (r *RepositoryTestSuite) Test_Calendar() {
+	date, _ := time.Parse(time.DateOnly, "2030-12-25")
+	err := r.repository.SaveCalendarDays([]*mysql.CalendarDay{{Date: models.PtrDate(date), Kind: models.CalendarBlackout}})
+	assert.Nil(r.T(), err, "Failed to save calendar day")
+	err = r.repository.SaveCalendarDays([]*mysql.CalendarDay{{Date: models.PtrDate(date), Kind: models.CalendarHoliday, Uplift: 25}})
+	assert.Nil(r.T(), err, "Expected the calendar day to be replaced")
+	days, err := r.repository.CalendarDays(date, date, models.CalendarHoliday)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), days, 1) {
+		assert.Equal(r.T(), 25.0, days[0].Uplift)
+	}
+	deleted, err := r.repository.DeleteCalendarDay(date)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 1, deleted)
+}
+
+func (r *RepositoryTestSuite) Test_Placement() {
+	placement := &mysql.Placement{ID: "newsletter", Name: "Newsletter", MaxPositions: 2}
+	_, err := r.repository.Create(placement)
+	assert.Nil(r.T(), err, "Failed to create placement")
+
+	// the same date and position in two placements are different slots
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(1).Build()
+	other := *slots[0]
+	other.Placement = placement.ID
+	_, err = r.repository.Create([]*mysql.Slot{slots[0], &other})
+	assert.Nil(r.T(), err, "Failed to create slots of two placements")
+	found, err := r.repository.SearchSlotsInRange(&mysql.GetOptions{
+		Placement: placement.ID,
+		StartDate: *slots[0].Date,
+		EndDate:   *slots[0].Date,
+	})
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), found, 1) {
+		assert.Equal(r.T(), placement.ID, found[0].Placement)
+	}
+	maxPos, err := r.repository.MaxPosition(placement.ID)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), *slots[0].Position, maxPos)
+
+	placement.MaxPositions = 4
+	err = r.repository.UpdatePlacement(placement)
+	assert.Nil(r.T(), err, "Failed to update placement")
+	saved, err := r.repository.GetPlacement(placement.ID)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), int32(4), saved.MaxPositions)
+}
+
+func (r *RepositoryTestSuite) Test_SlotWindows() {
+	placement := &mysql.Placement{
+		ID: "radio", Name: "Radio", Granularity: models.GranularityDayPart,
+		DayParts: []*mysql.DayPart{{Name: "morning", Start: "06:00", End: "10:00"}},
+	}
+	_, err := r.repository.Create(placement)
+	assert.Nil(r.T(), err, "Failed to create placement with day parts")
+	placement.DayParts = []*mysql.DayPart{{Name: "morning", Start: "06:00", End: "10:00"}, {Name: "night", Start: "22:00", End: "02:00"}}
+	err = r.repository.UpdatePlacement(placement)
+	assert.Nil(r.T(), err, "Failed to replace day parts")
+	saved, err := r.repository.GetPlacement(placement.ID)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), saved.DayParts, 2)
+
+	// the slots of the hours of a day are separate slots
+	day := time.Now().AddDate(0, 0, 1)
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+	var slots []*mysql.Slot
+	for h := 0; h < 3; h++ {
+		start := day.Add(time.Duration(h) * time.Hour)
+		slots = append(slots, &mysql.Slot{
+			Placement: placement.ID,
+			Date:      models.PtrDate(start),
+			EndsAt:    models.PtrDate(start.Add(time.Hour)),
+			Position:  models.PtrInt(1),
+			Cost:      models.PtrFloat(10),
+			Status:    models.PtrString(models.SlotStatusOpen),
+		})
+	}
+	_, err = r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create hourly slots")
+	found, err := r.repository.SearchSlotsInRange(&mysql.GetOptions{Placement: placement.ID, StartDate: day, EndDate: day})
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), found, 3, "Expected a date to include all the hours of the day")
+	found, err = r.repository.SearchSlotsInRange(&mysql.GetOptions{Placement: placement.ID, Start: &day})
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), found, 1, "Expected a start to match only the first hour") {
+		assert.True(r.T(), found[0].EndsAt.Equal(day.Add(time.Hour)))
+	}
+}
+
+func (r *RepositoryTestSuite) Test_Campaign() {
+	advertiser := &mysql.Advertiser{ID: uuid.New().String(), Name: "Acme"}
+	_, err := r.repository.Create(advertiser)
+	assert.Nil(r.T(), err, "Failed to create advertiser")
+	campaign := &mysql.Campaign{ID: uuid.New().String(), AdvertiserID: advertiser.ID, Name: "Launch", Status: models.CampaignStatusActive}
+	_, err = r.repository.Create(campaign)
+	assert.Nil(r.T(), err, "Failed to create campaign")
+
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(2).Build()
+	_, err = r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+	campaign.Budget = *slots[0].Cost
+	err = r.repository.UpdateCampaign(campaign)
+	assert.Nil(r.T(), err, "Failed to update campaign")
+
+	reserve := func(slot *mysql.Slot) error {
+		return r.repository.CreateTransactions(
+			[]*mysql.Transaction{{Placement: slot.Placement, Date: slot.Date, Position: slot.Position, CampaignID: models.PtrString(campaign.ID)}},
+			map[string]float64{campaign.ID: *slot.Cost},
+		)
+	}
+	err = reserve(slots[0])
+	assert.Nil(r.T(), err, "Expected the budget to cover the first slot")
+	err = reserve(slots[1])
+	assert.Error(r.T(), err, "Expected the exhausted budget to refuse the second slot")
+
+	spend, err := r.repository.CampaignSpend(campaign.ID)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), *slots[0].Cost, spend[campaign.ID])
+	found, err := r.repository.SearchSlotsInRange(&mysql.GetOptions{
+		StartDate:  time.Now(),
+		EndDate:    time.Now().AddDate(0, 0, 7),
+		CampaignID: campaign.ID,
+	})
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), found, 1) {
+		assert.Equal(r.T(), *slots[0].Position, *found[0].Position)
+	}
+}
+
+func (r *RepositoryTestSuite) Test_Creative() {
+	uid := uuid.New().String()
+	creative := &mysql.Creative{ID: uuid.New().String(), AdvertiserID: uid, Name: "Banner", Format: models.CreativeFormatPNG, Size: 68, BlobKey: "creatives/banner", Status: models.CreativeStatusPending}
+	_, err := r.repository.Create(creative)
+	assert.Nil(r.T(), err, "Failed to create creative")
+
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusBooked}).WithInstances(1).Build()
+	slots[0].BookedBy = models.PtrString(uid)
+	_, err = r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+
+	err = r.repository.AttachCreatives(slots, uid, []*string{models.PtrString(creative.ID)})
+	assert.Nil(r.T(), err, "Failed to attach creative")
+	used, err := r.repository.CreativeUsage(creative.ID)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), int64(1), used)
+	_, err = r.repository.DeleteCreative(creative.ID)
+	if assert.IsType(r.T(), &models.Error{}, err, "Expected an attached creative not to be deleted") {
+		assert.Equal(r.T(), models.ActionForbidden, err.(*models.Error).Type)
+	}
+	err = r.repository.AttachCreatives(slots, uuid.New().String(), []*string{nil})
+	if assert.IsType(r.T(), &models.Error{}, err, "Expected the slot of another advertiser to be refused") {
+		assert.Equal(r.T(), models.ActionForbidden, err.(*models.Error).Type)
+	}
+
+	_, err = r.repository.ReleaseSlots(slots)
+	assert.Nil(r.T(), err, "Failed to release slots")
+	used, err = r.repository.CreativeUsage(creative.ID)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), int64(0), used, "Expected releasing the slot to detach the creative")
+
+	creative.Status = models.CreativeStatusApproved
+	reviewed, err := r.repository.ReviewCreative(creative, models.CreativeStatusPending)
+	assert.Nil(r.T(), err)
+	assert.True(r.T(), reviewed, "Failed to approve pending creative")
+	reviewed, err = r.repository.ReviewCreative(creative, models.CreativeStatusPending)
+	assert.Nil(r.T(), err)
+	assert.False(r.T(), reviewed, "Expected a reviewed creative not to be pending anymore")
+
+	creatives, err := r.repository.Creatives(uid, models.CreativeStatusApproved)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), creatives, 1)
+	deleted, err := r.repository.DeleteCreative(creative.ID)
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 1, deleted)
+}
+
+func (r *RepositoryTestSuite) Test_ChangeNotifier() {
+	changes := make(chan string, 10)
+	r.repository.OnChange(func(tenant string) { changes <- tenant })
+
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(1).Build()
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+	assert.Len(r.T(), changes, 1, "Expected creating slots to notify the listeners")
+
+	_, err = r.repository.WalletStatement(uuid.New().String(), time.Now(), time.Now())
+	assert.Nil(r.T(), err)
+	_, err = r.repository.TopUpWallet(uuid.New().String(), 10)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), changes, 1, "Expected only changes of slots, creatives and placements to notify")
+
+	slot := slots[0]
+	closed := models.PtrString(models.SlotStatusClosed)
+	_, err = r.repository.UpdateSlots([]*mysql.Slot{
+		{Placement: slot.Placement, Date: slot.Date, Position: slot.Position, Status: closed},
+		{Placement: slot.Placement, Date: slot.Date, Position: models.PtrInt(99), Status: closed},
+	})
+	assert.NotNil(r.T(), err, "Expected the update of a missing slot to fail")
+	assert.Len(r.T(), changes, 1, "Expected the changes of a rolled back transaction not to notify")
+
+	// the listeners are called once the changes are committed
+	seen := make(chan string, 10)
+	r.repository.OnChange(func(tenant string) {
+		found, err := r.repository.SearchSlotsInRange(&mysql.GetOptions{Start: slot.Date})
+		if err == nil && len(found) == 1 {
+			seen <- *found[0].Status
+		}
+	})
+	_, err = r.repository.UpdateSlots([]*mysql.Slot{{Placement: slot.Placement, Date: slot.Date, Position: slot.Position, Status: closed}})
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), changes, 2)
+	if assert.Len(r.T(), seen, 1) {
+		assert.Equal(r.T(), models.SlotStatusClosed, <-seen)
+	}
+}
+
+func (r *RepositoryTestSuite) Test_DeliveryStats() {
+	date := models.StartOfDay(time.Now().AddDate(0, 0, 1))
+	stat := func(impressions, clicks int64) []*mysql.DeliveryStat {
+		return []*mysql.DeliveryStat{{
+			Placement:   models.DefaultPlacement,
+			Date:        &date,
+			Position:    models.PtrInt(1),
+			CreativeID:  "creative",
+			Impressions: impressions,
+			Clicks:      clicks,
+		}}
+	}
+	assert.Nil(r.T(), r.repository.AddDeliveryStats(stat(3, 1)))
+	assert.Nil(r.T(), r.repository.AddDeliveryStats(stat(2, 0)))
+
+	stats, err := r.repository.DeliveryStats(models.DefaultPlacement, date, date)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), stats, 1, "Expected the counts of a slot and creative to be added up") {
+		assert.Equal(r.T(), int64(5), stats[0].Impressions)
+		assert.Equal(r.T(), int64(1), stats[0].Clicks)
+	}
+	stats, err = r.repository.DeliveryStats("other", date, date)
+	assert.Nil(r.T(), err)
+	assert.Empty(r.T(), stats)
+}
+
+func (r *RepositoryTestSuite) Test_Reports() {
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(2).Build()
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+	booked := slots[0]
+	err = r.repository.CreateTransactions([]*mysql.Transaction{{Placement: booked.Placement, Date: booked.Date, Position: booked.Position}}, nil)
+	assert.Nil(r.T(), err, "Failed to reserve slot")
+	uid := uuid.New().String()
+	_, err = r.repository.UpdateSlots([]*mysql.Slot{{
+		Placement:  booked.Placement,
+		Date:       booked.Date,
+		Position:   booked.Position,
+		Status:     models.PtrString(models.SlotStatusBooked),
+		BookedBy:   models.PtrString(uid),
+		BookedDate: models.PtrDate(time.Now()),
+	}})
+	assert.Nil(r.T(), err, "Failed to book slot")
+
+	opts := &mysql.ReportOptions{Start: time.Now().AddDate(0, 0, -1), End: time.Now().AddDate(1, 0, 0), GroupBy: models.ReportGroupPosition, Limit: 10}
+	occupancy, err := r.repository.OccupancyReport(opts)
+	assert.Nil(r.T(), err)
+	var total, sold int64
+	for _, row := range occupancy {
+		total += row.Total
+		sold += row.Booked
+	}
+	assert.Equal(r.T(), int64(2), total)
+	assert.Equal(r.T(), int64(1), sold)
+
+	opts.GroupBy = models.ReportGroupMonth
+	revenue, err := r.repository.RevenueReport(opts)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), revenue, 1) {
+		assert.Equal(r.T(), int64(1), revenue[0].Bookings)
+		assert.Equal(r.T(), *booked.Cost, revenue[0].Revenue)
+	}
+	advertisers, err := r.repository.TopAdvertisers(opts)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), advertisers, 1) {
+		assert.Equal(r.T(), uid, advertisers[0].AdvertiserID)
+		assert.Equal(r.T(), *booked.Cost, advertisers[0].Spend)
+	}
+	leadTimes, err := r.repository.LeadTimeReport(opts)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), leadTimes, 1) {
+		assert.Equal(r.T(), int64(1), leadTimes[0].Bookings)
+	}
+}
+
+func (r *RepositoryTestSuite) Test_EachBooking() {
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(2).Build()
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slots")
+	held := slots[0]
+	err = r.repository.CreateTransactions([]*mysql.Transaction{{Placement: held.Placement, Date: held.Date, Position: held.Position}}, nil)
+	assert.Nil(r.T(), err, "Failed to reserve slot")
+
+	opts := &mysql.ExportOptions{Start: time.Now().AddDate(0, 0, -1), End: time.Now().AddDate(1, 0, 0)}
+	var rows []*mysql.BookingRow
+	err = r.repository.EachBooking(opts, func(row *mysql.BookingRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), rows, 2, "Expected the slots without transaction to be exported too")
+	for _, row := range rows {
+		if row.Position == *held.Position && row.Date.Equal(*held.Date) {
+			assert.NotNil(r.T(), row.Txnid, "Expected the transaction of the held slot")
+		}
+	}
+
+	opts.Statuses = []string{models.SlotStatusHold}
+	rows = nil
+	err = r.repository.EachBooking(opts, func(row *mysql.BookingRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), rows, 1) {
+		assert.Equal(r.T(), models.SlotStatusHold, rows[0].Status)
+	}
+}
+
+func (r *RepositoryTestSuite) Test_SlotAudit() {
+	audited := r.repository.WithAudit("operator", "req-1")
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(1).Build()
+	slot := slots[0]
+	_, err := audited.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slot")
+	err = audited.UpdateSlotsStatus([]*mysql.Slot{{Placement: slot.Placement, Date: slot.Date, Position: slot.Position}}, models.SlotStatusOpen, models.SlotStatusClosed)
+	assert.Nil(r.T(), err, "Failed to close slot")
+	_, err = r.repository.Delete([]*mysql.Slot{{Placement: slot.Placement, Date: slot.Date, Position: slot.Position}})
+	assert.Nil(r.T(), err, "Failed to delete slot")
+
+	audits, err := r.repository.SlotAudits(&mysql.SlotAuditOptions{Placement: slot.Placement, Date: slot.Date, Position: slot.Position})
+	assert.Nil(r.T(), err)
+	if !assert.Len(r.T(), audits, 3) {
+		return
+	}
+	// the latest change comes first
+	assert.Equal(r.T(), models.AuditActionDelete, audits[0].Action)
+	assert.Equal(r.T(), models.AuditActorSystem, audits[0].Actor)
+	assert.Contains(r.T(), string(audits[0].After), "deleted_at", "Expected the slot to be marked as deleted")
+	assert.Equal(r.T(), models.AuditActionStatus, audits[1].Action)
+	assert.Equal(r.T(), "req-1", audits[1].RequestID)
+	assert.JSONEq(r.T(), `{"status":"open"}`, string(audits[1].Before), "Expected only the changed fields")
+	assert.JSONEq(r.T(), `{"status":"closed"}`, string(audits[1].After), "Expected only the changed fields")
+	assert.Equal(r.T(), models.AuditActionCreate, audits[2].Action)
+	assert.Nil(r.T(), audits[2].Before)
+
+	audits, err = r.repository.SlotAudits(&mysql.SlotAuditOptions{Actor: "operator", From: time.Now().Add(-time.Hour)})
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), audits, 2, "Expected the changes of the actor")
+
+	// the audit log is append only
+	_, err = r.repository.Delete(&mysql.SlotAudit{ID: audits[0].ID})
+	assert.NotNil(r.T(), err, "Expected the audit entry to be kept")
+
+	// writes outside of the slot methods are recorded as well
+	other := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(1).Build()[0]
+	otherDate := slot.Date.AddDate(0, 1, 0)
+	other.Date = &otherDate
+	_, err = r.repository.Create([]*mysql.Slot{other})
+	assert.Nil(r.T(), err, "Failed to create slot")
+	_, err = audited.Create(&mysql.Transaction{Placement: other.Placement, Date: other.Date, Position: other.Position})
+	assert.Nil(r.T(), err, "Failed to reserve slot")
+	audits, err = r.repository.SlotAudits(&mysql.SlotAuditOptions{Placement: other.Placement, Date: other.Date, Position: other.Position})
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), audits, 2) {
+		assert.Equal(r.T(), models.AuditActionStatus, audits[0].Action)
+		assert.Equal(r.T(), "operator", audits[0].Actor)
+		assert.JSONEq(r.T(), `{"status":"hold"}`, string(audits[0].After))
+	}
+}
+
+func (r *RepositoryTestSuite) Test_SoftDeleteSlots() {
+	audited := r.repository.WithAudit("operator", "req-1")
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(1).Build()
+	slot := slots[0]
+	key := func() []*mysql.Slot {
+		return []*mysql.Slot{{Placement: slot.Placement, Date: slot.Date, Position: slot.Position}}
+	}
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slot")
+	deleted, err := audited.Delete(key())
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 1, deleted)
+
+	opts := &mysql.GetOptions{StartDate: *slot.Date, EndDate: *slot.Date}
+	found, err := r.repository.SearchSlotsInRange(opts)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), found, 0, "Expected the deleted slot to be left out")
+	opts.WithDeleted = true
+	found, err = r.repository.SearchSlotsInRange(opts)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), found, 1) {
+		assert.True(r.T(), found[0].DeletedAt.Valid)
+		assert.Equal(r.T(), "operator", models.StringValue(found[0].DeletedBy))
+	}
+
+	restored, err := r.repository.RestoreSlots(key())
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 1, restored)
+	_, err = r.repository.RestoreSlots(key())
+	assert.NotNil(r.T(), err, "Expected only deleted slots to be restored")
+	opts.WithDeleted = false
+	found, err = r.repository.SearchSlotsInRange(opts)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), found, 1, "Expected the restored slot")
+
+	// the deleted slot is superseded by a new slot at its position
+	_, err = r.repository.Delete(key())
+	assert.Nil(r.T(), err)
+	_, err = r.repository.Create(key())
+	assert.Nil(r.T(), err, "Expected a slot to be created at the position of a deleted one")
+
+	_, err = r.repository.Delete(key())
+	assert.Nil(r.T(), err)
+	purged, err := r.repository.PurgeDeletedSlots(time.Now().Add(-time.Hour))
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 0, purged, "Expected the slot to be kept for the retention")
+	purged, err = r.repository.PurgeDeletedSlots(time.Now().Add(time.Minute))
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 1, purged)
+	opts.WithDeleted = true
+	found, err = r.repository.SearchSlotsInRange(opts)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), found, 0, "Expected the purged slot to be removed")
+}
+
+func (r *RepositoryTestSuite) Test_ReleaseSlots() {
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(1).Build()
+	slot := slots[0]
+	_, err := r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slot")
+	_, err = r.repository.Create(&mysql.Transaction{Placement: slot.Placement, Date: slot.Date, Position: slot.Position})
+	assert.Nil(r.T(), err, "Failed to reserve slot")
+
+	released, err := r.repository.ReleaseSlots([]*mysql.Slot{{Placement: slot.Placement, Date: slot.Date, Position: slot.Position}})
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 1, released)
+	found, err := r.repository.SearchSlotsInRange(&mysql.GetOptions{StartDate: *slot.Date, EndDate: *slot.Date, PreloadTransaction: true})
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), found, 1) {
+		assert.Equal(r.T(), models.SlotStatusOpen, *found[0].Status)
+		assert.Nil(r.T(), found[0].Transaction, "Expected the transaction of the tenant to be deleted by its key")
+	}
+}
+
+func (r *RepositoryTestSuite) Test_Tenant() {
+	acme, err := r.repository.ForTenant("acme")
+	assert.Nil(r.T(), err, "Failed to create tenant storage")
+
+	// the same slot of two tenants is stored twice and only seen by its tenant
+	slotF := SlotFactory{}
+	slots := slotF.WithStatus([]string{models.SlotStatusOpen}).WithInstances(1).Build()
+	other := *slots[0]
+	_, err = r.repository.Create(slots)
+	assert.Nil(r.T(), err, "Failed to create slot of the default tenant")
+	_, err = acme.Create([]*mysql.Slot{&other})
+	assert.Nil(r.T(), err, "Failed to create the same slot for another tenant")
+	assert.Equal(r.T(), "acme", other.Tenant)
+
+	opts := &mysql.GetOptions{StartDate: *slots[0].Date, EndDate: *slots[0].Date}
+	found, err := acme.SearchSlotsInRange(opts)
+	assert.Nil(r.T(), err)
+	if assert.Len(r.T(), found, 1) {
+		assert.Equal(r.T(), "acme", found[0].Tenant)
+	}
+	deleted, err := acme.Delete(&mysql.Slot{Placement: other.Placement, Date: other.Date, Position: other.Position})
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 1, deleted, "Expected only the slot of the tenant to be deleted")
+	found, err = r.repository.SearchSlotsInRange(opts)
+	assert.Nil(r.T(), err)
+	assert.Len(r.T(), found, 1, "Expected the slot of the default tenant to be kept")
+	_, err = acme.GetPlacement(models.DefaultPlacement)
+	assert.Nil(r.T(), err, "Expected the tenant to have a default placement")
+}
+
 func TestRepositorySuite(t *testing.T) {
 	suite.Run(t, new(RepositoryTestSuite))
 }
@@ -6,9 +6,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
 	"github.com/kiran-anand14/admgr/internal/pkg/core"
 	"github.com/kiran-anand14/admgr/internal/pkg/http/rest"
 	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/payment"
 	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -71,11 +73,20 @@ func (r *HttRestTestSuite) BeforeTest(suiteName, test string) {
 		Host:            "localhost",
 		Port:            "10002",
 		HealthCheckPath: "health-check",
+		SigningSecret:   "admgr-test-secret",
 	}
-	accountService := accounting.NewAccountingService(logger, accntServiceConf, "admgr")
-	service := core.NewService(s, accountService, logger)
+	accountService, err := accounting.NewAccountingService(logger, accntServiceConf, "admgr")
+	if err != nil {
+		logger.Errorf("%s", err.Error())
+		return
+	}
+	registry := payment.NewRegistry(logger, s, payment.ProviderAccounting)
+	registry.Register(payment.ProviderAccounting, accountService)
+	registry.Register(payment.ProviderWallet, payment.NewWalletProvider(s))
+	registry.Register(payment.ProviderInvoice, payment.NewInvoiceProvider(s))
+	service := core.NewService(core.NewRepository(s), registry, core.Config{}, logger)
 
-	router, _ := rest.Handler(logger, service, os.Stdout)
+	router, _ := rest.Handler(logger, map[string]core.Service{models.DefaultTenant: service}, "", os.Stdout)
 	r.repository = s
 	r.url = admgr.Url()
 
@@ -279,6 +290,50 @@ func (r *HttRestTestSuite) TestDeleteSlot() {
 	}
 }
 
+func (r *HttRestTestSuite) TestImportSlots() {
+	date := time.Now().AddDate(0, 0, 1).Format(time.DateOnly)
+	csv := "date,position,cost\n" +
+		date + ",1-2,10\n" +
+		"someday,3,10\n" +
+		date + ",2,10\n"
+	importSlots := func(query string, body io.Reader) (int, *api.SlotImportResponse) {
+		req, _ := http.NewRequest(http.MethodPost, join(r.url, "adslots/import?"+query), body)
+		req.Header.Set("Content-Type", "text/csv")
+		res, err := r.client.Do(req)
+		require.Nil(r.T(), err)
+		defer res.Body.Close()
+		var report api.SlotImportResponse
+		json.NewDecoder(res.Body).Decode(&report)
+		return res.StatusCode, &report
+	}
+
+	status, report := importSlots("dry_run=true", strings.NewReader(csv))
+	assert.Equal(r.T(), http.StatusOK, status)
+	assert.Equal(r.T(), 3, report.Rows)
+	assert.Equal(r.T(), 2, report.Slots, "Expected the slots of the valid rows")
+	assert.Equal(r.T(), 0, report.Created, "Expected a dry run to create nothing")
+	if assert.Len(r.T(), report.Errors, 2) {
+		assert.Equal(r.T(), 3, report.Errors[0].Row, "Expected the invalid date to be reported")
+		assert.Equal(r.T(), 4, report.Errors[1].Row, "Expected the position of row 2 to be reported")
+	}
+
+	status, report = importSlots("", strings.NewReader(csv))
+	assert.Equal(r.T(), http.StatusBadRequest, status)
+	assert.Equal(r.T(), 0, report.Created, "Expected an atomic import with invalid rows to create nothing")
+
+	status, report = importSlots("atomic=false", strings.NewReader(csv))
+	assert.Equal(r.T(), http.StatusCreated, status)
+	assert.Equal(r.T(), 2, report.Created, "Expected the valid rows to be created")
+	assert.Len(r.T(), report.Errors, 2)
+
+	status, _ = importSlots("atomic=false", strings.NewReader(csv))
+	assert.Equal(r.T(), http.StatusBadRequest, status, "Expected the existing slots to be reported")
+
+	large := strings.NewReader("date,position,cost\n" + strings.Repeat(date+",1,10\n", 1<<20))
+	status, _ = importSlots("dry_run=true", large)
+	assert.Equal(r.T(), http.StatusBadRequest, status, "Expected files over 10MB to be refused")
+}
+
 func assertError(t *testing.T, err error, test TestRequiredParams) {
 	if test.ExpectedError {
 		assert.Error(t, err)
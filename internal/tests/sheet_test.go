@@ -0,0 +1,64 @@
+package tests_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/sheet"
+	"github.com/stretchr/testify/assert"
+)
+
+const inventoryWorkbook = `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Inventory" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const inventoryRels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/inventory.xml"/>
+</Relationships>`
+
+const inventorySharedStrings = `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>date</t></si><si><t>position</t></si><si><r><t>co</t></r><r><t>st</t></r></si>
+</sst>`
+
+const inventorySheet = `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c></row>
+<row r="3"><c r="A3"><v>47849</v></c><c r="C3"><v>12.5</v></c></row>
+<row r="4"><c r="A4" t="inlineStr"><is><t> 2030-12-31 </t></is></c><c r="B4" t="str"><v>1-3</v></c></row>
+</sheetData>
+</worksheet>`
+
+func TestReadSheet(t *testing.T) {
+	rows, err := sheet.Read(strings.NewReader("date, position,cost\n2030-12-31,1-3, 10\n\n2031-01-01,4\n"), sheet.FormatCSV)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"date", "position", "cost"}, {"2030-12-31", "1-3", "10"}, nil, {"2031-01-01", "4"}}, rows)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"xl/workbook.xml":             inventoryWorkbook,
+		"xl/_rels/workbook.xml.rels":  inventoryRels,
+		"xl/sharedStrings.xml":        inventorySharedStrings,
+		"xl/worksheets/inventory.xml": inventorySheet,
+	} {
+		w, err := zw.Create(name)
+		assert.Nil(t, err)
+		_, err = w.Write([]byte(content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, zw.Close())
+
+	rows, err = sheet.Read(&buf, sheet.FormatXLSX)
+	assert.Nil(t, err)
+	// rows keep their numbers, the missing row 2 is empty
+	assert.Equal(t, [][]string{{"date", "position", "cost"}, nil, {"47849", "", "12.5"}, {"2030-12-31", "1-3"}}, rows)
+
+	_, err = sheet.Read(strings.NewReader("date,position,cost"), sheet.FormatXLSX)
+	assert.Error(t, err, "Expected a file which isn't a workbook to fail")
+}
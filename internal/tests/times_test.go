@@ -0,0 +1,58 @@
+package tests_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlotTimes(t *testing.T) {
+	date, err := models.ParseTime("2023-05-04")
+	if assert.Nil(t, err) {
+		assert.True(t, models.IsDate(date))
+		assert.Equal(t, "2023-05-04", models.TimeToString(date))
+		assert.Equal(t, date.AddDate(0, 0, 1).Add(-time.Nanosecond), models.EndOfRange(date))
+	}
+
+	hour, err := models.ParseTime("2023-05-04T08:17:00Z")
+	if assert.Nil(t, err) {
+		assert.False(t, models.IsDate(hour))
+		assert.True(t, hour.Equal(time.Date(2023, 5, 4, 8, 17, 0, 0, time.UTC)))
+		assert.Equal(t, hour, models.EndOfRange(hour), "Expected a time to end the range itself")
+	}
+
+	_, err = models.ParseTime("04/05/2023")
+	assert.Error(t, err)
+
+	var body struct {
+		Date models.JSONDate `json:"date"`
+	}
+	err = json.Unmarshal([]byte(`{"date": "2023-05-04T08:17:00Z"}`), &body)
+	if assert.Nil(t, err) {
+		assert.True(t, time.Time(body.Date).Equal(hour))
+	}
+}
+
+func TestBusinessTimezone(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if !assert.Nil(t, err) {
+		return
+	}
+	models.SetLocation(kolkata)
+	defer models.SetLocation(time.Local)
+
+	date, err := models.ParseTime("2023-05-04")
+	if assert.Nil(t, err) {
+		assert.True(t, date.Equal(time.Date(2023, 5, 3, 18, 30, 0, 0, time.UTC)), "Expected a date to start at midnight of the business zone")
+	}
+	// 20:00 UTC is already the next day in the business zone
+	late := time.Date(2023, 5, 4, 20, 0, 0, 0, time.UTC)
+	assert.Equal(t, "2023-05-05", models.DateToString(late))
+	assert.True(t, models.StartOfDay(late).Equal(time.Date(2023, 5, 4, 18, 30, 0, 0, time.UTC)))
+	assert.True(t, models.IsDate(date.In(time.UTC)), "Expected midnight to be judged in the business zone")
+	assert.Equal(t, "2023-05-04T14:00:00+05:30", models.TimeToString(time.Date(2023, 5, 4, 8, 30, 0, 0, time.UTC)))
+	assert.Equal(t, kolkata, models.Today().Location())
+}
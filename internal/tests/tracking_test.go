@@ -0,0 +1,81 @@
+package tests_test
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kiran-anand14/admgr/internal/pkg/auth"
+	"github.com/kiran-anand14/admgr/internal/pkg/core"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// deliveryRecorder keeps the delivery stats flushed to it
+type deliveryRecorder struct {
+	core.Repository
+	stats []*mysql.DeliveryStat
+}
+
+func (d *deliveryRecorder) OnChange(listener func(tenant string)) {}
+
+func (d *deliveryRecorder) SearchSlotsByStatus(opts *mysql.GetOptions) ([]*mysql.Slot, error) {
+	return nil, nil
+}
+
+func (d *deliveryRecorder) Placements() ([]*mysql.Placement, error) {
+	return nil, nil
+}
+
+func (d *deliveryRecorder) AddDeliveryStats(stats []*mysql.DeliveryStat) error {
+	d.stats = append(d.stats, stats...)
+	return nil
+}
+
+func TestTrackingReplay(t *testing.T) {
+	secret := "admgr-tracking-secret"
+	rep := &deliveryRecorder{}
+	svc := core.NewService(rep, nil, core.Config{TrackingSecret: secret}, logrus.New())
+	signed := func(nonce string) map[string]string {
+		values := url.Values{
+			"tenant":    {models.DefaultTenant},
+			"placement": {"homepage"},
+			"date":      {models.TimeToString(time.Date(2030, 5, 4, 0, 0, 0, 0, time.UTC))},
+			"position":  {"1"},
+			"creative":  {"creative"},
+			"exp":       {strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)},
+			"nonce":     {nonce},
+		}
+		values.Set("sig", auth.SignValues(secret, values))
+		params := map[string]string{"user_agent": "Mozilla/5.0"}
+		for k := range values {
+			params[k] = values.Get(k)
+		}
+		return params
+	}
+
+	replayed := signed("first")
+	for i := 0; i < 5; i++ {
+		_, err := svc.Track(models.TrackImpression, replayed)
+		assert.Nil(t, err, "Expected a replayed url to be accepted without being counted")
+	}
+	_, err := svc.Track(models.TrackImpression, signed("second"))
+	assert.Nil(t, err)
+
+	n, err := svc.FlushTracking()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	if assert.Len(t, rep.stats, 1) {
+		assert.Equal(t, int64(2), rep.stats[0].Impressions, "Expected each served url to be counted once")
+	}
+
+	// the url stays counted after the flush
+	_, err = svc.Track(models.TrackImpression, replayed)
+	assert.Nil(t, err)
+	n, err = svc.FlushTracking()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n, "Expected a url replayed after the flush not to be counted")
+}
@@ -0,0 +1,173 @@
+package tests_test
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/api"
+	"github.com/kiran-anand14/admgr/internal/pkg/core"
+	"github.com/kiran-anand14/admgr/internal/pkg/events"
+	"github.com/kiran-anand14/admgr/internal/pkg/models"
+	"github.com/kiran-anand14/admgr/internal/pkg/payment"
+	"github.com/kiran-anand14/admgr/internal/pkg/storage/mysql"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingPublisher keeps the types of the published events
+type recordingPublisher struct {
+	mu    sync.Mutex
+	types []string
+}
+
+func (p *recordingPublisher) Publish(event *events.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.types = append(p.types, event.Type)
+}
+
+func (p *recordingPublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.types...)
+}
+
+// newService returns the service of the default tenant paid from the wallet
+func (r *RepositoryTestSuite) newService(publisher events.Publisher) core.Service {
+	logger := logrus.New()
+	registry := payment.NewRegistry(logger, r.repository, payment.ProviderWallet)
+	registry.Register(payment.ProviderWallet, payment.NewWalletProvider(r.repository))
+	return core.NewService(core.NewRepository(r.repository), registry, core.Config{Events: publisher}, logger)
+}
+
+// waitlistSlot builds an open slot of a whole day in a few days
+func waitlistSlot() *mysql.Slot {
+	slot := buildCostedSlots(models.SlotStatusOpen, 1)[0]
+	slot.Date = models.PtrDate(models.Today().AddDate(0, 0, 3))
+	return slot
+}
+
+func waitlistEntry(svc core.Service, uid string) *api.WaitlistEntryResponse {
+	entries, err := svc.GetWaitlist(uid)
+	if err != nil || len(entries) != 1 {
+		return nil
+	}
+	return entries[0]
+}
+
+func (r *RepositoryTestSuite) Test_WaitlistOffers() {
+	owner, first, second := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	slot := waitlistSlot()
+	publisher := &recordingPublisher{}
+	svc := r.newService(publisher)
+	request := []*api.ReserveSlotRequestBody{{Placement: slot.Placement, Date: models.JSONDate(*slot.Date), Position: slot.Position}}
+
+	r.bookWithWallet([]*mysql.Slot{slot}, owner, uuid.New().String())
+	joined, err := svc.JoinWaitlist(request, first)
+	assert.Nil(r.T(), err, "Failed to join the waitlist")
+	_, err = svc.JoinWaitlist(request, second)
+	assert.Nil(r.T(), err, "Failed to join the waitlist")
+	_, err = svc.JoinWaitlist(request, first)
+	assert.NotNil(r.T(), err, "Expected an advertiser to wait once for a slot")
+
+	// the cancelled slot is offered to the first advertiser waiting
+	assert.Nil(r.T(), svc.CancelReservation(request, owner), "Failed to cancel the reservation")
+	entry := waitlistEntry(svc, first)
+	if assert.NotNil(r.T(), entry) && assert.Equal(r.T(), models.WaitlistStatusOffered, entry.Status) {
+		hold, err := svc.GetHold(*entry.HoldId)
+		assert.Nil(r.T(), err)
+		assert.Equal(r.T(), first, hold.Uid)
+		assert.Equal(r.T(), models.HoldStatusActive, hold.Status)
+	}
+	assert.Equal(r.T(), models.WaitlistStatusWaiting, waitlistEntry(svc, second).Status)
+	assert.Contains(r.T(), publisher.published(), models.EventWaitlistOffered)
+
+	// leaving releases the offer to the next advertiser
+	err = svc.LeaveWaitlist(joined[0].Id, second)
+	if assert.IsType(r.T(), &models.Error{}, err, "Expected an entry not to be left by another advertiser") {
+		assert.Equal(r.T(), models.ActionForbidden, err.(*models.Error).Type)
+	}
+	assert.Equal(r.T(), models.WaitlistStatusOffered, waitlistEntry(svc, first).Status, "Expected the offer to be kept")
+	assert.Nil(r.T(), svc.LeaveWaitlist(joined[0].Id, first), "Failed to leave the waitlist")
+	assert.Equal(r.T(), models.WaitlistStatusLeft, waitlistEntry(svc, first).Status)
+	entry = waitlistEntry(svc, second)
+	if assert.NotNil(r.T(), entry) {
+		assert.Equal(r.T(), models.WaitlistStatusOffered, entry.Status)
+		assert.NotNil(r.T(), entry.HoldId)
+	}
+	assert.NotNil(r.T(), svc.LeaveWaitlist(joined[0].Id, first), "Expected a left entry not to be left again")
+}
+
+func (r *RepositoryTestSuite) Test_WaitlistOffersExpiredOffers() {
+	first, second := uuid.New().String(), uuid.New().String()
+	slot := waitlistSlot()
+	slot.Status = models.PtrString(models.SlotStatusClosed)
+	_, err := r.repository.Create(slot)
+	assert.Nil(r.T(), err, "Failed to create slot")
+	publisher := &recordingPublisher{}
+	svc := r.newService(publisher)
+	request := []*api.ReserveSlotRequestBody{{Placement: slot.Placement, Date: models.JSONDate(*slot.Date), Position: slot.Position}}
+	_, err = svc.JoinWaitlist(request, first)
+	assert.Nil(r.T(), err, "Failed to join the waitlist")
+	_, err = svc.JoinWaitlist(request, second)
+	assert.Nil(r.T(), err, "Failed to join the waitlist")
+
+	_, err = r.repository.UpdateSlots([]*mysql.Slot{{Placement: slot.Placement, Date: slot.Date, Position: slot.Position, Status: models.PtrString(models.SlotStatusOpen)}})
+	assert.Nil(r.T(), err)
+	_, err = svc.JoinWaitlist(request, uuid.New().String())
+	if assert.IsType(r.T(), &models.Error{}, err, "Expected an open slot to be reserved instead") {
+		assert.Equal(r.T(), models.ActionForbidden, err.(*models.Error).Type)
+	}
+	offers, err := svc.ProcessWaitlist()
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 1, offers)
+	entry := waitlistEntry(svc, first)
+	if !assert.NotNil(r.T(), entry) || !assert.NotNil(r.T(), entry.HoldId) {
+		return
+	}
+
+	// an offer which isn't confirmed in time passes to the next advertiser
+	_, err = r.repository.ReleaseHold(*entry.HoldId, models.HoldStatusExpired)
+	assert.Nil(r.T(), err)
+	offers, err = svc.ProcessWaitlist()
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 1, offers)
+	assert.Equal(r.T(), models.WaitlistStatusExpired, waitlistEntry(svc, first).Status)
+	assert.Equal(r.T(), models.WaitlistStatusOffered, waitlistEntry(svc, second).Status)
+	assert.Contains(r.T(), publisher.published(), models.EventWaitlistOfferExpired)
+
+	// a confirmed offer is accepted and nothing is left to offer
+	entry = waitlistEntry(svc, second)
+	_, err = r.repository.UpdateHoldStatus(*entry.HoldId, models.HoldStatusActive, models.HoldStatusConfirmed)
+	assert.Nil(r.T(), err)
+	offers, err = svc.ProcessWaitlist()
+	assert.Nil(r.T(), err)
+	assert.Equal(r.T(), 0, offers)
+	assert.Equal(r.T(), models.WaitlistStatusAccepted, waitlistEntry(svc, second).Status)
+}
+
+func (r *RepositoryTestSuite) Test_WaitlistOffersRevertedSlots() {
+	uid := uuid.New().String()
+	// a slot left on hold without its transaction by a failed reservation
+	slot := waitlistSlot()
+	slot.Status = models.PtrString(models.SlotStatusHold)
+	_, err := r.repository.Create(slot)
+	assert.Nil(r.T(), err, "Failed to create slot")
+	err = r.repository.CreateWaitlistEntries([]*mysql.WaitlistEntry{{
+		ID:        uuid.New().String(),
+		Placement: slot.Placement,
+		Date:      slot.Date,
+		Position:  slot.Position,
+		Uid:       uid,
+		Status:    models.WaitlistStatusWaiting,
+	}})
+	assert.Nil(r.T(), err, "Failed to join the waitlist")
+
+	// the startup opens the slot again and offers it right away
+	r.newService(&recordingPublisher{})
+	assert.Eventually(r.T(), func() bool {
+		entries, err := r.repository.WaitlistEntries(uid, models.WaitlistStatusOffered)
+		return err == nil && len(entries) == 1
+	}, 5*time.Second, 50*time.Millisecond, "Expected the reverted slot to be offered to the waitlist")
+}
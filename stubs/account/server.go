@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/kiran-anand14/admgr/internal/pkg/accounting"
+	"io"
 	"math/rand"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -37,14 +44,51 @@ type AccountingStatusResponse struct {
 
 type AccountingStatusRequest []string
 
+// verifySignature rejects requests which are not signed with the shared secret
+func verifySignature(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		err = accounting.VerifySignature(
+			secret,
+			c.Request.Method,
+			c.Request.URL.Path,
+			c.GetHeader(accounting.HeaderTimestamp),
+			c.GetHeader(accounting.HeaderSignature),
+			body,
+		)
+		if err != nil {
+			fmt.Println("SignatureVerificationFailed: ", err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
 func main() {
+	secret := flag.String("secret", os.Getenv("ACCOUNTING_SIGNING_SECRET"), "shared secret to verify request signatures, verification is disabled when empty")
+	certFile := flag.String("cert", "", "server certificate, enables TLS")
+	keyFile := flag.String("key", "", "server private key")
+	clientCA := flag.String("client-ca", "", "CA to verify client certificates, enables mutual TLS")
+	flag.Parse()
+
 	router := gin.Default()
 
 	router.GET("/health-check", func(c *gin.Context) {
 		c.Status(http.StatusOK)
 	})
 
-	router.POST("/debit", func(c *gin.Context) {
+	signed := router.Group("/")
+	if *secret != "" {
+		signed.Use(verifySignature(*secret))
+	}
+
+	signed.POST("/debit", func(c *gin.Context) {
 		var requestBody AccountingRequestBody
 
 		// Bind request body to struct
@@ -61,7 +105,7 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"message": "ok"})
 	})
 
-	router.POST("/status", func(c *gin.Context) {
+	signed.POST("/status", func(c *gin.Context) {
 		var requestBody AccountingStatusRequest
 		if err := c.BindJSON(&requestBody); err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to parse request body"})
@@ -98,7 +142,24 @@ func main() {
 		c.JSON(http.StatusOK, res)
 	})
 
-	if err := router.Run(":10002"); err != nil {
+	if *certFile == "" {
+		if err := router.Run(":10002"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	server := &http.Server{Addr: ":10002", Handler: router, TLSConfig: &tls.Config{}}
+	if *clientCA != "" {
+		ca, err := os.ReadFile(*clientCA)
+		if err != nil {
+			panic(err)
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		server.TLSConfig.ClientCAs = pool
+		server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if err := server.ListenAndServeTLS(*certFile, *keyFile); err != nil {
 		panic(err)
 	}
 }